@@ -22,7 +22,7 @@ func gracefulShutdown(apiServer *http.Server, done chan bool) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	if err := apiServer.Shutdown(ctx); err != nil {
+	if err := server.Shutdown(ctx, apiServer); err != nil {
 		log.Printf("Server forced to shutdown with error: %v", err)
 	}
 
@@ -31,12 +31,12 @@ func gracefulShutdown(apiServer *http.Server, done chan bool) {
 }
 
 func main() {
-	server := server.NewServer()
+	apiServer := server.NewServer()
 	done := make(chan bool, 1)
 
-	go gracefulShutdown(server, done)
+	go gracefulShutdown(apiServer, done)
 
-	err := server.ListenAndServe()
+	err := server.ListenAndServe(apiServer)
 	if err != nil && err != http.ErrServerClosed {
 		panic(fmt.Sprintf("http server error: %s", err))
 	}
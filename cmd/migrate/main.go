@@ -0,0 +1,95 @@
+// Command migrate manages the database schema using the migrations embedded
+// in internal/database.
+//
+//	migrate up          apply every pending migration
+//	migrate down N      roll back the N most recent migrations
+//	migrate status      list migrations and whether they are applied
+//	migrate force V     record the schema as being at migration V (0 for none)
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"flash_sale_contest/internal/database"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: migrate up | down N | status | force V")
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db, err := database.NewService(database.OptionsFromEnv())
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		if err := db.RunMigrations(); err != nil {
+			log.Fatal(err)
+		}
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				log.Fatalf("down needs a positive count, got %q", args[1])
+			}
+		}
+		if err := db.RollbackMigrations(n); err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		printStatus(db)
+	case "force":
+		if len(args) < 2 {
+			log.Fatal("force needs a migration version")
+		}
+		if err := db.ForceMigrationVersion(args[1]); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("schema forced to %s", args[1])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func printStatus(db database.Service) {
+	statuses, err := db.MigrationStatuses()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED AT\tDOWN")
+	for _, st := range statuses {
+		state, appliedAt := "pending", ""
+		switch {
+		case st.Dirty:
+			state = "DIRTY"
+		case st.Applied:
+			state = "applied"
+		}
+		if !st.AppliedAt.IsZero() {
+			appliedAt = st.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		down := "no"
+		if st.HasDown {
+			down = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", st.Version, state, appliedAt, down)
+	}
+	w.Flush()
+}
@@ -0,0 +1,20 @@
+// Command openapi writes the OpenAPI document derived from internal/api.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"flash_sale_contest/internal/api"
+)
+
+func main() {
+	out := flag.String("o", "openapi.yaml", "output file")
+	flag.Parse()
+
+	if err := os.WriteFile(*out, []byte(api.YAML(api.Spec())), 0o644); err != nil {
+		log.Fatalf("failed to write %s: %v", *out, err)
+	}
+	log.Printf("wrote %s", *out)
+}
@@ -0,0 +1,220 @@
+// Command seed prepares a contest load test. It makes N synthetic users,
+// signs each an events token for /ws/user with USER_EVENTS_SECRET,
+// registers them with the deployment, can run some of them through the
+// current sale first to warm the deployment up, and writes everything to a
+// fixtures file that load-test.js and the integration tests read (see
+// flashsale.LoadFixtures).
+//
+//	seed -users 5000 -url http://localhost:8080 -warmup 200
+//	seed -users 5000 -out fixtures.json
+//
+// Only registered users can check out. Without -url the users are not
+// registered, and the fixtures are only good for a deployment that has
+// registered them already, with their IDs as handles.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"flash_sale_contest/internal/config"
+	"flash_sale_contest/internal/usertoken"
+	"flash_sale_contest/pkg/flashsale"
+)
+
+func main() {
+	users := flag.Int("users", 1000, "number of synthetic users")
+	prefix := flag.String("prefix", "seed_user_", "prefix of the generated user IDs")
+	out := flag.String("out", "fixtures.json", "fixtures file to write")
+	baseURL := flag.String("url", "", "deployment to read the current sale from and warm up, e.g. http://localhost:8080")
+	tenant := flag.String("tenant", "", "tenant the users belong to; empty for the default tenant")
+	tokenTTL := flag.Duration("token-ttl", 2*time.Hour, "how long the events tokens stay valid")
+	warmup := flag.Int("warmup", 0, "number of users that check out and purchase in the current sale before the fixtures are written; needs -url")
+	concurrency := flag.Int("concurrency", 32, "concurrent registrations and warm-up checkouts")
+	flag.Parse()
+
+	if *users < 1 {
+		log.Fatal("-users must be at least 1")
+	}
+	if *warmup > 0 && *baseURL == "" {
+		log.Fatal("-warmup needs -url")
+	}
+
+	fixtures := &flashsale.Fixtures{
+		GeneratedAt: time.Now().UTC(),
+		BaseURL:     *baseURL,
+		Tenant:      *tenant,
+		Users:       makeUsers(*users, *prefix, *tenant, *tokenTTL),
+	}
+	if fixtures.Users[0].EventsToken == "" {
+		log.Println("USER_EVENTS_SECRET is not set, the users get no events tokens")
+	}
+
+	if *baseURL == "" {
+		log.Println("No -url, the users are not registered")
+	} else {
+		ctx := context.Background()
+		client := flashsale.New(*baseURL)
+		client.Tenant = *tenant
+
+		registerUsers(ctx, client, fixtures.Users, *concurrency)
+
+		if *warmup > 0 {
+			fixtures.Warmup = runWarmup(ctx, client, fixtures.Users[:min(*warmup, len(fixtures.Users))], *concurrency)
+			log.Printf("Warm-up of sale %s: %d checkouts, %d purchases, %d pending, %d refused, %d failed in %.1fs",
+				fixtures.Warmup.SaleID, fixtures.Warmup.Checkouts, fixtures.Warmup.Purchases, fixtures.Warmup.Pending,
+				fixtures.Warmup.Refused, fixtures.Warmup.Failed, fixtures.Warmup.Seconds)
+		}
+
+		info, err := client.SaleInfo(ctx)
+		if err != nil {
+			log.Printf("Warning: could not read the current sale, the fixtures have none: %v", err)
+		} else {
+			fixtures.Sale = info
+		}
+	}
+
+	if err := writeFixtures(*out, fixtures); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Wrote %d users to %s", len(fixtures.Users), *out)
+}
+
+// makeUsers names n users with zero-padded numbers, so they sort in the
+// order they were made, and signs their events tokens.
+func makeUsers(n int, prefix, tenant string, ttl time.Duration) []flashsale.FixtureUser {
+	secret := config.Get().UserEventsSecret
+	expires := time.Now().Add(ttl)
+	width := len(fmt.Sprint(n))
+
+	users := make([]flashsale.FixtureUser, n)
+	for i := range users {
+		userID := fmt.Sprintf("%s%0*d", prefix, width, i+1)
+		users[i] = flashsale.FixtureUser{UserID: userID, EventsToken: usertoken.Sign(secret, tenant, userID, expires)}
+	}
+	return users
+}
+
+// registerUsers registers each user with its ID as handle, concurrency
+// users at a time. Users registered by an earlier run are left as they are.
+func registerUsers(ctx context.Context, client *flashsale.Client, users []flashsale.FixtureUser, concurrency int) {
+	var registered, existing, failed atomic.Int64
+	next := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < max(concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for userID := range next {
+				_, err := client.RegisterUser(ctx, userID, userID)
+				var apiErr *flashsale.Error
+				switch {
+				case err == nil:
+					registered.Add(1)
+				case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict:
+					existing.Add(1)
+				default:
+					log.Printf("Registering %s failed: %v", userID, err)
+					failed.Add(1)
+				}
+			}
+		}()
+	}
+	for _, u := range users {
+		next <- u.UserID
+	}
+	close(next)
+	wg.Wait()
+
+	log.Printf("Registered %d users, %d already were, %d failed", registered.Load(), existing.Load(), failed.Load())
+}
+
+// runWarmup has each user check out whatever item is available and buy it,
+// concurrency users at a time, so connection pools, caches and the sale's
+// Redis state are warm before the load test starts.
+func runWarmup(ctx context.Context, client *flashsale.Client, users []flashsale.FixtureUser, concurrency int) *flashsale.Warmup {
+	warmup := &flashsale.Warmup{}
+	if current, err := client.CurrentSale(ctx); err == nil {
+		warmup.SaleID = current.SaleID
+	}
+
+	var mu sync.Mutex
+	count := func(n *int) {
+		mu.Lock()
+		*n++
+		mu.Unlock()
+	}
+
+	start := time.Now()
+	next := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < max(concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for userID := range next {
+				code, _, err := client.CheckoutAny(ctx, userID)
+				if err != nil {
+					if refused(err) {
+						count(&warmup.Refused)
+					} else {
+						log.Printf("Warm-up checkout of %s failed: %v", userID, err)
+						count(&warmup.Failed)
+					}
+					continue
+				}
+				count(&warmup.Checkouts)
+
+				_, err = client.Purchase(ctx, code)
+				var pending *flashsale.PendingError
+				switch {
+				case err == nil:
+					count(&warmup.Purchases)
+				case errors.As(err, &pending):
+					count(&warmup.Pending)
+				default:
+					log.Printf("Warm-up purchase of %s failed: %v", userID, err)
+					count(&warmup.Failed)
+				}
+			}
+		}()
+	}
+	for _, u := range users {
+		next <- u.UserID
+	}
+	close(next)
+	wg.Wait()
+
+	warmup.Seconds = time.Since(start).Seconds()
+	return warmup
+}
+
+// refused reports whether the sale turned a checkout away, as it does
+// once sold out or while queueing or running a lottery, rather than the
+// checkout failing.
+func refused(err error) bool {
+	var apiErr *flashsale.Error
+	var queued *flashsale.QueuedError
+	var entered *flashsale.LotteryEntryError
+	if errors.As(err, &queued) || errors.As(err, &entered) {
+		return true
+	}
+	return errors.As(err, &apiErr) && apiErr.StatusCode < 500
+}
+
+func writeFixtures(path string, fixtures *flashsale.Fixtures) error {
+	data, err := json.MarshalIndent(fixtures, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
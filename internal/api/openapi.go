@@ -0,0 +1,425 @@
+package api
+
+//go:generate go run ../../cmd/openapi -o ../../openapi.yaml
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ItemImageRequest struct {
+	ItemID string `path:"item_id" required:"true"`
+}
+
+type MetricsRequest struct {
+	SaleID string `query:"sale_id"`
+}
+
+// Operation describes one route of the API for the OpenAPI document.
+type Operation struct {
+	Method      string
+	Path        string
+	Summary     string
+	Request     interface{}
+	Response    interface{}
+	ContentType string
+	Errors      map[int]string
+}
+
+// Operations lists every public route. Keep it in sync with RegisterRoutes.
+var Operations = []Operation{
+	{Method: http.MethodGet, Path: "/", Summary: "Service banner", Response: MessageResponse{}},
+	{Method: http.MethodGet, Path: "/health", Summary: "Dependency health and metrics", Response: Stats{}},
+	{Method: http.MethodGet, Path: "/healthz", Summary: "Liveness probe", Response: ProbeResponse{}},
+	{Method: http.MethodGet, Path: "/readyz", Summary: "Readiness probe: Redis, Postgres, an active sale and a finished warm-up", Response: ProbeResponse{},
+		Errors: map[int]string{http.StatusServiceUnavailable: "A dependency is unreachable or no sale is loaded"}},
+	{Method: http.MethodGet, Path: "/metrics", Summary: "Lifetime or per-sale metrics", Request: MetricsRequest{}, Response: Stats{},
+		Errors: map[int]string{http.StatusNotFound: "No metrics for sale"}},
+	{Method: http.MethodGet, Path: "/sale/current", Summary: "Currently active sale", Response: CurrentSaleResponse{},
+		Errors: map[int]string{http.StatusNotFound: "No active sale", http.StatusNotModified: "Unchanged since the If-None-Match ETag"}},
+	{Method: http.MethodGet, Path: "/sale/status", Summary: "Remaining inventory of the active sale", Response: SaleStatusResponse{},
+		Errors: map[int]string{http.StatusNotFound: "No active sale"}},
+	{Method: http.MethodGet, Path: "/sale/info", Summary: "Showcase items of the active sale", Response: SaleInfoResponse{},
+		Errors: map[int]string{http.StatusServiceUnavailable: "No active sale", http.StatusNotModified: "Unchanged since the If-None-Match ETag"}},
+	{Method: http.MethodGet, Path: "/sale/items", Summary: "Page through the active sale's items, optionally by category", Request: SaleItemsRequest{}, Response: SaleItemsResponse{},
+		Errors: map[int]string{http.StatusServiceUnavailable: "No active sale", http.StatusNotModified: "Unchanged since the If-None-Match ETag"}},
+	{Method: http.MethodGet, Path: "/sale/analytics", Summary: "Items sold and revenue per currency of a sale, the active one by default", Request: SaleAnalyticsRequest{}, Response: SaleAnalyticsResponse{},
+		Errors: map[int]string{http.StatusUnauthorized: "Missing or invalid admin credentials", http.StatusNotFound: "Sale not found"}},
+	{Method: http.MethodGet, Path: "/sales", Summary: "Past sales, newest first, with items sold, duration and sell-out time", Request: SalesRequest{}, Response: SalesResponse{},
+		Errors: map[int]string{http.StatusBadRequest: "status must be ended or active"}},
+	{Method: http.MethodGet, Path: "/sale/{sale_id}/sold", Summary: "Items sold in a sale, in item order, for sold badges on the catalog", Request: SoldItemsRequest{}, Response: SoldItemsResponse{},
+		Errors: map[int]string{http.StatusNotFound: "Sale not found"}},
+	{Method: http.MethodGet, Path: "/items/{item_id}/image", Summary: "Item placeholder image", Request: ItemImageRequest{},
+		ContentType: "image/svg+xml", Errors: map[int]string{http.StatusBadGateway: "Image unavailable"}},
+	{Method: http.MethodPost, Path: "/users", Summary: "Register a user; only registered users can check out", Request: RegisterUserRequest{}, Response: RegisterUserResponse{},
+		Errors: map[int]string{
+			http.StatusBadRequest:      "Malformed user_id or handle",
+			http.StatusConflict:        "User already registered, or handle taken",
+			http.StatusTooManyRequests: "Rate limit exceeded",
+		}},
+	{Method: http.MethodPost, Path: "/checkout", Summary: "Reserve an item, or any available item without id, and receive a checkout code", Request: CheckoutRequest{}, Response: CheckoutResponse{},
+		Errors: map[int]string{
+			http.StatusBadRequest:         "user_id is required, id is required with category or for sales whose items are not numbered, or the promo code is invalid or expired",
+			http.StatusUnauthorized:       "Invalid API key",
+			http.StatusForbidden:          "User is not registered or is banned, purchase limit exceeded, overall or for the item's rarity, or the API key is not scoped to checkouts in the sale",
+			http.StatusConflict:           "Item or category sold out, item held by another live checkout code, or the promo code is fully redeemed",
+			http.StatusGone:               "Sale is closing for rollover; retry after the Retry-After delay",
+			http.StatusAccepted:           "Queued during the sale's opening window, or entered into its lottery; the body is a QueueStatusResponse to poll /queue/status with, or a LotteryStatusResponse to poll /lottery/status with",
+			http.StatusTooEarly:           "Sale is in preview; Retry-After holds the seconds until it starts",
+			http.StatusTooManyRequests:    "Rate limit exceeded, or too many unredeemed checkout codes",
+			http.StatusServiceUnavailable: "No active sale, the reservation timed out, the lottery is being drawn, or the checkout was shed to protect the latency objective; retry after the Retry-After delay where one is sent",
+		}},
+	{Method: http.MethodPost, Path: "/purchase", Summary: "Redeem a checkout code; a retry with a code already redeemed returns its purchase again", Request: PurchaseRequest{}, Response: PurchaseResponse{},
+		Errors: map[int]string{
+			http.StatusAccepted:           "Two-phase mode: purchase is pending payment confirmation",
+			http.StatusBadRequest:         "Invalid or expired code, or invalid purchase details",
+			http.StatusUnauthorized:       "Invalid API key",
+			http.StatusForbidden:          "API key not scoped to checkouts in the sale, the buyer or the gift's recipient is banned, or the recipient is at their purchase limit",
+			http.StatusNotFound:           "The gift's recipient is not a registered user",
+			http.StatusConflict:           "Gifts cannot be bought with a database fallback code, nor can fallback codes be redeemed with asynchronous purchases",
+			http.StatusGone:               "The code's sale has ended",
+			http.StatusServiceUnavailable: "Purchase timed out; the code may already be spent, retry to get the purchase back",
+		}},
+	{Method: http.MethodPost, Path: "/checkout/{code}/extend", Summary: "Extend a checkout code by another code TTL, once, in its last minute", Request: ExtendCheckoutRequest{}, Response: ExtendCheckoutResponse{},
+		Errors: map[int]string{
+			http.StatusBadRequest:         "Invalid or expired code",
+			http.StatusNotFound:           "No active sale",
+			http.StatusConflict:           "Code already extended or not in its last minute, sale closing, or a database fallback code",
+			http.StatusServiceUnavailable: "Extension timed out",
+		}},
+	{Method: http.MethodGet, Path: "/queue/status", Summary: "Position of a queued checkout", Request: QueueStatusRequest{}, Response: QueueStatusResponse{},
+		Errors: map[int]string{http.StatusBadRequest: "token is required", http.StatusNotFound: "Queue token not found"}},
+	{Method: http.MethodGet, Path: "/lottery/status", Summary: "Whether a lottery entrant won the active sale's draw, with the checkout code they drew", Request: LotteryStatusRequest{}, Response: LotteryStatusResponse{},
+		Errors: map[int]string{http.StatusBadRequest: "user_id is required", http.StatusNotFound: "Lottery disabled, no active sale, or the user did not enter"}},
+	{Method: http.MethodGet, Path: "/user/{user_id}/reservations", Summary: "A user's unredeemed checkout codes in the active sale", Request: UserReservationsRequest{}, Response: UserReservationsResponse{},
+		Errors: map[int]string{http.StatusNotFound: "No active sale"}},
+	{Method: http.MethodGet, Path: "/user/{user_id}/purchases", Summary: "Items a user bought or was given in past and running sales, newest first", Request: UserPurchasesRequest{}, Response: UserPurchasesResponse{}},
+	{Method: http.MethodGet, Path: "/receipt/{purchase_id}/verify", Summary: "Check that a purchase receipt was signed by this service", Request: VerifyReceiptRequest{}, Response: VerifyReceiptResponse{},
+		Errors: map[int]string{http.StatusBadRequest: "Missing or malformed receipt fields", http.StatusNotFound: "Receipts are disabled"}},
+	{Method: http.MethodGet, Path: "/purchase/{id}", Summary: "Shipping and contact details submitted with a purchase", Request: PurchaseDetailsRequest{}, Response: PurchaseDetailsResponse{},
+		Errors: map[int]string{http.StatusNotFound: "No details were submitted with the purchase, or they are not written yet"}},
+	{Method: http.MethodGet, Path: "/purchase/{id}/status", Summary: "Status of a two-phase purchase", Request: PurchaseStatusRequest{}, Response: PurchaseStatusResponse{},
+		Errors: map[int]string{http.StatusNotFound: "Purchase not found"}},
+	{Method: http.MethodPost, Path: "/item/{item_id}/view", Summary: "Count a look at an item's details, for /sale/trending", Request: ItemViewRequest{}, Response: ItemViewResponse{},
+		Errors: map[int]string{http.StatusNotFound: "No active sale or item not found"}},
+	{Method: http.MethodGet, Path: "/sale/trending", Summary: "The active sale's most viewed items that are not sold yet", Request: TrendingRequest{}, Response: TrendingResponse{},
+		Errors: map[int]string{http.StatusNotFound: "No active sale", http.StatusNotModified: "Unchanged since the If-None-Match ETag"}},
+	{Method: http.MethodGet, Path: "/item/{item_id}/availability", Summary: "Whether an item of the active sale is available, held by a checkout code or sold", Request: ItemAvailabilityRequest{}, Response: ItemAvailabilityResponse{},
+		Errors: map[int]string{http.StatusNotFound: "No active sale, or the item is not in it"}},
+	{Method: http.MethodGet, Path: "/ws/user", Summary: "Server-sent stream of a buyer's purchase confirmations, waitlist offers, code expiry warnings and sale extensions", Request: UserEventsRequest{},
+		ContentType: "text/event-stream", Errors: map[int]string{http.StatusUnauthorized: "Invalid or expired token", http.StatusNotFound: "User events are disabled"}},
+	{Method: http.MethodPost, Path: "/admin/metrics/reset", Summary: "Reset all metrics", Response: ResetResponse{}},
+	{Method: http.MethodGet, Path: "/admin/dlq", Summary: "Inspect database writes parked in the dead letter queue", Request: DeadLettersRequest{}, Response: DeadLettersResponse{}},
+	{Method: http.MethodGet, Path: "/admin/redis/audit", Summary: "Latest Redis key audit: keys, TTL repairs, purges and estimated memory per key family", Response: RedisAuditResponse{},
+		Errors: map[int]string{http.StatusNotFound: "No audit has run yet"}},
+	{Method: http.MethodPost, Path: "/admin/dry-run", Summary: "Play a sale with synthetic users in the sandbox Redis database and score its readiness", Request: DryRunRequest{}, Response: DryRunResponse{},
+		Errors: map[int]string{http.StatusBadRequest: "items, users or concurrency out of range", http.StatusConflict: "A dry run is already running", http.StatusServiceUnavailable: "Dry-run sandbox unavailable"}},
+	{Method: http.MethodPost, Path: "/admin/sales/{sale_id}/items", Summary: "Stage a CSV, JSON or NDJSON catalog, optionally gzipped, for the next sale (sale_id must be \"next\")", Request: CatalogUploadRequest{}, Response: CatalogUploadResponse{},
+		Errors: map[int]string{
+			http.StatusBadRequest:            "Catalog failed to decompress, parse or validate",
+			http.StatusConflict:              "The sale has already started",
+			http.StatusRequestEntityTooLarge: "Body larger than 16 MiB",
+			http.StatusUnsupportedMediaType:  "Content-Encoding other than gzip",
+		}},
+	{Method: http.MethodGet, Path: "/admin/sales/{sale_id}/items", Summary: "Stream a sale's items as a CSV (default) or NDJSON catalog that uploads back as it is", Request: CatalogExportRequest{}, Response: CatalogEntry{},
+		ContentType: "text/csv", Errors: map[int]string{http.StatusBadRequest: "Unknown format", http.StatusNotFound: "Sale not found"}},
+	{Method: http.MethodGet, Path: "/admin/sales/{sale_id}/export", Summary: "Stream a sale's purchases as CSV (default) or NDJSON", Request: SaleExportRequest{}, Response: ExportedPurchase{},
+		ContentType: "text/csv", Errors: map[int]string{http.StatusBadRequest: "Unknown format", http.StatusNotFound: "Sale not found"}},
+	{Method: http.MethodPost, Path: "/admin/promos", Summary: "Create a promo code buyers pass to /checkout as promo_code", Request: CreatePromoRequest{}, Response: Promo{},
+		Errors: map[int]string{http.StatusBadRequest: "Invalid code, percent_off, max_redemptions or expires_at", http.StatusConflict: "Promo code exists"}},
+	{Method: http.MethodGet, Path: "/admin/promos", Summary: "List promo codes with their redemption counts", Response: PromosResponse{}},
+	{Method: http.MethodGet, Path: "/admin/sales/{sale_id}/top-buyers", Summary: "Users with the most purchases in a sale", Request: TopBuyersRequest{}, Response: TopBuyersResponse{},
+		Errors: map[int]string{http.StatusNotFound: "Sale not found"}},
+	{Method: http.MethodGet, Path: "/admin/sales/{sale_id}/heatmap", Summary: "Checkouts per bucket of item numbers, flagging buckets with showcased items", Request: SaleHeatmapRequest{}, Response: SaleHeatmapResponse{},
+		Errors: map[int]string{http.StatusNotFound: "Sale not found"}},
+	{Method: http.MethodGet, Path: "/admin/sales/{sale_id}/stats", Summary: "Checkout and purchase stats recorded when a sale was finalized", Request: SaleStatsRequest{}, Response: SaleStatsResponse{},
+		Errors: map[int]string{http.StatusNotFound: "No stats for sale; it does not exist or is not finalized yet", http.StatusForbidden: "API key not scoped to the sale's stats"}},
+	{Method: http.MethodGet, Path: "/admin/sales/{sale_id}/ledger", Summary: "A sale's stock summed from its inventory ledger, against the Redis counter while it runs", Request: SaleLedgerRequest{}, Response: SaleLedgerResponse{},
+		Errors: map[int]string{http.StatusNotFound: "Sale not found"}},
+	{Method: http.MethodPost, Path: "/admin/sales/{sale_id}/users/{user_id}/revoke", Summary: "Take back the purchases a user made or was gifted in a sale, and put the items back on sale while it runs", Request: RevokePurchasesRequest{}, Response: RevokePurchasesResponse{},
+		Errors: map[int]string{http.StatusNotFound: "Sale not found"}},
+	{Method: http.MethodPut, Path: "/admin/sales/{sale_id}/showcase", Summary: "Set the staff picks of a running sale and pick its showcase again", Request: StaffPicksRequest{}, Response: SaleInfoResponse{},
+		Errors: map[int]string{http.StatusBadRequest: "Malformed body or unknown item", http.StatusConflict: "Sale is not running"}},
+	{Method: http.MethodPost, Path: "/admin/sales/{sale_id}/webhooks", Summary: "Register a URL every completed purchase of a sale is POSTed to, signed with the returned secret", Request: CreateWebhookRequest{}, Response: Webhook{},
+		Errors: map[int]string{http.StatusBadRequest: "url must be an absolute http or https URL", http.StatusNotFound: "Sale not found"}},
+	{Method: http.MethodGet, Path: "/admin/sales/{sale_id}/webhooks", Summary: "A sale's webhooks, and how many deliveries are still to be made", Request: WebhooksRequest{}, Response: WebhooksResponse{}},
+	{Method: http.MethodDelete, Path: "/admin/sales/{sale_id}/webhooks/{webhook_id}", Summary: "Stop sending a sale's purchases to a webhook; scheduled deliveries are still made", Request: DeleteWebhookRequest{}, Response: WebhooksResponse{},
+		Errors: map[int]string{http.StatusNotFound: "Webhook not found"}},
+	{Method: http.MethodPost, Path: "/admin/sales/{sale_id}/snapshot", Summary: "Copy a sale's Redis state (inventory, purchase counts, sold bitmap, outstanding codes) into Postgres", Request: SaleSnapshotRequest{}, Response: SaleSnapshotResponse{},
+		Errors: map[int]string{http.StatusNotFound: "Sale not found", http.StatusConflict: "Sale has no state in Redis"}},
+	{Method: http.MethodPost, Path: "/admin/sales/{sale_id}/restore", Summary: "Write a sale snapshot back into Redis, the latest unless snapshot_id is given", Request: RestoreSaleRequest{}, Response: RestoreSaleResponse{},
+		Errors: map[int]string{http.StatusNotFound: "Sale or snapshot not found", http.StatusConflict: "Sale is not running"}},
+	{Method: http.MethodPost, Path: "/admin/sales/{sale_id}/code-ttl", Summary: "Change how long a running sale's new checkout codes hold their item", Request: SaleCodeTTLRequest{}, Response: SaleCodeTTLResponse{},
+		Errors: map[int]string{http.StatusBadRequest: "ttl must be between 10s and 1h", http.StatusConflict: "Sale is not running"}},
+	{Method: http.MethodPost, Path: "/admin/sales/{sale_id}/oversell-buffer", Summary: "Change how many units a running sale may sell beyond its stock", Request: SaleOversellBufferRequest{}, Response: SaleOversellBufferResponse{},
+		Errors: map[int]string{http.StatusBadRequest: "buffer must be a non-negative integer", http.StatusConflict: "Sale is not running"}},
+	{Method: http.MethodGet, Path: "/admin/attempt-log", Summary: "Where this replica stores checkout attempts, and the stream backlog", Response: AttemptLogResponse{}},
+	{Method: http.MethodPost, Path: "/admin/attempt-log", Summary: "Switch where this replica stores checkout attempts: postgres, stream or none", Request: AttemptLogRequest{}, Response: AttemptLogResponse{},
+		Errors: map[int]string{http.StatusBadRequest: "Unknown mode"}},
+	{Method: http.MethodGet, Path: "/admin/flags", Summary: "The feature flags, and whether each is on", Response: FlagsResponse{}},
+	{Method: http.MethodPost, Path: "/admin/flags/{name}", Summary: "Switch a feature flag on or off for every replica", Request: SetFlagRequest{}, Response: FlagsResponse{},
+		Errors: map[int]string{http.StatusBadRequest: "enabled must be true or false", http.StatusNotFound: "Unknown flag"}},
+	{Method: http.MethodDelete, Path: "/admin/flags/{name}", Summary: "Put a feature flag back to its default", Request: ClearFlagRequest{}, Response: FlagsResponse{},
+		Errors: map[int]string{http.StatusNotFound: "Unknown flag"}},
+	{Method: http.MethodPost, Path: "/admin/api-keys", Summary: "Issue an API key scoped to some sales and operations; the key is only returned once", Request: CreateAPIKeyRequest{}, Response: APIKey{},
+		Errors: map[int]string{http.StatusBadRequest: "Malformed body, unknown scope or no sales", http.StatusNotFound: "Sale not found"}},
+	{Method: http.MethodGet, Path: "/admin/api-keys", Summary: "List the API keys, without their secrets", Response: APIKeysResponse{}},
+	{Method: http.MethodDelete, Path: "/admin/api-keys/{key_id}", Summary: "Revoke an API key; replicas stop accepting it within 10 seconds", Request: DeleteAPIKeyRequest{}, Response: APIKeysResponse{},
+		Errors: map[int]string{http.StatusNotFound: "API key not found"}},
+	{Method: http.MethodGet, Path: "/admin/bans", Summary: "The users banned from checking out and purchasing", Response: BansResponse{}},
+	{Method: http.MethodPost, Path: "/admin/bans/{user_id}", Summary: "Ban a user from checking out and purchasing, including codes they already hold", Request: BanUserRequest{}, Response: BansResponse{}},
+	{Method: http.MethodDelete, Path: "/admin/bans/{user_id}", Summary: "Lift a user's ban", Request: UnbanUserRequest{}, Response: BansResponse{},
+		Errors: map[int]string{http.StatusNotFound: "User is not banned"}},
+	{Method: http.MethodPost, Path: "/admin/config/reload", Summary: "Reread .env and the environment and swap in the validated config on this replica", Response: ConfigReloadResponse{},
+		Errors: map[int]string{http.StatusBadRequest: "Invalid configuration"}},
+	{Method: http.MethodPost, Path: "/admin/dlq/replay", Summary: "Retry parked database writes, oldest first", Request: ReplayDeadLettersRequest{}, Response: ReplayDeadLettersResponse{}},
+}
+
+// Spec builds the OpenAPI 3 document for Operations.
+func Spec() map[string]interface{} {
+	paths := map[string]interface{}{}
+	for _, op := range Operations {
+		item, ok := paths[op.Path].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = op.spec()
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Flash Sale Contest API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+	}
+}
+
+func (op Operation) spec() map[string]interface{} {
+	contentType := op.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	var schema interface{} = map[string]interface{}{"type": "string", "format": "binary"}
+	if op.Response != nil {
+		schema = schemaFor(reflect.TypeOf(op.Response))
+	}
+	if op.Response != nil && contentType == "application/json" {
+		envelope := schemaFor(reflect.TypeOf(Envelope{}))
+		envelope["properties"].(map[string]interface{})["data"] = schema
+		schema = envelope
+	}
+
+	responses := map[string]interface{}{
+		"200": map[string]interface{}{
+			"description": "OK",
+			"content": map[string]interface{}{
+				contentType: map[string]interface{}{"schema": schema},
+			},
+		},
+	}
+	errorContent := map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schemaFor(reflect.TypeOf(ErrorResponse{}))},
+	}
+	if strings.HasPrefix(op.Path, "/admin/") {
+		responses["401"] = map[string]interface{}{"description": "Missing or invalid admin credentials", "content": errorContent}
+	}
+	for status, description := range op.Errors {
+		responses[strconv.Itoa(status)] = map[string]interface{}{"description": description, "content": errorContent}
+	}
+
+	spec := map[string]interface{}{
+		"summary":   op.Summary,
+		"responses": responses,
+	}
+	if op.Request != nil {
+		spec["parameters"] = parametersFor(reflect.TypeOf(op.Request))
+		if body := requestBodyFor(reflect.TypeOf(op.Request)); body != nil {
+			spec["requestBody"] = body
+		}
+	}
+	return spec
+}
+
+// requestBodyFor describes the field of a request tagged body:"json", which
+// is read from the request body rather than its URL.
+func requestBodyFor(t reflect.Type) map[string]interface{} {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Tag.Get("body") != "json" {
+			continue
+		}
+		return map[string]interface{}{
+			"required": field.Tag.Get("required") == "true",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schemaFor(field.Type)},
+			},
+		}
+	}
+	return nil
+}
+
+func parametersFor(t reflect.Type) []interface{} {
+	var params []interface{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		for _, in := range []string{"query", "path", "header"} {
+			name := field.Tag.Get(in)
+			if name == "" {
+				continue
+			}
+			params = append(params, map[string]interface{}{
+				"name":     name,
+				"in":       in,
+				"required": in == "path" || field.Tag.Get("required") == "true",
+				"schema":   schemaFor(field.Type),
+			})
+		}
+	}
+	return params
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+func schemaFor(t reflect.Type) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	if t == rawMessageType {
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaFor(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": true}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			properties[name] = schemaFor(field.Type)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties}
+	}
+	return map[string]interface{}{}
+}
+
+// YAML renders v (built from maps, slices and scalars, as returned by Spec)
+// as YAML with sorted keys, so the generated file is stable across runs.
+func YAML(v interface{}) string {
+	var b strings.Builder
+	writeYAML(&b, v, 0)
+	return b.String()
+}
+
+func writeYAML(b *strings.Builder, v interface{}, indent int) {
+	pad := strings.Repeat("  ", indent)
+	switch val := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := val[k]
+			if isScalar(child) {
+				fmt.Fprintf(b, "%s%s: %s\n", pad, quoteYAML(k), scalarYAML(child))
+				continue
+			}
+			fmt.Fprintf(b, "%s%s:", pad, quoteYAML(k))
+			if isEmpty(child) {
+				b.WriteString(" " + emptyYAML(child) + "\n")
+				continue
+			}
+			b.WriteString("\n")
+			writeYAML(b, child, indent+1)
+		}
+	case []interface{}:
+		for _, item := range val {
+			if isScalar(item) {
+				fmt.Fprintf(b, "%s- %s\n", pad, scalarYAML(item))
+				continue
+			}
+			// Render the nested block one level deeper, then turn its first
+			// indentation into the list marker.
+			var nested strings.Builder
+			writeYAML(&nested, item, indent+1)
+			out := nested.String()
+			b.WriteString(pad + "- " + strings.TrimPrefix(out, pad+"  "))
+		}
+	}
+}
+
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+	return true
+}
+
+func isEmpty(v interface{}) bool {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return len(val) == 0
+	case []interface{}:
+		return len(val) == 0
+	}
+	return false
+}
+
+func emptyYAML(v interface{}) string {
+	if _, ok := v.([]interface{}); ok {
+		return "[]"
+	}
+	return "{}"
+}
+
+func scalarYAML(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return quoteYAML(val)
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+func quoteYAML(s string) string {
+	if s == "" || strings.ContainsAny(s, ":{}[],&*#?|-<>=!%@`'\"/") || s == "true" || s == "false" {
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+	return s
+}
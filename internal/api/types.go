@@ -0,0 +1,903 @@
+// Package api holds the request and response types of the HTTP API. The
+// handlers encode these types directly and the OpenAPI document is derived
+// from them, so the two cannot drift apart.
+package api
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// ErrorResponse is the body of every error. RequestID is the X-Request-ID
+// of the request, to quote when reporting a problem.
+type ErrorResponse struct {
+	Error     string    `json:"error"`
+	Status    int       `json:"status"`
+	RequestID string    `json:"request_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Envelope is the body of every successful JSON response. Data is what
+// the endpoint answers; RequestID and Timestamp are set as on an
+// ErrorResponse.
+type Envelope struct {
+	Data      interface{} `json:"data"`
+	RequestID string      `json:"request_id,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+type Item struct {
+	ItemID   string `json:"item_id"`
+	Name     string `json:"name"`
+	ImageURL string `json:"image_url"`
+	Category string `json:"category"`
+	// PriceMinor is the price in the currency's minor unit (cents for
+	// USD); Price is the same amount as a decimal string.
+	PriceMinor int64  `json:"price_minor"`
+	Price      string `json:"price,omitempty"`
+	Currency   string `json:"currency,omitempty"`
+	// Rarity is common, rare or legendary.
+	Rarity string `json:"rarity,omitempty"`
+	// Quantity is how many units of the item the sale has.
+	Quantity int `json:"quantity"`
+}
+
+type CurrentSaleResponse struct {
+	SaleID    string    `json:"sale_id"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Closing   bool      `json:"closing"`
+	// Phase is "preview", "active" or "ended".
+	Phase string `json:"phase"`
+	// Extensions is how often the anti-sniping rule moved EndTime.
+	Extensions int `json:"extensions,omitempty"`
+	// RemainingItems is omitted while the inventory cannot be read.
+	RemainingItems *int `json:"remaining_items,omitempty"`
+}
+
+type SaleStatusResponse struct {
+	SaleID               string         `json:"sale_id"`
+	RemainingItems       int            `json:"remaining_items"`
+	ItemsSold            int            `json:"items_sold"`
+	RemainingByCategory  map[string]int `json:"remaining_by_category"`
+	SaleEndsAt           time.Time      `json:"sale_ends_at"`
+	TimeRemainingSeconds int            `json:"time_remaining_seconds"`
+	// Stale is set when Redis could not be read and the last known
+	// inventory is shown.
+	Stale bool `json:"stale,omitempty"`
+	// Degraded is set once Redis failed over to its standby, whose
+	// inventory was rebuilt from the inventory ledger.
+	Degraded bool `json:"degraded,omitempty"`
+}
+
+// SaleInfoResponse shows the items picked by the showcase strategy.
+// FirstItems and LastItems are filled by the edges strategy, Showcase by
+// the others.
+type SaleInfoResponse struct {
+	SaleID           string   `json:"sale_id"`
+	TotalItems       int      `json:"total_items"`
+	ShowcaseStrategy string   `json:"showcase_strategy,omitempty"`
+	FirstItems       []string `json:"first_items"`
+	LastItems        []string `json:"last_items"`
+	Showcase         []string `json:"showcase,omitempty"`
+	ShowcaseItems    []Item   `json:"showcase_items"`
+}
+
+type SaleItemsRequest struct {
+	Category string `query:"category"`
+	Page     int    `query:"page"`
+}
+
+type SaleItemsResponse struct {
+	SaleID    string `json:"sale_id"`
+	Category  string `json:"category,omitempty"`
+	Page      int    `json:"page"`
+	PageSize  int    `json:"page_size"`
+	Remaining *int   `json:"remaining,omitempty"`
+	Items     []Item `json:"items"`
+}
+
+type SoldItemsRequest struct {
+	SaleID string `path:"sale_id" required:"true"`
+	Page   int    `query:"page"`
+}
+
+// SoldItemsResponse is a page of the items sold in a sale, in item order.
+type SoldItemsResponse struct {
+	SaleID    string   `json:"sale_id"`
+	Page      int      `json:"page"`
+	PageSize  int      `json:"page_size"`
+	TotalSold int      `json:"total_sold"`
+	ItemIDs   []string `json:"item_ids"`
+}
+
+type SalesRequest struct {
+	// Status is "ended" (the default) or "active".
+	Status string `query:"status"`
+	Page   int    `query:"page"`
+}
+
+type SalesResponse struct {
+	Status   string        `json:"status"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"page_size"`
+	Sales    []SaleSummary `json:"sales"`
+}
+
+// SaleSummary is one sale of the sales history. The sell-out fields are
+// omitted for sales that never sold out or are not finalized yet.
+type SaleSummary struct {
+	SaleID              string     `json:"sale_id"`
+	Status              string     `json:"status"`
+	StartTime           time.Time  `json:"start_time"`
+	EndTime             time.Time  `json:"end_time"`
+	DurationSeconds     int        `json:"duration_seconds"`
+	TotalItems          int        `json:"total_items"`
+	ItemsSold           int        `json:"items_sold"`
+	SoldOutAt           *time.Time `json:"sold_out_at,omitempty"`
+	SoldOutAfterSeconds *float64   `json:"sold_out_after_seconds,omitempty"`
+}
+
+// Lottery statuses of an entrant.
+const (
+	LotteryEntered = "entered"
+	LotteryWon     = "won"
+	LotteryLost    = "lost"
+)
+
+type LotteryStatusRequest struct {
+	UserID string `query:"user_id" required:"true"`
+}
+
+// LotteryStatusResponse is a lottery entrant's status. Winners get the
+// checkout code they drew, to redeem at /purchase before it expires.
+type LotteryStatusResponse struct {
+	SaleID    string    `json:"sale_id"`
+	UserID    string    `json:"user_id"`
+	Status    string    `json:"status"`
+	DrawAt    time.Time `json:"draw_at"`
+	Code      string    `json:"code,omitempty"`
+	ItemID    string    `json:"item_id,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+type RegisterUserRequest struct {
+	// UserID is generated when empty.
+	UserID string `query:"user_id"`
+	Handle string `query:"handle" required:"true"`
+}
+
+type RegisterUserResponse struct {
+	UserID    string    `json:"user_id"`
+	Handle    string    `json:"handle"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CheckoutRequest struct {
+	// APIKey, with the checkout scope for the running sale, marks a
+	// kiosk checking out on a buyer's behalf.
+	APIKey string `header:"X-API-Key"`
+	UserID string `query:"user_id" required:"true"`
+	// ItemID may be left out to reserve any available item, of Category
+	// when one is given; the item reserved is returned in the response.
+	ItemID    string `query:"id"`
+	Category  string `query:"category"`
+	PromoCode string `query:"promo_code"`
+}
+
+type CheckoutResponse struct {
+	Code   string `json:"code"`
+	ItemID string `json:"item_id"`
+	// ExpiresAt is when the code stops holding the item, TTLSeconds after
+	// it was issued.
+	ExpiresAt  time.Time `json:"expires_at"`
+	TTLSeconds int       `json:"ttl_seconds"`
+	// EventsToken opens the buyer's /ws/user event stream; it is only
+	// issued when USER_EVENTS_SECRET is set.
+	EventsToken string `json:"events_token,omitempty"`
+}
+
+type UserEventsRequest struct {
+	Token string `query:"token" required:"true"`
+}
+
+type QueueStatusRequest struct {
+	Token string `query:"token" required:"true"`
+}
+
+// QueueStatusResponse is also the 202 body of a queued /checkout.
+type QueueStatusResponse struct {
+	Token    string `json:"token"`
+	SaleID   string `json:"sale_id"`
+	Position int64  `json:"position"`
+	// Admitted means /checkout will now take the user's request.
+	Admitted             bool `json:"admitted"`
+	EstimatedWaitSeconds int  `json:"estimated_wait_seconds"`
+}
+
+type UserReservationsRequest struct {
+	UserID string `path:"user_id" required:"true"`
+}
+
+type Reservation struct {
+	Code             string    `json:"code"`
+	ItemID           string    `json:"item_id"`
+	Category         string    `json:"category,omitempty"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	ExpiresInSeconds int       `json:"expires_in_seconds"`
+	// Extended is set once the code was extended; it cannot be again.
+	Extended bool `json:"extended"`
+}
+
+type UserReservationsResponse struct {
+	SaleID       string        `json:"sale_id"`
+	UserID       string        `json:"user_id"`
+	Reservations []Reservation `json:"reservations"`
+}
+
+type UserPurchasesRequest struct {
+	UserID string `path:"user_id" required:"true"`
+	Page   int    `query:"page"`
+}
+
+// UserPurchase is one item of a user's purchase history. Gifts are listed
+// for both users: GiftTo is set on the buyer's, GiftFrom on the
+// recipient's.
+type UserPurchase struct {
+	SaleID      string    `json:"sale_id"`
+	ItemID      string    `json:"item_id"`
+	Unit        int       `json:"unit,omitempty"`
+	PromoCode   string    `json:"promo_code,omitempty"`
+	GiftTo      string    `json:"gift_to,omitempty"`
+	GiftFrom    string    `json:"gift_from,omitempty"`
+	PurchasedAt time.Time `json:"purchased_at"`
+}
+
+type UserPurchasesResponse struct {
+	UserID    string         `json:"user_id"`
+	Page      int            `json:"page"`
+	PageSize  int            `json:"page_size"`
+	Purchases []UserPurchase `json:"purchases"`
+}
+
+type ItemAvailabilityRequest struct {
+	ItemID string `path:"item_id" required:"true"`
+}
+
+type ItemViewRequest struct {
+	ItemID string `path:"item_id" required:"true"`
+}
+
+type ItemViewResponse struct {
+	SaleID string `json:"sale_id"`
+	ItemID string `json:"item_id"`
+}
+
+type TrendingRequest struct {
+	// Limit defaults to TRENDING_SIZE and is at most 50.
+	Limit int `query:"limit"`
+}
+
+// TrendingResponse lists the most viewed items of the active sale that
+// are not sold yet, most viewed first.
+type TrendingResponse struct {
+	SaleID string         `json:"sale_id"`
+	Items  []TrendingItem `json:"items"`
+}
+
+type TrendingItem struct {
+	ItemID string `json:"item_id"`
+	Views  int64  `json:"views"`
+}
+
+type ItemAvailabilityResponse struct {
+	SaleID string `json:"sale_id"`
+	ItemID string `json:"item_id"`
+	// Status is available, held (an unexpired checkout code holds it) or
+	// sold.
+	Status    string     `json:"status"`
+	HeldUntil *time.Time `json:"held_until,omitempty"`
+	// UnitsLeft is how many units an item sold by quantity has left.
+	UnitsLeft *int `json:"units_left,omitempty"`
+}
+
+type ExtendCheckoutRequest struct {
+	Code string `path:"code" required:"true"`
+}
+
+type ExtendCheckoutResponse struct {
+	Code             string    `json:"code"`
+	ItemID           string    `json:"item_id"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	ExpiresInSeconds int       `json:"expires_in_seconds"`
+}
+
+type PurchaseRequest struct {
+	// APIKey, with the checkout scope for the running sale, marks a
+	// kiosk purchasing on a buyer's behalf.
+	APIKey string `header:"X-API-Key"`
+	Code   string `query:"code" required:"true"`
+	// RecipientUserID buys the item as a gift for another registered
+	// user, within their purchase limit rather than the buyer's.
+	RecipientUserID string `query:"recipient_user_id"`
+	// Details is an optional JSON body.
+	Details *PurchaseDetails `body:"json"`
+}
+
+// PurchaseDetails is the shipping and contact information a buyer may
+// submit with /purchase. Phone, address_line2 and region are optional;
+// country is an ISO 3166-1 alpha-2 code.
+type PurchaseDetails struct {
+	Name         string `json:"name"`
+	Email        string `json:"email"`
+	Phone        string `json:"phone,omitempty"`
+	AddressLine1 string `json:"address_line1"`
+	AddressLine2 string `json:"address_line2,omitempty"`
+	City         string `json:"city"`
+	Region       string `json:"region,omitempty"`
+	PostalCode   string `json:"postal_code"`
+	Country      string `json:"country"`
+}
+
+type PurchaseDetailsRequest struct {
+	PurchaseID string `path:"id" required:"true"`
+}
+
+type PurchaseDetailsResponse struct {
+	PurchaseID  string          `json:"purchase_id"`
+	SaleID      string          `json:"sale_id"`
+	UserID      string          `json:"user_id"`
+	ItemID      string          `json:"item_id"`
+	Details     PurchaseDetails `json:"details"`
+	SubmittedAt time.Time       `json:"submitted_at"`
+}
+
+type PurchaseResponse struct {
+	Success bool `json:"success"`
+	// PurchaseID addresses the purchase's details at /purchase/{id}.
+	PurchaseID string `json:"purchase_id"`
+	UserID     string `json:"user_id"`
+	ItemID     string `json:"item_id"`
+	// Unit is which unit of an item sold by quantity was bought, counted
+	// from 1.
+	Unit int `json:"unit,omitempty"`
+	// RecipientUserID is who the item was bought for, when it was a gift.
+	RecipientUserID string `json:"recipient_user_id,omitempty"`
+	SaleID          string `json:"sale_id"`
+	PromoCode       string `json:"promo_code,omitempty"`
+	PercentOff      int    `json:"percent_off,omitempty"`
+	// Receipt is omitted when RECEIPT_SECRET is unset.
+	Receipt *Receipt `json:"receipt,omitempty"`
+}
+
+// Receipt proves a purchase without the database: its signature is an
+// HMAC over the other fields, which /receipt/{purchase_id}/verify checks.
+type Receipt struct {
+	PurchaseID  string    `json:"purchase_id"`
+	SaleID      string    `json:"sale_id"`
+	UserID      string    `json:"user_id"`
+	ItemID      string    `json:"item_id"`
+	PurchasedAt time.Time `json:"purchased_at"`
+	Signature   string    `json:"signature"`
+}
+
+type VerifyReceiptRequest struct {
+	PurchaseID  string `path:"purchase_id" required:"true"`
+	SaleID      string `query:"sale_id" required:"true"`
+	UserID      string `query:"user_id" required:"true"`
+	ItemID      string `query:"item_id" required:"true"`
+	PurchasedAt string `query:"purchased_at" required:"true"`
+	Signature   string `query:"signature" required:"true"`
+}
+
+type VerifyReceiptResponse struct {
+	PurchaseID string `json:"purchase_id"`
+	Valid      bool   `json:"valid"`
+}
+
+type PendingPurchaseResponse struct {
+	PurchaseID string `json:"purchase_id"`
+	Status     string `json:"status"`
+}
+
+type PurchaseStatusRequest struct {
+	PurchaseID string `path:"id" required:"true"`
+}
+
+type PurchaseStatusResponse struct {
+	PurchaseID string    `json:"purchase_id"`
+	Status     string    `json:"status"`
+	SaleID     string    `json:"sale_id"`
+	UserID     string    `json:"user_id"`
+	ItemID     string    `json:"item_id"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	// Receipt is set once the purchase is confirmed.
+	Receipt *Receipt `json:"receipt,omitempty"`
+}
+
+// ProbeResponse answers the liveness and readiness probes. Checks lists each
+// readiness dependency as "ok" or the reason it failed.
+type ProbeResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+type ResetResponse struct {
+	Reset bool `json:"reset"`
+}
+
+type DeadLettersRequest struct {
+	Offset int `query:"offset"`
+	Limit  int `query:"limit"`
+}
+
+type DeadLetter struct {
+	ID       string          `json:"id"`
+	Kind     string          `json:"kind"`
+	Payload  json.RawMessage `json:"payload"`
+	Error    string          `json:"error"`
+	Attempts int             `json:"attempts"`
+	FailedAt time.Time       `json:"failed_at"`
+}
+
+type DeadLettersResponse struct {
+	Depth int64        `json:"depth"`
+	Items []DeadLetter `json:"items"`
+}
+
+type SaleAnalyticsRequest struct {
+	SaleID string `query:"sale_id"`
+}
+
+// Revenue is a sale's takings in one currency.
+type Revenue struct {
+	Currency    string `json:"currency"`
+	Items       int    `json:"items"`
+	AmountMinor int64  `json:"amount_minor"`
+	Amount      string `json:"amount"`
+}
+
+type SaleAnalyticsResponse struct {
+	SaleID    string    `json:"sale_id"`
+	ItemsSold int       `json:"items_sold"`
+	Revenue   []Revenue `json:"revenue"`
+	// UnpricedItems were sold without a catalog price and are not in
+	// Revenue.
+	UnpricedItems int `json:"unpriced_items"`
+}
+
+type TopBuyersRequest struct {
+	SaleID string `path:"sale_id" required:"true"`
+	Limit  int    `query:"limit"`
+}
+
+type TopBuyer struct {
+	UserID    string `json:"user_id"`
+	Purchases int    `json:"purchases"`
+}
+
+type TopBuyersResponse struct {
+	SaleID string     `json:"sale_id"`
+	Buyers []TopBuyer `json:"buyers"`
+}
+
+type SaleHeatmapRequest struct {
+	SaleID string `path:"sale_id" required:"true"`
+}
+
+// HeatmapBucket counts the checkouts that named an item numbered
+// FirstItem through LastItem.
+type HeatmapBucket struct {
+	FirstItem int   `json:"first_item"`
+	LastItem  int   `json:"last_item"`
+	Attempts  int64 `json:"attempts"`
+	// Showcased is set when the bucket holds an item /sale/info shows.
+	Showcased bool `json:"showcased"`
+}
+
+type SaleHeatmapResponse struct {
+	SaleID     string `json:"sale_id"`
+	BucketSize int    `json:"bucket_size"`
+	Attempts   int64  `json:"attempts"`
+	// ShowcasedAttempts is the part of Attempts in showcased buckets.
+	ShowcasedAttempts int64           `json:"showcased_attempts"`
+	Buckets           []HeatmapBucket `json:"buckets"`
+}
+
+type SaleStatsRequest struct {
+	// APIKey, with the stats scope for the sale, stands in for the admin
+	// credentials.
+	APIKey string `header:"X-API-Key"`
+	SaleID string `path:"sale_id" required:"true"`
+}
+
+// SaleStatsResponse is a finalized sale's performance, summed over every
+// replica. Latencies are the slowest replica's p99.
+type SaleStatsResponse struct {
+	SaleID              string   `json:"sale_id"`
+	TotalItems          int      `json:"total_items"`
+	ItemsSold           int      `json:"items_sold"`
+	CheckoutRequests    int64    `json:"checkout_requests"`
+	CheckoutSuccess     int64    `json:"checkout_success"`
+	CheckoutSuccessRate float64  `json:"checkout_success_rate"`
+	PurchaseRequests    int64    `json:"purchase_requests"`
+	PurchaseSuccess     int64    `json:"purchase_success"`
+	PurchaseSuccessRate float64  `json:"purchase_success_rate"`
+	SoldOutErrors       int64    `json:"sold_out_errors"`
+	P99CheckoutMs       float64  `json:"p99_checkout_ms"`
+	P99PurchaseMs       float64  `json:"p99_purchase_ms"`
+	SoldOutAfterSeconds *float64 `json:"sold_out_after_seconds,omitempty"`
+	// OversellBuffer is how many units the sale could sell beyond its
+	// stock when it ended, and Oversold how many of them it sold.
+	OversellBuffer int       `json:"oversell_buffer"`
+	Oversold       int       `json:"oversold"`
+	Instances      int       `json:"instances"`
+	RecordedAt     time.Time `json:"recorded_at"`
+}
+
+type SaleLedgerRequest struct {
+	SaleID string `path:"sale_id" required:"true"`
+}
+
+// SaleLedgerResponse is a sale's stock as its inventory ledger has it.
+// While the sale runs, the Redis counter is shown next to it; drift is how
+// many units Redis holds above the ledger's available, negative when
+// below. Movements still queued or parked in the dead letter queue show up
+// as drift until they are written.
+type SaleLedgerResponse struct {
+	SaleID         string     `json:"sale_id"`
+	Supplied       int        `json:"supplied"`
+	Available      int        `json:"available"`
+	Reserved       int        `json:"reserved"`
+	Sold           int        `json:"sold"`
+	LastMovementAt *time.Time `json:"last_movement_at,omitempty"`
+	RedisAvailable *int       `json:"redis_available,omitempty"`
+	Drift          *int       `json:"drift,omitempty"`
+}
+
+type StaffPicksRequest struct {
+	SaleID string      `path:"sale_id" required:"true"`
+	Picks  *StaffPicks `body:"json" required:"true"`
+}
+
+// StaffPicks are the items the staff_picks showcase strategy shows, in
+// order. An empty list clears them.
+type StaffPicks struct {
+	ItemIDs []string `json:"item_ids"`
+}
+
+type CreateWebhookRequest struct {
+	SaleID string `path:"sale_id" required:"true"`
+	// URL is an absolute http or https URL.
+	URL string `query:"url" required:"true"`
+}
+
+type WebhooksRequest struct {
+	SaleID string `path:"sale_id" required:"true"`
+}
+
+type DeleteWebhookRequest struct {
+	SaleID    string `path:"sale_id" required:"true"`
+	WebhookID int64  `path:"webhook_id" required:"true"`
+}
+
+// Webhook is an endpoint every completed purchase of a sale is POSTed to.
+// Secret, which signs the payloads, is only returned when the webhook is
+// created.
+type Webhook struct {
+	WebhookID int64     `json:"webhook_id"`
+	SaleID    string    `json:"sale_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhooksResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+	// Backlog counts the deliveries of every sale still to be made.
+	Backlog int64 `json:"backlog"`
+}
+
+type CreateAPIKeyRequest struct {
+	Key *NewAPIKey `body:"json" required:"true"`
+}
+
+// NewAPIKey is an API key to issue. Scopes are "stats", to read the stats
+// of its sales, and "checkout", to check out and purchase in them on
+// behalf of buyers.
+type NewAPIKey struct {
+	Name    string   `json:"name"`
+	SaleIDs []string `json:"sale_ids"`
+	Scopes  []string `json:"scopes"`
+}
+
+type DeleteAPIKeyRequest struct {
+	KeyID string `path:"key_id" required:"true"`
+}
+
+// APIKey lets a partner integration call some operations for some sales,
+// sent in the X-API-Key header. Key, the header's value, is only returned
+// when the key is created.
+type APIKey struct {
+	KeyID     string    `json:"key_id"`
+	Name      string    `json:"name"`
+	SaleIDs   []string  `json:"sale_ids"`
+	Scopes    []string  `json:"scopes"`
+	Key       string    `json:"key,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type APIKeysResponse struct {
+	Keys []APIKey `json:"keys"`
+}
+
+type BanUserRequest struct {
+	UserID string `path:"user_id" required:"true"`
+}
+
+type UnbanUserRequest struct {
+	UserID string `path:"user_id" required:"true"`
+}
+
+// BansResponse lists the users banned from checking out and purchasing.
+type BansResponse struct {
+	UserIDs []string `json:"user_ids"`
+}
+
+type RevokePurchasesRequest struct {
+	SaleID string `path:"sale_id" required:"true"`
+	UserID string `path:"user_id" required:"true"`
+}
+
+// RevokedPurchase is a purchase taken back. UserID bought it and
+// RecipientUserID, for a gift, owned it.
+type RevokedPurchase struct {
+	PurchaseID      string    `json:"purchase_id"`
+	ItemID          string    `json:"item_id"`
+	Unit            int       `json:"unit"`
+	UserID          string    `json:"user_id"`
+	RecipientUserID string    `json:"recipient_user_id,omitempty"`
+	PurchasedAt     time.Time `json:"purchased_at"`
+}
+
+// RevokePurchasesResponse lists the purchases taken back from a user.
+// ReturnedToInventory counts the items put back on sale, which only
+// happens while the sale runs.
+type RevokePurchasesResponse struct {
+	SaleID              string            `json:"sale_id"`
+	UserID              string            `json:"user_id"`
+	Revoked             []RevokedPurchase `json:"revoked"`
+	ReturnedToInventory int               `json:"returned_to_inventory"`
+}
+
+type SaleSnapshotRequest struct {
+	SaleID string `path:"sale_id" required:"true"`
+}
+
+type SaleSnapshotResponse struct {
+	SnapshotID int64     `json:"snapshot_id"`
+	SaleID     string    `json:"sale_id"`
+	TakenAt    time.Time `json:"taken_at"`
+	Keys       int       `json:"keys"`
+	Codes      int       `json:"codes"`
+	Bytes      int       `json:"bytes"`
+}
+
+type RestoreSaleRequest struct {
+	SaleID string `path:"sale_id" required:"true"`
+	// SnapshotID of 0 restores the sale's latest snapshot.
+	SnapshotID int64 `query:"snapshot_id"`
+}
+
+type RestoreSaleResponse struct {
+	SnapshotID int64     `json:"snapshot_id"`
+	SaleID     string    `json:"sale_id"`
+	TakenAt    time.Time `json:"taken_at"`
+	Restored   int       `json:"restored"`
+	// Expired keys, such as checkout codes past their expiry, were skipped.
+	Expired int `json:"expired"`
+}
+
+type SaleCodeTTLRequest struct {
+	SaleID string `path:"sale_id" required:"true"`
+	// TTL is a Go duration such as "90s".
+	TTL string `query:"ttl" required:"true"`
+}
+
+type SaleCodeTTLResponse struct {
+	SaleID     string `json:"sale_id"`
+	TTLSeconds int    `json:"ttl_seconds"`
+}
+
+type SaleOversellBufferRequest struct {
+	SaleID string `path:"sale_id" required:"true"`
+	// Buffer is how many units the sale may sell beyond its stock.
+	Buffer string `query:"buffer" required:"true"`
+}
+
+type SaleOversellBufferResponse struct {
+	SaleID         string `json:"sale_id"`
+	OversellBuffer int    `json:"oversell_buffer"`
+}
+
+type AttemptLogRequest struct {
+	// Mode is postgres, stream or none.
+	Mode string `query:"mode" required:"true"`
+}
+
+type AttemptLogResponse struct {
+	Mode string `json:"mode"`
+	// StreamBacklog is how many attempts wait in the Redis stream to be
+	// written to Postgres.
+	StreamBacklog int64 `json:"stream_backlog"`
+}
+
+type SetFlagRequest struct {
+	Name    string `path:"name" required:"true"`
+	Enabled bool   `query:"enabled" required:"true"`
+}
+
+type ClearFlagRequest struct {
+	Name string `path:"name" required:"true"`
+}
+
+// Flag is a behavior that can be switched on and off mid-contest. It is
+// Default until overridden through the admin API.
+type Flag struct {
+	Name       string `json:"name"`
+	Enabled    bool   `json:"enabled"`
+	Default    bool   `json:"default"`
+	Overridden bool   `json:"overridden"`
+}
+
+type FlagsResponse struct {
+	Flags []Flag `json:"flags"`
+}
+
+type ConfigReloadResponse struct {
+	Changed    []string  `json:"changed"`
+	ReloadedAt time.Time `json:"reloaded_at"`
+}
+
+type SaleExportRequest struct {
+	SaleID string `path:"sale_id" required:"true"`
+	Format string `query:"format"`
+}
+
+// ExportedPurchase is one NDJSON line of a sale export; CSV exports carry
+// the same columns.
+type ExportedPurchase struct {
+	UserID       string    `json:"user_id"`
+	ItemID       string    `json:"item_id"`
+	PurchaseTime time.Time `json:"purchase_time"`
+}
+
+type CatalogUploadRequest struct {
+	SaleID string `path:"sale_id" required:"true"`
+	Format string `query:"format"`
+}
+
+type CatalogUploadResponse struct {
+	SaleID     string         `json:"sale_id"`
+	Items      int            `json:"items"`
+	Categories map[string]int `json:"categories"`
+}
+
+type CatalogExportRequest struct {
+	SaleID string `path:"sale_id" required:"true"`
+	Format string `query:"format"`
+}
+
+// CatalogEntry is one NDJSON line of a catalog export; CSV exports carry
+// the same columns. Both upload back as they are.
+type CatalogEntry struct {
+	SKU      string `json:"sku"`
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	ImageURL string `json:"image_url,omitempty"`
+	Price    string `json:"price"`
+	Currency string `json:"currency"`
+	Rarity   string `json:"rarity"`
+	Quantity int    `json:"quantity"`
+}
+
+type RedisKeyUsage struct {
+	Keys           int64 `json:"keys"`
+	SampledKeys    int64 `json:"sampled_keys"`
+	EstimatedBytes int64 `json:"estimated_bytes"`
+	TTLApplied     int64 `json:"ttl_applied"`
+	Deleted        int64 `json:"deleted"`
+}
+
+type RedisAuditResponse struct {
+	StartedAt      time.Time                `json:"started_at"`
+	DurationMs     int64                    `json:"duration_ms"`
+	Keys           int64                    `json:"keys"`
+	EstimatedBytes int64                    `json:"estimated_bytes"`
+	Prefixes       map[string]RedisKeyUsage `json:"prefixes"`
+}
+
+type CreatePromoRequest struct {
+	Code       string `query:"code" required:"true"`
+	PercentOff int    `query:"percent_off" required:"true"`
+	// MaxRedemptions of 0 leaves the code unlimited.
+	MaxRedemptions int       `query:"max_redemptions"`
+	ExpiresAt      time.Time `query:"expires_at"`
+}
+
+type Promo struct {
+	Code           string    `json:"code"`
+	PercentOff     int       `json:"percent_off"`
+	MaxRedemptions int       `json:"max_redemptions"`
+	Redeemed       int       `json:"redeemed"`
+	ExpiresAt      time.Time `json:"expires_at,omitzero"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type PromosResponse struct {
+	Promos []Promo `json:"promos"`
+}
+
+type ReplayDeadLettersRequest struct {
+	Limit int `query:"limit"`
+}
+
+type ReplayDeadLettersResponse struct {
+	Replayed  int   `json:"replayed"`
+	Failed    int   `json:"failed"`
+	Remaining int64 `json:"remaining"`
+}
+
+// DryRunRequest sizes a dry run; each field defaults to its DRY_RUN_*
+// setting.
+type DryRunRequest struct {
+	Items       int `query:"items"`
+	Users       int `query:"users"`
+	Concurrency int `query:"concurrency"`
+}
+
+// DryRunResponse reports a sale played in the sandbox. Score is the share,
+// in percent, of checkouts and purchases that met their SLO latency,
+// whichever is lower, and 0 when a check failed; Ready is set when every
+// check passed and the share reaches SLO_TARGET.
+type DryRunResponse struct {
+	SaleID       string           `json:"sale_id"`
+	Items        int              `json:"items"`
+	Users        int              `json:"users"`
+	Concurrency  int              `json:"concurrency"`
+	Reservations int              `json:"reservations"`
+	Purchases    int              `json:"purchases"`
+	Outcomes     map[string]int64 `json:"reservation_outcomes"`
+	Checkout     DryRunLatency    `json:"checkout"`
+	Purchase     DryRunLatency    `json:"purchase"`
+	Checks       []DryRunCheck    `json:"checks"`
+	Score        float64          `json:"score"`
+	Ready        bool             `json:"ready"`
+	TrafficMs    int64            `json:"traffic_ms"`
+	DurationMs   int64            `json:"duration_ms"`
+}
+
+type DryRunLatency struct {
+	Requests int64 `json:"requests"`
+	// Failed calls got a Redis error, Slow ones answered after the SLO
+	// latency.
+	Failed     int64   `json:"failed"`
+	Slow       int64   `json:"slow"`
+	P50Ms      float64 `json:"p50_ms"`
+	P99Ms      float64 `json:"p99_ms"`
+	Compliance float64 `json:"compliance"`
+}
+
+// DryRunCheck is one invariant checked against the state a dry run left.
+type DryRunCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+// Stats is a free-form key/value report such as /metrics or /health.
+type Stats map[string]interface{}
@@ -0,0 +1,163 @@
+// Package attempts stores checkout attempts off the request path. The store
+// is chosen by ATTEMPT_LOG and can be switched while the server runs, so an
+// operator can shed the write load of a rush without a deploy.
+package attempts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/database"
+)
+
+// Modes a Switch can log in.
+const (
+	// ModePostgres batches attempts into checkout_attempts directly.
+	ModePostgres = "postgres"
+	// ModeStream appends attempts to a Redis stream, which is drained into
+	// checkout_attempts in batches at a pace Postgres can take.
+	ModeStream = "stream"
+	// ModeNone discards attempts.
+	ModeNone = "none"
+)
+
+const (
+	// buffer bounds the attempts waiting in memory; beyond it they are
+	// dropped rather than slowing checkout.
+	buffer = 20000
+	// batchSize is the most attempts written in one statement or appended
+	// in one round trip.
+	batchSize = 500
+	// flushEvery is how long an attempt waits in memory at most.
+	flushEvery = 250 * time.Millisecond
+	// drainBatch is the most attempts read off the stream per insert.
+	drainBatch = 1000
+)
+
+// Logger stores checkout attempts. Log must not block.
+type Logger interface {
+	Log(attempt *database.CheckoutAttempt)
+}
+
+// Hooks tell the caller what a Logger could not store.
+type Hooks struct {
+	// Dropped is called for each attempt shed because the buffer was full.
+	Dropped func()
+	// Failed is called with a batch the database refused.
+	Failed func(batch []*database.CheckoutAttempt, err error)
+}
+
+// Switch is a Logger that forwards to the store of its current mode.
+// Attempts already buffered by the previous store are still written.
+type Switch struct {
+	loggers map[string]Logger
+	mode    atomic.Value
+}
+
+// NewSwitch starts the stores and logs in mode. consumer names this
+// replica among the stream's flushers.
+func NewSwitch(ctx context.Context, mode string, db database.Service, c cache.Service, consumer string, hooks Hooks) (*Switch, error) {
+	s := &Switch{loggers: map[string]Logger{
+		ModePostgres: newBatcher(ctx, hooks, func(ctx context.Context, batch []*database.CheckoutAttempt) error {
+			return db.LogCheckoutAttempts(ctx, batch)
+		}),
+		ModeStream: newStream(ctx, db, c, consumer, hooks),
+		ModeNone:   discard{},
+	}}
+	if err := s.Set(mode); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Set switches to mode.
+func (s *Switch) Set(mode string) error {
+	if _, ok := s.loggers[mode]; !ok {
+		return fmt.Errorf("unknown attempt log mode %q", mode)
+	}
+	if previous, _ := s.mode.Swap(mode).(string); previous != "" && previous != mode {
+		log.Printf("Checkout attempt log switched from %s to %s", previous, mode)
+	}
+	return nil
+}
+
+// Mode is the mode attempts are logged in.
+func (s *Switch) Mode() string {
+	mode, _ := s.mode.Load().(string)
+	return mode
+}
+
+func (s *Switch) Log(attempt *database.CheckoutAttempt) {
+	if attempt.CreatedAt.IsZero() {
+		attempt.CreatedAt = time.Now()
+	}
+	s.loggers[s.Mode()].Log(attempt)
+}
+
+type discard struct{}
+
+func (discard) Log(*database.CheckoutAttempt) {}
+
+// batcher buffers attempts in memory and hands them to write in batches.
+type batcher struct {
+	attempts chan *database.CheckoutAttempt
+	write    func(ctx context.Context, batch []*database.CheckoutAttempt) error
+	hooks    Hooks
+}
+
+func newBatcher(ctx context.Context, hooks Hooks, write func(ctx context.Context, batch []*database.CheckoutAttempt) error) *batcher {
+	b := &batcher{
+		attempts: make(chan *database.CheckoutAttempt, buffer),
+		write:    write,
+		hooks:    hooks,
+	}
+	go b.run(ctx)
+	return b
+}
+
+func (b *batcher) Log(attempt *database.CheckoutAttempt) {
+	select {
+	case b.attempts <- attempt:
+	default:
+		if b.hooks.Dropped != nil {
+			b.hooks.Dropped()
+		}
+	}
+}
+
+func (b *batcher) run(ctx context.Context) {
+	ticker := time.NewTicker(flushEvery)
+	defer ticker.Stop()
+
+	batch := make([]*database.CheckoutAttempt, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		writeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := b.write(writeCtx, batch); err != nil && b.hooks.Failed != nil {
+			b.hooks.Failed(batch, err)
+		}
+		cancel()
+		batch = make([]*database.CheckoutAttempt, 0, batchSize)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			flush()
+			return
+		case attempt := <-b.attempts:
+			batch = append(batch, attempt)
+			if len(batch) == batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package attempts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/database"
+)
+
+// newStream returns the Redis stream store: attempts are batched in memory,
+// appended to the stream, and a drainer on every replica moves them into
+// checkout_attempts one large insert at a time. A batch Redis refuses is
+// written to Postgres directly instead.
+func newStream(ctx context.Context, db database.Service, c cache.Service, consumer string, hooks Hooks) *batcher {
+	go drain(ctx, db, c, consumer)
+
+	return newBatcher(ctx, hooks, func(ctx context.Context, batch []*database.CheckoutAttempt) error {
+		payloads := make([][]byte, len(batch))
+		for i, attempt := range batch {
+			payloads[i], _ = json.Marshal(attempt)
+		}
+		err := c.AppendCheckoutAttempts(ctx, payloads)
+		if err == nil {
+			return nil
+		}
+		log.Printf("Failed to append %d checkout attempts to the stream, writing them to Postgres: %v", len(batch), err)
+		return db.LogCheckoutAttempts(ctx, batch)
+	})
+}
+
+// drain writes the stream's attempts to checkout_attempts until ctx is
+// done. It runs whatever the current mode, so attempts appended before a
+// switch away from the stream are still written. Batches the database
+// refuses stay unacknowledged and are retried once they have been idle for
+// a while.
+func drain(ctx context.Context, db database.Service, c cache.Service, consumer string) {
+	grouped := false
+	for ctx.Err() == nil {
+		if !grouped {
+			if err := c.EnsureCheckoutAttemptGroup(ctx); err != nil {
+				log.Printf("Failed to create the checkout attempt stream group: %v", err)
+				sleep(ctx, time.Second)
+				continue
+			}
+			grouped = true
+		}
+
+		entries, err := c.ReadCheckoutAttempts(ctx, consumer, drainBatch, time.Second)
+		if err != nil {
+			if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+				log.Printf("Failed to read checkout attempts: %v", err)
+				// The stream may have been deleted along with its group.
+				grouped = false
+				sleep(ctx, time.Second)
+			}
+			continue
+		}
+
+		batch := make([]*database.CheckoutAttempt, 0, len(entries))
+		ids := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+			var attempt database.CheckoutAttempt
+			if err := json.Unmarshal(entry.Payload, &attempt); err != nil {
+				log.Printf("Dropping malformed checkout attempt %s: %v", entry.ID, err)
+				continue
+			}
+			batch = append(batch, &attempt)
+		}
+
+		if len(batch) > 0 {
+			writeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err := db.LogCheckoutAttempts(writeCtx, batch)
+			cancel()
+			if err != nil {
+				log.Printf("Failed to write %d checkout attempts from the stream: %v", len(batch), err)
+				sleep(ctx, time.Second)
+				continue
+			}
+		}
+		if err := c.AckCheckoutAttempts(ctx, ids); err != nil {
+			log.Printf("Failed to ack %d checkout attempts: %v", len(ids), err)
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
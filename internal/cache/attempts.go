@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	checkoutAttemptsStream = "checkout_attempts:stream"
+	checkoutAttemptsGroup  = "attempt_flushers"
+
+	// checkoutAttemptsMaxLen caps the stream so a database outage cannot
+	// exhaust Redis memory; past it the oldest attempts are trimmed away.
+	checkoutAttemptsMaxLen = 1000000
+	// checkoutAttemptsReclaimIdle is how long an entry may sit delivered
+	// but unacknowledged, say by a replica that died mid-flush, before
+	// another flusher takes it over.
+	checkoutAttemptsReclaimIdle = time.Minute
+)
+
+// CheckoutAttemptEntry is one entry of the checkout attempts stream.
+type CheckoutAttemptEntry struct {
+	ID      string
+	Payload []byte
+}
+
+// AppendCheckoutAttempts adds encoded attempts to the stream in one round
+// trip.
+func (s *service) AppendCheckoutAttempts(ctx context.Context, payloads [][]byte) error {
+	pipe := s.client.Pipeline()
+	for _, payload := range payloads {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: checkoutAttemptsStream,
+			MaxLen: checkoutAttemptsMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{"attempt": payload},
+		})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// EnsureCheckoutAttemptGroup creates the flushers' consumer group (and the
+// stream) if they do not exist yet.
+func (s *service) EnsureCheckoutAttemptGroup(ctx context.Context) error {
+	err := s.client.XGroupCreateMkStream(ctx, checkoutAttemptsStream, checkoutAttemptsGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// ReadCheckoutAttempts returns up to count attempts for consumer to write:
+// entries abandoned by another flusher first, then new ones, blocking up to
+// block for them. It returns redis.Nil when nothing arrived.
+func (s *service) ReadCheckoutAttempts(ctx context.Context, consumer string, count int64, block time.Duration) ([]CheckoutAttemptEntry, error) {
+	claimed, _, err := s.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   checkoutAttemptsStream,
+		Group:    checkoutAttemptsGroup,
+		Consumer: consumer,
+		MinIdle:  checkoutAttemptsReclaimIdle,
+		Start:    "0",
+		Count:    count,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(claimed) > 0 {
+		return checkoutAttemptEntries(claimed), nil
+	}
+
+	streams, err := s.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    checkoutAttemptsGroup,
+		Consumer: consumer,
+		Streams:  []string{checkoutAttemptsStream, ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []CheckoutAttemptEntry
+	for _, stream := range streams {
+		out = append(out, checkoutAttemptEntries(stream.Messages)...)
+	}
+	return out, nil
+}
+
+func checkoutAttemptEntries(msgs []redis.XMessage) []CheckoutAttemptEntry {
+	out := make([]CheckoutAttemptEntry, 0, len(msgs))
+	for _, msg := range msgs {
+		payload, _ := msg.Values["attempt"].(string)
+		out = append(out, CheckoutAttemptEntry{ID: msg.ID, Payload: []byte(payload)})
+	}
+	return out
+}
+
+// AckCheckoutAttempts removes attempts that have been written to the
+// database.
+func (s *service) AckCheckoutAttempts(ctx context.Context, ids []string) error {
+	pipe := s.client.Pipeline()
+	pipe.XAck(ctx, checkoutAttemptsStream, checkoutAttemptsGroup, ids...)
+	pipe.XDel(ctx, checkoutAttemptsStream, ids...)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// CheckoutAttemptBacklog is how many attempts wait in the stream.
+func (s *service) CheckoutAttemptBacklog(ctx context.Context) (int64, error) {
+	return s.client.XLen(ctx, checkoutAttemptsStream).Result()
+}
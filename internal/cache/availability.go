@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Item availability states.
+const (
+	ItemAvailable = "available"
+	ItemHeld      = "held"
+	ItemSold      = "sold"
+)
+
+// ItemAvailability is whether an item can still be checked out.
+type ItemAvailability struct {
+	Status string
+	// HeldUntil is when the latest hold on a held item expires.
+	HeldUntil time.Time
+	// UnitsLeft is how many units an item sold by quantity has left; -1
+	// for other items.
+	UnitsLeft int
+}
+
+// itemHoldsKey is the reservation index of a sale: item ID to the expiry,
+// in milliseconds, of its latest checkout code, or "sold" once a code for
+// it was redeemed.
+func itemHoldsKey(saleID string) string {
+	return fmt.Sprintf("sale:%s:holds", saleID)
+}
+
+// SoldItemNumbers lists the numbered items of a sale marked sold, in
+// order. The bitmap holds one bit per item, so it is read whole.
+func (s *service) SoldItemNumbers(ctx context.Context, saleID string) ([]int, error) {
+	bitmap, err := s.client.Get(ctx, fmt.Sprintf("sale:%s:sold_bitmap", saleID)).Bytes()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	var numbers []int
+	for i, b := range bitmap {
+		for bit := 0; b != 0 && bit < 8; bit++ {
+			// SETBIT numbers bits from the most significant one.
+			if b&(0x80>>bit) != 0 {
+				numbers = append(numbers, i*8+bit+1)
+			}
+		}
+	}
+	return numbers, nil
+}
+
+// GetItemAvailability reports whether an item of a sale is sold, held by an
+// unexpired checkout code, or available. Items the sale does not have are
+// an "unknown item" error. An item sold by quantity is available while it
+// has units left, and sold once the last unit's hold has expired.
+func (s *service) GetItemAvailability(ctx context.Context, saleID, itemID string) (*ItemAvailability, error) {
+	pipe := s.client.Pipeline()
+	exists := pipe.HExists(ctx, fmt.Sprintf("sale:%s:items", saleID), itemID)
+	hold := pipe.HGet(ctx, itemHoldsKey(saleID), itemID)
+	stock := pipe.HGet(ctx, itemStockKey(saleID), itemID)
+	var sold *redis.IntCmd
+	if n := ItemNumber(saleID, itemID); n > 0 {
+		sold = pipe.GetBit(ctx, fmt.Sprintf("sale:%s:sold_bitmap", saleID), int64(n-1))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	if !exists.Val() {
+		return nil, fmt.Errorf("unknown item")
+	}
+	unitsLeft := -1
+	if n, err := stock.Int(); err == nil {
+		if n > 0 {
+			return &ItemAvailability{Status: ItemAvailable, UnitsLeft: n}, nil
+		}
+		unitsLeft = 0
+	}
+	if sold != nil && sold.Val() == 1 || hold.Val() == ItemSold {
+		return &ItemAvailability{Status: ItemSold, UnitsLeft: unitsLeft}, nil
+	}
+	if expiresMs, err := strconv.ParseInt(hold.Val(), 10, 64); err == nil {
+		if heldUntil := time.UnixMilli(expiresMs); time.Now().Before(heldUntil) {
+			return &ItemAvailability{Status: ItemHeld, HeldUntil: heldUntil, UnitsLeft: unitsLeft}, nil
+		}
+	}
+	// Units whose codes expired are not given back
+	if unitsLeft == 0 {
+		return &ItemAvailability{Status: ItemSold, UnitsLeft: 0}, nil
+	}
+	return &ItemAvailability{Status: ItemAvailable, UnitsLeft: unitsLeft}, nil
+}
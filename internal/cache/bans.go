@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"context"
+	"slices"
+)
+
+// bannedUsersKey is the set of user IDs banned from the tenant's sales.
+// Checkouts of banned users are refused before they reach Redis, and the
+// purchase scripts refuse codes checked out by, or gifted to, one.
+const bannedUsersKey = "users:banned"
+
+// BanUser bans a user from checking out and purchasing. It reports false
+// when they were banned already.
+func (s *service) BanUser(ctx context.Context, userID string) (bool, error) {
+	added, err := s.client.SAdd(ctx, s.tenantKey(bannedUsersKey), userID).Result()
+	return added == 1, err
+}
+
+// UnbanUser lifts a ban. It reports false when the user was not banned.
+func (s *service) UnbanUser(ctx context.Context, userID string) (bool, error) {
+	removed, err := s.client.SRem(ctx, s.tenantKey(bannedUsersKey), userID).Result()
+	return removed == 1, err
+}
+
+// IsUserBanned reports whether a user is banned.
+func (s *service) IsUserBanned(ctx context.Context, userID string) (bool, error) {
+	return s.client.SIsMember(ctx, s.tenantKey(bannedUsersKey), userID).Result()
+}
+
+// BannedUsers lists the banned users, sorted.
+func (s *service) BannedUsers(ctx context.Context) ([]string, error) {
+	users, err := s.client.SMembers(ctx, s.tenantKey(bannedUsersKey)).Result()
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(users)
+	return users, nil
+}
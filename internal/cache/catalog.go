@@ -0,0 +1,16 @@
+package cache
+
+import "context"
+
+const stagedCatalogKey = "catalog:next"
+
+// StageCatalog stores an encoded catalog for the next sale to pick up.
+func (s *service) StageCatalog(ctx context.Context, data []byte) error {
+	return s.client.Set(ctx, s.tenantKey(stagedCatalogKey), data, 0).Err()
+}
+
+// TakeStagedCatalog returns and removes the staged catalog. It returns
+// redis.Nil when none is staged.
+func (s *service) TakeStagedCatalog(ctx context.Context) ([]byte, error) {
+	return s.client.GetDel(ctx, s.tenantKey(stagedCatalogKey)).Bytes()
+}
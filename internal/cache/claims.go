@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// claimedItemsKey is the bitmap of numbered items a checkout has claimed,
+// bit n-1 for <sale>_item_<n>. ReserveItem picks the lowest clear bit for a
+// checkout that names no item, and sets the bit of every item it reserves so
+// later picks skip it.
+func claimedItemsKey(saleID string) string {
+	return fmt.Sprintf("sale:%s:claimed_bitmap", saleID)
+}
+
+// categoryItemsKey is the bitmap of a sale's numbered items in category,
+// bit n-1 for <sale>_item_<n>, set by SetItems. An any-available checkout
+// filtered by category only picks items whose bit is set here.
+func categoryItemsKey(saleID, category string) string {
+	return fmt.Sprintf("sale:%s:category_items:%s", saleID, category)
+}
+
+// categoryPickKey is scratch space for the reservation script, which
+// combines the claimed and category bitmaps there to pick an item.
+func categoryPickKey(saleID string) string {
+	return fmt.Sprintf("sale:%s:category_pick", saleID)
+}
+
+// ItemID returns the ID of item n of a sale's numbered catalog.
+func ItemID(saleID string, n int) string {
+	return fmt.Sprintf("%s_item_%06d", saleID, n)
+}
+
+// ItemNumber returns n for the item <saleID>_item_<n>, or 0 for items of
+// SKU-scheme catalogs, which carry no number.
+func ItemNumber(saleID, itemID string) int {
+	suffix, ok := strings.CutPrefix(itemID, saleID+"_item_")
+	if !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(suffix)
+	if err != nil || n <= 0 {
+		return 0
+	}
+	return n
+}
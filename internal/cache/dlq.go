@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const deadLettersKey = "dlq:db_writes"
+
+// Dead letter kinds, one per asynchronous database write.
+const (
+	DeadLetterCheckoutAttempt   = "checkout_attempt"
+	DeadLetterPurchase          = "purchase"
+	DeadLetterPurchaseDetails   = "purchase_details"
+	DeadLetterInventoryMovement = "inventory_movement"
+)
+
+// DeadLetter is an asynchronous database write that failed and is parked
+// for inspection and replay.
+type DeadLetter struct {
+	ID       string          `json:"id"`
+	Kind     string          `json:"kind"`
+	Payload  json.RawMessage `json:"payload"`
+	Error    string          `json:"error"`
+	Attempts int             `json:"attempts"`
+	FailedAt time.Time       `json:"failed_at"`
+}
+
+func (s *service) PushDeadLetter(ctx context.Context, d *DeadLetter) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return s.client.RPush(ctx, deadLettersKey, data).Err()
+}
+
+// PopDeadLetter takes the oldest dead letter off the queue. It returns
+// redis.Nil when the queue is empty.
+func (s *service) PopDeadLetter(ctx context.Context) (*DeadLetter, error) {
+	data, err := s.client.LPop(ctx, deadLettersKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var d DeadLetter
+	if err := json.Unmarshal([]byte(data), &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ListDeadLetters returns up to limit dead letters, oldest first, without
+// removing them.
+func (s *service) ListDeadLetters(ctx context.Context, offset, limit int) ([]DeadLetter, error) {
+	entries, err := s.client.LRange(ctx, deadLettersKey, int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]DeadLetter, 0, len(entries))
+	for _, entry := range entries {
+		var d DeadLetter
+		if err := json.Unmarshal([]byte(entry), &d); err != nil {
+			continue
+		}
+		letters = append(letters, d)
+	}
+	return letters, nil
+}
+
+func (s *service) DeadLetterDepth(ctx context.Context) (int64, error) {
+	return s.client.LLen(ctx, deadLettersKey).Result()
+}
@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// extendScanCount is how many keys each SCAN of ExtendSaleKeys asks for.
+const extendScanCount = 500
+
+// ExtendSaleKeys pushes back the expiry of every key of a sale by by, so a
+// sale whose end moved keeps its inventory, holds and counters past the
+// hour they were set up for. Keys without a TTL are left without one. It
+// returns how many keys it extended.
+func (s *service) ExtendSaleKeys(ctx context.Context, saleID string, by time.Duration) (int, error) {
+	extended := 0
+	var cursor uint64
+	for {
+		keys, next, err := s.client.Scan(ctx, cursor, fmt.Sprintf("sale:%s:*", saleID), extendScanCount).Result()
+		if err != nil {
+			return extended, err
+		}
+		if len(keys) > 0 {
+			n, err := pushBackExpiryScript.Run(ctx, s.client, keys, by.Milliseconds()).Int()
+			if err != nil {
+				return extended, err
+			}
+			extended += n
+		}
+		if cursor = next; cursor == 0 {
+			return extended, nil
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// failoverProbeEvery is how often the primary is pinged.
+	failoverProbeEvery = time.Second
+	// failoverProbeTimeout bounds one ping.
+	failoverProbeTimeout = 500 * time.Millisecond
+	// failoverAfter is how many pings in a row the primary must miss
+	// before the standby takes over.
+	failoverAfter = 3
+	// failoverFlagKey is set on the standby by the first replica that
+	// fails over to it. Every replica follows as soon as it sees it, so
+	// replicas that can still reach the primary do not keep writing there.
+	failoverFlagKey = "failover:standby_active"
+)
+
+// errPrimaryRetired fails commands sent on a connection to the primary
+// after the client failed over. They are refused before anything is
+// written, so Redis never ran them.
+var errPrimaryRetired = errors.New("redis failed over to standby")
+
+// failover moves the client from the primary to a standby Redis once the
+// primary stops answering, or once another replica has failed over to it.
+// Commands keep going through the same client: new connections are dialed
+// to the standby, and pooled connections to the primary refuse to send
+// anything once failed over, see primaryConn, so the pool drops them even
+// when the primary is still alive on the other side of a partition. There
+// is no failing back; the standby holds everything written since, so it
+// serves until the process restarts.
+type failover struct {
+	primary string
+	standby string
+	probes  [2]*redis.Client
+
+	active atomic.Bool
+
+	mu        sync.Mutex
+	listeners []func()
+}
+
+func newFailover(opts Options) *failover {
+	probe := func(addr string) *redis.Client {
+		return redis.NewClient(&redis.Options{
+			Addr:        addr,
+			Password:    opts.Password,
+			DB:          opts.DB,
+			PoolSize:    1,
+			DialTimeout: failoverProbeTimeout,
+			ReadTimeout: failoverProbeTimeout,
+			MaxRetries:  -1,
+		})
+	}
+	return &failover{
+		primary: opts.Addr,
+		standby: opts.StandbyAddr,
+		probes:  [2]*redis.Client{probe(opts.Addr), probe(opts.StandbyAddr)},
+	}
+}
+
+// DialHook sends new connections to the standby once failed over, and
+// marks those to the primary so they can be retired.
+func (f *failover) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if f.active.Load() {
+			return next(ctx, network, f.standby)
+		}
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &primaryConn{Conn: conn, failover: f}, nil
+	}
+}
+
+// primaryConn is a connection to the primary. Once failed over, every write
+// on it fails with a network error, which makes the pool discard it and
+// go-redis retry the command on a fresh connection, to the standby.
+type primaryConn struct {
+	net.Conn
+	failover *failover
+}
+
+func (c *primaryConn) Write(b []byte) (int, error) {
+	if c.failover.active.Load() {
+		return 0, &net.OpError{Op: "write", Net: c.LocalAddr().Network(), Addr: c.RemoteAddr(), Err: errPrimaryRetired}
+	}
+	return c.Conn.Write(b)
+}
+
+func (f *failover) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (f *failover) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+// monitor pings the primary until it has failed over or ctx is done. The
+// decision is shared through failoverFlagKey on the standby: a replica
+// only fails over once it has set the flag there, and follows one that
+// did. A replica that cannot reach the standby stays on the primary.
+func (f *failover) monitor(ctx context.Context) {
+	ticker := time.NewTicker(failoverProbeEvery)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if f.flagged(ctx) {
+			log.Printf("Another replica failed over to Redis standby %s, following it", f.standby)
+		} else if err := f.ping(ctx, f.probes[0]); err == nil {
+			missed = 0
+			continue
+		} else if missed++; missed < failoverAfter {
+			continue
+		} else if err := f.flag(ctx); err != nil {
+			log.Printf("Redis primary %s is down, but standby %s is not answering either: %v", f.primary, f.standby, err)
+			continue
+		} else {
+			log.Printf("Redis primary %s missed %d pings, failing over to standby %s", f.primary, missed, f.standby)
+		}
+
+		f.active.Store(true)
+		for _, probe := range f.probes {
+			probe.Close()
+		}
+		f.mu.Lock()
+		listeners := f.listeners
+		f.mu.Unlock()
+		for _, fn := range listeners {
+			go fn()
+		}
+		return
+	}
+}
+
+func (f *failover) ping(ctx context.Context, probe *redis.Client) error {
+	ctx, cancel := context.WithTimeout(ctx, failoverProbeTimeout)
+	defer cancel()
+	return probe.Ping(ctx).Err()
+}
+
+// flagged reports whether a replica has failed over to the standby. An
+// unreachable standby counts as not flagged.
+func (f *failover) flagged(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, failoverProbeTimeout)
+	defer cancel()
+	n, err := f.probes[1].Exists(ctx, failoverFlagKey).Result()
+	return err == nil && n == 1
+}
+
+// flag records on the standby that it has taken over.
+func (f *failover) flag(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, failoverProbeTimeout)
+	defer cancel()
+	return f.probes[1].Set(ctx, failoverFlagKey, time.Now().UTC().Format(time.RFC3339), 0).Err()
+}
+
+// OnFailover registers fn to run, in a goroutine of its own, when the
+// standby takes over. It is never called without a standby configured.
+func (s *service) OnFailover(fn func()) {
+	if s.failover == nil {
+		return
+	}
+	s.failover.mu.Lock()
+	s.failover.listeners = append(s.failover.listeners, fn)
+	s.failover.mu.Unlock()
+}
+
+// FailedOver reports whether the standby has taken over.
+func (s *service) FailedOver() bool {
+	return s.failover != nil && s.failover.active.Load()
+}
+
+// WarmStandby gives a standby that took over the running sale the minimum
+// it needs to keep taking checkouts: its remaining inventory, overall and
+// per category, the numbered items already claimed and the item metadata
+// any-available checkouts pick from. Keys the standby already holds, as a
+// replica of the primary would, are kept, so replicas warming it at once
+// cannot undo each other's checkouts. Purchase counts, holds and
+// outstanding codes are not restored.
+//
+// The item metadata is written first; the inventory and everything
+// checkouts count against are then written in one script, which does
+// nothing if the standby already holds the inventory. Replicas that already
+// follow the standby never see the sale half warmed.
+//
+// claimed counts the units taken of each item. Items sold by quantity get
+// back the units they have left, and units bought from here on are
+// numbered after the claimed ones, so they cannot repeat a unit sold
+// before the failover.
+func (s *service) WarmStandby(ctx context.Context, saleID string, remaining int, categories map[string]int, claimed map[string]int, items []ItemInfo) error {
+	inventoryKey := fmt.Sprintf("sale:%s:inventory", saleID)
+	held, err := s.client.Exists(ctx, inventoryKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to warm inventory: %w", err)
+	}
+	if held == 1 {
+		log.Printf("Standby already holds sale %s, keeping its inventory", saleID)
+		return nil
+	}
+	if err := s.SetItems(ctx, saleID, items); err != nil {
+		return err
+	}
+
+	quantities := make(map[string]int)
+	for _, item := range items {
+		if item.Quantity > 1 {
+			quantities[item.ItemID] = item.Quantity
+		}
+	}
+	claimedNumbers := []int{}
+	unitsSold := make(map[string]int, len(claimed))
+	for itemID, units := range claimed {
+		if n := ItemNumber(saleID, itemID); n > 0 && units >= max(quantities[itemID], 1) {
+			claimedNumbers = append(claimedNumbers, n)
+		}
+		unitsSold[itemID] = units
+	}
+	stock := make(map[string]int, len(quantities))
+	for itemID, quantity := range quantities {
+		stock[itemID] = max(quantity-claimed[itemID], 0)
+	}
+	if categories == nil {
+		categories = map[string]int{}
+	}
+	args := []interface{}{remaining, (time.Hour + 10*time.Minute).Milliseconds(), saleStatsTTL.Milliseconds()}
+	for _, v := range []interface{}{categories, claimedNumbers, unitsSold, stock} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		args = append(args, data)
+	}
+	keys := []string{
+		inventoryKey,
+		fmt.Sprintf("sale:%s:active", saleID),
+		fmt.Sprintf("sale:%s:category_inventory", saleID),
+		claimedItemsKey(saleID),
+		unitsSoldKey(saleID),
+		itemStockKey(saleID),
+	}
+	warmed, err := warmStandbyScript.Run(ctx, s.client, keys, args...).Int()
+	if err != nil {
+		return fmt.Errorf("failed to warm sale state: %w", err)
+	}
+	if warmed == 0 {
+		log.Printf("Standby already holds sale %s, keeping its inventory", saleID)
+		return nil
+	}
+	log.Printf("Warmed standby with sale %s: %d items left, %d claimed", saleID, remaining, len(claimed))
+	return nil
+}
+
+// MissingSaleKeys reports which of a running sale's inventory and item
+// metadata keys Redis does not hold, as "inventory" and "items", for
+// instance after a flush.
+func (s *service) MissingSaleKeys(ctx context.Context, saleID string) ([]string, error) {
+	pipe := s.client.Pipeline()
+	inventory := pipe.Exists(ctx, fmt.Sprintf("sale:%s:inventory", saleID))
+	items := pipe.Exists(ctx, fmt.Sprintf("sale:%s:items", saleID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	if inventory.Val() == 0 {
+		missing = append(missing, "inventory")
+	}
+	if items.Val() == 0 {
+		missing = append(missing, "items")
+	}
+	return missing, nil
+}
@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+)
+
+// flagsKey holds a tenant's feature flag overrides, "1" or "0" by name.
+const flagsKey = "flags"
+
+// GetFlags returns the feature flags set through the admin API.
+func (s *service) GetFlags(ctx context.Context) (map[string]bool, error) {
+	values, err := s.client.HGetAll(ctx, s.tenantKey(flagsKey)).Result()
+	if err != nil {
+		return nil, err
+	}
+	flags := make(map[string]bool, len(values))
+	for name, v := range values {
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			continue
+		}
+		flags[name] = on
+	}
+	return flags, nil
+}
+
+// SetFlag overrides a feature flag for every replica.
+func (s *service) SetFlag(ctx context.Context, name string, on bool) error {
+	return s.client.HSet(ctx, s.tenantKey(flagsKey), name, strconv.FormatBool(on)).Err()
+}
+
+// ClearFlag drops the override of a feature flag.
+func (s *service) ClearFlag(ctx context.Context, name string) error {
+	return s.client.HDel(ctx, s.tenantKey(flagsKey), name).Err()
+}
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// heatmapKey counts a sale's reservation attempts per item-number bucket.
+func heatmapKey(saleID string) string {
+	return fmt.Sprintf("sale:%s:heatmap", saleID)
+}
+
+// AddReservationAttempts adds per-bucket reservation attempt counts to a
+// sale's heatmap.
+func (s *service) AddReservationAttempts(ctx context.Context, saleID string, buckets map[int]int64) error {
+	key := heatmapKey(saleID)
+	pipe := s.client.Pipeline()
+	for bucket, n := range buckets {
+		pipe.HIncrBy(ctx, key, strconv.Itoa(bucket), n)
+	}
+	pipe.Expire(ctx, key, time.Hour+10*time.Minute)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetReservationHeatmap returns a sale's reservation attempts per bucket.
+// Buckets nobody tried are absent.
+func (s *service) GetReservationHeatmap(ctx context.Context, saleID string) (map[int]int64, error) {
+	vals, err := s.client.HGetAll(ctx, heatmapKey(saleID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	buckets := make(map[int]int64, len(vals))
+	for field, val := range vals {
+		bucket, err := strconv.Atoi(field)
+		if err != nil {
+			continue
+		}
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			continue
+		}
+		buckets[bucket] = n
+	}
+	return buckets, nil
+}
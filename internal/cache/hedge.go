@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Hedging configures WithHedging. OnHedge, when set, is called with the
+// operation's name for every second request sent.
+type Hedging struct {
+	Delay   time.Duration
+	OnHedge func(op string)
+}
+
+// hedged sends a second copy of the idempotent reads behind /sale/status
+// when the first has not answered within the hedging delay, and takes
+// whichever answers first. Each copy gets a connection of its own from the
+// pool, so one stalled connection no longer sets the tail latency of every
+// status poll.
+type hedged struct {
+	Service
+	hedging Hedging
+}
+
+// WithHedging hedges GetInventoryStatus and GetCategoryInventory of svc
+// after hedging.Delay; zero turns hedging off. Other calls go straight to
+// svc.
+func WithHedging(svc Service, hedging Hedging) Service {
+	if hedging.Delay <= 0 {
+		return svc
+	}
+	return &hedged{Service: svc, hedging: hedging}
+}
+
+func (h *hedged) ForTenant(tenant string) Service {
+	return &hedged{Service: h.Service.ForTenant(tenant), hedging: h.hedging}
+}
+
+func (h *hedged) GetInventoryStatus(ctx context.Context, saleID string) (int, error) {
+	return hedge(h, ctx, "get_inventory_status", func(ctx context.Context) (int, error) {
+		return h.Service.GetInventoryStatus(ctx, saleID)
+	})
+}
+
+func (h *hedged) GetCategoryInventory(ctx context.Context, saleID string) (map[string]int, error) {
+	return hedge(h, ctx, "get_category_inventory", func(ctx context.Context) (map[string]int, error) {
+		return h.Service.GetCategoryInventory(ctx, saleID)
+	})
+}
+
+// hedge runs fn, and runs it again if it has not returned after the
+// hedging delay. The first success wins and cancels the other; an error
+// is only returned once both copies have failed, or the caller gave up.
+func hedge[T any](h *hedged, ctx context.Context, op string, fn func(context.Context) (T, error)) (T, error) {
+	type result struct {
+		v   T
+		err error
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Buffered for both copies, so the loser never blocks.
+	results := make(chan result, 2)
+	run := func() {
+		v, err := fn(ctx)
+		results <- result{v, err}
+	}
+	go run()
+
+	timer := time.NewTimer(h.hedging.Delay)
+	defer timer.Stop()
+
+	var zero T
+	pending := 1
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			if h.hedging.OnHedge != nil {
+				h.hedging.OnHedge(op)
+			}
+			pending++
+			go run()
+		case r := <-results:
+			if r.err == nil {
+				return r.v, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			// A copy that fails before the delay is not hedged: Redis
+			// answered, it was not stalled.
+			if pending--; pending == 0 {
+				return zero, firstErr
+			}
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		}
+	}
+}
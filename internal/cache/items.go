@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ItemInfo is the display metadata of a sale item.
+type ItemInfo struct {
+	ItemID   string `json:"item_id"`
+	Name     string `json:"name"`
+	ImageURL string `json:"image_url"`
+	Category string `json:"category"`
+	// PriceMinor is the price in minor units of Currency.
+	PriceMinor int64  `json:"price_minor,omitempty"`
+	Currency   string `json:"currency,omitempty"`
+	// Rarity is read by the reservation script to enforce RARITY_LIMITS.
+	Rarity string `json:"rarity,omitempty"`
+	// Quantity is how many units of the item the sale has. Items sold one
+	// unit at a time have 0 or 1.
+	Quantity int `json:"quantity,omitempty"`
+}
+
+const itemsBatchSize = 1000
+
+// SetItems caches the metadata of a sale's items, and marks each numbered
+// item in the bitmap of its category, see categoryItemsKey.
+func (s *service) SetItems(ctx context.Context, saleID string, items []ItemInfo) error {
+	key := fmt.Sprintf("sale:%s:items", saleID)
+	categories := make(map[string]bool)
+
+	for i := 0; i < len(items); i += itemsBatchSize {
+		end := i + itemsBatchSize
+		if end > len(items) {
+			end = len(items)
+		}
+
+		pipe := s.client.Pipeline()
+		fields := make(map[string]interface{}, end-i)
+		for _, item := range items[i:end] {
+			data, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			fields[item.ItemID] = data
+			if n := ItemNumber(saleID, item.ItemID); n > 0 && item.Category != "" {
+				pipe.SetBit(ctx, categoryItemsKey(saleID, item.Category), int64(n-1), 1)
+				categories[item.Category] = true
+			}
+		}
+		pipe.HSet(ctx, key, fields)
+
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("failed to cache items: %w", err)
+		}
+	}
+
+	pipe := s.client.Pipeline()
+	pipe.Expire(ctx, key, time.Hour+10*time.Minute)
+	for category := range categories {
+		pipe.Expire(ctx, categoryItemsKey(saleID, category), time.Hour+10*time.Minute)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetItems resolves item metadata by ID. Unknown IDs are skipped, so the
+// result may be shorter than ids.
+func (s *service) GetItems(ctx context.Context, saleID string, ids ...string) ([]ItemInfo, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	key := fmt.Sprintf("sale:%s:items", saleID)
+	values, err := s.client.HMGet(ctx, key, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]ItemInfo, 0, len(values))
+	for _, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var item ItemInfo
+		if err := json.Unmarshal([]byte(data), &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
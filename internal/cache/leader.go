@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+func (s *service) AcquireLeadership(ctx context.Context, name, owner string, ttl time.Duration) (int64, bool, error) {
+	lockKey := fmt.Sprintf("leader:%s:lock", name)
+	epochKey := fmt.Sprintf("leader:%s:epoch", name)
+
+	token, err := acquireLeaderScript.Run(ctx, s.client, []string{lockKey, epochKey}, owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, false, err
+	}
+	return token, token > 0, nil
+}
+
+func (s *service) ReleaseLeadership(ctx context.Context, name, owner string) error {
+	lockKey := fmt.Sprintf("leader:%s:lock", name)
+	return releaseLeaderScript.Run(ctx, s.client, []string{lockKey}, owner).Err()
+}
+
+// ValidateFencingToken reports whether token still belongs to the current
+// leadership term. Leaders call it right before side effects that must not be
+// performed by a stale leader.
+func (s *service) ValidateFencingToken(ctx context.Context, name string, token int64) (bool, error) {
+	epochKey := fmt.Sprintf("leader:%s:epoch", name)
+	current, err := s.client.Get(ctx, epochKey).Int64()
+	if err != nil {
+		return false, err
+	}
+	return current == token, nil
+}
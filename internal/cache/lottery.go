@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// lotteryTTL outlives the sale, like its other keys.
+const lotteryTTL = time.Hour + 10*time.Minute
+
+// Lottery draw states. A sale whose draw has not started has none.
+const (
+	LotteryDrawing = "drawing"
+	LotteryDone    = "done"
+)
+
+// lotteryLossesKey counts, per user, the lotteries lost in a row. It is
+// shared by a tenant's sales so losers are favoured in the next draw, and
+// forgotten a week after the last one.
+const (
+	lotteryLossesKey = "lottery:losses"
+	lotteryLossesTTL = 7 * 24 * time.Hour
+)
+
+// LotteryResult is what a lottery entrant drew. Losers have no code.
+type LotteryResult struct {
+	Won       bool      `json:"won"`
+	Code      string    `json:"code,omitempty"`
+	ItemID    string    `json:"item_id,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+func lotteryEntriesKey(saleID string) string {
+	return fmt.Sprintf("sale:%s:lottery_entries", saleID)
+}
+
+func lotteryResultsKey(saleID string) string {
+	return fmt.Sprintf("sale:%s:lottery_results", saleID)
+}
+
+func lotteryDrawKey(saleID string) string {
+	return fmt.Sprintf("sale:%s:lottery_draw", saleID)
+}
+
+// EnterLottery enters a user into a sale's lottery. Entering again is a
+// no-op, so retries gain nothing; it reports whether the entry is new.
+func (s *service) EnterLottery(ctx context.Context, saleID, userID string) (bool, error) {
+	pipe := s.client.TxPipeline()
+	entered := pipe.HSetNX(ctx, lotteryEntriesKey(saleID), userID, time.Now().UnixMilli())
+	pipe.Expire(ctx, lotteryEntriesKey(saleID), lotteryTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	return entered.Val(), nil
+}
+
+// IsLotteryEntrant reports whether a user entered a sale's lottery.
+func (s *service) IsLotteryEntrant(ctx context.Context, saleID, userID string) (bool, error) {
+	return s.client.HExists(ctx, lotteryEntriesKey(saleID), userID).Result()
+}
+
+// GetLotteryEntrants returns every entrant of a sale's lottery with the
+// number of lotteries each lost in a row before it.
+func (s *service) GetLotteryEntrants(ctx context.Context, saleID string) (map[string]int, error) {
+	users, err := s.client.HKeys(ctx, lotteryEntriesKey(saleID)).Result()
+	if err != nil || len(users) == 0 {
+		return nil, err
+	}
+	losses, err := s.client.HMGet(ctx, s.tenantKey(lotteryLossesKey), users...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entrants := make(map[string]int, len(users))
+	for i, user := range users {
+		str, _ := losses[i].(string)
+		entrants[user], _ = strconv.Atoi(str)
+	}
+	return entrants, nil
+}
+
+// ClaimLotteryDraw marks a sale's lottery as being drawn for up to ttl. It
+// reports false when the draw was already claimed, by this or another
+// replica. A draw that is not saved within ttl can be claimed again.
+func (s *service) ClaimLotteryDraw(ctx context.Context, saleID string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, lotteryDrawKey(saleID), LotteryDrawing, ttl).Result()
+}
+
+// GetLotteryDrawState returns LotteryDrawing, LotteryDone, or "" for a
+// draw that has not started.
+func (s *service) GetLotteryDrawState(ctx context.Context, saleID string) (string, error) {
+	state, err := s.client.Get(ctx, lotteryDrawKey(saleID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return state, err
+}
+
+// SaveLotteryWin records a winner's result as soon as it is drawn, so a
+// draw that fails partway and is drawn again skips them instead of
+// reserving them a second item. It reports false, and changes nothing,
+// when the user already has a result.
+func (s *service) SaveLotteryWin(ctx context.Context, saleID, userID string, result *LotteryResult) (bool, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return false, err
+	}
+	pipe := s.client.TxPipeline()
+	saved := pipe.HSetNX(ctx, lotteryResultsKey(saleID), userID, data)
+	pipe.Expire(ctx, lotteryResultsKey(saleID), lotteryTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	return saved.Val(), nil
+}
+
+// GetLotteryResults returns the results recorded so far of a sale's
+// lottery, by user.
+func (s *service) GetLotteryResults(ctx context.Context, saleID string) (map[string]*LotteryResult, error) {
+	fields, err := s.client.HGetAll(ctx, lotteryResultsKey(saleID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[string]*LotteryResult, len(fields))
+	for user, data := range fields {
+		var result LotteryResult
+		if err := json.Unmarshal([]byte(data), &result); err != nil {
+			return nil, err
+		}
+		results[user] = &result
+	}
+	return results, nil
+}
+
+// SaveLotteryResults records the draw of a sale: every entrant's result,
+// and the losing streaks winners end and losers extend. Results already
+// recorded, see SaveLotteryWin, are kept. The draw is then done.
+func (s *service) SaveLotteryResults(ctx context.Context, saleID string, results map[string]*LotteryResult) error {
+	fields := make(map[string]interface{}, len(results))
+	for user, result := range results {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		fields[user] = data
+	}
+
+	pipe := s.client.TxPipeline()
+	if len(fields) > 0 {
+		for user, data := range fields {
+			pipe.HSetNX(ctx, lotteryResultsKey(saleID), user, data)
+		}
+		pipe.Expire(ctx, lotteryResultsKey(saleID), lotteryTTL)
+	}
+	lossesKey := s.tenantKey(lotteryLossesKey)
+	for user, result := range results {
+		if result.Won {
+			pipe.HDel(ctx, lossesKey, user)
+		} else {
+			pipe.HIncrBy(ctx, lossesKey, user, 1)
+		}
+	}
+	pipe.Expire(ctx, lossesKey, lotteryLossesTTL)
+	pipe.Set(ctx, lotteryDrawKey(saleID), LotteryDone, lotteryTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetLotteryResult returns a user's draw. It returns redis.Nil until the
+// user is drawn, and for users who did not enter it.
+func (s *service) GetLotteryResult(ctx context.Context, saleID, userID string) (*LotteryResult, error) {
+	data, err := s.client.HGet(ctx, lotteryResultsKey(saleID), userID).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var result LotteryResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
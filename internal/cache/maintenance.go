@@ -0,0 +1,194 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	lastKeyAuditKey = "maintenance:last_audit"
+	auditScanCount  = 1000
+)
+
+// expiringPrefixes are key families that must always carry a TTL. Anything
+// else (leader locks, queues, the staged catalog) is meant to persist.
+var expiringPrefixes = []string{"sale:", "checkout_code:", "checkout_done:", "purchase:", "rate_limit:"}
+
+// KeyAuditOptions tunes AuditKeys.
+type KeyAuditOptions struct {
+	// PurgeSale reports whether all keys of a sale can be deleted. It is
+	// asked once per sale ID seen.
+	PurgeSale func(saleID string) bool
+	// DefaultTTL is applied to keys that should expire but have no TTL.
+	DefaultTTL time.Duration
+	// SampleEvery measures MEMORY USAGE of one key in this many.
+	SampleEvery int
+}
+
+// PrefixUsage is the audit result for one key family.
+type PrefixUsage struct {
+	Keys           int64 `json:"keys"`
+	SampledKeys    int64 `json:"sampled_keys"`
+	EstimatedBytes int64 `json:"estimated_bytes"`
+	TTLApplied     int64 `json:"ttl_applied"`
+	Deleted        int64 `json:"deleted"`
+}
+
+// KeyAudit summarizes one pass over the keyspace.
+type KeyAudit struct {
+	StartedAt      time.Time               `json:"started_at"`
+	DurationMs     int64                   `json:"duration_ms"`
+	Keys           int64                   `json:"keys"`
+	EstimatedBytes int64                   `json:"estimated_bytes"`
+	Prefixes       map[string]*PrefixUsage `json:"prefixes"`
+}
+
+// AuditKeys walks the keyspace with SCAN, deletes keys of sales that
+// opts.PurgeSale releases, gives missing TTLs to keys that should expire,
+// and estimates memory per key family from sampled MEMORY USAGE. The
+// result is also stored for GetLastKeyAudit.
+func (s *service) AuditKeys(ctx context.Context, opts KeyAuditOptions) (*KeyAudit, error) {
+	audit := &KeyAudit{StartedAt: time.Now(), Prefixes: map[string]*PrefixUsage{}}
+	sampledBytes := map[string]int64{}
+	purge := map[string]bool{}
+
+	var cursor uint64
+	for {
+		keys, next, err := s.client.Scan(ctx, cursor, "*", auditScanCount).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		ttls := make([]*redis.DurationCmd, len(keys))
+		pipe := s.client.Pipeline()
+		for i, key := range keys {
+			ttls[i] = pipe.TTL(ctx, key)
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+
+		pipe = s.client.Pipeline()
+		usage := map[string]*redis.IntCmd{}
+		for i, key := range keys {
+			prefix := keyPrefix(key)
+			stats, ok := audit.Prefixes[prefix]
+			if !ok {
+				stats = &PrefixUsage{}
+				audit.Prefixes[prefix] = stats
+			}
+			stats.Keys++
+			audit.Keys++
+
+			if saleID, ok := saleOfKey(key); ok && opts.PurgeSale != nil {
+				doPurge, seen := purge[saleID]
+				if !seen {
+					doPurge = opts.PurgeSale(saleID)
+					purge[saleID] = doPurge
+				}
+				if doPurge {
+					pipe.Unlink(ctx, key)
+					stats.Deleted++
+					continue
+				}
+			}
+
+			// TTL reports -1 for a key without expiry.
+			if ttls[i].Val() == -1 && mustExpire(key) && opts.DefaultTTL > 0 {
+				pipe.Expire(ctx, key, opts.DefaultTTL)
+				stats.TTLApplied++
+			}
+
+			if opts.SampleEvery > 0 && (stats.Keys-1)%int64(opts.SampleEvery) == 0 {
+				usage[prefix+"\x00"+key] = pipe.MemoryUsage(ctx, key)
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+
+		for id, cmd := range usage {
+			prefix, _, _ := strings.Cut(id, "\x00")
+			if n, err := cmd.Result(); err == nil {
+				audit.Prefixes[prefix].SampledKeys++
+				sampledBytes[prefix] += n
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	for prefix, stats := range audit.Prefixes {
+		if stats.SampledKeys > 0 {
+			kept := stats.Keys - stats.Deleted
+			stats.EstimatedBytes = sampledBytes[prefix] / stats.SampledKeys * kept
+			audit.EstimatedBytes += stats.EstimatedBytes
+		}
+	}
+	audit.DurationMs = time.Since(audit.StartedAt).Milliseconds()
+
+	if data, err := json.Marshal(audit); err == nil {
+		s.client.Set(ctx, lastKeyAuditKey, data, 0)
+	}
+	return audit, nil
+}
+
+// GetLastKeyAudit returns the result of the most recent AuditKeys run on any
+// replica. It returns redis.Nil before the first audit.
+func (s *service) GetLastKeyAudit(ctx context.Context) (*KeyAudit, error) {
+	data, err := s.client.Get(ctx, lastKeyAuditKey).Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var audit KeyAudit
+	if err := json.Unmarshal(data, &audit); err != nil {
+		return nil, err
+	}
+	return &audit, nil
+}
+
+// keyPrefix groups a key into its family: "sale:<id>:user_codes:<user>"
+// becomes "sale:*:user_codes", "checkout_code:<code>" becomes
+// "checkout_code:*".
+func keyPrefix(key string) string {
+	parts := strings.Split(key, ":")
+	if len(parts) >= 3 && parts[0] == "sale" {
+		return "sale:*:" + parts[2]
+	}
+	if len(parts) >= 2 {
+		if parts[0] == "sale" || parts[0] == "catalog" || parts[0] == "maintenance" {
+			return key
+		}
+		return parts[0] + ":*"
+	}
+	return key
+}
+
+// saleOfKey extracts the sale ID of a sale-scoped key.
+func saleOfKey(key string) (string, bool) {
+	parts := strings.SplitN(key, ":", 3)
+	if len(parts) == 3 && parts[0] == "sale" {
+		return parts[1], true
+	}
+	return "", false
+}
+
+func mustExpire(key string) bool {
+	if key == "sale:current" {
+		return false
+	}
+	for _, prefix := range expiringPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,13 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ClaimNonce records nonce for ttl and reports whether it was unused, so a
+// signed admin request cannot be replayed within its validity window.
+func (s *service) ClaimNonce(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, fmt.Sprintf("admin:nonce:%s", nonce), 1, ttl).Result()
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	notificationsStream = "notifications:events"
+	notificationsGroup  = "notifiers"
+
+	// notificationsMaxLen caps the stream; acknowledged entries are trimmed
+	// away as new ones arrive.
+	notificationsMaxLen = 100000
+)
+
+// Notification is one entry of the notifications stream.
+type Notification struct {
+	ID      string
+	Payload []byte
+}
+
+func (s *service) PublishNotification(ctx context.Context, payload []byte) error {
+	return s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: notificationsStream,
+		MaxLen: notificationsMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"event": payload},
+	}).Err()
+}
+
+// EnsureNotificationGroup creates the consumer group (and the stream) if
+// they do not exist yet.
+func (s *service) EnsureNotificationGroup(ctx context.Context) error {
+	err := s.client.XGroupCreateMkStream(ctx, notificationsStream, notificationsGroup, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// ReadNotifications blocks up to block for new entries delivered to
+// consumer. It returns redis.Nil when nothing arrived.
+func (s *service) ReadNotifications(ctx context.Context, consumer string, count int64, block time.Duration) ([]Notification, error) {
+	streams, err := s.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    notificationsGroup,
+		Consumer: consumer,
+		Streams:  []string{notificationsStream, ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Notification
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			payload, _ := msg.Values["event"].(string)
+			out = append(out, Notification{ID: msg.ID, Payload: []byte(payload)})
+		}
+	}
+	return out, nil
+}
+
+func (s *service) AckNotification(ctx context.Context, id string) error {
+	return s.client.XAck(ctx, notificationsStream, notificationsGroup, id).Err()
+}
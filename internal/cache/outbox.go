@@ -0,0 +1,31 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// outboxMarkerTTL is how long a published outbox event is remembered. It
+// only has to outlive the relay's lease and the write that marks the event
+// published in Postgres.
+const outboxMarkerTTL = 24 * time.Hour
+
+func outboxMarkerKey(id int64) string {
+	return fmt.Sprintf("outbox:published:%d", id)
+}
+
+// PublishOutboxEvent publishes outbox event id: notification, unless
+// empty, to the notifications stream, and deliveries to the webhook
+// schedule, due at once. It runs as one script that also sets the event's
+// marker, so an event the relay claims again after publishing it, because
+// Postgres did not hear back, is skipped and reported false.
+func (s *service) PublishOutboxEvent(ctx context.Context, id int64, notification []byte, deliveries []WebhookDelivery) (bool, error) {
+	keys := []string{outboxMarkerKey(id), notificationsStream, webhookScheduleKey, webhookPayloadsKey}
+	args := []interface{}{outboxMarkerTTL.Milliseconds(), notification, notificationsMaxLen, time.Now().UnixMilli()}
+	for _, d := range deliveries {
+		args = append(args, d.ID, d.Payload)
+	}
+	published, err := publishOutboxScript.Run(ctx, s.client, keys, args...).Int()
+	return published == 1, err
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Outcomes of the reservation script that are not refusals.
+const (
+	ReservationSuccess = "success"
+	// ReservationError is a reservation the script never answered, such
+	// as after a Redis timeout.
+	ReservationError = "error"
+)
+
+// reservationRefusals maps each refusal of the reservation script to the
+// error ReserveItem returns for it.
+var reservationRefusals = map[string]string{
+	"sale_closing":          "sale closing",
+	"unknown_user":          "unknown user",
+	"user_limit_exceeded":   "user limit exceeded",
+	"rarity_limit_exceeded": "rarity limit exceeded",
+	"too_many_outstanding":  "too many outstanding codes",
+	"sold_out":              "sold out",
+	"category_sold_out":     "category sold out",
+	"unknown_category":      "unknown category",
+	"category_mismatch":     "item not in category",
+	"already_reserved_item": "item already reserved",
+	"promo_invalid":         "invalid promo code",
+	"promo_expired":         "promo code expired",
+	"promo_exhausted":       "promo code exhausted",
+	"items_not_numbered":    "items not numbered",
+}
+
+// reservationOutcomesKey counts how the reservation script answered in a
+// sale, one field per outcome.
+func reservationOutcomesKey(saleID string) string {
+	return fmt.Sprintf("sale:%s:reserve_outcomes", saleID)
+}
+
+// ReservationOutcome names the script outcome behind what ReserveItem
+// returned: ReservationSuccess, the script's refusal, or ReservationError.
+func ReservationOutcome(err error) string {
+	if err == nil {
+		return ReservationSuccess
+	}
+	for status, message := range reservationRefusals {
+		if err.Error() == message {
+			return status
+		}
+	}
+	return ReservationError
+}
+
+// ReservationOutcomes returns how many times the reservation script of a
+// sale answered with each outcome, on every replica. Codes drawn again
+// because the first was in use are not counted, and a checkout retried
+// after its user was registered counts twice.
+func (s *service) ReservationOutcomes(ctx context.Context, saleID string) (map[string]int64, error) {
+	fields, err := s.client.HGetAll(ctx, reservationOutcomesKey(saleID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	outcomes := make(map[string]int64, len(fields))
+	for status, n := range fields {
+		count, err := strconv.ParseInt(n, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed count of reservation outcome %q: %w", status, err)
+		}
+		outcomes[status] = count
+	}
+	return outcomes, nil
+}
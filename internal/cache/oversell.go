@@ -0,0 +1,31 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// oversellBufferKey holds how many units the reservation script lets a
+// sale's inventory go below zero; missing means none.
+func oversellBufferKey(saleID string) string {
+	return fmt.Sprintf("sale:%s:oversell_buffer", saleID)
+}
+
+// SetOversellBuffer lets the reservation script take up to buffer units
+// beyond a sale's stock, for merchants that expect some buyers not to pay.
+// It applies to the next checkout on every replica.
+func (s *service) SetOversellBuffer(ctx context.Context, saleID string, buffer int) error {
+	return s.client.Set(ctx, oversellBufferKey(saleID), buffer, time.Hour+10*time.Minute).Err()
+}
+
+// GetOversellBuffer returns a sale's oversell buffer, 0 when it has none.
+func (s *service) GetOversellBuffer(ctx context.Context, saleID string) (int, error) {
+	buffer, err := s.client.Get(ctx, oversellBufferKey(saleID)).Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return buffer, err
+}
@@ -0,0 +1,229 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	PurchasePending   = "pending"
+	PurchaseConfirmed = "confirmed"
+	PurchaseFailed    = "failed"
+
+	pendingPurchasesKey = "purchases:pending"
+	// A dequeued purchase moves to the processing list, and is leased in
+	// the leases sorted set, until its worker acknowledges it.
+	processingPurchasesKey = "purchases:processing"
+	purchaseLeasesKey      = "purchases:leases"
+	pendingPurchaseTTL     = time.Hour + 10*time.Minute
+)
+
+// PendingPurchase is a redeemed checkout code waiting for payment
+// confirmation in two-phase purchase mode.
+type PendingPurchase struct {
+	PurchaseID  string `json:"purchase_id"`
+	Code        string `json:"code"`
+	SaleID      string `json:"sale_id"`
+	UserID      string `json:"user_id"`
+	ItemID      string `json:"item_id"`
+	Unit        int    `json:"unit,omitempty"`
+	RecipientID string `json:"recipient_id,omitempty"`
+	Category    string `json:"category,omitempty"`
+	PromoCode   string `json:"promo_code,omitempty"`
+	PercentOff  int    `json:"percent_off,omitempty"`
+	// Tenant owns the sale; empty for the default tenant.
+	Tenant string `json:"tenant,omitempty"`
+	// Traceparent and CorrelationID carry the purchase request's trace to
+	// the payments worker.
+	Traceparent   string    `json:"traceparent,omitempty"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	Status        string    `json:"status"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	// Settled is set once the worker has recorded the purchase's final
+	// state elsewhere, see SettlePurchase.
+	Settled bool `json:"settled,omitempty"`
+}
+
+// Owner is who the purchase counts against: the recipient of a gift,
+// otherwise the buyer.
+func (p *PendingPurchase) Owner() string {
+	if p.RecipientID != "" {
+		return p.RecipientID
+	}
+	return p.UserID
+}
+
+func (s *service) EnqueuePendingPurchase(ctx context.Context, p *PendingPurchase) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, fmt.Sprintf("purchase:%s", p.PurchaseID), data, pendingPurchaseTTL)
+	pipe.RPush(ctx, pendingPurchasesKey, p.PurchaseID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// DequeuePendingPurchase blocks up to timeout for the next purchase awaiting
+// payment and leases it for lease. It returns redis.Nil when the queue
+// stayed empty. The purchase stays on the processing list until
+// AckPendingPurchase; if the worker dies first, RequeueStalePurchases puts
+// it back once the lease runs out, so every purchase is processed at least
+// once.
+func (s *service) DequeuePendingPurchase(ctx context.Context, timeout, lease time.Duration) (*PendingPurchase, error) {
+	purchaseID, err := s.client.BLMove(ctx, pendingPurchasesKey, processingPurchasesKey, "LEFT", "RIGHT", timeout).Result()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.client.ZAdd(ctx, purchaseLeasesKey, redis.Z{Score: float64(time.Now().Add(lease).UnixMilli()), Member: purchaseID}).Err(); err != nil {
+		return nil, err
+	}
+
+	p, err := s.GetPendingPurchase(ctx, purchaseID)
+	if errors.Is(err, redis.Nil) {
+		// The purchase expired while queued; nothing is left to process.
+		if err := s.AckPendingPurchase(ctx, purchaseID); err != nil {
+			return nil, err
+		}
+	}
+	return p, err
+}
+
+// AckPendingPurchase takes a processed purchase off the processing list.
+func (s *service) AckPendingPurchase(ctx context.Context, purchaseID string) error {
+	pipe := s.client.TxPipeline()
+	pipe.LRem(ctx, processingPurchasesKey, 1, purchaseID)
+	pipe.ZRem(ctx, purchaseLeasesKey, purchaseID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RequeueStalePurchases puts purchases whose lease ran out back on the
+// pending queue and returns how many. A purchase moved by a worker that
+// died before leasing it is leased for lease first, and requeued once that
+// runs out.
+func (s *service) RequeueStalePurchases(ctx context.Context, lease time.Duration) (int, error) {
+	now := time.Now()
+	return requeuePurchasesScript.Run(ctx, s.client, []string{processingPurchasesKey, pendingPurchasesKey, purchaseLeasesKey},
+		now.UnixMilli(), now.Add(lease).UnixMilli()).Int()
+}
+
+func (s *service) GetPendingPurchase(ctx context.Context, purchaseID string) (*PendingPurchase, error) {
+	data, err := s.client.Get(ctx, fmt.Sprintf("purchase:%s", purchaseID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var p PendingPurchase
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *service) SetPurchaseStatus(ctx context.Context, p *PendingPurchase, status string) error {
+	p.Status = status
+	p.UpdatedAt = time.Now()
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, fmt.Sprintf("purchase:%s", p.PurchaseID), data, pendingPurchaseTTL).Err()
+}
+
+// FailPurchase records that a purchase's payment failed and releases its
+// reservation, see ReleaseReservation, in one transaction, so a failed
+// purchase is released exactly once however often it is processed.
+func (s *service) FailPurchase(ctx context.Context, p *PendingPurchase) error {
+	p.Status = PurchaseFailed
+	p.UpdatedAt = time.Now()
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, fmt.Sprintf("purchase:%s", p.PurchaseID), data, pendingPurchaseTTL)
+	s.releaseReservation(ctx, pipe, p.SaleID, p.Owner(), p.ItemID, p.Category, p.PromoCode)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// SettlePurchase marks a confirmed or failed purchase settled once its
+// final state has been recorded, so a purchase requeued after that is not
+// recorded again. UpdatedAt, which its receipt is signed with, is kept.
+func (s *service) SettlePurchase(ctx context.Context, p *PendingPurchase) error {
+	p.Settled = true
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, fmt.Sprintf("purchase:%s", p.PurchaseID), data, pendingPurchaseTTL).Err()
+}
+
+// ReleaseReservation gives an item back to the sale and uncounts it from
+// the user, from the user's rarity tier and from the promo code it used,
+// for purchases whose payment failed. The item's hold is dropped and a
+// numbered item is unclaimed too, so the item shows as available and
+// any-available checkouts can pick it again.
+func (s *service) ReleaseReservation(ctx context.Context, saleID, userID, itemID, category, promoCode string) error {
+	pipe := s.client.TxPipeline()
+	s.releaseReservation(ctx, pipe, saleID, userID, itemID, category, promoCode)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RevokePurchase gives a sold item back to the sale as ReleaseReservation
+// does, counting it back into the category its metadata names, and clears
+// its bit in the sold bitmap so it no longer shows as sold.
+func (s *service) RevokePurchase(ctx context.Context, saleID, userID, itemID, promoCode string) error {
+	category := ""
+	if items, err := s.GetItems(ctx, saleID, itemID); err == nil && len(items) == 1 {
+		category = items[0].Category
+	}
+
+	pipe := s.client.TxPipeline()
+	s.releaseReservation(ctx, pipe, saleID, userID, itemID, category, promoCode)
+	if n := ItemNumber(saleID, itemID); n > 0 {
+		unclaimItemScript.Eval(ctx, pipe, []string{fmt.Sprintf("sale:%s:sold_bitmap", saleID)}, n-1)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// releaseReservation queues the writes of ReleaseReservation on pipe.
+func (s *service) releaseReservation(ctx context.Context, pipe redis.Pipeliner, saleID, userID, itemID, category, promoCode string) {
+	tier := "common"
+	if items, err := s.GetItems(ctx, saleID, itemID); err == nil && len(items) == 1 && items[0].Rarity != "" {
+		tier = items[0].Rarity
+	}
+
+	pipe.Incr(ctx, fmt.Sprintf("sale:%s:inventory", saleID))
+	if n := ItemNumber(saleID, itemID); n > 0 {
+		// SETBIT would recreate an expired bitmap without its TTL.
+		unclaimItemScript.Eval(ctx, pipe, []string{claimedItemsKey(saleID)}, n-1)
+	}
+	pipe.HDel(ctx, itemHoldsKey(saleID), itemID)
+	// Only an item sold by quantity gets its unit back; HINCRBY would add
+	// any other to its stock.
+	restockItemScript.Eval(ctx, pipe, []string{itemStockKey(saleID)}, itemID)
+	if category != "" {
+		pipe.HIncrBy(ctx, fmt.Sprintf("sale:%s:category_inventory", saleID), category, 1)
+	}
+	pipe.HIncrBy(ctx, fmt.Sprintf("sale:%s:user_purchases", saleID), userID, -1)
+	pipe.HIncrBy(ctx, tierPurchasesKey(saleID), tier+":"+userID, -1)
+	if promoCode != "" {
+		// Only a live code is credited back; HINCRBY would recreate an
+		// expired one without its TTL.
+		unredeemPromoScript.Eval(ctx, pipe, []string{s.promoKey(promoCode)})
+	}
+}
@@ -0,0 +1,32 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Prewarm opens the pool's MinIdleConns connections at once and loads
+// the Lua scripts, so the first requests of a sale neither dial Redis nor
+// meet NOSCRIPT. It returns how many connections it opened. The client
+// fills its idle pool in the background anyway; this waits for it.
+func (s *service) Prewarm(ctx context.Context) (int, error) {
+	n := s.client.Options().MinIdleConns
+	conns := make([]*redis.Conn, 0, n)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	// Holding every connection until the end makes the pool hand out a
+	// distinct one each time, dialing those it has not opened yet.
+	for range n {
+		conn := s.client.Conn()
+		conns = append(conns, conn)
+		if err := conn.Ping(ctx).Err(); err != nil {
+			return len(conns) - 1, err
+		}
+	}
+	return len(conns), s.loadScripts(ctx)
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Promo is a promo code as ReserveItem sees it.
+type Promo struct {
+	Code       string
+	PercentOff int
+	// MaxRedemptions caps uses; 0 is unlimited.
+	MaxRedemptions int
+	// ExpiresAt is zero for codes that never expire.
+	ExpiresAt time.Time
+}
+
+// promoRetention keeps an expired code's counter around for reporting.
+const promoRetention = 24 * time.Hour
+
+func (s *service) promoKey(code string) string {
+	return s.tenantKey(fmt.Sprintf("promo:%s", code))
+}
+
+// SetPromo publishes a promo code to ReserveItem. The redemption counter
+// starts at zero and is never reset by republishing.
+func (s *service) SetPromo(ctx context.Context, p *Promo) error {
+	key := s.promoKey(p.Code)
+	var expiresMs int64
+	if !p.ExpiresAt.IsZero() {
+		expiresMs = p.ExpiresAt.UnixMilli()
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.HSet(ctx, key, "percent_off", p.PercentOff, "max_redemptions", p.MaxRedemptions, "expires_at_ms", expiresMs)
+	pipe.HSetNX(ctx, key, "redeemed", 0)
+	if expiresMs > 0 {
+		pipe.PExpireAt(ctx, key, p.ExpiresAt.Add(promoRetention))
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetPromoRedemptions returns how many times each code has been redeemed.
+// Codes Redis does not know are left out.
+func (s *service) GetPromoRedemptions(ctx context.Context, codes ...string) (map[string]int, error) {
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(codes))
+	for i, code := range codes {
+		cmds[i] = pipe.HGet(ctx, s.promoKey(code), "redeemed")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	redeemed := make(map[string]int, len(codes))
+	for i, code := range codes {
+		if n, err := strconv.Atoi(cmds[i].Val()); err == nil {
+			redeemed[code] = n
+		}
+	}
+	return redeemed, nil
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"flash_sale_contest/internal/codes"
+)
+
+// queueTTL outlives the sale, like its other keys.
+const queueTTL = time.Hour + 10*time.Minute
+
+// JoinQueue gives a user a place in a sale's waiting queue and a token to
+// poll it with. A user who already queued keeps their place, so retrying
+// never moves anyone back. Places are numbered from 1 in arrival order.
+func (s *service) JoinQueue(ctx context.Context, saleID, userID string) (string, int64, error) {
+	keys := []string{
+		fmt.Sprintf("sale:%s:queue_users", saleID),
+		queueKey(saleID),
+		fmt.Sprintf("sale:%s:queue_seq", saleID),
+	}
+	result, err := joinQueueScript.Run(ctx, s.client, keys, userID, codes.NewID(), queueTTL.Milliseconds()).Slice()
+	if err != nil {
+		return "", 0, err
+	}
+
+	token, _ := result[0].(string)
+	placeStr, _ := result[1].(string)
+	place, err := strconv.ParseInt(placeStr, 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("queue entry of user %s has no place", userID)
+	}
+	return token, place, nil
+}
+
+// QueuePlace looks up a queue token's place. It returns redis.Nil for
+// tokens the sale never issued.
+func (s *service) QueuePlace(ctx context.Context, saleID, token string) (int64, error) {
+	score, err := s.client.ZScore(ctx, queueKey(saleID), token).Result()
+	if err != nil {
+		return 0, err
+	}
+	return int64(score), nil
+}
+
+func queueKey(saleID string) string {
+	return fmt.Sprintf("sale:%s:queue", saleID)
+}
@@ -2,81 +2,369 @@ package cache
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"slices"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+
+	"flash_sale_contest/internal/codes"
+	"flash_sale_contest/internal/config"
 )
 
 const (
-	codeExpiryTime  = 5 * time.Minute
-	maxRetries      = 3
+	maxRetries = 3
+
+	// currentSaleKey points every replica at the running sale.
+	currentSaleKey = "sale:current"
 )
 
 type CheckoutInfo struct {
 	UserID    string    `json:"user_id"`
 	ItemID    string    `json:"item_id"`
 	SaleID    string    `json:"sale_id"`
+	Category  string    `json:"category,omitempty"`
 	ExpiresAt time.Time `json:"expires_at"`
+	// PromoCode is the promo code redeemed with this checkout, worth
+	// PercentOff off the item's price.
+	PromoCode  string `json:"promo_code,omitempty"`
+	PercentOff int    `json:"percent_off,omitempty"`
+	// Extended is set once the code was extended; see ExtendCheckout.
+	Extended bool `json:"extended,omitempty"`
+	// Unit is which unit of the item the code bought, counted from 1, and
+	// RecipientID who it was bought for as a gift. Both are only known
+	// once CompletePurchase has redeemed the code.
+	Unit        int    `json:"unit,omitempty"`
+	RecipientID string `json:"recipient_id,omitempty"`
+	// PurchaseID and PurchasedAt identify the purchase the code was
+	// redeemed for. Replayed is set when the code had already been
+	// redeemed, by an earlier try of the same purchase. They are kept in
+	// the purchase's completion record, not the code's payload.
+	PurchaseID  string    `json:"-"`
+	PurchasedAt time.Time `json:"-"`
+	Replayed    bool      `json:"-"`
+}
+
+// Owner is who the purchase counts against: the recipient of a gift,
+// otherwise the buyer.
+func (c *CheckoutInfo) Owner() string {
+	if c.RecipientID != "" {
+		return c.RecipientID
+	}
+	return c.UserID
 }
 
 type Service interface {
 	Health() map[string]string
 	Close() error
+	Prewarm(ctx context.Context) (int, error)
 	GetClient() *redis.Client
-	InitializeSale(ctx context.Context, saleID string, totalItems int) error
-	ReserveItem(ctx context.Context, saleID, userID, itemID string) (string, error)
-	VerifyAndPurchase(ctx context.Context, code string) (*CheckoutInfo, error)
+	ForTenant(tenant string) Service
+	OnFailover(fn func())
+	FailedOver() bool
+	WarmStandby(ctx context.Context, saleID string, remaining int, categories map[string]int, claimed map[string]int, items []ItemInfo) error
+	MissingSaleKeys(ctx context.Context, saleID string) ([]string, error)
+	DeleteSandboxSale(ctx context.Context, saleID string) (int, error)
+	ExtendSaleKeys(ctx context.Context, saleID string, by time.Duration) (int, error)
+	InitializeSale(ctx context.Context, saleID string, totalItems int, categoryCounts map[string]int) error
+	ReserveItem(ctx context.Context, saleID, userID, itemID, category, promoCode string, ttl time.Duration) (*Reservation, error)
+	CompletePurchase(ctx context.Context, saleID, code, recipientID string) (*CheckoutInfo, error)
+	ExtendCheckout(ctx context.Context, saleID, code string, window, by time.Duration) (*CheckoutInfo, error)
 	GetUserPurchaseCount(ctx context.Context, saleID, userID string) (int, error)
-	IncrementUserPurchase(ctx context.Context, saleID, userID string) error
+	GetUserPurchaseCounts(ctx context.Context, saleID string, userIDs ...string) (map[string]int, error)
 	GetInventoryStatus(ctx context.Context, saleID string) (int, error)
+	GetCategoryInventory(ctx context.Context, saleID string) (map[string]int, error)
+	ApplyFallbackPurchase(ctx context.Context, saleID, userID, itemID string) (bool, error)
 	CleanupExpiredCodes(ctx context.Context, saleID string) error
 	SetShowcaseInfo(ctx context.Context, saleID string, info *ShowcaseInfo) error
 	GetShowcaseInfo(ctx context.Context, saleID string) (*ShowcaseInfo, error)
+	SetStaffPicks(ctx context.Context, saleID string, itemIDs []string) error
+	GetStaffPicks(ctx context.Context, saleID string) ([]string, error)
+	RecordItemView(ctx context.Context, saleID, itemID string) error
+	MostViewedItems(ctx context.Context, saleID string, n int) ([]string, error)
+	TrendingItems(ctx context.Context, saleID string, n int) ([]ItemViews, error)
 	MarkItemAsSold(ctx context.Context, saleID string, itemNumber int) error
+	SoldItemNumbers(ctx context.Context, saleID string) ([]int, error)
+	EnqueuePendingPurchase(ctx context.Context, p *PendingPurchase) error
+	DequeuePendingPurchase(ctx context.Context, timeout, lease time.Duration) (*PendingPurchase, error)
+	AckPendingPurchase(ctx context.Context, purchaseID string) error
+	RequeueStalePurchases(ctx context.Context, lease time.Duration) (int, error)
+	GetPendingPurchase(ctx context.Context, purchaseID string) (*PendingPurchase, error)
+	SetPurchaseStatus(ctx context.Context, p *PendingPurchase, status string) error
+	FailPurchase(ctx context.Context, p *PendingPurchase) error
+	SettlePurchase(ctx context.Context, p *PendingPurchase) error
+	ReleaseReservation(ctx context.Context, saleID, userID, itemID, category, promoCode string) error
+	RevokePurchase(ctx context.Context, saleID, userID, itemID, promoCode string) error
+	ListReservations(ctx context.Context, saleID, userID string) ([]Reservation, error)
+	PublishNotification(ctx context.Context, payload []byte) error
+	EnsureNotificationGroup(ctx context.Context) error
+	ReadNotifications(ctx context.Context, consumer string, count int64, block time.Duration) ([]Notification, error)
+	AckNotification(ctx context.Context, id string) error
+	ScheduleWebhook(ctx context.Context, id string, payload []byte, at time.Time) error
+	ClaimWebhooks(ctx context.Context, lease time.Duration, n int) ([]WebhookDelivery, error)
+	CompleteWebhook(ctx context.Context, id string) error
+	WebhookBacklog(ctx context.Context) (int64, error)
+	GetFlags(ctx context.Context) (map[string]bool, error)
+	SetFlag(ctx context.Context, name string, on bool) error
+	ClearFlag(ctx context.Context, name string) error
+	AppendCheckoutAttempts(ctx context.Context, payloads [][]byte) error
+	EnsureCheckoutAttemptGroup(ctx context.Context) error
+	ReadCheckoutAttempts(ctx context.Context, consumer string, count int64, block time.Duration) ([]CheckoutAttemptEntry, error)
+	AckCheckoutAttempts(ctx context.Context, ids []string) error
+	CheckoutAttemptBacklog(ctx context.Context) (int64, error)
+	PublishUserEvent(ctx context.Context, userID string, payload []byte) error
+	SubscribeUserEvents(ctx context.Context, userID string) *redis.PubSub
+	PushDeadLetter(ctx context.Context, d *DeadLetter) error
+	PopDeadLetter(ctx context.Context) (*DeadLetter, error)
+	ListDeadLetters(ctx context.Context, offset, limit int) ([]DeadLetter, error)
+	DeadLetterDepth(ctx context.Context) (int64, error)
+	SetItems(ctx context.Context, saleID string, items []ItemInfo) error
+	GetItems(ctx context.Context, saleID string, ids ...string) ([]ItemInfo, error)
+	SetCurrentSale(ctx context.Context, sale *CurrentSale) error
+	GetCurrentSale(ctx context.Context) (*CurrentSale, error)
+	SetCurrentSaleCodeTTL(ctx context.Context, saleID string, ttl time.Duration) (bool, error)
+	AcquireLeadership(ctx context.Context, name, owner string, ttl time.Duration) (int64, bool, error)
+	ReleaseLeadership(ctx context.Context, name, owner string) error
+	ValidateFencingToken(ctx context.Context, name string, token int64) (bool, error)
+	SetSaleState(ctx context.Context, saleID, state string) error
+	SetOversellBuffer(ctx context.Context, saleID string, buffer int) error
+	SetItemStock(ctx context.Context, saleID string, stock map[string]int) error
+	GetOversellBuffer(ctx context.Context, saleID string) (int, error)
+	StageCatalog(ctx context.Context, data []byte) error
+	TakeStagedCatalog(ctx context.Context) ([]byte, error)
+	AuditKeys(ctx context.Context, opts KeyAuditOptions) (*KeyAudit, error)
+	GetLastKeyAudit(ctx context.Context) (*KeyAudit, error)
+	ClaimNonce(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+	ClaimRestock(ctx context.Context, saleID string, n, max int) (int, error)
+	UnclaimRestock(ctx context.Context, saleID string, n int) error
+	RestockInventory(ctx context.Context, saleID string, categoryCounts map[string]int) error
+	SetPromo(ctx context.Context, p *Promo) error
+	JoinQueue(ctx context.Context, saleID, userID string) (string, int64, error)
+	SnapshotSale(ctx context.Context, saleID string) (*SaleSnapshot, error)
+	RestoreSale(ctx context.Context, snap *SaleSnapshot) (int, error)
+	QueuePlace(ctx context.Context, saleID, token string) (int64, error)
+	EnterLottery(ctx context.Context, saleID, userID string) (bool, error)
+	IsLotteryEntrant(ctx context.Context, saleID, userID string) (bool, error)
+	GetLotteryEntrants(ctx context.Context, saleID string) (map[string]int, error)
+	ClaimLotteryDraw(ctx context.Context, saleID string, ttl time.Duration) (bool, error)
+	GetLotteryDrawState(ctx context.Context, saleID string) (string, error)
+	SaveLotteryWin(ctx context.Context, saleID, userID string, result *LotteryResult) (bool, error)
+	GetLotteryResults(ctx context.Context, saleID string) (map[string]*LotteryResult, error)
+	SaveLotteryResults(ctx context.Context, saleID string, results map[string]*LotteryResult) error
+	GetLotteryResult(ctx context.Context, saleID, userID string) (*LotteryResult, error)
+	GetPromoRedemptions(ctx context.Context, codes ...string) (map[string]int, error)
+	PublishSaleReport(ctx context.Context, saleID, instance string, report []byte) error
+	GetSaleReports(ctx context.Context, saleID string) ([][]byte, error)
+	GetSoldOutAt(ctx context.Context, saleID string) (time.Time, error)
+	GetItemAvailability(ctx context.Context, saleID, itemID string) (*ItemAvailability, error)
+	ReservationOutcomes(ctx context.Context, saleID string) (map[string]int64, error)
+	AddReservationAttempts(ctx context.Context, saleID string, buckets map[int]int64) error
+	GetReservationHeatmap(ctx context.Context, saleID string) (map[int]int64, error)
+	RegisterUsers(ctx context.Context, userIDs ...string) error
+	RegisteredUserCount(ctx context.Context) (int64, error)
+	BanUser(ctx context.Context, userID string) (bool, error)
+	UnbanUser(ctx context.Context, userID string) (bool, error)
+	IsUserBanned(ctx context.Context, userID string) (bool, error)
+	BannedUsers(ctx context.Context) ([]string, error)
+	PublishOutboxEvent(ctx context.Context, id int64, notification []byte, deliveries []WebhookDelivery) (bool, error)
 }
 
+// CurrentSale is the shared pointer to the sale every replica should serve.
+type CurrentSale struct {
+	SaleID     string    `json:"sale_id"`
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	TotalItems int       `json:"total_items,omitempty"`
+	ClosingAt  time.Time `json:"closing_at,omitzero"`
+	// CodeTTLMs is how long checkout codes hold their item, 0 for the
+	// CHECKOUT_CODE_TTL default.
+	CodeTTLMs int64 `json:"code_ttl_ms,omitempty"`
+	// Extensions is how often the anti-sniping rule moved EndTime.
+	Extensions int `json:"extensions,omitempty"`
+}
+
+// Sale rollover states. A closing sale rejects new reservations but still
+// redeems codes already handed out; a closed sale does neither.
+const (
+	SaleStateClosing = "closing"
+	SaleStateClosed  = "closed"
+)
+
+// ShowcaseInfo is the items /sale/info shows. The edges strategy fills
+// FirstItemIDs and LastItemIDs, the others ItemIDs.
 type ShowcaseInfo struct {
+	Strategy     string   `json:"strategy,omitempty"`
 	FirstItemIDs []string `json:"first_item_ids"`
 	LastItemIDs  []string `json:"last_item_ids"`
+	ItemIDs      []string `json:"item_ids,omitempty"`
+}
+
+// IDs lists every showcased item.
+func (i *ShowcaseInfo) IDs() []string {
+	return slices.Concat(i.FirstItemIDs, i.LastItemIDs, i.ItemIDs)
 }
 
 type service struct {
 	client *redis.Client
+	// tenant prefixes the keys that are not scoped by a sale ID; empty for
+	// the default tenant.
+	tenant string
+	// sealer encrypts checkout payloads; nil stores them as plaintext.
+	sealer *sealer
+	// codes generates checkout codes; codesPerSale scopes their keys by
+	// sale, so shorter codes only need to be unique within one sale.
+	codes        *codes.Generator
+	codesPerSale bool
+	// failover is set when a standby is configured.
+	failover *failover
+	// sandbox is set for a service opened with Options.Sandbox.
+	sandbox bool
 }
 
-var cacheInstance *service
+// ForTenant returns a view of the cache whose current-sale pointer, staged
+// catalog and promo codes belong to tenant. Sale-scoped keys need no
+// prefix: tenants' sale IDs never collide.
+func (s *service) ForTenant(tenant string) Service {
+	return &service{client: s.client, tenant: tenant, sealer: s.sealer, codes: s.codes, codesPerSale: s.codesPerSale, failover: s.failover, sandbox: s.sandbox}
+}
 
-func New() Service {
-	if cacheInstance != nil {
-		return cacheInstance
+// tenantKey scopes a key that is shared by all of a tenant's sales.
+func (s *service) tenantKey(key string) string {
+	if s.tenant == "" {
+		return key
+	}
+	return "tenant:" + s.tenant + ":" + key
+}
+
+// Options configure a connection to Redis.
+type Options struct {
+	Addr         string
+	Password     string
+	DB           int
+	PoolSize     int
+	MinIdleConns int
+	// CheckoutKey is a base64 AES key that checkout payloads are encrypted
+	// with; CheckoutKeyFile names a file holding one instead, such as a
+	// secret mounted from a KMS. Without either they are stored as
+	// plaintext.
+	CheckoutKey     string
+	CheckoutKeyFile string
+	// CodeFormat and CodeLength shape checkout codes, see the codes
+	// package; empty and 0 issue 32-character hex codes. CodesPerSale
+	// namespaces codes by sale, so the same code may be issued in two
+	// sales.
+	CodeFormat   string
+	CodeLength   int
+	CodesPerSale bool
+	// StandbyAddr is a second Redis the client fails over to when Addr
+	// stops answering; empty disables failover.
+	StandbyAddr string
+	// Sandbox, when set, makes the service a sandbox of that name, see
+	// DeleteSandboxSale.
+	Sandbox string
+}
+
+// OptionsFromEnv reads REDIS_ADDR, REDIS_STANDBY_ADDR, REDIS_PASSWORD,
+// CHECKOUT_ENCRYPTION_KEY or CHECKOUT_ENCRYPTION_KEY_FILE and the
+// CHECKOUT_CODE_* settings, with the pool sized for the checkout rush.
+func OptionsFromEnv() Options {
+	codeLength, _ := strconv.Atoi(os.Getenv("CHECKOUT_CODE_LENGTH"))
+	codesPerSale, _ := strconv.ParseBool(os.Getenv("CHECKOUT_CODE_PER_SALE"))
+	return Options{
+		Addr:            os.Getenv("REDIS_ADDR"),
+		StandbyAddr:     os.Getenv("REDIS_STANDBY_ADDR"),
+		Password:        os.Getenv("REDIS_PASSWORD"),
+		PoolSize:        200,
+		MinIdleConns:    50,
+		CheckoutKey:     os.Getenv("CHECKOUT_ENCRYPTION_KEY"),
+		CheckoutKeyFile: os.Getenv("CHECKOUT_ENCRYPTION_KEY_FILE"),
+		CodeFormat:      os.Getenv("CHECKOUT_CODE_FORMAT"),
+		CodeLength:      codeLength,
+		CodesPerSale:    codesPerSale,
+	}
+}
+
+// NewService connects to Redis and preloads the Lua scripts. Every call
+// opens a client of its own.
+func NewService(opts Options) (Service, error) {
+	sealer, err := newSealer(opts.CheckoutKey, opts.CheckoutKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if opts.CodeFormat == "" {
+		opts.CodeFormat = codes.FormatHex
+	}
+	generator, err := codes.New(opts.CodeFormat, opts.CodeLength)
+	if err != nil {
+		return nil, err
 	}
 
 	rdb := redis.NewClient(&redis.Options{
-		Addr:         os.Getenv("REDIS_ADDR"),
-		Password:     os.Getenv("REDIS_PASSWORD"),
-		DB:           0,
-		PoolSize:     200,
-		MinIdleConns: 50, 
+		Addr:         opts.Addr,
+		Password:     opts.Password,
+		DB:           opts.DB,
+		PoolSize:     opts.PoolSize,
+		MinIdleConns: opts.MinIdleConns,
 		MaxRetries:   maxRetries,
 		DialTimeout:  5 * time.Second,
 		ReadTimeout:  3 * time.Second,
 		WriteTimeout: 3 * time.Second,
 		PoolTimeout:  4 * time.Second,
+
+		// Calls may carry shorter deadlines than ReadTimeout; see
+		// WithTimeouts.
+		ContextTimeoutEnabled: true,
 	})
 
 	if err := rdb.Ping(context.Background()).Err(); err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
+		rdb.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
 	log.Println("Connected to Redis with optimized settings")
-	cacheInstance = &service{client: rdb}
+	s := &service{client: rdb, sealer: sealer, codes: generator, codesPerSale: opts.CodesPerSale}
+	if opts.Sandbox != "" {
+		s.tenant, s.sandbox, s.codesPerSale = opts.Sandbox, true, true
+	}
+	if opts.StandbyAddr != "" {
+		s.failover = newFailover(opts)
+		rdb.AddHook(s.failover)
+		go s.failover.monitor(context.Background())
+		log.Printf("Redis fails over to standby %s", opts.StandbyAddr)
+	}
+	if sealer != nil {
+		log.Println("Checkout payloads are encrypted at rest")
+	}
+	if opts.CodeFormat != codes.FormatHex || opts.CodeLength != 0 {
+		log.Printf("Issuing %s checkout codes with %.0f bits of entropy", opts.CodeFormat, generator.Bits())
+	}
+	if err := s.loadScripts(context.Background()); err != nil {
+		log.Printf("Warning: %v; scripts will be loaded on first use", err)
+	}
+	return s, nil
+}
+
+var (
+	cacheOnce     sync.Once
+	cacheInstance Service
+)
+
+// New returns the process-wide cache, connected with OptionsFromEnv on
+// first use. It exits when Redis is unreachable. Prefer NewService.
+func New() Service {
+	cacheOnce.Do(func() {
+		s, err := NewService(OptionsFromEnv())
+		if err != nil {
+			log.Fatal(err)
+		}
+		cacheInstance = s
+	})
 	return cacheInstance
 }
 
@@ -101,6 +389,10 @@ func (s *service) Health() map[string]string {
 
 	stats["status"] = "up"
 	stats["message"] = "healthy"
+	if s.FailedOver() {
+		stats["message"] = "serving from standby"
+		stats["failed_over"] = "true"
+	}
 	stats["ping_latency_ms"] = fmt.Sprintf("%.2f", float64(latency.Nanoseconds())/1e6)
 	stats["pool_hits"] = strconv.Itoa(int(poolStats.Hits))
 	stats["pool_misses"] = strconv.Itoa(int(poolStats.Misses))
@@ -114,15 +406,32 @@ func (s *service) Close() error {
 	return s.client.Close()
 }
 
-func (s *service) InitializeSale(ctx context.Context, saleID string, totalItems int) error {
+func (s *service) InitializeSale(ctx context.Context, saleID string, totalItems int, categoryCounts map[string]int) error {
 	pipe := s.client.Pipeline()
 	inventoryKey := fmt.Sprintf("sale:%s:inventory", saleID)
+	categoryKey := fmt.Sprintf("sale:%s:category_inventory", saleID)
 
 	pipe.Set(ctx, inventoryKey, totalItems, time.Hour+10*time.Minute)
 
+	pipe.Del(ctx, categoryKey)
+	if len(categoryCounts) > 0 {
+		fields := make(map[string]interface{}, len(categoryCounts))
+		for category, count := range categoryCounts {
+			fields[category] = count
+		}
+		pipe.HSet(ctx, categoryKey, fields)
+		pipe.Expire(ctx, categoryKey, time.Hour+10*time.Minute)
+	}
+
 	pipe.Set(ctx, fmt.Sprintf("sale:%s:active", saleID), "1", time.Hour+10*time.Minute)
 	pipe.Del(ctx, fmt.Sprintf("sale:%s:user_purchases", saleID))
+	pipe.Del(ctx, tierPurchasesKey(saleID))
 	pipe.Del(ctx, fmt.Sprintf("sale:%s:sold_bitmap", saleID))
+	pipe.Del(ctx, claimedItemsKey(saleID))
+	pipe.Del(ctx, unitsSoldKey(saleID))
+	pipe.Del(ctx, itemHoldsKey(saleID))
+	pipe.Del(ctx, heatmapKey(saleID))
+	pipe.Del(ctx, reservationOutcomesKey(saleID))
 
 	_, err := pipe.Exec(ctx)
 	if err != nil {
@@ -133,85 +442,294 @@ func (s *service) InitializeSale(ctx context.Context, saleID string, totalItems
 	return nil
 }
 
-func (s *service) ReserveItem(ctx context.Context, saleID, userID, itemID string) (string, error) {
-	luaScript := `
-		local inventory_key = KEYS[1]
-		local user_key = KEYS[2]
-		local user_id = ARGV[1]
-		local max_per_user = tonumber(ARGV[2])
-
-		-- Check user limit first
-		local user_count = redis.call('HGET', user_key, user_id)
-		if user_count and tonumber(user_count) >= max_per_user then
-			return "user_limit_exceeded"
-		end
-
-		-- Try to reserve inventory
-		local remaining = redis.call('DECR', inventory_key)
-		if remaining < 0 then
-			redis.call('INCR', inventory_key)
-			return "sold_out"
-		end
-
-		return "success"
-	`
-	inventoryKey := fmt.Sprintf("sale:%s:inventory", saleID)
-	userKey := fmt.Sprintf("sale:%s:user_purchases", saleID)
+// ReserveItem holds one unit of inventory for the user and stores the
+// checkout code, all in one script. The user limit counts completed
+// purchases together with unexpired reservations, so it caps what a user
+// can own in the sale, not just what they have paid for. A promo code is
+// redeemed in the same script, so a code's limit holds exactly like the
+// inventory does; the discount is stored with the checkout code. The code
+// expires after ttl; its expiry is returned with it.
+//
+// An empty itemID reserves any available item: the script picks the
+// lowest-numbered item no checkout has claimed yet, within category when
+// one is given, and returns it. Sales
+// whose items carry no number cannot be checked out this way. An item sold
+// by quantity, see SetItemStock, gives up one of its units and is only
+// claimed once they are all gone.
+//
+// A named item is refused with "item already reserved" while a live code
+// holds it or once it is sold, unless it is sold by quantity. Every answer
+// of the script is counted per sale, see ReservationOutcomes.
+//
+// A non-empty category filters the checkout: the category must have stock
+// left, and a named item outside it is refused with "item not in
+// category". Every reservation, filtered or not, counts down the category
+// its item has in the sale's item metadata, which is returned in the
+// reservation's Category.
+//
+// The script refuses a code that is already live, and another is drawn, so
+// short code formats never hand two buyers the same code. Users missing
+// from RegisterUsers are refused with "unknown user".
+func (s *service) ReserveItem(ctx context.Context, saleID, userID, itemID, category, promoCode string, ttl time.Duration) (*Reservation, error) {
+	now := time.Now()
+	checkoutInfo := CheckoutInfo{
+		UserID:    userID,
+		ItemID:    itemID,
+		SaleID:    saleID,
+		Category:  category,
+		ExpiresAt: now.Add(ttl),
+	}
+	// A sealed payload cannot be completed by the script; when it picks the
+	// item or applies a promo code, the payload is sealed again below.
+	sealed := "0"
+	if s.sealer != nil {
+		sealed = "1"
+	}
+	code := s.codes.Generate()
+	codeKey := s.checkoutCodeKey(saleID, code)
+
+	keys := []string{
+		fmt.Sprintf("sale:%s:inventory", saleID),
+		fmt.Sprintf("sale:%s:user_purchases", saleID),
+		fmt.Sprintf("sale:%s:category_inventory", saleID),
+		outstandingCodesKey(saleID, userID),
+		codeKey,
+		saleStateKey(saleID),
+		s.promoKey(promoCode),
+		soldOutAtKey(saleID),
+		claimedItemsKey(saleID),
+		fmt.Sprintf("sale:%s:items", saleID),
+		itemHoldsKey(saleID),
+		tierPurchasesKey(saleID),
+		tierCodesKey(saleID, userID),
+		s.registeredUsersKey(),
+		oversellBufferKey(saleID),
+		itemStockKey(saleID),
+		reservationOutcomesKey(saleID),
+		categoryItemsKey(saleID, category),
+		categoryPickKey(saleID),
+	}
+	args := []interface{}{
+		userID, config.Get().MaxPerUser, category, config.Get().MaxOutstandingCodes,
+		now.UnixMilli(), checkoutInfo.ExpiresAt.UnixMilli(), code, s.encodeCheckout(code, &checkoutInfo), ttl.Milliseconds(),
+		promoCode, saleStatsTTL.Milliseconds(),
+		itemID, ItemNumber(saleID, itemID), saleID + "_item_", sealed,
+		rarityLimitsArg(),
+	}
 
-	result, err := s.client.Eval(ctx, luaScript, []string{inventoryKey, userKey}, userID, 10).Result()
+	result, err := reserveItemScript.Run(ctx, s.client, keys, args...).Result()
+	for attempt := 1; err == nil && result == "code_taken" && attempt < codeAttempts; attempt++ {
+		code = s.codes.Generate()
+		codeKey = s.checkoutCodeKey(saleID, code)
+		keys[4] = codeKey
+		args[6], args[7] = code, s.encodeCheckout(code, &checkoutInfo)
+		result, err = reserveItemScript.Run(ctx, s.client, keys, args...).Result()
+	}
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	if reply, ok := result.([]interface{}); ok {
+		checkoutInfo.ItemID = reply[1].(string)
+		checkoutInfo.Category = reply[3].(string)
+		if promoCode != "" {
+			checkoutInfo.PromoCode = promoCode
+			checkoutInfo.PercentOff = int(reply[2].(int64))
+		}
+		if s.sealer != nil && (itemID == "" || promoCode != "" || checkoutInfo.Category != category) {
+			if err := s.client.SetArgs(ctx, codeKey, s.encodeCheckout(code, &checkoutInfo), redis.SetArgs{Mode: "XX", KeepTTL: true}).Err(); err != nil {
+				if err := s.ReleaseReservation(ctx, saleID, userID, checkoutInfo.ItemID, checkoutInfo.Category, promoCode); err != nil {
+					log.Printf("Failed to release reservation of code %s: %v", code, err)
+				}
+				return nil, fmt.Errorf("failed to store checkout code: %w", err)
+			}
+		}
+		return &Reservation{Code: code, CheckoutInfo: checkoutInfo}, nil
 	}
 
 	status := result.(string)
-	if status == "user_limit_exceeded" {
-		return "", fmt.Errorf("user limit exceeded")
+	if message, ok := reservationRefusals[status]; ok {
+		return nil, errors.New(message)
 	}
-	if status == "sold_out" {
-		return "", fmt.Errorf("sold out")
+	if status == "code_taken" {
+		return nil, fmt.Errorf("no free checkout code after %d attempts", codeAttempts)
 	}
 
-	code := s.generateCode()
-	checkoutInfo := CheckoutInfo{
-		UserID:    userID,
-		ItemID:    itemID,
-		SaleID:    saleID,
-		ExpiresAt: time.Now().Add(codeExpiryTime),
-	}
+	return nil, fmt.Errorf("unexpected reservation status %q", status)
+}
 
-	data, _ := json.Marshal(checkoutInfo)
-	codeKey := fmt.Sprintf("checkout_code:%s", code)
+// codeAttempts bounds the codes drawn for one reservation. Even 40-bit
+// codes collide so rarely that a third draw means something is wrong.
+const codeAttempts = 3
 
-	err = s.client.Set(ctx, codeKey, data, codeExpiryTime).Err()
-	if err != nil {
-		s.client.Incr(ctx, inventoryKey)
-		return "", err
+// checkoutCodeKey stores the payload of a checkout code.
+func (s *service) checkoutCodeKey(saleID, code string) string {
+	if s.codesPerSale {
+		return fmt.Sprintf("checkout_code:%s:%s", saleID, code)
+	}
+	return fmt.Sprintf("checkout_code:%s", code)
+}
+
+// completedCodeKey holds the completion record of a redeemed code, see
+// CompletePurchase. It is scoped like the code's own key.
+func (s *service) completedCodeKey(saleID, code string) string {
+	if s.codesPerSale {
+		return fmt.Sprintf("checkout_done:%s:%s", saleID, code)
 	}
+	return fmt.Sprintf("checkout_done:%s", code)
+}
 
-	return code, nil
+// outstandingCodesKey is the sorted set of a user's unredeemed codes in a
+// sale, scored by expiry time in milliseconds.
+func outstandingCodesKey(saleID, userID string) string {
+	return fmt.Sprintf("sale:%s:user_codes:%s", saleID, userID)
 }
 
-func (s *service) VerifyAndPurchase(ctx context.Context, code string) (*CheckoutInfo, error) {
-	codeKey := fmt.Sprintf("checkout_code:%s", code)
+// tierPurchasesKey counts each user's purchases in a sale by rarity tier,
+// under "<tier>:<user_id>".
+func tierPurchasesKey(saleID string) string {
+	return fmt.Sprintf("sale:%s:user_tier_purchases", saleID)
+}
 
-	data, err := s.client.GetDel(ctx, codeKey).Result()
-	if err != nil {
+// tierCodesKey is the sorted set of a user's unredeemed codes in a sale
+// for items of a capped rarity tier, as "<tier>:<code>" scored by expiry
+// time in milliseconds.
+func tierCodesKey(saleID, userID string) string {
+	return fmt.Sprintf("sale:%s:user_tier_codes:%s", saleID, userID)
+}
+
+// rarityLimitsArg passes RARITY_LIMITS to the reservation script as a JSON
+// object, or empty when no tier is capped.
+func rarityLimitsArg() string {
+	limits := config.Get().RarityLimits
+	if len(limits) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(limits)
+	return string(data)
+}
+
+// CompletePurchase redeems a checkout code and credits the purchase to the
+// user's count. The code's payload is read, and opened when encrypted,
+// first: the sale and user it names pick the keys the script is passed,
+// and the script redeems the code only if the payload is still the one
+// read.
+//
+// The code is normalized first, so grouped codes may be typed in any case
+// and without dashes. saleID is the sale the code was issued in; it is only
+// needed when codes are namespaced per sale.
+//
+// A non-empty recipientID buys the item as a gift for another registered
+// user. The recipient owns it: it counts against their per-user cap, not
+// the buyer's, and the code is refused with "recipient limit exceeded",
+// and kept, when they are at the cap. Unregistered recipients are refused
+// with "unknown recipient". Codes of banned users, or gifted to one, are
+// refused with "user banned" and kept.
+//
+// Redeeming a code leaves a completion record in its place, written by the
+// same script, for as long as the sale's keys live. A purchase retried
+// after its reply was lost finds the code redeemed and gets the record
+// back, marked Replayed, instead of "invalid or expired code"; it is not
+// counted again.
+func (s *service) CompletePurchase(ctx context.Context, saleID, code, recipientID string) (*CheckoutInfo, error) {
+	code = s.codes.Normalize(code)
+	codeKey := s.checkoutCodeKey(saleID, code)
+	completedKey := s.completedCodeKey(saleID, code)
+
+	payload, err := s.client.Get(ctx, codeKey).Result()
+	if err == redis.Nil {
+		record, err := s.client.Get(ctx, completedKey).Result()
 		if err == redis.Nil {
 			return nil, fmt.Errorf("invalid or expired code")
 		}
+		if err != nil {
+			return nil, err
+		}
+		return s.decodeCompletion(code, []interface{}{record, int64(1)})
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.decodeCheckout(code, payload)
+	if err != nil {
 		return nil, err
 	}
 
-	var checkoutInfo CheckoutInfo
-	if err := json.Unmarshal([]byte(data), &checkoutInfo); err != nil {
+	keys := []string{
+		codeKey,
+		s.registeredUsersKey(),
+		s.tenantKey(bannedUsersKey),
+		completedKey,
+		saleStateKey(info.SaleID),
+		fmt.Sprintf("sale:%s:user_purchases", info.SaleID),
+		outstandingCodesKey(info.SaleID, info.UserID),
+		outstandingCodesKey(info.SaleID, recipientID),
+		itemHoldsKey(info.SaleID),
+		unitsSoldKey(info.SaleID),
+		fmt.Sprintf("sale:%s:items", info.SaleID),
+		tierPurchasesKey(info.SaleID),
+		tierCodesKey(info.SaleID, info.UserID),
+	}
+	args := []interface{}{
+		code, payload, info.ItemID, info.UserID, saleStatsTTL.Milliseconds(),
+		recipientID, config.Get().MaxPerUser, time.Now().UnixMilli(), codes.NewID(),
+	}
+	result, err := completePurchaseScript.Run(ctx, s.client, keys, args...).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, fmt.Errorf("invalid or expired code")
+		}
 		return nil, err
 	}
+	reply, ok := result.([]interface{})
+	if !ok {
+		return nil, purchaseRefusal(result.(string))
+	}
+	return s.decodeCompletion(code, reply)
+}
 
-	if time.Now().After(checkoutInfo.ExpiresAt) {
-		return nil, fmt.Errorf("code expired")
+// completion is what a redeemed code's completion record holds: the code's
+// payload and what its purchase added to it.
+type completion struct {
+	PurchaseID    string `json:"purchase_id"`
+	PurchasedAtMs int64  `json:"purchased_at_ms,string"`
+	Unit          int    `json:"unit"`
+	RecipientID   string `json:"recipient_id"`
+	Payload       string `json:"payload"`
+}
+
+// decodeCompletion reads a purchase script's reply: the completion record
+// of the code and 1 when the code had been redeemed before.
+func (s *service) decodeCompletion(code string, reply []interface{}) (*CheckoutInfo, error) {
+	var c completion
+	if err := json.Unmarshal([]byte(reply[0].(string)), &c); err != nil {
+		return nil, fmt.Errorf("failed to decode completion record: %w", err)
+	}
+	info, err := s.decodeCheckout(code, c.Payload)
+	if err != nil {
+		return nil, err
 	}
+	info.Unit = c.Unit
+	if c.RecipientID != info.UserID {
+		info.RecipientID = c.RecipientID
+	}
+	info.PurchaseID = c.PurchaseID
+	info.PurchasedAt = time.UnixMilli(c.PurchasedAtMs)
+	info.Replayed = reply[1].(int64) == 1
+	return info, nil
+}
 
-	return &checkoutInfo, nil
+// purchaseRefusal is the error of a purchase script's status reply.
+func purchaseRefusal(status string) error {
+	switch status {
+	case "unknown_recipient":
+		return fmt.Errorf("unknown recipient")
+	case "recipient_limit_exceeded":
+		return fmt.Errorf("recipient limit exceeded")
+	case "banned":
+		return fmt.Errorf("user banned")
+	}
+	return fmt.Errorf("sale closed")
 }
 
 func (s *service) GetUserPurchaseCount(ctx context.Context, saleID, userID string) (int, error) {
@@ -232,9 +750,30 @@ func (s *service) GetUserPurchaseCount(ctx context.Context, saleID, userID strin
 	return count, nil
 }
 
-func (s *service) IncrementUserPurchase(ctx context.Context, saleID, userID string) error {
+// GetUserPurchaseCounts reads many users' purchase counts in one HMGET.
+// Users without purchases map to 0.
+func (s *service) GetUserPurchaseCounts(ctx context.Context, saleID string, userIDs ...string) (map[string]int, error) {
+	counts := make(map[string]int, len(userIDs))
+	if len(userIDs) == 0 {
+		return counts, nil
+	}
+
 	key := fmt.Sprintf("sale:%s:user_purchases", saleID)
-	return s.client.HIncrBy(ctx, key, userID, 1).Err()
+	vals, err := s.client.HMGet(ctx, key, userIDs...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, userID := range userIDs {
+		counts[userID] = 0
+		if v, ok := vals[i].(string); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, err
+			}
+			counts[userID] = n
+		}
+	}
+	return counts, nil
 }
 
 func (s *service) CleanupExpiredCodes(ctx context.Context, saleID string) error {
@@ -271,10 +810,47 @@ func (s *service) GetInventoryStatus(ctx context.Context, saleID string) (int, e
 	return val, nil
 }
 
-func (s *service) generateCode() string {
-	bytes := make([]byte, 16)
-	rand.Read(bytes)
-	return hex.EncodeToString(bytes)
+func (s *service) GetCategoryInventory(ctx context.Context, saleID string) (map[string]int, error) {
+	key := fmt.Sprintf("sale:%s:category_inventory", saleID)
+	values, err := s.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(values))
+	for category, v := range values {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		counts[category] = n
+	}
+	return counts, nil
+}
+
+// ApplyFallbackPurchase books a purchase made through the Postgres fallback
+// in Redis, as the reservation and purchase scripts would have: it takes
+// the unit from the inventory, the item's category and its stock, counts
+// it against the user's limit and rarity tier, and claims the item and
+// marks it sold so Redis does not sell it again. It returns false, and
+// changes nothing, when Redis had already sold the item.
+func (s *service) ApplyFallbackPurchase(ctx context.Context, saleID, userID, itemID string) (bool, error) {
+	keys := []string{
+		fmt.Sprintf("sale:%s:inventory", saleID),
+		fmt.Sprintf("sale:%s:user_purchases", saleID),
+		fmt.Sprintf("sale:%s:category_inventory", saleID),
+		claimedItemsKey(saleID),
+		fmt.Sprintf("sale:%s:items", saleID),
+		itemHoldsKey(saleID),
+		tierPurchasesKey(saleID),
+		itemStockKey(saleID),
+		fmt.Sprintf("sale:%s:sold_bitmap", saleID),
+	}
+	applied, err := applyFallbackPurchaseScript.Run(ctx, s.client, keys, userID, itemID, ItemNumber(saleID, itemID), saleStatsTTL.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return applied == 1, nil
 }
 
 func (s *service) MarkItemAsSold(ctx context.Context, saleID string, itemNumber int) error {
@@ -308,3 +884,47 @@ func (s *service) GetShowcaseInfo(ctx context.Context, saleID string) (*Showcase
 	}
 	return &info, nil
 }
+
+func (s *service) SetCurrentSale(ctx context.Context, sale *CurrentSale) error {
+	data, err := json.Marshal(sale)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(sale.EndTime) + 10*time.Minute
+	if ttl < time.Minute {
+		ttl = time.Minute
+	}
+	return s.client.Set(ctx, s.tenantKey(currentSaleKey), data, ttl).Err()
+}
+
+func (s *service) GetCurrentSale(ctx context.Context) (*CurrentSale, error) {
+	data, err := s.client.Get(ctx, s.tenantKey(currentSaleKey)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var sale CurrentSale
+	if err := json.Unmarshal([]byte(data), &sale); err != nil {
+		return nil, err
+	}
+	return &sale, nil
+}
+
+// SetCurrentSaleCodeTTL changes the code TTL in the current-sale pointer,
+// in place so it cannot undo a concurrent update of other fields. It
+// returns false when the pointer is missing or names another sale.
+func (s *service) SetCurrentSaleCodeTTL(ctx context.Context, saleID string, ttl time.Duration) (bool, error) {
+	updated, err := setCodeTTLScript.Run(ctx, s.client, []string{s.tenantKey(currentSaleKey)}, saleID, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return updated == 1, nil
+}
+
+func (s *service) SetSaleState(ctx context.Context, saleID, state string) error {
+	return s.client.Set(ctx, saleStateKey(saleID), state, time.Hour+10*time.Minute).Err()
+}
+
+func saleStateKey(saleID string) string {
+	return fmt.Sprintf("sale:%s:state", saleID)
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Reservation is an unredeemed checkout code and what it holds.
+type Reservation struct {
+	Code string
+	CheckoutInfo
+}
+
+// ListReservations returns a user's unexpired, unredeemed codes in a sale,
+// soonest to expire first. It reads the per-user code index that
+// ReserveItem adds to and CompletePurchase removes from.
+func (s *service) ListReservations(ctx context.Context, saleID, userID string) ([]Reservation, error) {
+	codes, err := s.client.ZRangeByScore(ctx, outstandingCodesKey(saleID, userID), &redis.ZRangeBy{
+		Min: "(" + strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reservations: %w", err)
+	}
+	if len(codes) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(codes))
+	for i, code := range codes {
+		keys[i] = s.checkoutCodeKey(saleID, code)
+	}
+	payloads, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load reservations: %w", err)
+	}
+
+	reservations := make([]Reservation, 0, len(codes))
+	for i, payload := range payloads {
+		data, ok := payload.(string)
+		if !ok {
+			// Redeemed or expired since the index was read
+			continue
+		}
+		info, err := s.decodeCheckout(codes[i], data)
+		if err != nil {
+			continue
+		}
+		reservations = append(reservations, Reservation{Code: codes[i], CheckoutInfo: *info})
+	}
+	return reservations, nil
+}
+
+// ExtendCheckout moves the expiry of an unredeemed code back by by, once,
+// and only within window of it expiring. The code's payload, its entries
+// in the user's code indexes and the item's hold all follow, so the
+// extended code keeps counting against the user's limits and the item
+// stays held. Sealed payloads are opened and sealed again here.
+func (s *service) ExtendCheckout(ctx context.Context, saleID, code string, window, by time.Duration) (*CheckoutInfo, error) {
+	code = s.codes.Normalize(code)
+	codeKey := s.checkoutCodeKey(saleID, code)
+
+	payload, err := s.client.Get(ctx, codeKey).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, fmt.Errorf("invalid or expired code")
+		}
+		return nil, err
+	}
+	info, err := s.decodeCheckout(code, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if info.Extended {
+		return nil, fmt.Errorf("code already extended")
+	}
+	if info.ExpiresAt.Sub(now) > window {
+		return nil, fmt.Errorf("code not expiring yet")
+	}
+	expiresAt := info.ExpiresAt
+	info.ExpiresAt = expiresAt.Add(by)
+	info.Extended = true
+
+	keys := []string{
+		codeKey,
+		outstandingCodesKey(info.SaleID, info.UserID),
+		tierCodesKey(info.SaleID, info.UserID),
+		itemHoldsKey(info.SaleID),
+		fmt.Sprintf("sale:%s:items", info.SaleID),
+		saleStateKey(info.SaleID),
+	}
+	args := []interface{}{
+		payload, s.encodeCheckout(code, info), code, info.ItemID,
+		expiresAt.UnixMilli(), info.ExpiresAt.UnixMilli(), now.UnixMilli(),
+	}
+	status, err := extendCheckoutScript.Run(ctx, s.client, keys, args...).Text()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, fmt.Errorf("invalid or expired code")
+		}
+		return nil, err
+	}
+	switch status {
+	case "extended":
+		return nil, fmt.Errorf("code already extended")
+	case "sale_closing":
+		return nil, fmt.Errorf("sale closing")
+	}
+	return info, nil
+}
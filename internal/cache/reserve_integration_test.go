@@ -0,0 +1,225 @@
+//go:build integration
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"flash_sale_contest/internal/codes"
+	"flash_sale_contest/internal/config"
+)
+
+// testService connects to the Redis at REDIS_ADDR with a pool sized for
+// tens of thousands of concurrent scripts. It issues the default hex
+// codes.
+func testService(t *testing.T) *service {
+	t.Helper()
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set")
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:        addr,
+		Password:    os.Getenv("REDIS_PASSWORD"),
+		PoolSize:    256,
+		PoolTimeout: time.Minute,
+		ReadTimeout: 10 * time.Second,
+	})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Fatalf("redis at %s: %v", addr, err)
+	}
+	t.Cleanup(func() { client.Close() })
+	generator, err := codes.New(codes.FormatHex, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &service{client: client, codes: generator}
+}
+
+// newTestSale initializes a sale with a unique ID and deletes its keys and
+// checkout codes when the test ends.
+func newTestSale(t *testing.T, s *service, items int) string {
+	t.Helper()
+	ctx := context.Background()
+	saleID := fmt.Sprintf("reserve_test_%d", time.Now().UnixNano())
+	if err := s.InitializeSale(ctx, saleID, items, map[string]int{"gems": items}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		iter := s.client.Scan(ctx, 0, fmt.Sprintf("sale:%s:*", saleID), 1000).Iterator()
+		for iter.Next(ctx) {
+			s.client.Del(ctx, iter.Val())
+		}
+	})
+	return saleID
+}
+
+// perUserCap is the most codes one user can hold at once.
+func perUserCap() int {
+	limit := config.Get().MaxPerUser
+	if outstanding := config.Get().MaxOutstandingCodes; outstanding > 0 && outstanding < limit {
+		limit = outstanding
+	}
+	return limit
+}
+
+type reserveOutcome struct {
+	mu        sync.Mutex
+	successes map[string]int
+	codes     []string
+	failures  map[string]int
+}
+
+// reserveConcurrently registers users of the sale and makes calls
+// ReserveItem calls at once, spread round-robin over them. The users are
+// named after the sale and unregistered when the test ends, so the shared
+// registry keeps no test users.
+func reserveConcurrently(t *testing.T, s *service, saleID string, users, calls int) *reserveOutcome {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	userIDs := make([]string, users)
+	members := make([]interface{}, users)
+	for i := range userIDs {
+		userIDs[i] = fmt.Sprintf("%s-user-%d", saleID, i)
+		members[i] = userIDs[i]
+	}
+	t.Cleanup(func() {
+		s.client.SRem(context.Background(), s.registeredUsersKey(), members...)
+	})
+	if err := s.RegisterUsers(ctx, userIDs...); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &reserveOutcome{successes: map[string]int{}, failures: map[string]int{}}
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func(userID, itemID string) {
+			defer wg.Done()
+			<-start
+			reservation, err := s.ReserveItem(ctx, saleID, userID, itemID, "", "", 5*time.Minute)
+
+			out.mu.Lock()
+			defer out.mu.Unlock()
+			if err != nil {
+				out.failures[err.Error()]++
+				return
+			}
+			out.successes[userID]++
+			out.codes = append(out.codes, reservation.Code)
+		}(userIDs[i%users], fmt.Sprint(i))
+	}
+	close(start)
+	wg.Wait()
+
+	t.Cleanup(func() {
+		for _, code := range out.codes {
+			s.client.Del(context.Background(), s.checkoutCodeKey(saleID, code))
+		}
+	})
+	return out
+}
+
+// TestReserveItemNoOversell is the service's core invariant: 50k buyers
+// racing for 10k items get exactly 10k codes, the counters end at zero and
+// no user holds more than their cap. Every item is a gem, so each
+// reservation counts the gems down too.
+func TestReserveItemNoOversell(t *testing.T) {
+	const (
+		inventory = 10000
+		calls     = 50000
+		users     = 5000
+	)
+	s := testService(t)
+	saleID := newTestSale(t, s, inventory)
+	items := make([]ItemInfo, calls)
+	for i := range items {
+		items[i] = ItemInfo{ItemID: fmt.Sprint(i), Category: "gems"}
+	}
+	if err := s.SetItems(context.Background(), saleID, items); err != nil {
+		t.Fatal(err)
+	}
+
+	out := reserveConcurrently(t, s, saleID, users, calls)
+
+	total := 0
+	for user, n := range out.successes {
+		total += n
+		if n > perUserCap() {
+			t.Errorf("%s got %d codes, cap is %d", user, n, perUserCap())
+		}
+	}
+	if total != inventory {
+		t.Errorf("%d reservations succeeded, want exactly %d", total, inventory)
+	}
+	for reason, n := range out.failures {
+		switch reason {
+		case "sold out", "user limit exceeded", "too many outstanding codes":
+		default:
+			t.Errorf("%d calls failed unexpectedly: %s", n, reason)
+		}
+	}
+
+	ctx := context.Background()
+	remaining, err := s.GetInventoryStatus(ctx, saleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 0 {
+		t.Errorf("inventory counter is %d after selling out, want 0", remaining)
+	}
+	categories, err := s.GetCategoryInventory(ctx, saleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if categories["gems"] != 0 {
+		t.Errorf("gem stock is %d after every gem was reserved, want 0", categories["gems"])
+	}
+
+	outstanding := 0
+	for user := range out.successes {
+		n, err := s.client.ZCard(ctx, outstandingCodesKey(saleID, user)).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		outstanding += int(n)
+	}
+	if outstanding != inventory {
+		t.Errorf("%d outstanding codes recorded, want %d", outstanding, inventory)
+	}
+}
+
+// TestReserveItemPerUserCap gives every user more attempts than their cap
+// with stock to spare, so each must end with exactly the cap.
+func TestReserveItemPerUserCap(t *testing.T) {
+	const (
+		users        = 100
+		callsPerUser = 20
+	)
+	s := testService(t)
+	saleID := newTestSale(t, s, users*callsPerUser)
+
+	out := reserveConcurrently(t, s, saleID, users, users*callsPerUser)
+
+	if len(out.successes) != users {
+		t.Fatalf("%d users got codes, want %d", len(out.successes), users)
+	}
+	for user, n := range out.successes {
+		if n != perUserCap() {
+			t.Errorf("%s got %d codes, want exactly the cap of %d", user, n, perUserCap())
+		}
+	}
+	if n := out.failures["sold out"]; n > 0 {
+		t.Errorf("%d calls saw sold out with stock to spare", n)
+	}
+}
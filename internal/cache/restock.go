@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ClaimRestock reserves up to n items of a sale's restock budget of max and
+// returns how many were granted, 0 once the budget is spent. The count lives
+// in Redis so a new leader does not restart the budget.
+func (s *service) ClaimRestock(ctx context.Context, saleID string, n, max int) (int, error) {
+	key := fmt.Sprintf("sale:%s:restocked", saleID)
+	granted, err := claimRestockScript.Run(ctx, s.client, []string{key}, n, max, int((time.Hour + 10*time.Minute).Seconds())).Int()
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim restock: %w", err)
+	}
+	return granted, nil
+}
+
+// UnclaimRestock gives n items claimed with ClaimRestock back to a sale's
+// restock budget, for a tranche that could not be added.
+func (s *service) UnclaimRestock(ctx context.Context, saleID string, n int) error {
+	key := fmt.Sprintf("sale:%s:restocked", saleID)
+	if err := s.client.DecrBy(ctx, key, int64(n)).Err(); err != nil {
+		return fmt.Errorf("failed to unclaim restock: %w", err)
+	}
+	return nil
+}
+
+// RestockInventory adds items to a running sale's total and per-category
+// inventory.
+func (s *service) RestockInventory(ctx context.Context, saleID string, categoryCounts map[string]int) error {
+	pipe := s.client.TxPipeline()
+	total := 0
+	categoryKey := fmt.Sprintf("sale:%s:category_inventory", saleID)
+	for category, count := range categoryCounts {
+		pipe.HIncrBy(ctx, categoryKey, category, int64(count))
+		total += count
+	}
+	pipe.IncrBy(ctx, fmt.Sprintf("sale:%s:inventory", saleID), int64(total))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to restock inventory: %w", err)
+	}
+	return nil
+}
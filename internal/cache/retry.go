@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RetryPolicy configures WithRetry. OnRetry and OnExhausted, when set, are
+// called with the operation's name for every retry and for every call that
+// ran out of attempts or time while still failing transiently.
+type RetryPolicy struct {
+	Attempts    int
+	Backoff     time.Duration
+	Jitter      float64
+	OnRetry     func(op string)
+	OnExhausted func(op string)
+}
+
+// retrying retries the checkout and purchase scripts on transient Redis
+// failures. Neither script may run twice for one request, so only failures
+// that guarantee the script never ran are retried: a timeout after the
+// request was sent may have reserved or sold an item already. The caller
+// sees that timeout, and the buyer's own retry of the purchase comes back
+// as a replay, which the server records then.
+type retrying struct {
+	Service
+	policy RetryPolicy
+}
+
+// WithRetry wraps ReserveItem and CompletePurchase of svc with policy.
+// Other calls go straight to svc.
+func WithRetry(svc Service, policy RetryPolicy) Service {
+	if policy.Attempts <= 1 {
+		return svc
+	}
+	return &retrying{Service: svc, policy: policy}
+}
+
+func (r *retrying) ForTenant(tenant string) Service {
+	return &retrying{Service: r.Service.ForTenant(tenant), policy: r.policy}
+}
+
+func (r *retrying) ReserveItem(ctx context.Context, saleID, userID, itemID, category, promoCode string, ttl time.Duration) (*Reservation, error) {
+	var reservation *Reservation
+	err := r.do(ctx, "reserve_item", func() error {
+		var err error
+		reservation, err = r.Service.ReserveItem(ctx, saleID, userID, itemID, category, promoCode, ttl)
+		return err
+	})
+	return reservation, err
+}
+
+func (r *retrying) CompletePurchase(ctx context.Context, saleID, code, recipientID string) (*CheckoutInfo, error) {
+	var info *CheckoutInfo
+	err := r.do(ctx, "complete_purchase", func() error {
+		var err error
+		info, err = r.Service.CompletePurchase(ctx, saleID, code, recipientID)
+		return err
+	})
+	return info, err
+}
+
+func (r *retrying) do(ctx context.Context, op string, fn func() error) error {
+	delay := r.policy.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !isTransient(err) {
+			return err
+		}
+
+		wait := jittered(delay, r.policy.Jitter)
+		deadline, hasDeadline := ctx.Deadline()
+		if attempt >= r.policy.Attempts || (hasDeadline && time.Until(deadline) <= wait) {
+			if r.policy.OnExhausted != nil {
+				r.policy.OnExhausted(op)
+			}
+			return err
+		}
+
+		if r.policy.OnRetry != nil {
+			r.policy.OnRetry(op)
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
+
+// jittered randomizes fraction of d, so replicas that failed together do
+// not retry in lockstep.
+func jittered(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 || d <= 0 {
+		return d
+	}
+	fraction = min(fraction, 1)
+	spread := time.Duration(float64(d) * fraction)
+	return d - spread + time.Duration(rand.Int63n(int64(spread)+1))
+}
+
+// isTransient reports whether err means Redis never ran the command: the
+// connection could not be made or taken from the pool, it led to a primary
+// the client failed over from, or the server refused to run it for now.
+// Business errors, read timeouts and dropped connections are not retried.
+func isTransient(err error) bool {
+	if errors.Is(err, redis.ErrPoolTimeout) || errors.Is(err, errPrimaryRetired) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		for _, prefix := range []string{"LOADING ", "BUSY ", "TRYAGAIN ", "READONLY ", "MASTERDOWN ", "CLUSTERDOWN "} {
+			if strings.HasPrefix(redisErr.Error(), prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// saleStatsTTL outlives the sale, like its other keys.
+const saleStatsTTL = time.Hour + 10*time.Minute
+
+func saleReportsKey(saleID string) string {
+	return fmt.Sprintf("sale:%s:reports", saleID)
+}
+
+func soldOutAtKey(saleID string) string {
+	return fmt.Sprintf("sale:%s:sold_out_at", saleID)
+}
+
+// PublishSaleReport stores one instance's metrics report for a sale,
+// replacing the instance's previous one.
+func (s *service) PublishSaleReport(ctx context.Context, saleID, instance string, report []byte) error {
+	key := saleReportsKey(saleID)
+	pipe := s.client.TxPipeline()
+	pipe.HSet(ctx, key, instance, report)
+	pipe.Expire(ctx, key, saleStatsTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetSaleReports returns every instance's latest report for a sale.
+func (s *service) GetSaleReports(ctx context.Context, saleID string) ([][]byte, error) {
+	reports, err := s.client.HVals(ctx, saleReportsKey(saleID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]byte, len(reports))
+	for i, report := range reports {
+		out[i] = []byte(report)
+	}
+	return out, nil
+}
+
+// GetSoldOutAt returns when ReserveItem first took a sale's inventory to
+// zero, or the zero time if it never sold out.
+func (s *service) GetSoldOutAt(ctx context.Context, saleID string) (time.Time, error) {
+	val, err := s.client.Get(ctx, soldOutAtKey(saleID)).Result()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	ms, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// sandboxScanCount is the SCAN batch, and the most keys unlinked at once,
+// when a sandbox sale is deleted.
+const sandboxScanCount = 500
+
+// DeleteSandboxSale deletes every key a sale played in a sandbox left and
+// returns how many. A sandbox keeps the keys shared by its sales, the
+// registered users included, under its own tenant prefix and namespaces
+// checkout codes by sale, so its sale's keys can be found by prefix with
+// SCAN and removed with UNLINK without touching any other key of the
+// database. Services that are not a sandbox are refused.
+func (s *service) DeleteSandboxSale(ctx context.Context, saleID string) (int, error) {
+	if !s.sandbox {
+		return 0, errors.New("not a sandbox")
+	}
+
+	deleted := 0
+	for _, pattern := range []string{
+		fmt.Sprintf("sale:%s:*", saleID),
+		fmt.Sprintf("checkout_code:%s:*", saleID),
+		fmt.Sprintf("checkout_done:%s:*", saleID),
+		s.tenantKey("*"),
+	} {
+		var batch []string
+		unlink := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			n, err := s.client.Unlink(ctx, batch...).Result()
+			deleted += int(n)
+			batch = batch[:0]
+			return err
+		}
+
+		iter := s.client.Scan(ctx, 0, pattern, sandboxScanCount).Iterator()
+		for iter.Next(ctx) {
+			batch = append(batch, iter.Val())
+			if len(batch) == sandboxScanCount {
+				if err := unlink(); err != nil {
+					return deleted, err
+				}
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return deleted, err
+		}
+		if err := unlink(); err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
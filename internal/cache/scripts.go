@@ -0,0 +1,679 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Every Lua script the service runs. Calls go through Script.Run, which
+// sends EVALSHA and falls back to EVAL, loading the script again, when
+// Redis answers NOSCRIPT after a restart or failover; New preloads them all
+// so the hot path never ships a script body. Scripts queued in a pipeline
+// use Script.Eval instead, since a NOSCRIPT reply inside a transaction
+// could not be retried.
+var (
+	// reserveItemScript checks every checkout limit and takes one unit of
+	// inventory, see ReserveItem for its keys and replies.
+	reserveItemScript = redis.NewScript(`
+		local inventory_key = KEYS[1]
+		local user_key = KEYS[2]
+		local category_key = KEYS[3]
+		local outstanding_key = KEYS[4]
+		local code_key = KEYS[5]
+		local user_id = ARGV[1]
+		local max_per_user = tonumber(ARGV[2])
+		local category = ARGV[3]
+		local max_outstanding = tonumber(ARGV[4])
+		local now_ms = tonumber(ARGV[5])
+		local expires_ms = tonumber(ARGV[6])
+		local code = ARGV[7]
+		local payload = ARGV[8]
+		local ttl_ms = tonumber(ARGV[9])
+		local promo_code = ARGV[10]
+		local promo_key = KEYS[7]
+		local sold_out_key = KEYS[8]
+		local sale_ttl_ms = ARGV[11]
+		local claimed_key = KEYS[9]
+		local items_key = KEYS[10]
+		local item_id = ARGV[12]
+		local item_number = tonumber(ARGV[13])
+		local item_prefix = ARGV[14]
+		local holds_key = KEYS[11]
+		local sealed = ARGV[15] == "1"
+		local tier_purchases_key = KEYS[12]
+		local tier_codes_key = KEYS[13]
+		local rarity_limits = ARGV[16]
+		local registered_users_key = KEYS[14]
+		-- Units the inventory may go below zero, for merchants expecting
+		-- payment drop-off
+		local oversell = tonumber(redis.call('GET', KEYS[15]) or '0')
+		local overselling = false
+		local stock_key = KEYS[16]
+
+		-- Every reply but a code already in use, which the caller retries
+		-- with another, is counted per sale
+		local function outcome(status)
+			redis.call('HINCRBY', KEYS[17], status, 1)
+			redis.call('PEXPIRE', KEYS[17], sale_ttl_ms)
+			return status
+		end
+
+		-- A sale that is rolling over takes no new reservations
+		if redis.call('EXISTS', KEYS[6]) == 1 then
+			return outcome("sale_closing")
+		end
+
+		-- Only registered users can reserve
+		if redis.call('SISMEMBER', registered_users_key, user_id) == 0 then
+			return outcome("unknown_user")
+		end
+
+		-- A live code is never issued twice
+		if redis.call('EXISTS', code_key) == 1 then
+			return "code_taken"
+		end
+
+		-- Expired codes no longer count against the user's budget
+		redis.call('ZREMRANGEBYSCORE', outstanding_key, '-inf', now_ms)
+		local outstanding = redis.call('ZCARD', outstanding_key)
+
+		-- The per-user limit caps owned items: purchases plus live reservations
+		local purchased = tonumber(redis.call('HGET', user_key, user_id) or '0')
+		if purchased + outstanding >= max_per_user then
+			return outcome("user_limit_exceeded")
+		end
+
+		if max_outstanding > 0 and outstanding >= max_outstanding then
+			return outcome("too_many_outstanding")
+		end
+
+		-- A category-filtered checkout needs stock left in that category
+		-- and an item of it, see below
+		if category ~= "" then
+			local category_left = redis.call('HGET', category_key, category)
+			if not category_left then
+				return outcome("unknown_category")
+			end
+			-- Oversold units are capped overall, not per category
+			if tonumber(category_left) <= 0 and oversell == 0 then
+				return outcome("category_sold_out")
+			end
+		end
+
+		-- A promo code must exist, be unexpired and have redemptions left
+		local percent_off = 0
+		if promo_code ~= "" then
+			local promo = redis.call('HMGET', promo_key, 'percent_off', 'max_redemptions', 'expires_at_ms', 'redeemed')
+			if not promo[1] then
+				return outcome("promo_invalid")
+			end
+			local expires_at_ms = tonumber(promo[3])
+			if expires_at_ms > 0 and expires_at_ms <= now_ms then
+				return outcome("promo_expired")
+			end
+			local max_redemptions = tonumber(promo[2])
+			if max_redemptions > 0 and tonumber(promo[4] or '0') >= max_redemptions then
+				return outcome("promo_exhausted")
+			end
+			percent_off = tonumber(promo[1])
+		end
+
+		-- A filtered any-available checkout takes the first unclaimed item
+		-- of its category: the first clear bit once the items outside the
+		-- category are set along with the claimed ones. Oversold units are
+		-- not handed out by category
+		if item_id == "" and category ~= "" then
+			local category_items_key = KEYS[18]
+			local pick_key = KEYS[19]
+			if redis.call('EXISTS', category_items_key) == 0 then
+				return outcome("items_not_numbered")
+			end
+			redis.call('BITOP', 'NOT', pick_key, category_items_key)
+			redis.call('BITOP', 'OR', pick_key, pick_key, claimed_key)
+			local pos = redis.call('BITPOS', pick_key, 0)
+			redis.call('DEL', pick_key)
+			if redis.call('GETBIT', category_items_key, pos) == 0 then
+				return outcome("category_sold_out")
+			end
+			item_id = string.format('%s%06d', item_prefix, pos + 1)
+			item_number = pos + 1
+		end
+
+		-- An any-available checkout takes the first unclaimed numbered item
+		-- that the sale's item metadata knows about
+		if item_id == "" then
+			local pos = redis.call('BITPOS', claimed_key, 0)
+			item_id = string.format('%s%06d', item_prefix, pos + 1)
+			if redis.call('HEXISTS', items_key, item_id) == 0 then
+				if pos == 0 then
+					return outcome("items_not_numbered")
+				end
+				-- With every item claimed, oversold units go to the items
+				-- again in turn
+				local left = tonumber(redis.call('GET', inventory_key) or '0')
+				if oversell == 0 or left <= -oversell then
+					return outcome("sold_out")
+				end
+				pos = (-left) % redis.call('HLEN', items_key)
+				item_id = string.format('%s%06d', item_prefix, pos + 1)
+				overselling = true
+			end
+			item_number = pos + 1
+		end
+
+		-- An item sold by quantity needs a unit left, unless it is being
+		-- oversold
+		local stock_left = redis.call('HGET', stock_key, item_id)
+		if stock_left and tonumber(stock_left) <= 0 and not overselling then
+			return outcome("sold_out")
+		end
+
+		-- A named item is sold once: while a live code holds it, or once
+		-- it is sold, it cannot be reserved again. Items sold by quantity
+		-- are held by unit, so their holds do not count
+		if ARGV[12] ~= "" and not stock_left then
+			local hold = redis.call('HGET', holds_key, item_id)
+			if hold and (hold == "sold" or (tonumber(hold) or 0) > now_ms) then
+				return outcome("already_reserved_item")
+			end
+		end
+
+		-- The item's own category is counted down, so a filtered checkout
+		-- must have picked an item of the category it asked for
+		local meta = redis.call('HGET', items_key, item_id)
+		local item_category = (meta and cjson.decode(meta).category) or ""
+		if category ~= "" and item_category ~= category then
+			return outcome("category_mismatch")
+		end
+
+		-- A capped rarity tier limits the items of that tier the user owns,
+		-- counted like the per-user limit; codes that expired no longer count
+		local tier = ""
+		if rarity_limits ~= "" then
+			tier = (meta and cjson.decode(meta).rarity) or "common"
+			local limit = cjson.decode(rarity_limits)[tier]
+			if limit then
+				redis.call('ZREMRANGEBYSCORE', tier_codes_key, '-inf', now_ms)
+				local owned = tonumber(redis.call('HGET', tier_purchases_key, tier .. ':' .. user_id) or '0')
+				for _, member in ipairs(redis.call('ZRANGE', tier_codes_key, 0, -1)) do
+					if string.sub(member, 1, #tier + 1) == tier .. ':' then
+						owned = owned + 1
+					end
+				end
+				if owned >= limit then
+					return outcome("rarity_limit_exceeded")
+				end
+			else
+				tier = ""
+			end
+		end
+
+		-- Try to reserve inventory
+		local remaining = redis.call('DECR', inventory_key)
+		if remaining < -oversell then
+			redis.call('INCR', inventory_key)
+			return outcome("sold_out")
+		end
+
+		if remaining == 0 then
+			redis.call('SET', sold_out_key, now_ms, 'NX', 'PX', sale_ttl_ms)
+		end
+
+		-- HINCRBY would add a category the sale does not count
+		if item_category ~= "" and redis.call('HEXISTS', category_key, item_category) == 1 then
+			redis.call('HINCRBY', category_key, item_category, -1)
+		end
+
+		-- An item sold by quantity is only claimed with its last unit
+		local units_left = 0
+		if stock_left then
+			units_left = redis.call('HINCRBY', stock_key, item_id, -1)
+		end
+		if item_number > 0 and units_left <= 0 then
+			redis.call('SETBIT', claimed_key, item_number - 1, 1)
+			redis.call('PEXPIRE', claimed_key, sale_ttl_ms)
+		end
+		redis.call('HSET', holds_key, item_id, expires_ms)
+		redis.call('PEXPIRE', holds_key, sale_ttl_ms)
+
+		if promo_code ~= "" then
+			redis.call('HINCRBY', promo_key, 'redeemed', 1)
+		end
+		-- A sealed payload is completed by the caller instead
+		if not sealed and (promo_code ~= "" or ARGV[12] == "" or item_category ~= category) then
+			local info = cjson.decode(payload)
+			info.item_id = item_id
+			if item_category ~= "" then
+				info.category = item_category
+			else
+				info.category = nil
+			end
+			if promo_code ~= "" then
+				info.promo_code = promo_code
+				info.percent_off = percent_off
+			end
+			payload = cjson.encode(info)
+		end
+
+		redis.call('SET', code_key, payload, 'PX', ttl_ms)
+		redis.call('ZADD', outstanding_key, expires_ms, code)
+		redis.call('PEXPIRE', outstanding_key, ttl_ms)
+		if tier ~= "" then
+			redis.call('ZADD', tier_codes_key, expires_ms, tier .. ':' .. code)
+			redis.call('PEXPIRE', tier_codes_key, ttl_ms)
+		end
+
+		outcome("success")
+		return {"success", item_id, percent_off, item_category}
+	`)
+
+	// completePurchaseScript redeems the checkout code ARGV[1] as purchase
+	// ARGV[9], if its payload is still ARGV[2], the one CompletePurchase
+	// read to learn the sale and buyer the keys are named after. It leaves
+	// the code's completion record, the payload with the number of the unit
+	// of the item it bought, in KEYS[4], and returns the record and 0, or
+	// the record and 1 when the code was redeemed before. A gift to ARGV[6]
+	// is owned by the recipient, see CompletePurchase. Codes of users in the
+	// ban set KEYS[3], or gifted to one, are kept unredeemed.
+	completePurchaseScript = redis.NewScript(`
+		local code_key = KEYS[1]
+		local registered_users_key = KEYS[2]
+		local banned_key = KEYS[3]
+		local completed_key = KEYS[4]
+		local state_key = KEYS[5]
+		local user_purchases_key = KEYS[6]
+		local user_codes_key = KEYS[7]
+		local recipient_codes_key = KEYS[8]
+		local holds_key = KEYS[9]
+		local units_key = KEYS[10]
+		local items_key = KEYS[11]
+		local tier_purchases_key = KEYS[12]
+		local tier_codes_key = KEYS[13]
+		local code = ARGV[1]
+		local payload = ARGV[2]
+		local item_id = ARGV[3]
+		local user_id = ARGV[4]
+		local sale_ttl_ms = ARGV[5]
+		local recipient = ARGV[6]
+		local max_per_user = tonumber(ARGV[7])
+		local now_ms = ARGV[8]
+		local purchase_id = ARGV[9]
+
+		local data = redis.call('GET', code_key)
+		if data ~= payload then
+			-- Redeemed since the caller read it, by another try
+			local record = not data and redis.call('GET', completed_key)
+			if record then
+				return {record, 1}
+			end
+			return false
+		end
+		if redis.call('GET', state_key) == 'closed' then
+			return 'sale_closed'
+		end
+		if redis.call('SISMEMBER', banned_key, user_id) == 1 or redis.call('SISMEMBER', banned_key, recipient) == 1 then
+			return 'banned'
+		end
+
+		-- A gift counts against the recipient's cap, purchases plus live
+		-- codes, as if they had checked out themselves
+		local owner = user_id
+		if recipient ~= '' and recipient ~= user_id then
+			if redis.call('SISMEMBER', registered_users_key, recipient) == 0 then
+				return 'unknown_recipient'
+			end
+			local owned = tonumber(redis.call('HGET', user_purchases_key, recipient) or '0')
+				+ redis.call('ZCOUNT', recipient_codes_key, '(' .. now_ms, '+inf')
+			if owned >= max_per_user then
+				return 'recipient_limit_exceeded'
+			end
+			owner = recipient
+		end
+		redis.call('DEL', code_key)
+
+		redis.call('HINCRBY', user_purchases_key, owner, 1)
+		redis.call('ZREM', user_codes_key, code)
+		redis.call('HSET', holds_key, item_id, 'sold')
+
+		-- Units are numbered in the order they are bought
+		local unit = redis.call('HINCRBY', units_key, item_id, 1)
+		if redis.call('PTTL', units_key) < 0 then
+			redis.call('PEXPIRE', units_key, sale_ttl_ms)
+		end
+
+		-- Purchases count against RARITY_LIMITS by the item's tier
+		local meta = redis.call('HGET', items_key, item_id)
+		local tier = (meta and cjson.decode(meta).rarity) or 'common'
+		redis.call('HINCRBY', tier_purchases_key, tier .. ':' .. owner, 1)
+		redis.call('ZREM', tier_codes_key, tier .. ':' .. code)
+
+		local record = cjson.encode({purchase_id = purchase_id, purchased_at_ms = now_ms, unit = unit, recipient_id = recipient, payload = payload})
+		redis.call('SET', completed_key, record, 'PX', sale_ttl_ms)
+		return {record, 0}
+	`)
+
+	// extendCheckoutScript moves a code's expiry to ARGV[6] if its payload
+	// is still ARGV[1], along with its entries in the user's code indexes
+	// and the item's hold, see ExtendCheckout.
+	extendCheckoutScript = redis.NewScript(`
+		local code_key = KEYS[1]
+		local outstanding_key = KEYS[2]
+		local tier_codes_key = KEYS[3]
+		local holds_key = KEYS[4]
+		local items_key = KEYS[5]
+		local state_key = KEYS[6]
+		local code = ARGV[3]
+		local item_id = ARGV[4]
+		local old_expires_ms = ARGV[5]
+		local expires_ms = ARGV[6]
+		local ttl_ms = tonumber(expires_ms) - tonumber(ARGV[7])
+
+		local data = redis.call('GET', code_key)
+		if not data then
+			return false
+		end
+		-- Another extension got there first
+		if data ~= ARGV[1] then
+			return "extended"
+		end
+		if redis.call('EXISTS', state_key) == 1 then
+			return "sale_closing"
+		end
+
+		redis.call('SET', code_key, ARGV[2], 'PX', ttl_ms)
+		redis.call('ZADD', outstanding_key, 'XX', expires_ms, code)
+		local meta = redis.call('HGET', items_key, item_id)
+		local tier = (meta and cjson.decode(meta).rarity) or 'common'
+		redis.call('ZADD', tier_codes_key, 'XX', expires_ms, tier .. ':' .. code)
+		-- The indexes must outlive the code they count
+		for _, key in ipairs({outstanding_key, tier_codes_key}) do
+			local pttl = redis.call('PTTL', key)
+			if pttl >= 0 and pttl < ttl_ms then
+				redis.call('PEXPIRE', key, ttl_ms)
+			end
+		end
+		-- The hold follows unless a later code holds the item
+		if redis.call('HGET', holds_key, item_id) == old_expires_ms then
+			redis.call('HSET', holds_key, item_id, expires_ms)
+		end
+		return "ok"
+	`)
+
+	// setCodeTTLScript rewrites the code TTL of the current-sale pointer.
+	setCodeTTLScript = redis.NewScript(`
+		local data = redis.call('GET', KEYS[1])
+		if not data then
+			return 0
+		end
+		local sale = cjson.decode(data)
+		if sale.sale_id ~= ARGV[1] then
+			return 0
+		end
+		sale.code_ttl_ms = tonumber(ARGV[2])
+		redis.call('SET', KEYS[1], cjson.encode(sale), 'KEEPTTL')
+		return 1
+	`)
+
+	// joinQueueScript places a user in a sale's waiting queue once.
+	joinQueueScript = redis.NewScript(`
+		local token = redis.call('HGET', KEYS[1], ARGV[1])
+		if token then
+			return {token, redis.call('ZSCORE', KEYS[2], token)}
+		end
+
+		local place = redis.call('INCR', KEYS[3])
+		redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+		redis.call('ZADD', KEYS[2], place, ARGV[2])
+		for _, key in ipairs(KEYS) do
+			redis.call('PEXPIRE', key, ARGV[3])
+		end
+		return {ARGV[2], tostring(place)}
+	`)
+
+	// claimRestockScript grants what is left of a restock budget.
+	claimRestockScript = redis.NewScript(`
+		local done = tonumber(redis.call('GET', KEYS[1]) or '0')
+		local granted = math.min(tonumber(ARGV[1]), tonumber(ARGV[2]) - done)
+		if granted <= 0 then
+			return 0
+		end
+		redis.call('INCRBY', KEYS[1], granted)
+		redis.call('EXPIRE', KEYS[1], ARGV[3])
+		return granted
+	`)
+
+	// acquireLeaderScript takes the lock when it is free, or extends it when
+	// the caller already holds it. Every fresh acquisition bumps the epoch
+	// counter, which doubles as the fencing token for the term. Returns 0
+	// when another owner holds the lock.
+	acquireLeaderScript = redis.NewScript(`
+		local lock_key = KEYS[1]
+		local epoch_key = KEYS[2]
+		local owner = ARGV[1]
+		local ttl_ms = ARGV[2]
+
+		local holder = redis.call('GET', lock_key)
+		if holder == owner then
+			redis.call('PEXPIRE', lock_key, ttl_ms)
+			return tonumber(redis.call('GET', epoch_key) or '0')
+		end
+		if not holder then
+			redis.call('SET', lock_key, owner, 'PX', ttl_ms)
+			return redis.call('INCR', epoch_key)
+		end
+
+		return 0
+	`)
+
+	releaseLeaderScript = redis.NewScript(`
+		if redis.call('GET', KEYS[1]) == ARGV[1] then
+			return redis.call('DEL', KEYS[1])
+		end
+		return 0
+	`)
+
+	// unclaimItemScript clears an item's bit in the claimed or sold bitmap
+	// if the bitmap still exists.
+	unclaimItemScript = redis.NewScript(`
+		if redis.call('EXISTS', KEYS[1]) == 1 then
+			return redis.call('SETBIT', KEYS[1], ARGV[1], 0)
+		end
+		return 0
+	`)
+
+	// restockItemScript gives a unit back to an item sold by quantity; other
+	// items are left out of the stock.
+	restockItemScript = redis.NewScript(`
+		if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 1 then
+			return redis.call('HINCRBY', KEYS[1], ARGV[1], 1)
+		end
+		return 0
+	`)
+
+	// unredeemPromoScript credits a redemption back to a promo code if the
+	// code still exists.
+	unredeemPromoScript = redis.NewScript(`
+		if redis.call('EXISTS', KEYS[1]) == 1 then
+			return redis.call('HINCRBY', KEYS[1], 'redeemed', -1)
+		end
+		return 0
+	`)
+
+	// claimWebhooksScript leases up to ARGV[3] due webhook deliveries by
+	// pushing them back to ARGV[2], and returns their IDs and payloads.
+	// Deliveries whose payload is gone are dropped.
+	claimWebhooksScript = redis.NewScript(`
+		local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[3]))
+		local out = {}
+		for _, id in ipairs(due) do
+			local payload = redis.call('HGET', KEYS[2], id)
+			if payload then
+				redis.call('ZADD', KEYS[1], ARGV[2], id)
+				table.insert(out, id)
+				table.insert(out, payload)
+			else
+				redis.call('ZREM', KEYS[1], id)
+			end
+		end
+		return out
+	`)
+
+	// requeuePurchasesScript puts the purchases of the processing list
+	// KEYS[1] whose lease in KEYS[3] ran out before ARGV[1] back on the
+	// pending queue KEYS[2]. A purchase without a lease, moved by a worker
+	// that has not leased it yet, gets one ending at ARGV[2] instead.
+	requeuePurchasesScript = redis.NewScript(`
+		local requeued = 0
+		for _, id in ipairs(redis.call('LRANGE', KEYS[1], 0, -1)) do
+			local lease = redis.call('ZSCORE', KEYS[3], id)
+			if not lease then
+				redis.call('ZADD', KEYS[3], ARGV[2], id)
+			elseif tonumber(lease) <= tonumber(ARGV[1]) then
+				redis.call('LREM', KEYS[1], 1, id)
+				redis.call('ZREM', KEYS[3], id)
+				redis.call('RPUSH', KEYS[2], id)
+				requeued = requeued + 1
+			end
+		end
+		return requeued
+	`)
+
+	// applyFallbackPurchaseScript books a sale made by the Postgres
+	// fallback as the purchase script would have: item ARGV[2], number
+	// ARGV[3], goes to user ARGV[1], see ApplyFallbackPurchase for its
+	// keys. An item Redis already sold is left alone.
+	applyFallbackPurchaseScript = redis.NewScript(`
+		local item_id = ARGV[2]
+		local item_number = tonumber(ARGV[3])
+		if redis.call('HGET', KEYS[6], item_id) == 'sold' then
+			return 0
+		end
+
+		redis.call('DECR', KEYS[1])
+		redis.call('HINCRBY', KEYS[2], ARGV[1], 1)
+
+		local meta = redis.call('HGET', KEYS[5], item_id)
+		local category = (meta and cjson.decode(meta).category) or ''
+		if category ~= '' and redis.call('HEXISTS', KEYS[3], category) == 1 then
+			redis.call('HINCRBY', KEYS[3], category, -1)
+		end
+		local tier = (meta and cjson.decode(meta).rarity) or 'common'
+		redis.call('HINCRBY', KEYS[7], tier .. ':' .. ARGV[1], 1)
+
+		local units_left = 0
+		if redis.call('HEXISTS', KEYS[8], item_id) == 1 then
+			units_left = redis.call('HINCRBY', KEYS[8], item_id, -1)
+		end
+		if item_number > 0 and units_left <= 0 then
+			redis.call('SETBIT', KEYS[4], item_number - 1, 1)
+			redis.call('SETBIT', KEYS[9], item_number - 1, 1)
+			redis.call('PEXPIRE', KEYS[4], ARGV[4])
+		end
+		redis.call('HSET', KEYS[6], item_id, 'sold')
+		redis.call('PEXPIRE', KEYS[6], ARGV[4])
+		return 1
+	`)
+
+	// warmStandbyScript claims sale state on a standby for the replica
+	// that sets its inventory first, and writes the rest of what
+	// WarmStandby restores in the same step, so no checkout can run
+	// against a half-warmed sale. ARGV[4] to ARGV[7] are JSON: category
+	// counts, claimed item numbers, units sold and units left per item.
+	warmStandbyScript = redis.NewScript(`
+		if not redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+			return 0
+		end
+		redis.call('SET', KEYS[2], '1', 'PX', ARGV[2])
+		for category, count in pairs(cjson.decode(ARGV[4])) do
+			redis.call('HSET', KEYS[3], category, count)
+		end
+		redis.call('PEXPIRE', KEYS[3], ARGV[2])
+		for _, n in ipairs(cjson.decode(ARGV[5])) do
+			redis.call('SETBIT', KEYS[4], n - 1, 1)
+		end
+		for item_id, units in pairs(cjson.decode(ARGV[6])) do
+			redis.call('HSET', KEYS[5], item_id, units)
+		end
+		for item_id, left in pairs(cjson.decode(ARGV[7])) do
+			redis.call('HSET', KEYS[6], item_id, left)
+		end
+		for i = 4, 6 do
+			redis.call('PEXPIRE', KEYS[i], ARGV[3])
+		end
+		return 1
+	`)
+
+	// recordItemViewScript counts a view of item ARGV[1] if the sale has
+	// it, so beacons for made-up items do not grow the ranking.
+	recordItemViewScript = redis.NewScript(`
+		if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 0 then
+			return 0
+		end
+		redis.call('ZINCRBY', KEYS[2], 1, ARGV[1])
+		redis.call('PEXPIRE', KEYS[2], ARGV[2])
+		return 1
+	`)
+
+	// pushBackExpiryScript adds ARGV[1] milliseconds to the TTL of each of
+	// KEYS that has one.
+	pushBackExpiryScript = redis.NewScript(`
+		local n = 0
+		for _, key in ipairs(KEYS) do
+			local ttl = redis.call('PTTL', key)
+			if ttl > 0 then
+				redis.call('PEXPIRE', key, ttl + tonumber(ARGV[1]))
+				n = n + 1
+			end
+		end
+		return n
+	`)
+
+	// publishOutboxScript publishes an outbox event unless its marker says
+	// it was published before, see PublishOutboxEvent.
+	publishOutboxScript = redis.NewScript(`
+		if not redis.call('SET', KEYS[1], '1', 'NX', 'PX', ARGV[1]) then
+			return 0
+		end
+		if ARGV[2] ~= "" then
+			redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[3], '*', 'event', ARGV[2])
+		end
+		for i = 5, #ARGV, 2 do
+			redis.call('HSET', KEYS[4], ARGV[i], ARGV[i + 1])
+			redis.call('ZADD', KEYS[3], ARGV[4], ARGV[i])
+		end
+		return 1
+	`)
+)
+
+var scripts = []*redis.Script{
+	reserveItemScript,
+	completePurchaseScript,
+	extendCheckoutScript,
+	setCodeTTLScript,
+	joinQueueScript,
+	claimRestockScript,
+	acquireLeaderScript,
+	releaseLeaderScript,
+	unclaimItemScript,
+	restockItemScript,
+	unredeemPromoScript,
+	claimWebhooksScript,
+	requeuePurchasesScript,
+	applyFallbackPurchaseScript,
+	warmStandbyScript,
+	recordItemViewScript,
+	publishOutboxScript,
+	pushBackExpiryScript,
+}
+
+// loadScripts loads every script into Redis' script cache with SCRIPT LOAD.
+func (s *service) loadScripts(ctx context.Context) error {
+	for _, script := range scripts {
+		if err := script.Load(ctx, s.client).Err(); err != nil {
+			return fmt.Errorf("failed to load Lua script: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// sealedPrefix marks a checkout payload encrypted with AES-GCM. Payloads
+// without it are plaintext JSON, so codes issued before encryption was
+// turned on can still be redeemed.
+const sealedPrefix = "enc:v1:"
+
+// sealer encrypts checkout payloads, so a dump of Redis does not say which
+// user holds which item. Each payload is bound to its code: a sealed
+// payload copied to another code key fails to open.
+type sealer struct {
+	aead cipher.AEAD
+}
+
+// newSealer builds a sealer from a base64 AES-128, -192 or -256 key, read
+// from keyFile when one is named. It returns nil when no key is set.
+func newSealer(key, keyFile string) (*sealer, error) {
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read checkout encryption key: %w", err)
+		}
+		key = strings.TrimSpace(string(data))
+	}
+	if key == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("checkout encryption key is not base64: %w", err)
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkout encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &sealer{aead: aead}, nil
+}
+
+func (s *sealer) seal(code string, plaintext []byte) string {
+	nonce := make([]byte, s.aead.NonceSize())
+	rand.Read(nonce)
+	sealed := s.aead.Seal(nonce, nonce, plaintext, []byte(code))
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed)
+}
+
+func (s *sealer) open(code, payload string) ([]byte, error) {
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(payload, sealedPrefix))
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return nil, errors.New("malformed sealed checkout payload")
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	return s.aead.Open(nil, nonce, ciphertext, []byte(code))
+}
+
+// encodeCheckout is the payload stored under a checkout code.
+func (s *service) encodeCheckout(code string, info *CheckoutInfo) string {
+	data, _ := json.Marshal(info)
+	if s.sealer == nil {
+		return string(data)
+	}
+	return s.sealer.seal(code, data)
+}
+
+// decodeCheckout reads the payload stored under a checkout code.
+func (s *service) decodeCheckout(code, payload string) (*CheckoutInfo, error) {
+	data := []byte(payload)
+	if isSealed(payload) {
+		if s.sealer == nil {
+			return nil, errors.New("checkout payload is encrypted but no key is configured")
+		}
+		var err error
+		if data, err = s.sealer.open(code, payload); err != nil {
+			return nil, fmt.Errorf("failed to decrypt checkout payload: %w", err)
+		}
+	}
+
+	var info CheckoutInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func isSealed(payload string) bool {
+	return strings.HasPrefix(payload, sealedPrefix)
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func staffPicksKey(saleID string) string {
+	return fmt.Sprintf("sale:%s:staff_picks", saleID)
+}
+
+// itemViewsKey ranks a sale's items by how often they were looked at.
+func itemViewsKey(saleID string) string {
+	return fmt.Sprintf("sale:%s:item_views", saleID)
+}
+
+// SetStaffPicks replaces the items staff chose to showcase in a sale, in
+// the order given.
+func (s *service) SetStaffPicks(ctx context.Context, saleID string, itemIDs []string) error {
+	key := staffPicksKey(saleID)
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, key)
+	if len(itemIDs) > 0 {
+		values := make([]interface{}, len(itemIDs))
+		for i, id := range itemIDs {
+			values[i] = id
+		}
+		pipe.RPush(ctx, key, values...)
+		pipe.Expire(ctx, key, saleStatsTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetStaffPicks returns the staff picks of a sale; none when there are none.
+func (s *service) GetStaffPicks(ctx context.Context, saleID string) ([]string, error) {
+	return s.client.LRange(ctx, staffPicksKey(saleID), 0, -1).Result()
+}
+
+// RecordItemView counts a look at an item of a sale. Items the sale does
+// not have are an "unknown item" error.
+func (s *service) RecordItemView(ctx context.Context, saleID, itemID string) error {
+	keys := []string{fmt.Sprintf("sale:%s:items", saleID), itemViewsKey(saleID)}
+	counted, err := recordItemViewScript.Run(ctx, s.client, keys, itemID, saleStatsTTL.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if counted == 0 {
+		return fmt.Errorf("unknown item")
+	}
+	return nil
+}
+
+// MostViewedItems returns up to n items of a sale, most viewed first.
+func (s *service) MostViewedItems(ctx context.Context, saleID string, n int) ([]string, error) {
+	ids, err := s.client.ZRevRange(ctx, itemViewsKey(saleID), 0, int64(n-1)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return ids, err
+}
+
+// ItemViews is how often an item was looked at.
+type ItemViews struct {
+	ItemID string
+	Views  int64
+}
+
+// trendingScanLimit bounds how far down the view ranking TrendingItems
+// looks for unsold items, so a sale that is nearly sold out does not read
+// the whole ranking.
+const trendingScanLimit = 1000
+
+// TrendingItems returns up to n of a sale's most viewed items that are not
+// sold yet, most viewed first. Held items are kept: their holds may lapse.
+func (s *service) TrendingItems(ctx context.Context, saleID string, n int) ([]ItemViews, error) {
+	page := int64(max(2*n, 20))
+	var trending []ItemViews
+	for start := int64(0); len(trending) < n && start < trendingScanLimit; start += page {
+		ranked, err := s.client.ZRevRangeWithScores(ctx, itemViewsKey(saleID), start, start+page-1).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		if len(ranked) == 0 {
+			break
+		}
+
+		pipe := s.client.Pipeline()
+		holds := make([]*redis.StringCmd, len(ranked))
+		sold := make([]*redis.IntCmd, len(ranked))
+		for i, z := range ranked {
+			itemID, _ := z.Member.(string)
+			holds[i] = pipe.HGet(ctx, itemHoldsKey(saleID), itemID)
+			if number := ItemNumber(saleID, itemID); number > 0 {
+				sold[i] = pipe.GetBit(ctx, fmt.Sprintf("sale:%s:sold_bitmap", saleID), int64(number-1))
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+
+		for i, z := range ranked {
+			if holds[i].Val() == ItemSold || sold[i] != nil && sold[i].Val() == 1 {
+				continue
+			}
+			itemID, _ := z.Member.(string)
+			trending = append(trending, ItemViews{ItemID: itemID, Views: int64(z.Score)})
+			if len(trending) == n {
+				break
+			}
+		}
+		if int64(len(ranked)) < page {
+			break
+		}
+	}
+	return trending, nil
+}
@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SnapshotKey is one key of a sale snapshot in Redis DUMP format.
+type SnapshotKey struct {
+	Key string `json:"key"`
+	// TTLMs is the key's remaining TTL when the snapshot was taken, 0 for
+	// keys without one.
+	TTLMs int64  `json:"ttl_ms"`
+	Value []byte `json:"value"`
+}
+
+// SaleSnapshot is everything Redis holds for one sale: its sale:<id>:* keys
+// (inventory, category stock, user purchases, sold bitmap, outstanding code
+// sets, items, queue), the checkout codes still outstanding, and the
+// current-sale pointer if it points at the sale.
+type SaleSnapshot struct {
+	SaleID  string        `json:"sale_id"`
+	TakenAt time.Time     `json:"taken_at"`
+	Keys    []SnapshotKey `json:"keys"`
+	// Codes is how many outstanding checkout codes Keys holds.
+	Codes int `json:"codes"`
+}
+
+const snapshotScanCount = 1000
+
+// SnapshotSale dumps a sale's keys. Each key is read consistently, but the
+// snapshot as a whole is not a single point in time: purchases made while it
+// is taken may be half captured.
+func (s *service) SnapshotSale(ctx context.Context, saleID string) (*SaleSnapshot, error) {
+	snap := &SaleSnapshot{SaleID: saleID, TakenAt: time.Now()}
+
+	var keys []string
+	iter := s.client.Scan(ctx, 0, fmt.Sprintf("sale:%s:*", saleID), snapshotScanCount).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sale keys: %w", err)
+	}
+
+	// Outstanding codes are found through the users' code sets.
+	userCodes := fmt.Sprintf("sale:%s:user_codes:", saleID)
+	now := fmt.Sprint(snap.TakenAt.UnixMilli())
+	var codeKeys []string
+	for _, key := range keys {
+		if !strings.HasPrefix(key, userCodes) {
+			continue
+		}
+		codes, err := s.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: now, Max: "+inf"}).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list outstanding codes: %w", err)
+		}
+		for _, code := range codes {
+			codeKeys = append(codeKeys, s.checkoutCodeKey(saleID, code))
+		}
+	}
+	keys = append(keys, codeKeys...)
+
+	if current, err := s.GetCurrentSale(ctx); err == nil && current.SaleID == saleID {
+		keys = append(keys, s.tenantKey(currentSaleKey))
+	}
+
+	for start := 0; start < len(keys); start += snapshotScanCount {
+		batch := keys[start:min(start+snapshotScanCount, len(keys))]
+		pipe := s.client.Pipeline()
+		dumps := make([]*redis.StringCmd, len(batch))
+		ttls := make([]*redis.DurationCmd, len(batch))
+		for i, key := range batch {
+			dumps[i] = pipe.Dump(ctx, key)
+			ttls[i] = pipe.PTTL(ctx, key)
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("failed to dump sale keys: %w", err)
+		}
+		for i, key := range batch {
+			value, err := dumps[i].Result()
+			if err != nil {
+				// Expired or redeemed since it was listed.
+				continue
+			}
+			sk := SnapshotKey{Key: key, Value: []byte(value)}
+			if ttl := ttls[i].Val(); ttl > 0 {
+				sk.TTLMs = ttl.Milliseconds()
+			}
+			snap.Keys = append(snap.Keys, sk)
+			if strings.HasPrefix(key, "checkout_code:") {
+				snap.Codes++
+			}
+		}
+	}
+	return snap, nil
+}
+
+// RestoreSale writes a snapshot back, replacing whatever the keys hold now.
+// TTLs are shortened by the time since the snapshot, and keys that would
+// already have expired, such as codes past their expiry, are skipped. It
+// returns how many keys were restored.
+func (s *service) RestoreSale(ctx context.Context, snap *SaleSnapshot) (int, error) {
+	elapsed := time.Since(snap.TakenAt).Milliseconds()
+
+	restored := 0
+	for start := 0; start < len(snap.Keys); start += snapshotScanCount {
+		batch := snap.Keys[start:min(start+snapshotScanCount, len(snap.Keys))]
+		pipe := s.client.Pipeline()
+		n := 0
+		for _, sk := range batch {
+			var ttl time.Duration
+			if sk.TTLMs > 0 {
+				if sk.TTLMs <= elapsed {
+					continue
+				}
+				ttl = time.Duration(sk.TTLMs-elapsed) * time.Millisecond
+			}
+			pipe.RestoreReplace(ctx, sk.Key, ttl, string(sk.Value))
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return restored, fmt.Errorf("failed to restore sale keys: %w", err)
+		}
+		restored += n
+	}
+	return restored, nil
+}
@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+)
+
+// itemStockKey counts the units left of each item sold by quantity, by
+// item ID. Items sold one unit at a time are not in it.
+func itemStockKey(saleID string) string {
+	return fmt.Sprintf("sale:%s:item_stock", saleID)
+}
+
+// unitsSoldKey counts the purchases of each item of a sale, by item ID,
+// which numbers the units sold.
+func unitsSoldKey(saleID string) string {
+	return fmt.Sprintf("sale:%s:units_sold", saleID)
+}
+
+// SetItemStock replaces the units left of a sale's items sold by quantity.
+// The reservation script takes a unit of such an item at a time, and only
+// counts the item claimed once the last one is gone. Items left out are
+// sold one unit at a time.
+func (s *service) SetItemStock(ctx context.Context, saleID string, stock map[string]int) error {
+	key := itemStockKey(saleID)
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, key)
+	if len(stock) > 0 {
+		fields := make(map[string]interface{}, len(stock))
+		for itemID, units := range stock {
+			fields[itemID] = units
+		}
+		pipe.HSet(ctx, key, fields)
+		pipe.Expire(ctx, key, saleStatsTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
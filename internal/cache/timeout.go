@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrTimeout is returned when a call outran its own deadline from
+// WithTimeouts, as opposed to the caller's context ending.
+var ErrTimeout = errors.New("cache timeout")
+
+// Timeouts configures WithTimeouts. Reserve and Purchase bound the checkout
+// and purchase scripts, Read the other calls on the request path; zero
+// leaves a call unbounded. OnTimeout, when set, is called with the
+// operation's name for every call that timed out.
+type Timeouts struct {
+	Reserve   time.Duration
+	Purchase  time.Duration
+	Read      time.Duration
+	OnTimeout func(op string)
+}
+
+// timed gives each request-path call its own short deadline, so a slow
+// Redis fails the request fast instead of holding it for the client's
+// read timeout. Background work keeps the client-level timeouts.
+type timed struct {
+	Service
+	timeouts Timeouts
+}
+
+// WithTimeouts bounds the request-path calls of svc by timeouts. Other
+// calls go straight to svc.
+func WithTimeouts(svc Service, timeouts Timeouts) Service {
+	return &timed{Service: svc, timeouts: timeouts}
+}
+
+func (t *timed) ForTenant(tenant string) Service {
+	return &timed{Service: t.Service.ForTenant(tenant), timeouts: t.timeouts}
+}
+
+func (t *timed) ReserveItem(ctx context.Context, saleID, userID, itemID, category, promoCode string, ttl time.Duration) (*Reservation, error) {
+	return within(t, ctx, "reserve_item", t.timeouts.Reserve, func(ctx context.Context) (*Reservation, error) {
+		return t.Service.ReserveItem(ctx, saleID, userID, itemID, category, promoCode, ttl)
+	})
+}
+
+func (t *timed) CompletePurchase(ctx context.Context, saleID, code, recipientID string) (*CheckoutInfo, error) {
+	return within(t, ctx, "complete_purchase", t.timeouts.Purchase, func(ctx context.Context) (*CheckoutInfo, error) {
+		return t.Service.CompletePurchase(ctx, saleID, code, recipientID)
+	})
+}
+
+func (t *timed) ExtendCheckout(ctx context.Context, saleID, code string, window, by time.Duration) (*CheckoutInfo, error) {
+	return within(t, ctx, "extend_checkout", t.timeouts.Purchase, func(ctx context.Context) (*CheckoutInfo, error) {
+		return t.Service.ExtendCheckout(ctx, saleID, code, window, by)
+	})
+}
+
+func (t *timed) GetUserPurchaseCount(ctx context.Context, saleID, userID string) (int, error) {
+	return within(t, ctx, "get_user_purchase_count", t.timeouts.Read, func(ctx context.Context) (int, error) {
+		return t.Service.GetUserPurchaseCount(ctx, saleID, userID)
+	})
+}
+
+func (t *timed) GetInventoryStatus(ctx context.Context, saleID string) (int, error) {
+	return within(t, ctx, "get_inventory_status", t.timeouts.Read, func(ctx context.Context) (int, error) {
+		return t.Service.GetInventoryStatus(ctx, saleID)
+	})
+}
+
+func (t *timed) GetShowcaseInfo(ctx context.Context, saleID string) (*ShowcaseInfo, error) {
+	return within(t, ctx, "get_showcase_info", t.timeouts.Read, func(ctx context.Context) (*ShowcaseInfo, error) {
+		return t.Service.GetShowcaseInfo(ctx, saleID)
+	})
+}
+
+func (t *timed) GetItems(ctx context.Context, saleID string, ids ...string) ([]ItemInfo, error) {
+	return within(t, ctx, "get_items", t.timeouts.Read, func(ctx context.Context) ([]ItemInfo, error) {
+		return t.Service.GetItems(ctx, saleID, ids...)
+	})
+}
+
+func (t *timed) ListReservations(ctx context.Context, saleID, userID string) ([]Reservation, error) {
+	return within(t, ctx, "list_reservations", t.timeouts.Read, func(ctx context.Context) ([]Reservation, error) {
+		return t.Service.ListReservations(ctx, saleID, userID)
+	})
+}
+
+func (t *timed) GetItemAvailability(ctx context.Context, saleID, itemID string) (*ItemAvailability, error) {
+	return within(t, ctx, "get_item_availability", t.timeouts.Read, func(ctx context.Context) (*ItemAvailability, error) {
+		return t.Service.GetItemAvailability(ctx, saleID, itemID)
+	})
+}
+
+func (t *timed) GetPendingPurchase(ctx context.Context, purchaseID string) (*PendingPurchase, error) {
+	return within(t, ctx, "get_pending_purchase", t.timeouts.Read, func(ctx context.Context) (*PendingPurchase, error) {
+		return t.Service.GetPendingPurchase(ctx, purchaseID)
+	})
+}
+
+func (t *timed) QueuePlace(ctx context.Context, saleID, token string) (int64, error) {
+	return within(t, ctx, "queue_place", t.timeouts.Read, func(ctx context.Context) (int64, error) {
+		return t.Service.QueuePlace(ctx, saleID, token)
+	})
+}
+
+// within runs fn under its own deadline d and turns running past it into
+// ErrTimeout. A context the caller cancelled is left as it is.
+func within[T any](t *timed, ctx context.Context, op string, d time.Duration, fn func(context.Context) (T, error)) (T, error) {
+	if d <= 0 {
+		return fn(ctx)
+	}
+	callCtx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	v, err := fn(callCtx)
+	if err != nil && callCtx.Err() != nil && ctx.Err() == nil {
+		if t.timeouts.OnTimeout != nil {
+			t.timeouts.OnTimeout(op)
+		}
+		var zero T
+		return zero, ErrTimeout
+	}
+	return v, err
+}
@@ -0,0 +1,24 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// userEventsChannel is the pub/sub channel of one user's realtime events.
+// Unlike the notifications stream nothing is kept: an event reaches the
+// user's open /ws/user connections, on whichever replica, or no one.
+func (s *service) userEventsChannel(userID string) string {
+	return s.tenantKey("user_events:" + userID)
+}
+
+func (s *service) PublishUserEvent(ctx context.Context, userID string, payload []byte) error {
+	return s.client.Publish(ctx, s.userEventsChannel(userID), payload).Err()
+}
+
+// SubscribeUserEvents subscribes to a user's events. The caller must close
+// the subscription.
+func (s *service) SubscribeUserEvents(ctx context.Context, userID string) *redis.PubSub {
+	return s.client.Subscribe(ctx, s.userEventsChannel(userID))
+}
@@ -0,0 +1,34 @@
+package cache
+
+import "context"
+
+// registeredUsersKey is the set of registered user IDs, shared by all
+// tenants like the users table it mirrors. ReserveItem refuses users that
+// are not in it.
+const registeredUsersKey = "users:registered"
+
+// registeredUsersKey is the set of a service's registered users: the shared
+// one, except in a sandbox, which keeps its own.
+func (s *service) registeredUsersKey() string {
+	if s.sandbox {
+		return s.tenantKey(registeredUsersKey)
+	}
+	return registeredUsersKey
+}
+
+// RegisterUsers adds user IDs to the set ReserveItem checks.
+func (s *service) RegisterUsers(ctx context.Context, userIDs ...string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	members := make([]interface{}, len(userIDs))
+	for i, id := range userIDs {
+		members[i] = id
+	}
+	return s.client.SAdd(ctx, s.registeredUsersKey(), members...).Err()
+}
+
+// RegisteredUserCount returns how many user IDs ReserveItem knows.
+func (s *service) RegisteredUserCount(ctx context.Context) (int64, error) {
+	return s.client.SCard(ctx, s.registeredUsersKey()).Result()
+}
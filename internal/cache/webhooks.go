@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Webhook deliveries of every tenant share one schedule: a sorted set of
+// delivery IDs scored by when each is due, next to a hash of their
+// payloads.
+const (
+	webhookScheduleKey = "webhooks:schedule"
+	webhookPayloadsKey = "webhooks:payloads"
+)
+
+// WebhookDelivery is a scheduled webhook delivery.
+type WebhookDelivery struct {
+	ID      string
+	Payload []byte
+}
+
+// ScheduleWebhook stores a delivery to be made at at, replacing the
+// payload of a delivery with the same ID.
+func (s *service) ScheduleWebhook(ctx context.Context, id string, payload []byte, at time.Time) error {
+	pipe := s.client.TxPipeline()
+	pipe.HSet(ctx, webhookPayloadsKey, id, payload)
+	pipe.ZAdd(ctx, webhookScheduleKey, redis.Z{Score: float64(at.UnixMilli()), Member: id})
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ClaimWebhooks returns up to n deliveries that are due, and leases them
+// for lease: a replica that dies while delivering leaves them to be
+// claimed again once the lease runs out.
+func (s *service) ClaimWebhooks(ctx context.Context, lease time.Duration, n int) ([]WebhookDelivery, error) {
+	now := time.Now()
+	res, err := claimWebhooksScript.Run(ctx, s.client, []string{webhookScheduleKey, webhookPayloadsKey},
+		now.UnixMilli(), now.Add(lease).UnixMilli(), n).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]WebhookDelivery, 0, len(res)/2)
+	for i := 0; i+1 < len(res); i += 2 {
+		deliveries = append(deliveries, WebhookDelivery{ID: res[i], Payload: []byte(res[i+1])})
+	}
+	return deliveries, nil
+}
+
+// CompleteWebhook forgets a delivery that succeeded or was given up on.
+func (s *service) CompleteWebhook(ctx context.Context, id string) error {
+	pipe := s.client.TxPipeline()
+	pipe.ZRem(ctx, webhookScheduleKey, id)
+	pipe.HDel(ctx, webhookPayloadsKey, id)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// WebhookBacklog is how many deliveries are scheduled or in flight.
+func (s *service) WebhookBacklog(ctx context.Context) (int64, error) {
+	return s.client.ZCard(ctx, webhookScheduleKey).Result()
+}
@@ -0,0 +1,300 @@
+// Package catalog loads and validates externally supplied item catalogs,
+// so a sale can sell real SKUs instead of generated items.
+package catalog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"flash_sale_contest/internal/money"
+)
+
+const (
+	MaxEntries = 100000
+	// MaxUnits bounds the units of a whole catalog, counting each entry's
+	// quantity.
+	MaxUnits = 1000000
+	// MaxBytes bounds a catalog once decompressed, so a small gzip upload
+	// cannot expand without limit.
+	MaxBytes = 256 << 20
+
+	maxNameLen     = 255
+	maxCategoryLen = 50
+	maxImageURLLen = 255
+	// maxReportedErrors bounds how many validation problems one error lists.
+	maxReportedErrors = 20
+
+	FormatCSV    = "csv"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+var skuPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,30}$`)
+
+// Rarity tiers of an item. RARITY_LIMITS caps how many items of a tier one
+// user may own in a sale.
+const (
+	RarityCommon    = "common"
+	RarityRare      = "rare"
+	RarityLegendary = "legendary"
+)
+
+// ValidRarity reports whether rarity is one of the rarity tiers.
+func ValidRarity(rarity string) bool {
+	switch rarity {
+	case RarityCommon, RarityRare, RarityLegendary:
+		return true
+	}
+	return false
+}
+
+// Entry is one sellable item of a catalog. Category, ImageURL, Price,
+// Currency, Rarity and Quantity are optional; the sale fills in defaults.
+type Entry struct {
+	SKU      string `json:"sku"`
+	Name     string `json:"name"`
+	Category string `json:"category,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	// Price is a decimal amount such as "19.99" in Currency, or in
+	// SALE_CURRENCY when Currency is empty.
+	Price    string `json:"price,omitempty"`
+	Currency string `json:"currency,omitempty"`
+	// Rarity is common, rare or legendary; empty is common.
+	Rarity string `json:"rarity,omitempty"`
+	// Quantity is how many units of the item the sale has; 0 is one.
+	Quantity int `json:"quantity,omitempty"`
+}
+
+// Units is how many units the entry stands for.
+func (e Entry) Units() int {
+	return max(e.Quantity, 1)
+}
+
+// LoadFile reads a catalog from path, picking the format from the
+// extension once any .gz is stripped.
+func LoadFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	format := FormatCSV
+	switch ext := strings.ToLower(filepath.Ext(strings.TrimSuffix(path, ".gz"))); ext {
+	case ".json":
+		format = FormatJSON
+	case ".ndjson", ".jsonl":
+		format = FormatNDJSON
+	}
+	return Parse(f, format)
+}
+
+// errTooLarge is returned once a catalog reads past MaxBytes.
+var errTooLarge = fmt.Errorf("catalog is larger than %d MiB uncompressed", MaxBytes>>20)
+
+// boundedReader fails reads past MaxBytes.
+type boundedReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (b *boundedReader) Read(p []byte) (int, error) {
+	if b.left <= 0 {
+		return 0, errTooLarge
+	}
+	if int64(len(p)) > b.left {
+		p = p[:b.left]
+	}
+	n, err := b.r.Read(p)
+	b.left -= int64(n)
+	return n, err
+}
+
+// Parse decodes and validates a catalog. CSV input needs a header row with
+// at least sku and name columns; JSON input is an array of entries and
+// NDJSON input one entry per line. Input starting with the gzip magic
+// number is decompressed first, whatever the format.
+func Parse(r io.Reader, format string) ([]Entry, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress catalog: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+	r = &boundedReader{r: r, left: MaxBytes}
+
+	var (
+		entries []Entry
+		err     error
+	)
+	switch format {
+	case FormatCSV:
+		entries, err = parseCSV(r)
+	case FormatJSON:
+		err = json.NewDecoder(r).Decode(&entries)
+	case FormatNDJSON:
+		entries, err = parseNDJSON(r)
+	default:
+		return nil, fmt.Errorf("unsupported catalog format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse catalog: %w", err)
+	}
+
+	if err := Validate(entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// errTooManyEntries stops streamed formats at MaxEntries, rather than
+// reading the rest only for Validate to refuse it.
+var errTooManyEntries = fmt.Errorf("catalog has more than %d entries", MaxEntries)
+
+func parseNDJSON(r io.Reader) ([]Entry, error) {
+	dec := json.NewDecoder(r)
+	var entries []Entry
+	for {
+		var e Entry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", len(entries)+1, err)
+		}
+		if len(entries) == MaxEntries {
+			return nil, errTooManyEntries
+		}
+		entries = append(entries, e)
+	}
+}
+
+func parseCSV(r io.Reader) ([]Entry, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"sku", "name"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing %q column", required)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var entries []Entry
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == MaxEntries {
+			return nil, errTooManyEntries
+		}
+		var quantity int
+		if q := field(record, "quantity"); q != "" {
+			if quantity, err = strconv.Atoi(q); err != nil {
+				return nil, fmt.Errorf("entry %d: quantity %q is not a whole number", len(entries)+1, q)
+			}
+		}
+		entries = append(entries, Entry{
+			SKU:      field(record, "sku"),
+			Name:     field(record, "name"),
+			Category: field(record, "category"),
+			ImageURL: field(record, "image_url"),
+			Price:    field(record, "price"),
+			Currency: strings.ToUpper(field(record, "currency")),
+			Rarity:   strings.ToLower(field(record, "rarity")),
+			Quantity: quantity,
+		})
+	}
+}
+
+// Validate checks a catalog as a whole: it must be non-empty, within
+// MaxEntries and MaxUnits, and every entry needs a unique, well-formed SKU
+// and a name.
+func Validate(entries []Entry) error {
+	if len(entries) == 0 {
+		return errors.New("catalog is empty")
+	}
+	if len(entries) > MaxEntries {
+		return fmt.Errorf("catalog has %d entries, at most %d are allowed", len(entries), MaxEntries)
+	}
+
+	var problems []error
+	seen := make(map[string]int, len(entries))
+	units := 0
+	for i, e := range entries {
+		entry := i + 1
+		if !skuPattern.MatchString(e.SKU) {
+			problems = append(problems, fmt.Errorf("entry %d: sku %q must be 1-30 letters, digits, '-' or '_'", entry, e.SKU))
+		} else if first, dup := seen[e.SKU]; dup {
+			problems = append(problems, fmt.Errorf("entry %d: sku %q duplicates entry %d", entry, e.SKU, first))
+		} else {
+			seen[e.SKU] = entry
+		}
+		if e.Name == "" || len(e.Name) > maxNameLen {
+			problems = append(problems, fmt.Errorf("entry %d: name must be 1-%d characters", entry, maxNameLen))
+		}
+		if len(e.Category) > maxCategoryLen {
+			problems = append(problems, fmt.Errorf("entry %d: category longer than %d characters", entry, maxCategoryLen))
+		}
+		if len(e.ImageURL) > maxImageURLLen {
+			problems = append(problems, fmt.Errorf("entry %d: image_url longer than %d characters", entry, maxImageURLLen))
+		}
+		if e.Currency != "" && !money.ValidCurrency(e.Currency) {
+			problems = append(problems, fmt.Errorf("entry %d: currency %q is not an ISO 4217 code", entry, e.Currency))
+		} else if e.Price != "" {
+			if _, err := money.Parse(e.Price, e.Currency); err != nil {
+				problems = append(problems, fmt.Errorf("entry %d: price: %w", entry, err))
+			}
+		}
+		if e.Rarity != "" && !ValidRarity(e.Rarity) {
+			problems = append(problems, fmt.Errorf("entry %d: rarity %q must be common, rare or legendary", entry, e.Rarity))
+		}
+		if e.Quantity < 0 || e.Quantity > MaxUnits {
+			problems = append(problems, fmt.Errorf("entry %d: quantity must be between 1 and %d", entry, MaxUnits))
+		} else {
+			units += e.Units()
+		}
+		if len(problems) >= maxReportedErrors {
+			problems = append(problems, errors.New("too many problems, stopping"))
+			break
+		}
+	}
+	if units > MaxUnits {
+		problems = append(problems, fmt.Errorf("catalog has %d units, at most %d are allowed", units, MaxUnits))
+	}
+	return errors.Join(problems...)
+}
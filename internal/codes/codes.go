@@ -0,0 +1,125 @@
+// Package codes generates the random strings handed to buyers: checkout
+// codes in a configurable format and length, and opaque IDs for purchases,
+// tokens and dead letters.
+package codes
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Formats a Generator can produce.
+const (
+	// FormatHex is lowercase hexadecimal, e.g. "9f86d081884c7d65".
+	FormatHex = "hex"
+	// FormatBase32 is the RFC 4648 alphabet without padding, e.g.
+	// "MZXW6YTBOI".
+	FormatBase32 = "base32"
+	// FormatGroups is uppercase letters and digits without the easily
+	// confused 0, 1, I and O, in dash-separated groups of four, e.g.
+	// "K7F3-QX9A-MN2P", for codes people read out or type.
+	FormatGroups = "groups"
+)
+
+// minBits is the least entropy a code may carry. A checkout code is a
+// bearer token for a purchase, so it must not be guessable while it lives.
+const minBits = 40
+
+const groupSize = 4
+
+var alphabets = map[string]string{
+	FormatHex:    "0123456789abcdef",
+	FormatBase32: "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567",
+	FormatGroups: "23456789ABCDEFGHJKLMNPQRSTUVWXYZ",
+}
+
+// defaultLengths give every format at least 60 bits.
+var defaultLengths = map[string]int{
+	FormatHex:    32,
+	FormatBase32: 26,
+	FormatGroups: 12,
+}
+
+// Generator makes codes of one format and length.
+type Generator struct {
+	format   string
+	alphabet string
+	length   int
+}
+
+// New returns a generator of codes of format with length symbols, not
+// counting group separators; 0 picks the format's default length.
+func New(format string, length int) (*Generator, error) {
+	alphabet, ok := alphabets[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown code format %q", format)
+	}
+	if length == 0 {
+		length = defaultLengths[format]
+	}
+	g := &Generator{format: format, alphabet: alphabet, length: length}
+	if bits := g.Bits(); bits < minBits {
+		return nil, fmt.Errorf("%d-symbol %s codes carry %.0f bits, fewer than the %d required", length, format, bits, minBits)
+	}
+	return g, nil
+}
+
+// Bits is the entropy of one code.
+func (g *Generator) Bits() float64 {
+	return float64(g.length) * math.Log2(float64(len(g.alphabet)))
+}
+
+// Generate returns a new random code. Every alphabet has a power-of-two
+// size, so masking random bytes picks symbols without bias.
+func (g *Generator) Generate() string {
+	buf := make([]byte, g.length)
+	rand.Read(buf)
+	mask := byte(len(g.alphabet) - 1)
+
+	var b strings.Builder
+	b.Grow(g.length + g.length/groupSize)
+	for i, r := range buf {
+		if g.format == FormatGroups && i > 0 && i%groupSize == 0 {
+			b.WriteByte('-')
+		}
+		b.WriteByte(g.alphabet[r&mask])
+	}
+	return b.String()
+}
+
+// Normalize puts a code as a buyer typed it into the form it was issued
+// in: hex is lowercased, the other formats uppercased, and grouped codes
+// regrouped, so case, spaces and dashes do not matter.
+func (g *Generator) Normalize(code string) string {
+	switch g.format {
+	case FormatHex:
+		return strings.ToLower(code)
+	case FormatGroups:
+		symbols := strings.Map(func(r rune) rune {
+			if r == '-' || r == ' ' {
+				return -1
+			}
+			return r
+		}, strings.ToUpper(code))
+		var b strings.Builder
+		for i := 0; i < len(symbols); i++ {
+			if i > 0 && i%groupSize == 0 {
+				b.WriteByte('-')
+			}
+			b.WriteByte(symbols[i])
+		}
+		return b.String()
+	}
+	return strings.ToUpper(code)
+}
+
+// NewID returns a random 128-bit ID in hex, for identifiers that are never
+// typed by hand.
+func NewID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,705 @@
+// Package config holds runtime settings read from the environment.
+package config
+
+import (
+	"log"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+type Config struct {
+	// MaxPerUser caps how many items one user may own in a sale, counting
+	// purchases and live checkout codes.
+	MaxPerUser int
+	// MaxOutstandingCodes caps how many unredeemed, unexpired checkout codes
+	// a single user may hold in a sale.
+	MaxOutstandingCodes int
+
+	// RarityLimits caps how many items of a rarity tier one user may own
+	// in a sale, counting purchases and live checkout codes like the
+	// per-user limit does, e.g. "legendary=1,rare=3". Tiers not listed are
+	// only held to the per-user limit.
+	RarityLimits map[string]int
+
+	// OversellBuffer is how many units a new sale may sell beyond its
+	// stock, for merchants who expect some buyers not to pay. It can be
+	// changed per sale while it runs.
+	OversellBuffer int
+
+	// HTTP listener tuning.
+	HTTPReadTimeout       time.Duration
+	HTTPReadHeaderTimeout time.Duration
+	HTTPWriteTimeout      time.Duration
+	HTTPIdleTimeout       time.Duration
+	HTTPMaxHeaderBytes    int
+	// HTTPMaxConns rejects connections beyond this many open ones; 0 disables.
+	HTTPMaxConns int
+	// HTTPEnableH2C serves HTTP/2 over cleartext alongside HTTP/1.1.
+	HTTPEnableH2C bool
+	// TLSCertFile and TLSKeyFile serve HTTPS with a certificate from disk.
+	// TLSAutocertDomains instead gets certificates for those hosts from
+	// Let's Encrypt, cached in TLSAutocertCacheDir.
+	TLSCertFile         string
+	TLSKeyFile          string
+	TLSAutocertDomains  []string
+	TLSAutocertCacheDir string
+	// HTTPRedirectAddr, with TLS on, is a plain HTTP listener that redirects
+	// to HTTPS and answers ACME challenges; empty disables it.
+	HTTPRedirectAddr string
+
+	// ArchiveAfter is how long an ended sale stays in the hot tables before
+	// it is moved to the archive tables.
+	ArchiveAfter time.Duration
+	// ArchiveInterval is how often the leader looks for sales to archive;
+	// 0 disables archival.
+	ArchiveInterval time.Duration
+	// ReconcileInterval is how often the leader replays Postgres fallback
+	// sales into Redis; 0 leaves them until the sale is finalized.
+	ReconcileInterval time.Duration
+	// CleanupInterval is how often the leader deletes checkout codes left
+	// without an expiry; 0 disables the cleanup.
+	CleanupInterval time.Duration
+	// AttemptLog is where checkout attempts go: postgres, stream (a Redis
+	// stream drained into Postgres) or none. Admins can switch it at
+	// runtime.
+	AttemptLog string
+	// WriteWorkers is how many goroutines write completed purchases and
+	// their details to the database, behind a queue of WriteQueue writes.
+	// When the queue is full, WriteBackpressure either drops the write
+	// into the dead letter queue or blocks the request until there is
+	// room.
+	WriteWorkers      int
+	WriteQueue        int
+	WriteBackpressure string
+	// WebhookWorkers is how many goroutines deliver purchase webhooks; 0
+	// sends none. A delivery the endpoint refuses is retried up to
+	// WebhookMaxAttempts times in all, WebhookBackoff after the first
+	// attempt and twice as long after each further one.
+	WebhookWorkers     int
+	WebhookMaxAttempts int
+	WebhookBackoff     time.Duration
+
+	// RedisAuditInterval is how often the leader audits Redis keys; 0
+	// disables the audit.
+	RedisAuditInterval time.Duration
+	// RedisPurgeAfter is how long after a sale ends its Redis keys are
+	// deleted.
+	RedisPurgeAfter time.Duration
+	// RedisAuditSampleEvery measures the memory of one key in this many.
+	RedisAuditSampleEvery int
+
+	// DryRunItems, DryRunUsers and DryRunConcurrency size a dry run that
+	// does not name its own.
+	DryRunItems       int
+	DryRunUsers       int
+	DryRunConcurrency int
+
+	// RolloverDrain is how long an ended sale keeps redeeming codes, while
+	// refusing new checkouts, before the next sale replaces it.
+	RolloverDrain time.Duration
+	// SalePreview is how long a new sale can be browsed before checkouts
+	// open; 0 opens it immediately.
+	SalePreview time.Duration
+	// AntiSnipeShare, AntiSnipeWindow and AntiSnipeExtension stop buyers
+	// from sniping the end of a sale: when more than AntiSnipeShare of its
+	// items sold in its last AntiSnipeWindow, it ends AntiSnipeExtension
+	// later, and again for as long as that keeps happening. A zero window
+	// or extension turns the rule off.
+	AntiSnipeShare     float64
+	AntiSnipeWindow    time.Duration
+	AntiSnipeExtension time.Duration
+	// CheckoutCodeTTL is how long a new sale's checkout codes hold their
+	// item, between MinCheckoutCodeTTL and MaxCheckoutCodeTTL; admins can
+	// change it per running sale.
+	CheckoutCodeTTL time.Duration
+	// CodeExpiryWarning is how long before a checkout code expires its
+	// owner is warned on /ws/user; 0 sends no warnings.
+	CodeExpiryWarning time.Duration
+	// HeatmapBucketSize is how many consecutive item numbers share a bucket
+	// of the reservation heatmap; 0 stops recording it.
+	HeatmapBucketSize int
+	// ShowcaseStrategy picks the items /sale/info shows: edges, random,
+	// staff_picks or most_viewed.
+	ShowcaseStrategy string
+	// ShowcaseSize is how many items /sale/info shows.
+	ShowcaseSize int
+	// ShowcaseRefresh is how often the running sale's showcase is picked
+	// again; 0 keeps the one picked when the sale started.
+	ShowcaseRefresh time.Duration
+	// ReadCacheMaxAge is how long browsers and CDNs may cache /sale/info,
+	// /sale/current and /sale/items; 0 sends no-cache so every read is
+	// revalidated against the ETag.
+	ReadCacheMaxAge time.Duration
+	// ResponseCompression lists the encodings responses may be compressed
+	// with, gzip and deflate, in the order they are preferred when a client
+	// accepts both; none turns compression off.
+	ResponseCompression []string
+	// ResponseCompressMinBytes is the size from which response bodies are
+	// compressed; 0 never compresses. Streamed exports, whose size is not
+	// known up front, are always compressed when they may be.
+	ResponseCompressMinBytes int
+	// ResponseCompressTypes lists the content types that are compressed.
+	ResponseCompressTypes []string
+	// ResponseCompressLevel is the compression level, from 1 (fastest) to
+	// 9 (smallest).
+	ResponseCompressLevel int
+
+	// FlagRefresh is how long a replica trusts the feature flags it read
+	// from Redis; flags set on another replica apply here within it.
+	FlagRefresh time.Duration
+
+	// TrendingSize is how many items /sale/trending lists unless asked
+	// for fewer or more; TrendingRefresh is how long one Redis read of the
+	// ranking serves it.
+	TrendingSize    int
+	TrendingRefresh time.Duration
+
+	// SaleEvents has replicas LISTEN for sale events on Postgres, so they
+	// follow a new or closing sale and expire their cached inventory at once
+	// instead of on their next poll. Turn it off behind a connection pooler
+	// that does not keep sessions. SaleEventsCoalesce is how often purchase
+	// events may expire the cached inventory and trending items.
+	SaleEvents         bool
+	SaleEventsCoalesce time.Duration
+
+	// OutboxRelayInterval is how often the outbox relay looks for purchase
+	// events to publish; 0 turns this replica's relay off.
+	OutboxRelayInterval time.Duration
+
+	// InventoryGateThreshold is how far below zero the local inventory
+	// estimate must fall before /checkout answers 409 without asking Redis;
+	// a negative value disables the gate.
+	InventoryGateThreshold int
+	// InventoryGateRefresh is how often the estimate is reset from Redis.
+	InventoryGateRefresh time.Duration
+	// StatusCacheTTL is how long one Redis read of the inventory serves
+	// /sale/status and /sale/current; 0 reads it for every request.
+	StatusCacheTTL time.Duration
+
+	// QueueWindow is how long after a sale starts /checkout admits buyers
+	// through the waiting queue; 0 disables the queue.
+	QueueWindow time.Duration
+	// QueueAdmitRate is how many queued buyers are admitted per second.
+	QueueAdmitRate int
+
+	// CheckoutMode is "fcfs", where the fastest checkout wins, or
+	// "lottery", where /checkout enters buyers into a draw for the first
+	// LotteryWindow of a sale and codes are issued to random entrants.
+	CheckoutMode string
+	// LotteryWindow is how long after a sale starts buyers can enter.
+	LotteryWindow time.Duration
+	// LotteryLoserBonus is added to an entrant's weight for every lottery
+	// they lost in a row, up to five.
+	LotteryLoserBonus float64
+
+	// RedisRetryAttempts is how often the checkout and purchase scripts are
+	// tried when Redis fails transiently; 1 disables retries. The delay
+	// starts at RedisRetryBackoff and doubles, with RedisRetryJitter of it
+	// randomized.
+	RedisRetryAttempts int
+	RedisRetryBackoff  time.Duration
+	RedisRetryJitter   float64
+	// RedisReserveTimeout, RedisPurchaseTimeout and RedisReadTimeout bound
+	// each checkout script, purchase script and other request-path Redis
+	// call, so a slow Redis fails requests fast; 0 leaves only the
+	// client's 3s read timeout.
+	RedisReserveTimeout  time.Duration
+	RedisPurchaseTimeout time.Duration
+	RedisReadTimeout     time.Duration
+
+	// RedisHedgeDelay is how long a /sale/status inventory read may take
+	// before a second copy is sent on another connection; 0 sends none.
+	RedisHedgeDelay time.Duration
+
+	// DBSlowQuery is how long a timed database call may take before it is
+	// logged and counted as slow; 0 logs none.
+	DBSlowQuery time.Duration
+
+	// PrewarmDBConns is how many Postgres connections are opened, with the
+	// purchase path's statements prepared on each, before the replica
+	// reports ready. Connections beyond the idle pool of 20 are closed
+	// again; 0 opens none.
+	PrewarmDBConns int
+
+	// SLOTarget is the share of checkouts and purchases that must answer
+	// without a server error within SLOCheckoutLatency or
+	// SLOPurchaseLatency, measured over SLOWindow. When the error budget
+	// burns more than SLOShedBurnRate times too fast over SLOBurnWindow,
+	// checkouts are shed until it slows down; 0 never sheds.
+	SLOTarget          float64
+	SLOCheckoutLatency time.Duration
+	SLOPurchaseLatency time.Duration
+	SLOWindow          time.Duration
+	SLOBurnWindow      time.Duration
+	SLOShedBurnRate    float64
+
+	// RestockTranche is how many items are added to a sale once
+	// RestockSellThrough of its items have sold, up to RestockMaxItems per
+	// sale; 0 disables restocks.
+	RestockTranche     int
+	RestockSellThrough float64
+	RestockMaxItems    int
+
+	// CatalogPath points at a CSV or JSON catalog sold by every sale instead
+	// of generated items.
+	CatalogPath string
+	// ItemIDScheme is "sequential" or "sku"; see sale.catalogItems.
+	ItemIDScheme string
+	// SaleCurrency prices generated items and catalog entries that do not
+	// name a currency.
+	SaleCurrency string
+
+	// RateLimitPerUser and RateLimitPerIP cap /checkout, /purchase and
+	// /users requests per minute; 0 disables a limit. Checkouts and
+	// purchases made with a checkout API key count against
+	// RateLimitPerAPIKey instead of the IP's, unless it is 0.
+	RateLimitPerUser   int
+	RateLimitPerIP     int
+	RateLimitPerAPIKey int
+	// TrustedProxies are the peers whose X-Forwarded-For and X-Real-IP
+	// headers are believed when resolving the client IP.
+	TrustedProxies []netip.Prefix
+
+	// AccessLogSampling maps a route (e.g. "/checkout") to the fraction of
+	// its requests that are access-logged; "*" sets the default.
+	AccessLogSampling map[string]float64
+	// TraceSampleRate is the fraction of new traces whose spans are logged;
+	// callers that send a sampled traceparent are always traced.
+	TraceSampleRate float64
+
+	// CORSAllowedOrigins are the browser origins allowed to call the API;
+	// "*" allows any origin, but never with credentials.
+	CORSAllowedOrigins []string
+	// CORSAllowedMethods and CORSAllowedHeaders answer preflights;
+	// CORSExposedHeaders are the response headers scripts may read.
+	CORSAllowedMethods []string
+	CORSAllowedHeaders []string
+	CORSExposedHeaders []string
+	// CORSAllowCredentials lets explicitly listed origins send cookies and
+	// Authorization headers.
+	CORSAllowCredentials bool
+	// CORSMaxAge is how long browsers may cache a preflight answer.
+	CORSMaxAge time.Duration
+	// CORSRouteOrigins replace CORSAllowedOrigins for routes under a path
+	// prefix, the longest matching prefix winning. Admin routes allow no
+	// origin unless they are listed here.
+	CORSRouteOrigins map[string][]string
+
+	// Tenants are the contests run alongside the default one, each with its
+	// own sales, sale manager and metrics. Requests pick one with the
+	// X-Tenant-ID header or a <tenant>.example.com subdomain.
+	Tenants []string
+
+	// AdminToken authenticates operator-only endpoints.
+	AdminToken string
+	// AdminHMACSecret lets operators sign admin requests instead of sending
+	// the token; AdminSignatureMaxSkew bounds how old a signature may be.
+	AdminHMACSecret       string
+	AdminSignatureMaxSkew time.Duration
+	// UserEventsSecret signs the tokens /checkout hands out for /ws/user;
+	// empty disables the user event stream.
+	UserEventsSecret string
+	// ReceiptSecret signs purchase receipts; empty disables receipts.
+	ReceiptSecret string
+	// DebugAddr is the listen address of the pprof/expvar listener; empty
+	// disables it.
+	DebugAddr string
+}
+
+// Bounds of a sale's checkout code TTL.
+const (
+	MinCheckoutCodeTTL = 10 * time.Second
+	MaxCheckoutCodeTTL = time.Hour
+)
+
+// Bounds of a dry run, set or requested.
+const (
+	MaxDryRunItems       = 100000
+	MaxDryRunUsers       = 100000
+	MaxDryRunConcurrency = 1000
+)
+
+var current atomic.Pointer[Config]
+
+var (
+	loadMu sync.Mutex
+	// malformed collects the variables the running load could not parse.
+	malformed []string
+)
+
+// Get returns the active configuration, loading it on first use.
+func Get() *Config {
+	if c := current.Load(); c != nil {
+		return c
+	}
+	current.CompareAndSwap(nil, Load())
+	return current.Load()
+}
+
+// Load reads a fresh configuration from the environment. Values that do
+// not parse are logged and replaced by their defaults.
+func Load() *Config {
+	c, invalid := load()
+	for _, key := range invalid {
+		log.Printf("Ignoring invalid %s %q, using its default", key, os.Getenv(key))
+	}
+	return c
+}
+
+// load reads the configuration along with the names of the variables that
+// are set but did not parse.
+func load() (*Config, []string) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	malformed = nil
+	c := read()
+	return c, malformed
+}
+
+func read() *Config {
+	return &Config{
+		MaxPerUser:          intEnv("MAX_PER_USER", 10),
+		MaxOutstandingCodes: intEnv("MAX_OUTSTANDING_CODES", 5),
+
+		RarityLimits: limitsEnv("RARITY_LIMITS"),
+
+		OversellBuffer: intEnv("OVERSELL_BUFFER", 0),
+
+		HTTPReadTimeout:       durationEnv("HTTP_READ_TIMEOUT", 10*time.Second),
+		HTTPReadHeaderTimeout: durationEnv("HTTP_READ_HEADER_TIMEOUT", 2*time.Second),
+		HTTPWriteTimeout:      durationEnv("HTTP_WRITE_TIMEOUT", 30*time.Second),
+		HTTPIdleTimeout:       durationEnv("HTTP_IDLE_TIMEOUT", time.Minute),
+		HTTPMaxHeaderBytes:    intEnv("HTTP_MAX_HEADER_BYTES", 16<<10),
+		HTTPMaxConns:          intEnv("HTTP_MAX_CONNS", 0),
+		HTTPEnableH2C:         boolEnv("HTTP_ENABLE_H2C", false),
+
+		TLSCertFile:         os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:          os.Getenv("TLS_KEY_FILE"),
+		TLSAutocertDomains:  listEnv("TLS_AUTOCERT_DOMAINS"),
+		TLSAutocertCacheDir: stringEnv("TLS_AUTOCERT_CACHE_DIR", "certs"),
+		HTTPRedirectAddr:    os.Getenv("HTTP_REDIRECT_ADDR"),
+
+		ArchiveAfter:      durationEnv("ARCHIVE_AFTER", 2*time.Hour),
+		ArchiveInterval:   durationEnv("ARCHIVE_INTERVAL", 10*time.Minute),
+		ReconcileInterval: durationEnv("RECONCILE_INTERVAL", 5*time.Second),
+		CleanupInterval:   durationEnv("CLEANUP_INTERVAL", 10*time.Minute),
+		AttemptLog:        stringEnv("ATTEMPT_LOG", "postgres"),
+		WriteWorkers:      intEnv("WRITE_WORKERS", 32),
+		WriteQueue:        intEnv("WRITE_QUEUE", 10000),
+		WriteBackpressure: stringEnv("WRITE_BACKPRESSURE", "drop"),
+
+		WebhookWorkers:     intEnv("WEBHOOK_WORKERS", 4),
+		WebhookMaxAttempts: intEnv("WEBHOOK_MAX_ATTEMPTS", 10),
+		WebhookBackoff:     durationEnv("WEBHOOK_BACKOFF", 5*time.Second),
+
+		RedisAuditInterval:    durationEnv("REDIS_AUDIT_INTERVAL", 15*time.Minute),
+		RedisPurgeAfter:       durationEnv("REDIS_PURGE_AFTER", 30*time.Minute),
+		RedisAuditSampleEvery: intEnv("REDIS_AUDIT_SAMPLE_EVERY", 20),
+
+		DryRunItems:       intEnv("DRY_RUN_ITEMS", 1000),
+		DryRunUsers:       intEnv("DRY_RUN_USERS", 500),
+		DryRunConcurrency: intEnv("DRY_RUN_CONCURRENCY", 50),
+
+		RolloverDrain:     durationEnv("ROLLOVER_DRAIN", 5*time.Second),
+		SalePreview:       durationEnv("SALE_PREVIEW", 0),
+		CheckoutCodeTTL:   durationEnv("CHECKOUT_CODE_TTL", 5*time.Minute),
+		CodeExpiryWarning: durationEnv("CODE_EXPIRY_WARNING", 30*time.Second),
+		HeatmapBucketSize: intEnv("HEATMAP_BUCKET_SIZE", 100),
+		ShowcaseStrategy:  stringEnv("SHOWCASE_STRATEGY", "edges"),
+		ShowcaseSize:      intEnv("SHOWCASE_SIZE", 20),
+		ShowcaseRefresh:   durationEnv("SHOWCASE_REFRESH", 30*time.Second),
+		ReadCacheMaxAge:   durationEnv("READ_CACHE_MAX_AGE", 5*time.Second),
+
+		AntiSnipeShare:     floatEnv("ANTI_SNIPE_SHARE", 0.05),
+		AntiSnipeWindow:    durationEnv("ANTI_SNIPE_WINDOW", 0),
+		AntiSnipeExtension: durationEnv("ANTI_SNIPE_EXTENSION", 2*time.Minute),
+
+		// RESPONSE_GZIP_MIN_BYTES is the name the size threshold had when
+		// only gzip was supported.
+		ResponseCompression:      listEnvOr("RESPONSE_COMPRESSION", "gzip,deflate"),
+		ResponseCompressMinBytes: intEnv("RESPONSE_COMPRESS_MIN_BYTES", intEnv("RESPONSE_GZIP_MIN_BYTES", 4096)),
+		ResponseCompressTypes:    listEnvOr("RESPONSE_COMPRESS_TYPES", "application/json,text/csv,application/x-ndjson"),
+		ResponseCompressLevel:    intEnv("RESPONSE_COMPRESS_LEVEL", 1),
+
+		FlagRefresh: durationEnv("FLAG_REFRESH", time.Second),
+
+		TrendingSize:    intEnv("TRENDING_SIZE", 10),
+		TrendingRefresh: durationEnv("TRENDING_REFRESH", 2*time.Second),
+
+		SaleEvents:         boolEnv("SALE_EVENTS", true),
+		SaleEventsCoalesce: durationEnv("SALE_EVENTS_COALESCE", 100*time.Millisecond),
+
+		OutboxRelayInterval: durationEnv("OUTBOX_RELAY_INTERVAL", 200*time.Millisecond),
+
+		InventoryGateThreshold: intEnv("INVENTORY_GATE_THRESHOLD", 100),
+		InventoryGateRefresh:   durationEnv("INVENTORY_GATE_REFRESH", 100*time.Millisecond),
+		StatusCacheTTL:         durationEnv("STATUS_CACHE_TTL", 200*time.Millisecond),
+
+		QueueWindow:    durationEnv("QUEUE_WINDOW", 0),
+		QueueAdmitRate: intEnv("QUEUE_ADMIT_RATE", 500),
+
+		CheckoutMode:      stringEnv("CHECKOUT_MODE", "fcfs"),
+		LotteryWindow:     durationEnv("LOTTERY_WINDOW", 30*time.Second),
+		LotteryLoserBonus: floatEnv("LOTTERY_LOSER_BONUS", 1),
+
+		RedisRetryAttempts: intEnv("REDIS_RETRY_ATTEMPTS", 3),
+		RedisRetryBackoff:  durationEnv("REDIS_RETRY_BACKOFF", 10*time.Millisecond),
+		RedisRetryJitter:   floatEnv("REDIS_RETRY_JITTER", 0.5),
+
+		RedisReserveTimeout:  durationEnv("REDIS_RESERVE_TIMEOUT", 50*time.Millisecond),
+		RedisPurchaseTimeout: durationEnv("REDIS_PURCHASE_TIMEOUT", 100*time.Millisecond),
+		RedisReadTimeout:     durationEnv("REDIS_READ_TIMEOUT", 100*time.Millisecond),
+
+		RedisHedgeDelay: durationEnv("REDIS_HEDGE_DELAY", 0),
+
+		DBSlowQuery: durationEnv("DB_SLOW_QUERY", 200*time.Millisecond),
+
+		PrewarmDBConns: intEnv("PREWARM_DB_CONNS", 20),
+
+		SLOTarget:          floatEnv("SLO_TARGET", 0.999),
+		SLOCheckoutLatency: durationEnv("SLO_CHECKOUT_LATENCY", 100*time.Millisecond),
+		SLOPurchaseLatency: durationEnv("SLO_PURCHASE_LATENCY", 250*time.Millisecond),
+		SLOWindow:          durationEnv("SLO_WINDOW", time.Hour),
+		SLOBurnWindow:      durationEnv("SLO_BURN_WINDOW", time.Minute),
+		SLOShedBurnRate:    floatEnv("SLO_SHED_BURN_RATE", 0),
+
+		RestockTranche:     intEnv("RESTOCK_TRANCHE", 0),
+		RestockSellThrough: floatEnv("RESTOCK_SELL_THROUGH", 0.9),
+		RestockMaxItems:    intEnv("RESTOCK_MAX_ITEMS", 5000),
+
+		CatalogPath:  os.Getenv("CATALOG_PATH"),
+		ItemIDScheme: stringEnv("ITEM_ID_SCHEME", "sequential"),
+		SaleCurrency: strings.ToUpper(stringEnv("SALE_CURRENCY", "USD")),
+
+		RateLimitPerUser:   intEnv("RATE_LIMIT_PER_USER", 100),
+		RateLimitPerIP:     intEnv("RATE_LIMIT_PER_IP", 0),
+		RateLimitPerAPIKey: intEnv("RATE_LIMIT_PER_API_KEY", 0),
+		TrustedProxies:     prefixesEnv("TRUSTED_PROXIES"),
+
+		AccessLogSampling: sampleRatesEnv("ACCESS_LOG_SAMPLE", "*=1,/checkout=0.01,/purchase=0.01"),
+		TraceSampleRate:   floatEnv("TRACE_SAMPLE_RATE", 0.01),
+
+		CORSAllowedOrigins:   listEnvOr("CORS_ALLOWED_ORIGINS", "*"),
+		CORSAllowedMethods:   listEnvOr("CORS_ALLOWED_METHODS", "GET,POST"),
+		CORSAllowedHeaders:   listEnvOr("CORS_ALLOWED_HEADERS", "Accept,Authorization,Content-Type,X-Request-ID,X-Tenant-ID,traceparent,If-None-Match"),
+		CORSExposedHeaders:   listEnvOr("CORS_EXPOSED_HEADERS", "X-Request-ID,traceparent,ETag"),
+		CORSAllowCredentials: boolEnv("CORS_ALLOW_CREDENTIALS", false),
+		CORSMaxAge:           durationEnv("CORS_MAX_AGE", 10*time.Minute),
+		CORSRouteOrigins:     routeOriginsEnv("CORS_ROUTE_ORIGINS"),
+
+		Tenants: tenantsEnv("TENANTS"),
+
+		AdminToken:            os.Getenv("ADMIN_TOKEN"),
+		AdminHMACSecret:       os.Getenv("ADMIN_HMAC_SECRET"),
+		AdminSignatureMaxSkew: durationEnv("ADMIN_SIGNATURE_MAX_SKEW", 5*time.Minute),
+		UserEventsSecret:      os.Getenv("USER_EVENTS_SECRET"),
+		ReceiptSecret:         os.Getenv("RECEIPT_SECRET"),
+		DebugAddr:             os.Getenv("DEBUG_ADDR"),
+	}
+}
+
+// AccessLogRate returns the sampling rate for route.
+func (c *Config) AccessLogRate(route string) float64 {
+	if rate, ok := c.AccessLogSampling[route]; ok {
+		return rate
+	}
+	if rate, ok := c.AccessLogSampling["*"]; ok {
+		return rate
+	}
+	return 1
+}
+
+func intEnv(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	invalid(key)
+	return def
+}
+
+// invalid records key as malformed unless it is unset or empty, which
+// selects the default.
+func invalid(key string) {
+	if os.Getenv(key) != "" {
+		malformed = append(malformed, key)
+	}
+}
+
+func stringEnv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func durationEnv(key string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
+	}
+	invalid(key)
+	return def
+}
+
+func floatEnv(key string, def float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return v
+	}
+	invalid(key)
+	return def
+}
+
+func boolEnv(key string, def bool) bool {
+	if v, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return v
+	}
+	invalid(key)
+	return def
+}
+
+// sampleRatesEnv parses "route=rate,route=rate" pairs. Malformed pairs are
+// skipped.
+func sampleRatesEnv(key, def string) map[string]float64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		raw = def
+	}
+
+	rates := make(map[string]float64)
+	for _, pair := range strings.Split(raw, ",") {
+		route, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		rates[route] = rate
+	}
+	return rates
+}
+
+// limitsEnv parses "name=n,name=n" pairs. Malformed pairs and negative
+// limits are skipped.
+func limitsEnv(key string) map[string]int {
+	limits := make(map[string]int)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil || n < 0 {
+			invalid(key)
+			continue
+		}
+		limits[strings.TrimSpace(name)] = n
+	}
+	return limits
+}
+
+// prefixesEnv parses a comma separated list of CIDRs or bare addresses.
+// Invalid entries are logged and skipped.
+func prefixesEnv(key string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(os.Getenv(key), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if addr, err := netip.ParseAddr(entry); err == nil {
+				prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+				continue
+			}
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			log.Printf("Ignoring invalid %s entry %q: %v", key, entry, err)
+			continue
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+// listEnv parses a comma separated list, skipping empty entries.
+func listEnv(key string) []string {
+	return splitList(os.Getenv(key), ",")
+}
+
+// listEnvOr is listEnv with a default for an unset variable.
+func listEnvOr(key, def string) []string {
+	if v := os.Getenv(key); v != "" {
+		return splitList(v, ",")
+	}
+	return splitList(def, ",")
+}
+
+func splitList(raw, sep string) []string {
+	var list []string
+	for _, entry := range strings.Split(raw, sep) {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// routeOriginsEnv parses comma separated <path prefix>=<origins> pairs,
+// the origins separated by spaces, e.g.
+// "/admin/=https://ops.example.com,/ws/user=https://app.example.com". An
+// empty origin list allows none.
+func routeOriginsEnv(key string) map[string][]string {
+	routes := make(map[string][]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		route, origins, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !strings.HasPrefix(route, "/") {
+			continue
+		}
+		routes[route] = strings.Fields(origins)
+	}
+	return routes
+}
+
+// tenantsEnv parses a comma separated list of tenant IDs. IDs end up in
+// Redis keys and sale IDs, so only 1-32 lowercase letters, digits and
+// dashes are accepted; other entries are logged and skipped.
+func tenantsEnv(key string) []string {
+	var tenants []string
+	for _, entry := range strings.Split(os.Getenv(key), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !ValidTenant(entry) {
+			log.Printf("Ignoring invalid %s entry %q", key, entry)
+			continue
+		}
+		if !slices.Contains(tenants, entry) {
+			tenants = append(tenants, entry)
+		}
+	}
+	return tenants
+}
+
+// ValidTenant reports whether id can name a tenant.
+func ValidTenant(id string) bool {
+	if id == "" || len(id) > 32 || id[0] == '-' {
+		return false
+	}
+	for _, c := range id {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"flash_sale_contest/internal/catalog"
+)
+
+// envFile is the file godotenv's autoload reads at startup.
+const envFile = ".env"
+
+var (
+	reloadMu sync.Mutex
+	// fileEnv is what envFile held when it was last applied.
+	fileEnv = readEnvFile()
+	// reloadHooks are called after every reload that was applied.
+	reloadHooks []func(old, next *Config)
+)
+
+func readEnvFile() map[string]string {
+	env, err := godotenv.Read(envFile)
+	if err != nil {
+		return map[string]string{}
+	}
+	return env
+}
+
+// OnReload registers fn to be called with the previous and the new
+// configuration after each successful Reload, for settings that were
+// copied somewhere when the server started.
+func OnReload(fn func(old, next *Config)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadHooks = append(reloadHooks, fn)
+}
+
+// Reload rereads envFile and the environment and swaps the result in as
+// the active configuration, returning the names of the settings that
+// changed. Variables set in the process environment rather than in envFile
+// keep winning, as they do at startup. A configuration that does not parse
+// or validate is not applied and the environment is left as it was.
+//
+// Settings read for every request apply at once; those used to build the
+// listeners, pools and workers only apply on restart.
+func Reload() ([]string, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	env, err := godotenv.Read(envFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		env = map[string]string{}
+	} else if err != nil {
+		return nil, fmt.Errorf("read %s: %w", envFile, err)
+	}
+	restore := applyEnvFile(env)
+
+	next, invalid := load()
+	if len(invalid) > 0 {
+		err = fmt.Errorf("invalid values for %v", invalid)
+	} else {
+		err = next.Validate()
+	}
+	if err != nil {
+		restore()
+		return nil, err
+	}
+	fileEnv = env
+
+	old := Get()
+	current.Store(next)
+	changed := diff(old, next)
+	log.Printf("Config reloaded, changed: %v", changed)
+	for _, fn := range reloadHooks {
+		fn(old, next)
+	}
+	return changed, nil
+}
+
+// applyEnvFile sets the variables of env that came from envFile or are not
+// set, and unsets those dropped from it, returning a func that undoes it.
+func applyEnvFile(env map[string]string) func() {
+	prev := make(map[string]*string)
+	set := func(key string, value *string) {
+		if _, saved := prev[key]; !saved {
+			if v, ok := os.LookupEnv(key); ok {
+				prev[key] = &v
+			} else {
+				prev[key] = nil
+			}
+		}
+		if value == nil {
+			os.Unsetenv(key)
+		} else {
+			os.Setenv(key, *value)
+		}
+	}
+
+	for key, value := range env {
+		if v, ok := os.LookupEnv(key); !ok || v == fileEnv[key] {
+			set(key, &value)
+		}
+	}
+	for key, value := range fileEnv {
+		if _, kept := env[key]; !kept && os.Getenv(key) == value {
+			set(key, nil)
+		}
+	}
+
+	return func() {
+		for key, value := range prev {
+			if value == nil {
+				os.Unsetenv(key)
+			} else {
+				os.Setenv(key, *value)
+			}
+		}
+	}
+}
+
+// Validate reports the settings that are out of range.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.MaxPerUser >= 1, "MAX_PER_USER must be at least 1")
+	check(c.MaxOutstandingCodes >= 0, "MAX_OUTSTANDING_CODES must not be negative")
+	for tier := range c.RarityLimits {
+		check(catalog.ValidRarity(tier), "RARITY_LIMITS names unknown rarity %q", tier)
+	}
+	check(c.CheckoutCodeTTL >= MinCheckoutCodeTTL && c.CheckoutCodeTTL <= MaxCheckoutCodeTTL,
+		"CHECKOUT_CODE_TTL must be between %s and %s", MinCheckoutCodeTTL, MaxCheckoutCodeTTL)
+	check(c.CodeExpiryWarning >= 0, "CODE_EXPIRY_WARNING must not be negative")
+	check(c.AntiSnipeShare >= 0 && c.AntiSnipeShare <= 1, "ANTI_SNIPE_SHARE must be between 0 and 1")
+	check(c.AntiSnipeWindow >= 0 && c.AntiSnipeExtension >= 0, "ANTI_SNIPE_WINDOW and ANTI_SNIPE_EXTENSION must not be negative")
+	check(c.RateLimitPerUser >= 0, "RATE_LIMIT_PER_USER must not be negative")
+	check(c.RateLimitPerIP >= 0, "RATE_LIMIT_PER_IP must not be negative")
+	check(c.FlagRefresh >= 0, "FLAG_REFRESH must not be negative")
+	for _, encoding := range c.ResponseCompression {
+		check(encoding == "gzip" || encoding == "deflate" || encoding == "none", "RESPONSE_COMPRESSION names unknown encoding %q, use gzip, deflate or none", encoding)
+	}
+	check(c.ResponseCompressMinBytes >= 0, "RESPONSE_COMPRESS_MIN_BYTES must not be negative")
+	check(c.ResponseCompressLevel >= 1 && c.ResponseCompressLevel <= 9, "RESPONSE_COMPRESS_LEVEL must be between 1 and 9")
+	check(c.PrewarmDBConns >= 0, "PREWARM_DB_CONNS must not be negative")
+	check(c.SLOTarget > 0 && c.SLOTarget < 1, "SLO_TARGET must be between 0 and 1")
+	check(c.SLOCheckoutLatency > 0 && c.SLOPurchaseLatency > 0, "SLO_CHECKOUT_LATENCY and SLO_PURCHASE_LATENCY must be positive")
+	check(c.SLOWindow >= time.Second && c.SLOWindow <= 24*time.Hour, "SLO_WINDOW must be between 1s and 24h")
+	check(c.SLOBurnWindow >= time.Second && c.SLOBurnWindow <= c.SLOWindow, "SLO_BURN_WINDOW must be between 1s and SLO_WINDOW")
+	check(c.SLOShedBurnRate >= 0, "SLO_SHED_BURN_RATE must not be negative")
+	check(c.DryRunItems >= 1 && c.DryRunItems <= MaxDryRunItems, "DRY_RUN_ITEMS must be between 1 and %d", MaxDryRunItems)
+	check(c.DryRunUsers >= 1 && c.DryRunUsers <= MaxDryRunUsers, "DRY_RUN_USERS must be between 1 and %d", MaxDryRunUsers)
+	check(c.DryRunConcurrency >= 1 && c.DryRunConcurrency <= MaxDryRunConcurrency, "DRY_RUN_CONCURRENCY must be between 1 and %d", MaxDryRunConcurrency)
+	check(c.CheckoutMode == "fcfs" || c.CheckoutMode == "lottery", "CHECKOUT_MODE must be fcfs or lottery")
+	check(c.QueueWindow <= 0 || c.QueueAdmitRate > 0, "QUEUE_ADMIT_RATE must be positive while QUEUE_WINDOW is set")
+	for route, rate := range c.AccessLogSampling {
+		check(rate >= 0 && rate <= 1, "ACCESS_LOG_SAMPLE rate of %s must be between 0 and 1", route)
+	}
+	check(c.TraceSampleRate >= 0 && c.TraceSampleRate <= 1, "TRACE_SAMPLE_RATE must be between 0 and 1")
+	return errors.Join(errs...)
+}
+
+// diff returns the names of the fields that differ between a and b.
+func diff(a, b *Config) []string {
+	changed := []string{}
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	for i := range va.NumField() {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			changed = append(changed, va.Type().Field(i).Name)
+		}
+	}
+	return changed
+}
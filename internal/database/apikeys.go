@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Operations an API key can be scoped to.
+const (
+	// APIKeyScopeStats reads the stats of the key's sales.
+	APIKeyScopeStats = "stats"
+	// APIKeyScopeCheckout checks out and purchases on behalf of buyers,
+	// as a kiosk does, in the key's sales.
+	APIKeyScopeCheckout = "checkout"
+)
+
+// APIKey lets a partner integration call some operations for some sales
+// of a tenant. SecretHash is the hex SHA-256 of the secret handed out when
+// the key was created; the secret itself is not kept.
+type APIKey struct {
+	ID         string
+	Name       string
+	SaleIDs    []string
+	Scopes     []string
+	SecretHash string
+	CreatedAt  time.Time
+}
+
+// CreateAPIKey stores a key of the tenant and fills in its creation time.
+func (s *service) CreateAPIKey(ctx context.Context, k *APIKey) error {
+	query := `
+		INSERT INTO api_keys (key_id, tenant_id, name, sale_ids, scopes, secret_hash)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at`
+	return s.db.QueryRowContext(ctx, query, k.ID, s.tenant, k.Name, k.SaleIDs, k.Scopes, k.SecretHash).Scan(&k.CreatedAt)
+}
+
+// GetAPIKey returns a key of the tenant, or sql.ErrNoRows.
+func (s *service) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	query := `
+		SELECT key_id, name, array_to_json(sale_ids), array_to_json(scopes), secret_hash, created_at
+		FROM api_keys WHERE tenant_id = $1 AND key_id = $2`
+	return scanAPIKey(s.db.QueryRowContext(ctx, query, s.tenant, id))
+}
+
+// ListAPIKeys returns the keys of the tenant, oldest first.
+func (s *service) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	query := `
+		SELECT key_id, name, array_to_json(sale_ids), array_to_json(scopes), secret_hash, created_at
+		FROM api_keys WHERE tenant_id = $1 ORDER BY created_at, key_id`
+	rows, err := s.db.QueryContext(ctx, query, s.tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey revokes a key of the tenant. It returns sql.ErrNoRows when
+// the tenant has no such key.
+func (s *service) DeleteAPIKey(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM api_keys WHERE tenant_id = $1 AND key_id = $2`, s.tenant, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// scanAPIKey reads a row of key_id, name, sale_ids and scopes as JSON
+// arrays, secret_hash and created_at.
+func scanAPIKey(row interface{ Scan(...any) error }) (*APIKey, error) {
+	var k APIKey
+	var saleIDs, scopes []byte
+	if err := row.Scan(&k.ID, &k.Name, &saleIDs, &scopes, &k.SecretHash, &k.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(saleIDs, &k.SaleIDs); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(scopes, &k.Scopes); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
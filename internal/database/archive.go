@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ArchiveResult counts the rows moved out of the hot tables for one sale.
+type ArchiveResult struct {
+	Items            int64
+	CheckoutAttempts int64
+	Purchases        int64
+}
+
+// archivedTables are moved in this order; each has a *_archive twin.
+var archivedTables = []string{"items", "checkout_attempts", "purchases"}
+
+// hotTables are vacuumed after archival.
+var hotTables = []string{"items", "checkout_attempts", "purchases", "items_available"}
+
+// ListArchivableSales returns ended, not yet archived sales that ended
+// before cutoff, oldest first.
+func (s *service) ListArchivableSales(ctx context.Context, cutoff time.Time, limit int) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT sale_id FROM sales
+		WHERE tenant_id = $1 AND status = 'ended' AND archived_at IS NULL AND end_time < $2
+		ORDER BY end_time
+		LIMIT $3`, s.tenant, cutoff, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var saleIDs []string
+	for rows.Next() {
+		var saleID string
+		if err := rows.Scan(&saleID); err != nil {
+			return nil, err
+		}
+		saleIDs = append(saleIDs, saleID)
+	}
+	return saleIDs, rows.Err()
+}
+
+// ArchiveSale moves a sale's rows from the hot tables into their archive
+// twins and drops its fallback availability rows and Redis snapshots, in
+// one transaction.
+func (s *service) ArchiveSale(ctx context.Context, saleID string) (*ArchiveResult, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	moved := make([]int64, len(archivedTables))
+	for i, table := range archivedTables {
+		query := fmt.Sprintf(`
+			WITH moved AS (DELETE FROM %[1]s WHERE sale_id = $1 RETURNING *)
+			INSERT INTO %[1]s_archive SELECT * FROM moved`, table)
+		res, err := tx.ExecContext(ctx, query, saleID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to archive %s: %w", table, err)
+		}
+		moved[i], _ = res.RowsAffected()
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM items_available WHERE sale_id = $1`, saleID); err != nil {
+		return nil, fmt.Errorf("failed to prune items_available: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sale_snapshots WHERE sale_id = $1`, saleID); err != nil {
+		return nil, fmt.Errorf("failed to prune sale_snapshots: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE sales SET archived_at = NOW() WHERE sale_id = $1`, saleID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &ArchiveResult{Items: moved[0], CheckoutAttempts: moved[1], Purchases: moved[2]}, nil
+}
+
+// VacuumHotTables reclaims the space left behind by archival. VACUUM
+// cannot run inside a transaction, so each table is its own statement.
+func (s *service) VacuumHotTables(ctx context.Context) error {
+	for _, table := range hotTables {
+		if _, err := s.db.ExecContext(ctx, "VACUUM (ANALYZE) "+table); err != nil {
+			return fmt.Errorf("failed to vacuum %s: %w", table, err)
+		}
+	}
+	return nil
+}
@@ -7,9 +7,11 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	_ "github.com/joho/godotenv/autoload"
 )
 
@@ -22,6 +24,12 @@ type Sale struct {
 	ItemsSold  int       `json:"items_sold"`
 	Status     string    `json:"status"`
 	CreatedAt  time.Time `json:"created_at"`
+	// CodeTTL is how long the sale's checkout codes hold their item.
+	CodeTTL time.Duration `json:"code_ttl"`
+	// OversellBuffer is how many units the sale may sell beyond its stock.
+	OversellBuffer int `json:"oversell_buffer"`
+	// Extensions is how often the anti-sniping rule moved EndTime.
+	Extensions int `json:"extensions"`
 }
 
 type Item struct {
@@ -30,6 +38,14 @@ type Item struct {
 	SaleID   string `json:"sale_id"`
 	Name     string `json:"name"`
 	ImageURL string `json:"image_url"`
+	Category string `json:"category"`
+	// PriceMinor is the price in minor units of Currency.
+	PriceMinor int64  `json:"price_minor"`
+	Currency   string `json:"currency"`
+	// Rarity is the item's rarity tier: common, rare or legendary.
+	Rarity string `json:"rarity"`
+	// Quantity is how many units of the item the sale has; 0 is read as 1.
+	Quantity int `json:"quantity"`
 }
 
 type CheckoutAttempt struct {
@@ -38,62 +54,211 @@ type CheckoutAttempt struct {
 	UserID    string    `json:"user_id"`
 	ItemID    string    `json:"item_id"`
 	Code      string    `json:"code"`
-	Status    bool    `json:"status"`
+	Status    bool      `json:"status"`
 	CreatedAt time.Time `json:"created_at"`
+	// FailureReason is why a checkout was refused, one of the Failure
+	// constants; empty for checkouts that issued a code.
+	FailureReason string `json:"failure_reason,omitempty"`
 }
 
+// Checkout failure reasons, as recorded in checkout_attempts.
+const (
+	FailureSoldOut         = "sold_out"
+	FailureCategorySoldOut = "category_sold_out"
+	FailureItemReserved    = "item_reserved"
+	FailureUserLimit       = "user_limit"
+	FailureRarityLimit     = "rarity_limit"
+	FailureTooManyCodes    = "too_many_codes"
+	FailureRateLimited     = "rate_limited"
+	FailureNotStarted      = "not_started"
+	FailureSaleClosing     = "sale_closing"
+	FailureInvalidRequest  = "invalid_request"
+	FailurePromo           = "promo"
+	FailureCacheTimeout    = "cache_timeout"
+	FailureError           = "error"
+)
+
 type Purchase struct {
-	ID           string    `json:"id"`
-	SaleID       string    `json:"sale_id"`
-	UserID       string    `json:"user_id"`
-	ItemID       string    `json:"item_id"`
+	ID     string `json:"id"`
+	SaleID string `json:"sale_id"`
+	UserID string `json:"user_id"`
+	ItemID string `json:"item_id"`
+	// Unit is which unit of the item was sold, counted from 1; items sold
+	// one unit at a time leave it 0, which is recorded as 1.
+	Unit int `json:"unit,omitempty"`
+	// RecipientID is the user a gift was bought for, who owns the item;
+	// empty when the buyer bought it for themselves.
+	RecipientID  string    `json:"recipient_id,omitempty"`
 	PurchaseTime time.Time `json:"purchase_time"`
+	// PromoCode and PercentOff are the discount taken off the item's price.
+	PromoCode  string `json:"promo_code,omitempty"`
+	PercentOff int    `json:"percent_off,omitempty"`
 }
 
 type Service interface {
 	Health() map[string]string
 	Close() error
+	Prewarm(ctx context.Context, n int) (int, error)
+	ForTenant(tenant string) Service
 	RunMigrations() error
+	RollbackMigrations(n int) error
+	MigrationStatuses() ([]MigrationStatus, error)
+	ForceMigrationVersion(target string) error
 	CreateSale(ctx context.Context, sale *Sale) error
+	ActivateSale(ctx context.Context, saleID string, token int64) (bool, error)
+	AbandonSale(ctx context.Context, saleID string) error
 	CreateItems(ctx context.Context, items []Item) error
+	DeleteItems(ctx context.Context, saleID string, itemIDs []string) error
 	GetActiveSale(ctx context.Context) (*Sale, error)
-	GetSaleItems(ctx context.Context, saleID string, limit int) ([]Item, error)
+	GetSale(ctx context.Context, saleID string) (*Sale, error)
+	SetSaleCodeTTL(ctx context.Context, saleID string, ttl time.Duration) error
+	SetSaleOversellBuffer(ctx context.Context, saleID string, buffer int) error
+	EndSale(ctx context.Context, saleID string, itemsSold int) error
+	AddSaleItems(ctx context.Context, saleID string, n int) error
+	ExtendSale(ctx context.Context, saleID string, endTime time.Time) error
+	CountPurchasesSince(ctx context.Context, saleID string, since time.Time) (int, error)
+	GetSaleItems(ctx context.Context, saleID, category string, limit, offset int) ([]Item, error)
 	LogCheckoutAttempt(ctx context.Context, attempt *CheckoutAttempt) error
+	LogCheckoutAttempts(ctx context.Context, attempts []*CheckoutAttempt) error
 	CreatePurchase(ctx context.Context, purchase *Purchase) error
+	RevokePurchases(ctx context.Context, saleID, userID string) ([]Purchase, error)
 	UpdateCheckoutStatus(ctx context.Context, code string, status bool) error
 	GetShowcaseItemIDs(ctx context.Context, saleID string, limit int) (firstIDs, lastIDs []string, err error)
+	RandomItemIDs(ctx context.Context, saleID string, n int) ([]string, error)
+	SeedAvailableItems(ctx context.Context, saleID string) error
+	ReserveAvailableItem(ctx context.Context, saleID, userID, itemID, category, code string, holdFor time.Duration, maxPerUser int, rarityLimits map[string]int) (string, error)
+	GetFallbackReservation(ctx context.Context, code string) (*FallbackReservation, error)
+	ClaimFallbackPurchase(ctx context.Context, code string) (*FallbackReservation, error)
+	ConsumeAvailableItem(ctx context.Context, saleID, itemID string) error
+	UnreconciledFallbackPurchases(ctx context.Context, saleID string) ([]FallbackReservation, error)
+	MarkFallbackReconciled(ctx context.Context, saleID, itemID string) error
+	FlagFallbackConflict(ctx context.Context, r *FallbackReservation) error
+	ListArchivableSales(ctx context.Context, cutoff time.Time, limit int) ([]string, error)
+	ArchiveSale(ctx context.Context, saleID string) (*ArchiveResult, error)
+	VacuumHotTables(ctx context.Context) error
+	StreamPurchases(ctx context.Context, saleID string, fn func(*Purchase) error) error
+	StreamItems(ctx context.Context, saleID string, fn func(*Item) error) error
+	SaleRevenue(ctx context.Context, saleID string) ([]Revenue, error)
+	TopBuyers(ctx context.Context, saleID string, limit int) ([]BuyerCount, error)
+	CreatePromoCode(ctx context.Context, p *PromoCode) error
+	SaveSaleSnapshot(ctx context.Context, snap *SaleSnapshot) error
+	GetSaleSnapshot(ctx context.Context, saleID string, id int64) (*SaleSnapshot, error)
+	ListPromoCodes(ctx context.Context) ([]PromoCode, error)
+	SaveSaleStats(ctx context.Context, st *SaleStats) error
+	GetSaleStats(ctx context.Context, saleID string) (*SaleStats, error)
+	SavePurchaseDetails(ctx context.Context, d *PurchaseDetails) error
+	GetPurchaseDetails(ctx context.Context, purchaseID string) (*PurchaseDetails, error)
+	RecordInventoryMovement(ctx context.Context, m *InventoryMovement) error
+	GetInventoryBalance(ctx context.Context, saleID string) (*InventoryBalance, error)
+	ClaimedItemUnits(ctx context.Context, saleID string) (map[string]int, error)
+	ListUserPurchases(ctx context.Context, userID string, limit, offset int) ([]Purchase, error)
+	ListSoldItemIDs(ctx context.Context, saleID string, limit, offset int) ([]string, int, error)
+	ListSales(ctx context.Context, status string, limit, offset int) ([]SaleSummary, error)
+	CreateWebhook(ctx context.Context, w *Webhook) error
+	ListWebhooks(ctx context.Context, saleID string) ([]Webhook, error)
+	DeleteWebhook(ctx context.Context, saleID string, id int64) error
+	CreateAPIKey(ctx context.Context, k *APIKey) error
+	GetAPIKey(ctx context.Context, id string) (*APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	DeleteAPIKey(ctx context.Context, id string) error
+	NotifySaleEvent(ctx context.Context, event SaleEvent) error
+	ListenSaleEvents(ctx context.Context, fn func(SaleEvent)) error
+	CreateUser(ctx context.Context, u *User) error
+	GetUser(ctx context.Context, id string) (*User, error)
+	ListUserIDs(ctx context.Context, after string, limit int) ([]string, error)
+	ClaimOutboxEvents(ctx context.Context, n int, lease time.Duration) ([]OutboxEvent, error)
+	MarkOutboxPublished(ctx context.Context, ids []int64) error
+	FailOutboxEvent(ctx context.Context, id int64, cause error) error
+	PruneOutbox(ctx context.Context, cutoff time.Time) (int64, error)
+	OutboxBacklog(ctx context.Context) (int64, error)
 }
 
 type service struct {
 	db *sql.DB
+	// tenant scopes sales and promo codes; empty for the default tenant.
+	tenant string
+}
+
+// ForTenant returns a view of the database whose sales and promo codes
+// belong to tenant. Rows keyed by sale ID need no filter: tenants' sale IDs
+// never collide.
+func (s *service) ForTenant(tenant string) Service {
+	return &service{db: s.db, tenant: tenant}
+}
+
+// Options configure the connections to Postgres.
+type Options struct {
+	// URL is the primary's connection string.
+	URL string
+	// ReplicaURL is a read replica's connection string; empty sends every
+	// query to the primary.
+	ReplicaURL      string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// OptionsFromEnv builds the primary's URL from the BLUEPRINT_DB_* variables.
+func OptionsFromEnv() Options {
+	return Options{
+		URL: fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable&search_path=%s",
+			os.Getenv("BLUEPRINT_DB_USERNAME"), os.Getenv("BLUEPRINT_DB_PASSWORD"),
+			os.Getenv("BLUEPRINT_DB_HOST"), os.Getenv("BLUEPRINT_DB_PORT"),
+			os.Getenv("BLUEPRINT_DB_DATABASE"), os.Getenv("BLUEPRINT_DB_SCHEMA")),
+		ReplicaURL:      os.Getenv("BLUEPRINT_DB_REPLICA_URL"),
+		MaxOpenConns:    100,
+		MaxIdleConns:    20,
+		ConnMaxLifetime: 5 * time.Minute,
+	}
+}
+
+// NewService opens connection pools to the primary and, if configured, the
+// replica. Every call opens pools of their own.
+func NewService(opts Options) (Service, error) {
+	primary, err := open(opts.URL, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ReplicaURL == "" {
+		return primary, nil
+	}
+	replica, err := open(opts.ReplicaURL, opts)
+	if err != nil {
+		primary.db.Close()
+		return nil, err
+	}
+	return &routed{Service: primary, replica: replica}, nil
 }
 
 var (
-	database   = os.Getenv("BLUEPRINT_DB_DATABASE")
-	password   = os.Getenv("BLUEPRINT_DB_PASSWORD")
-	username   = os.Getenv("BLUEPRINT_DB_USERNAME")
-	port       = os.Getenv("BLUEPRINT_DB_PORT")
-	host       = os.Getenv("BLUEPRINT_DB_HOST")
-	schema     = os.Getenv("BLUEPRINT_DB_SCHEMA")
-	dbInstance *service
+	dbOnce     sync.Once
+	dbInstance Service
 )
 
+// New returns the process-wide database, opened with OptionsFromEnv on
+// first use. It exits when the pools cannot be opened. Prefer NewService.
 func New() Service {
-	if dbInstance != nil {
-		return dbInstance
-	}
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable&search_path=%s", username, password, host, port, database, schema)
+	dbOnce.Do(func() {
+		s, err := NewService(OptionsFromEnv())
+		if err != nil {
+			log.Fatal(err)
+		}
+		dbInstance = s
+	})
+	return dbInstance
+}
+
+func open(connStr string, opts Options) (*service, error) {
 	db, err := sql.Open("pgx", connStr)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	db.SetMaxOpenConns(100)
-	db.SetMaxIdleConns(20)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
 
-	dbInstance = &service{db: db}
-	return dbInstance
+	return &service{db: db}, nil
 }
 
 func (s *service) Health() map[string]string {
@@ -120,74 +285,192 @@ func (s *service) Health() map[string]string {
 }
 
 func (s *service) Close() error {
-	log.Printf("Disconnected from database: %s", database)
+	log.Println("Disconnected from database")
 	return s.db.Close()
 }
 
 func (s *service) CreateSale(ctx context.Context, sale *Sale) error {
-	query := `INSERT INTO sales (sale_id, start_time, end_time, total_items, status) VALUES ($1, $2, $3, $4, $5)`
-	_, err := s.db.ExecContext(ctx, query, sale.SaleID, sale.StartTime, sale.EndTime, sale.TotalItems, sale.Status)
+	query := `INSERT INTO sales (sale_id, start_time, end_time, total_items, status, code_ttl_ms, oversell_buffer, tenant_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := s.db.ExecContext(ctx, query, sale.SaleID, sale.StartTime, sale.EndTime, sale.TotalItems, sale.Status, sale.CodeTTL.Milliseconds(), sale.OversellBuffer, s.tenant)
 	return err
 }
 
+// ActivateSale turns a pending sale active, fenced by the leader token of
+// the sale manager that created it: once a higher token has activated a
+// sale of the tenant, a lower one no longer can. A fenced-off sale is
+// marked abandoned and false is returned.
+func (s *service) ActivateSale(ctx context.Context, saleID string, token int64) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	fenceQuery := `
+		INSERT INTO sale_fences (tenant_id, token) VALUES ($1, $2)
+		ON CONFLICT (tenant_id) DO UPDATE SET token = EXCLUDED.token WHERE sale_fences.token <= EXCLUDED.token`
+	res, err := tx.ExecContext(ctx, fenceQuery, s.tenant, token)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	status := "active"
+	if n == 0 {
+		status = "abandoned"
+	}
+
+	updateQuery := `UPDATE sales SET status = $1 WHERE sale_id = $2 AND tenant_id = $3 AND status = 'pending'`
+	res, err = tx.ExecContext(ctx, updateQuery, status, saleID, s.tenant)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return false, sql.ErrNoRows
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return status == "active", nil
+}
+
+// itemColumns are the columns of items CreateItems fills, in copy order.
+var itemColumns = []string{"item_id", "sale_id", "name", "image_url", "category", "price_minor", "currency", "rarity", "quantity"}
+
+// CreateItems loads items with a single COPY, so a catalog of a hundred
+// thousand items goes in as one statement, and either all of it or none.
 func (s *service) CreateItems(ctx context.Context, items []Item) error {
 	if len(items) == 0 {
 		return nil
 	}
 
-	batchSize := 1000
-	for i := 0; i < len(items); i += batchSize {
-		end := i + batchSize
-		if end > len(items) {
-			end = len(items)
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		pgConn := driverConn.(*stdlib.Conn).Conn()
+		rows := pgx.CopyFromSlice(len(items), func(i int) ([]any, error) {
+			item := items[i]
+			return []any{item.ItemID, item.SaleID, item.Name, item.ImageURL, item.Category, item.PriceMinor, item.Currency, item.Rarity, max(item.Quantity, 1)}, nil
+		})
+		if _, err := pgConn.CopyFrom(ctx, pgx.Identifier{"items"}, itemColumns, rows); err != nil {
+			return fmt.Errorf("failed to copy items: %w", err)
 		}
+		return nil
+	})
+}
 
-		if err := s.createItemsBatch(ctx, items[i:end]); err != nil {
-			return err
-		}
-	}
+func (s *service) GetActiveSale(ctx context.Context) (*Sale, error) {
+	query := `SELECT sale_id, start_time, end_time, total_items, items_sold, status, code_ttl_ms, oversell_buffer, extensions FROM sales WHERE tenant_id = $1 AND status = 'active' ORDER BY start_time DESC LIMIT 1`
+	return scanSale(s.db.QueryRowContext(ctx, query, s.tenant))
+}
 
-	return nil
+func scanSale(row *sql.Row) (*Sale, error) {
+	var (
+		sale      Sale
+		codeTTLMs int64
+	)
+	err := row.Scan(&sale.SaleID, &sale.StartTime, &sale.EndTime, &sale.TotalItems, &sale.ItemsSold, &sale.Status, &codeTTLMs, &sale.OversellBuffer, &sale.Extensions)
+	if err != nil {
+		return nil, err
+	}
+	sale.CodeTTL = time.Duration(codeTTLMs) * time.Millisecond
+	return &sale, nil
 }
 
-func (s *service) createItemsBatch(ctx context.Context, items []Item) error {
-	tx, err := s.db.BeginTx(ctx, nil)
+// SetSaleCodeTTL changes how long a running sale's new checkout codes hold
+// their item. It returns sql.ErrNoRows unless the sale is active.
+func (s *service) SetSaleCodeTTL(ctx context.Context, saleID string, ttl time.Duration) error {
+	query := `UPDATE sales SET code_ttl_ms = $1 WHERE sale_id = $2 AND tenant_id = $3 AND status = 'active'`
+	res, err := s.db.ExecContext(ctx, query, ttl.Milliseconds(), saleID, s.tenant)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
 
-	stmt, err := tx.PrepareContext(ctx, `INSERT INTO items (item_id, sale_id, name, image_url) VALUES ($1, $2, $3, $4)`)
+// SetSaleOversellBuffer changes how many units a running sale may sell
+// beyond its stock. It returns sql.ErrNoRows unless the sale is active.
+func (s *service) SetSaleOversellBuffer(ctx context.Context, saleID string, buffer int) error {
+	query := `UPDATE sales SET oversell_buffer = $1 WHERE sale_id = $2 AND tenant_id = $3 AND status = 'active'`
+	res, err := s.db.ExecContext(ctx, query, buffer, saleID, s.tenant)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
-
-	for _, item := range items {
-		_, err := stmt.ExecContext(ctx, item.ItemID, item.SaleID, item.Name, item.ImageURL)
-		if err != nil {
-			return err
-		}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
 	}
+	return nil
+}
 
-	return tx.Commit()
+// AbandonSale marks a sale that failed to start abandoned, so the Redis
+// audit purges it. Sales that already ended are left alone.
+func (s *service) AbandonSale(ctx context.Context, saleID string) error {
+	query := `UPDATE sales SET status = 'abandoned' WHERE sale_id = $1 AND tenant_id = $2 AND status IN ('pending', 'active')`
+	_, err := s.db.ExecContext(ctx, query, saleID, s.tenant)
+	return err
 }
 
-func (s *service) GetActiveSale(ctx context.Context) (*Sale, error) {
-	query := `SELECT sale_id, start_time, end_time, total_items, items_sold, status FROM sales WHERE status = 'active' ORDER BY start_time DESC LIMIT 1`
-	row := s.db.QueryRowContext(ctx, query)
+func (s *service) EndSale(ctx context.Context, saleID string, itemsSold int) error {
+	query := `UPDATE sales SET status = 'ended', items_sold = $1 WHERE sale_id = $2`
+	_, err := s.db.ExecContext(ctx, query, itemsSold, saleID)
+	return err
+}
 
-	var sale Sale
-	err := row.Scan(&sale.SaleID, &sale.StartTime, &sale.EndTime, &sale.TotalItems, &sale.ItemsSold, &sale.Status)
+// ExtendSale moves a running sale's end to endTime and counts the
+// extension. It returns sql.ErrNoRows unless the sale is active.
+func (s *service) ExtendSale(ctx context.Context, saleID string, endTime time.Time) error {
+	query := `UPDATE sales SET end_time = $1, extensions = extensions + 1 WHERE sale_id = $2 AND tenant_id = $3 AND status = 'active'`
+	res, err := s.db.ExecContext(ctx, query, endTime, saleID, s.tenant)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return &sale, nil
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CountPurchasesSince counts the purchases of a sale made at or after
+// since. purchase_time is stamped by Postgres' clock, so since is turned
+// into an age on it.
+func (s *service) CountPurchasesSince(ctx context.Context, saleID string, since time.Time) (int, error) {
+	var n int
+	query := `SELECT COUNT(*) FROM purchases WHERE sale_id = $1 AND purchase_time >= CURRENT_TIMESTAMP - make_interval(secs => $2)`
+	err := s.db.QueryRowContext(ctx, query, saleID, time.Since(since).Seconds()).Scan(&n)
+	return n, err
+}
+
+// DeleteItems removes items of a sale that never went on sale, such as a
+// restock tranche Redis could not take.
+func (s *service) DeleteItems(ctx context.Context, saleID string, itemIDs []string) error {
+	query := `DELETE FROM items WHERE sale_id = $1 AND item_id = ANY($2)`
+	_, err := s.db.ExecContext(ctx, query, saleID, itemIDs)
+	return err
 }
 
-func (s *service) GetSaleItems(ctx context.Context, saleID string, limit int) ([]Item, error) {
-	query := `SELECT item_id, sale_id, name, image_url FROM items WHERE sale_id = $1 ORDER BY created_at LIMIT $2`
-	rows, err := s.db.QueryContext(ctx, query, saleID, limit)
+// AddSaleItems raises a running sale's total_items after a restock.
+func (s *service) AddSaleItems(ctx context.Context, saleID string, n int) error {
+	query := `UPDATE sales SET total_items = total_items + $1 WHERE sale_id = $2`
+	_, err := s.db.ExecContext(ctx, query, n, saleID)
+	return err
+}
+
+const saleItemsQuery = `SELECT item_id, sale_id, name, image_url, category, price_minor, currency, rarity, quantity FROM items WHERE sale_id = $1 AND ($2 = '' OR category = $2) ORDER BY item_id LIMIT $3 OFFSET $4`
+
+// GetSaleItems pages through a sale's items, optionally restricted to one
+// category when category is non-empty.
+func (s *service) GetSaleItems(ctx context.Context, saleID, category string, limit, offset int) ([]Item, error) {
+	rows, err := s.db.QueryContext(ctx, saleItemsQuery, saleID, category, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -196,7 +479,7 @@ func (s *service) GetSaleItems(ctx context.Context, saleID string, limit int) ([
 	var items []Item
 	for rows.Next() {
 		var item Item
-		err := rows.Scan(&item.ItemID, &item.SaleID, &item.Name, &item.ImageURL)
+		err := rows.Scan(&item.ItemID, &item.SaleID, &item.Name, &item.ImageURL, &item.Category, &item.PriceMinor, &item.Currency, &item.Rarity, &item.Quantity)
 		if err != nil {
 			return nil, err
 		}
@@ -205,23 +488,131 @@ func (s *service) GetSaleItems(ctx context.Context, saleID string, limit int) ([
 	return items, nil
 }
 
+// LogCheckoutAttempt records an attempt. Attempts by unregistered users,
+// which can only have been refused, are dropped.
 func (s *service) LogCheckoutAttempt(ctx context.Context, attempt *CheckoutAttempt) error {
-	query := `INSERT INTO checkout_attempts (sale_id, user_id, item_id, code, status) VALUES ($1, $2, $3, $4, $5)`
-	_, err := s.db.ExecContext(ctx, query, attempt.SaleID, attempt.UserID, attempt.ItemID, attempt.Code, attempt.Status)
+	query := `
+		INSERT INTO checkout_attempts (sale_id, user_id, item_id, code, status, failure_reason, created_at)
+		SELECT $1, $2, $3, $4, $5, NULLIF($6, ''), COALESCE($7, CURRENT_TIMESTAMP)
+		WHERE EXISTS (SELECT 1 FROM users WHERE id = $2)`
+	createdAt := sql.NullTime{Time: attempt.CreatedAt, Valid: !attempt.CreatedAt.IsZero()}
+	_, err := s.db.ExecContext(ctx, query, attempt.SaleID, attempt.UserID, attempt.ItemID, attempt.Code, attempt.Status, attempt.FailureReason, createdAt)
 	return err
 }
 
-func (s *service) CreatePurchase(ctx context.Context, purchase *Purchase) error {
-	query := `INSERT INTO purchases (sale_id, user_id, item_id) VALUES ($1, $2, $3)`
-	_, err := s.db.ExecContext(ctx, query, purchase.SaleID, purchase.UserID, purchase.ItemID)
+const logCheckoutAttemptsQuery = `
+	INSERT INTO checkout_attempts (sale_id, user_id, item_id, code, status, failure_reason, created_at)
+	SELECT sale_id, user_id, item_id, code, status, NULLIF(failure_reason, ''), created_at
+	FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::bool[], $6::text[], $7::timestamptz[])
+		AS t(sale_id, user_id, item_id, code, status, failure_reason, created_at)
+	WHERE EXISTS (SELECT 1 FROM users u WHERE u.id = t.user_id)`
+
+// LogCheckoutAttempts inserts a batch of attempts in one statement. Attempts
+// keep the time they were made, however late the batch is written. As in
+// LogCheckoutAttempt, attempts by unregistered users are dropped, so one of
+// them cannot fail the whole batch.
+func (s *service) LogCheckoutAttempts(ctx context.Context, attempts []*CheckoutAttempt) error {
+	n := len(attempts)
+	saleIDs, userIDs, itemIDs, codes := make([]string, n), make([]string, n), make([]string, n), make([]string, n)
+	statuses, reasons, createdAts := make([]bool, n), make([]string, n), make([]time.Time, n)
+	now := time.Now()
+	for i, a := range attempts {
+		saleIDs[i], userIDs[i], itemIDs[i], codes[i] = a.SaleID, a.UserID, a.ItemID, a.Code
+		statuses[i], reasons[i], createdAts[i] = a.Status, a.FailureReason, a.CreatedAt
+		if a.CreatedAt.IsZero() {
+			createdAts[i] = now
+		}
+	}
+	_, err := s.db.ExecContext(ctx, logCheckoutAttemptsQuery, saleIDs, userIDs, itemIDs, codes, statuses, reasons, createdAts)
 	return err
 }
 
+// createPurchaseQuery charges the item's catalog price less any promo
+// discount, rounded down; items outside the catalog are recorded without
+// one. The event's payload decodes as a Purchase.
+const createPurchaseQuery = `
+	WITH purchase AS (
+		INSERT INTO purchases (id, sale_id, user_id, item_id, amount_minor, currency, promo_code, unit, recipient_id)
+		SELECT COALESCE(NULLIF($10, '')::uuid, gen_random_uuid()), $1, $2, $3, i.price_minor * (100 - $5) / 100, i.currency, NULLIF($4, ''), $8, NULLIF($9, '')
+		FROM (SELECT 1) AS one
+		LEFT JOIN items i ON i.sale_id = $1 AND i.item_id = $3
+		ON CONFLICT DO NOTHING
+		RETURNING id, sale_id, user_id, item_id, unit, recipient_id, promo_code, purchase_time
+	)
+	INSERT INTO outbox (tenant_id, event_type, payload)
+	SELECT $6, $7, json_build_object(
+		'id', replace(id::text, '-', ''), 'sale_id', sale_id, 'user_id', user_id, 'item_id', item_id, 'unit', unit, 'recipient_id', recipient_id,
+		'promo_code', promo_code, 'percent_off', $5::int, 'purchase_time', purchase_time AT TIME ZONE 'UTC')
+	FROM purchase`
+
+// CreatePurchase records a purchase together with its purchase.completed
+// outbox event, in one statement and so one transaction: the event exists
+// exactly when the purchase does. Each unit of an item can only be sold
+// once per sale; a second purchase of it is not an error for the caller but
+// is flagged in purchase_anomalies for reconciliation, and has no event.
+// The purchase is stored under purchase.ID, the ID its buyer was handed,
+// or a fresh one if that is empty. Recording the same purchase ID again,
+// as a replayed purchase does, changes nothing and flags nothing.
+func (s *service) CreatePurchase(ctx context.Context, purchase *Purchase) error {
+	res, err := s.db.ExecContext(ctx, createPurchaseQuery, purchase.SaleID, purchase.UserID, purchase.ItemID, purchase.PromoCode, purchase.PercentOff,
+		s.tenant, OutboxPurchaseCompleted, max(purchase.Unit, 1), purchase.RecipientID, purchase.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return s.flagDuplicatePurchase(ctx, purchase)
+	}
+	return nil
+}
+
+// flagDuplicatePurchase flags a purchase that collided with another one.
+// A collision with a row stored under the same purchase ID is that purchase
+// recorded twice, not a double sell, and is not flagged.
+func (s *service) flagDuplicatePurchase(ctx context.Context, purchase *Purchase) error {
+	query := `
+		INSERT INTO purchase_anomalies (kind, sale_id, item_id, unit, user_id, existing_user_id, purchase_time)
+		SELECT 'duplicate_purchase', $1, $2, $4, $3, user_id, NOW()
+		FROM purchases WHERE sale_id = $1 AND item_id = $2 AND unit = $4
+			AND NOT EXISTS (SELECT 1 FROM purchases WHERE id = NULLIF($5, '')::uuid)`
+	unit := max(purchase.Unit, 1)
+	res, err := s.db.ExecContext(ctx, query, purchase.SaleID, purchase.ItemID, purchase.UserID, unit, purchase.ID)
+	if err != nil {
+		return fmt.Errorf("failed to flag duplicate purchase: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil
+	}
+	log.Printf("ANOMALY: unit %d of item %s of sale %s sold twice (second buyer %s)", unit, purchase.ItemID, purchase.SaleID, purchase.UserID)
+	return nil
+}
+
+const updateCheckoutStatusQuery = `UPDATE checkout_attempts SET status = $1 WHERE code = $2`
+
 func (s *service) UpdateCheckoutStatus(ctx context.Context, code string, status bool) error {
-	query := `UPDATE checkout_attempts SET status = $1 WHERE code = $2`
-	_, err := s.db.ExecContext(ctx, query, status, code)
+	_, err := s.db.ExecContext(ctx, updateCheckoutStatusQuery, status, code)
 	return err
 }
+
+// RandomItemIDs samples up to n items of a sale.
+func (s *service) RandomItemIDs(ctx context.Context, saleID string, n int) ([]string, error) {
+	query := `SELECT item_id FROM items WHERE sale_id = $1 ORDER BY random() LIMIT $2`
+	rows, err := s.db.QueryContext(ctx, query, saleID, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample items: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
 func (s *service) GetShowcaseItemIDs(ctx context.Context, saleID string, limit int) (firstIDs, lastIDs []string, err error) {
 	// Get first N items
 	firstQuery := `SELECT item_id FROM items WHERE sale_id = $1 ORDER BY item_id ASC LIMIT $2`
@@ -254,4 +645,4 @@ func (s *service) GetShowcaseItemIDs(ctx context.Context, saleID string, limit i
 	}
 
 	return firstIDs, lastIDs, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// exportFetchSize is how many rows each FETCH pulls from the export cursor.
+const exportFetchSize = 1000
+
+// GetSale loads one sale by ID, whatever its status.
+func (s *service) GetSale(ctx context.Context, saleID string) (*Sale, error) {
+	query := `SELECT sale_id, start_time, end_time, total_items, items_sold, status, code_ttl_ms, oversell_buffer, extensions FROM sales WHERE sale_id = $1 AND tenant_id = $2`
+	return scanSale(s.db.QueryRowContext(ctx, query, saleID, s.tenant))
+}
+
+// StreamPurchases calls fn for every purchase of a sale, archived or not, in
+// purchase order. Rows are read through a server-side cursor a batch at a
+// time, so memory stays flat however large the sale is.
+func (s *service) StreamPurchases(ctx context.Context, saleID string, fn func(*Purchase) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	declare := `
+		DECLARE purchases_export NO SCROLL CURSOR FOR
+		SELECT sale_id, user_id, item_id, purchase_time FROM purchases WHERE sale_id = $1
+		UNION ALL
+		SELECT sale_id, user_id, item_id, purchase_time FROM purchases_archive WHERE sale_id = $1
+		ORDER BY purchase_time`
+	if _, err := tx.ExecContext(ctx, declare, saleID); err != nil {
+		return fmt.Errorf("failed to open export cursor: %w", err)
+	}
+
+	fetch := fmt.Sprintf("FETCH %d FROM purchases_export", exportFetchSize)
+	for {
+		rows, err := tx.QueryContext(ctx, fetch)
+		if err != nil {
+			return err
+		}
+
+		n := 0
+		for rows.Next() {
+			var p Purchase
+			if err := rows.Scan(&p.SaleID, &p.UserID, &p.ItemID, &p.PurchaseTime); err != nil {
+				rows.Close()
+				return err
+			}
+			n++
+			if err := fn(&p); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if n < exportFetchSize {
+			return nil
+		}
+	}
+}
+
+// StreamItems calls fn for every item of a sale, archived or not, in item
+// order, through a cursor like StreamPurchases.
+func (s *service) StreamItems(ctx context.Context, saleID string, fn func(*Item) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	declare := `
+		DECLARE items_export NO SCROLL CURSOR FOR
+		SELECT item_id, sale_id, name, image_url, category, price_minor, currency, rarity, quantity FROM items WHERE sale_id = $1
+		UNION ALL
+		SELECT item_id, sale_id, name, image_url, category, price_minor, currency, rarity, quantity FROM items_archive WHERE sale_id = $1
+		ORDER BY item_id`
+	if _, err := tx.ExecContext(ctx, declare, saleID); err != nil {
+		return fmt.Errorf("failed to open export cursor: %w", err)
+	}
+
+	fetch := fmt.Sprintf("FETCH %d FROM items_export", exportFetchSize)
+	for {
+		rows, err := tx.QueryContext(ctx, fetch)
+		if err != nil {
+			return err
+		}
+
+		n := 0
+		for rows.Next() {
+			var item Item
+			if err := rows.Scan(&item.ItemID, &item.SaleID, &item.Name, &item.ImageURL, &item.Category, &item.PriceMinor, &item.Currency, &item.Rarity, &item.Quantity); err != nil {
+				rows.Close()
+				return err
+			}
+			n++
+			if err := fn(&item); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if n < exportFetchSize {
+			return nil
+		}
+	}
+}
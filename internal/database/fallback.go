@@ -0,0 +1,230 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// FallbackReservation is an item reserved through Postgres while Redis was
+// unavailable.
+type FallbackReservation struct {
+	SaleID string `json:"sale_id"`
+	UserID string `json:"user_id"`
+	ItemID string `json:"item_id"`
+}
+
+// SeedAvailableItems offers a sale's items to the fallback. Items sold by
+// quantity are left out: their units are numbered and counted by Redis
+// alone, so the fallback cannot sell one without repeating a unit.
+func (s *service) SeedAvailableItems(ctx context.Context, saleID string) error {
+	query := `INSERT INTO items_available (item_id, sale_id, category) SELECT item_id, sale_id, category FROM items WHERE sale_id = $1 AND quantity <= 1 ON CONFLICT (item_id) DO NOTHING`
+	_, err := s.db.ExecContext(ctx, query, saleID)
+	return err
+}
+
+// ReserveAvailableItem is the degraded-mode reservation: it locks one free
+// row with SKIP LOCKED so concurrent buyers never wait on each other, and
+// enforces the per-user cap from the same table. Items of a rarity tier the
+// user owns rarityLimits of are passed over. A non-empty itemID reserves
+// that item or nothing, refused with "item already reserved" when it is not
+// free; otherwise any free item is taken. Unregistered users are refused
+// with "unknown user".
+func (s *service) ReserveAvailableItem(ctx context.Context, saleID, userID, itemID, category, code string, holdFor time.Duration, maxPerUser int, rarityLimits map[string]int) (string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var registered bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, userID).Scan(&registered); err != nil {
+		return "", err
+	}
+	if !registered {
+		return "", fmt.Errorf("unknown user")
+	}
+
+	// Purchases made through Redis count too; fallback reservations are
+	// counted until their purchase is written.
+	var owned int
+	countQuery := `
+		SELECT
+			(SELECT COUNT(*) FROM purchases WHERE sale_id = $1 AND COALESCE(recipient_id, user_id) = $2)
+			+ (SELECT COUNT(*) FROM items_available a
+				WHERE a.sale_id = $1 AND a.reserved_by = $2 AND (a.sold OR a.reserved_until > NOW())
+					AND NOT EXISTS (SELECT 1 FROM purchases p WHERE p.sale_id = a.sale_id AND p.item_id = a.item_id AND p.user_id = $2))`
+	if err := tx.QueryRowContext(ctx, countQuery, saleID, userID).Scan(&owned); err != nil {
+		return "", err
+	}
+	if owned >= maxPerUser {
+		return "", fmt.Errorf("user limit exceeded")
+	}
+	fullTiers, err := fullRarityTiers(ctx, tx, saleID, userID, rarityLimits)
+	if err != nil {
+		return "", err
+	}
+
+	selectQuery := `
+		SELECT a.item_id FROM items_available a
+		WHERE a.sale_id = $1 AND ($2 = '' OR a.category = $2) AND ($4 = '' OR a.item_id = $4) AND NOT a.sold AND (a.reserved_until IS NULL OR a.reserved_until < NOW())
+			AND NOT EXISTS (SELECT 1 FROM items i WHERE i.item_id = a.item_id AND i.rarity = ANY($3))
+		LIMIT 1
+		FOR UPDATE OF a SKIP LOCKED`
+	requested := itemID
+	if err := tx.QueryRowContext(ctx, selectQuery, saleID, category, fullTiers, requested).Scan(&itemID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			if requested != "" {
+				return "", fmt.Errorf("item already reserved")
+			}
+			return "", fmt.Errorf("sold out")
+		}
+		return "", err
+	}
+
+	updateQuery := `UPDATE items_available SET reserved_by = $1, code = $2, reserved_until = $3, fallback = TRUE, reconciled = FALSE WHERE item_id = $4`
+	if _, err := tx.ExecContext(ctx, updateQuery, userID, code, time.Now().Add(holdFor), itemID); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return itemID, nil
+}
+
+// fullRarityTiers lists the rarity tiers of which the user already owns
+// the most rarityLimits allows in the sale.
+func fullRarityTiers(ctx context.Context, tx *sql.Tx, saleID, userID string, rarityLimits map[string]int) ([]string, error) {
+	full := []string{}
+	if len(rarityLimits) == 0 {
+		return full, nil
+	}
+
+	query := `
+		SELECT i.rarity, COUNT(*) FROM items_available a JOIN items i ON i.item_id = a.item_id
+		WHERE a.sale_id = $1 AND a.reserved_by = $2 AND (a.sold OR a.reserved_until > NOW())
+		GROUP BY i.rarity`
+	rows, err := tx.QueryContext(ctx, query, saleID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	owned := make(map[string]int)
+	for rows.Next() {
+		var rarity string
+		var n int
+		if err := rows.Scan(&rarity, &n); err != nil {
+			return nil, err
+		}
+		owned[rarity] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for tier, limit := range rarityLimits {
+		if owned[tier] >= limit {
+			full = append(full, tier)
+		}
+	}
+	return full, nil
+}
+
+// GetFallbackReservation returns the live, unsold reservation of a fallback
+// checkout code without claiming it, so its owner can be checked first.
+func (s *service) GetFallbackReservation(ctx context.Context, code string) (*FallbackReservation, error) {
+	query := `
+		SELECT sale_id, reserved_by, item_id FROM items_available
+		WHERE code = $1 AND NOT sold AND reserved_until > NOW()`
+
+	var r FallbackReservation
+	if err := s.db.QueryRowContext(ctx, query, code).Scan(&r.SaleID, &r.UserID, &r.ItemID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("invalid or expired code")
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *service) ClaimFallbackPurchase(ctx context.Context, code string) (*FallbackReservation, error) {
+	query := `
+		UPDATE items_available SET sold = TRUE
+		WHERE code = $1 AND NOT sold AND reserved_until > NOW()
+		RETURNING sale_id, reserved_by, item_id`
+
+	var r FallbackReservation
+	if err := s.db.QueryRowContext(ctx, query, code).Scan(&r.SaleID, &r.UserID, &r.ItemID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("invalid or expired code")
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+const consumeAvailableItemQuery = `UPDATE items_available SET sold = TRUE WHERE sale_id = $1 AND item_id = $2`
+
+// ConsumeAvailableItem mirrors a Redis-path sale of itemID into
+// items_available so the fallback path never offers it again.
+func (s *service) ConsumeAvailableItem(ctx context.Context, saleID, itemID string) error {
+	_, err := s.db.ExecContext(ctx, consumeAvailableItemQuery, saleID, itemID)
+	return err
+}
+
+// UnreconciledFallbackPurchases lists the fallback sales of a sale that
+// have not been replayed against Redis yet.
+func (s *service) UnreconciledFallbackPurchases(ctx context.Context, saleID string) ([]FallbackReservation, error) {
+	query := `
+		SELECT sale_id, reserved_by, item_id FROM items_available
+		WHERE sale_id = $1 AND fallback AND sold AND NOT reconciled`
+	rows, err := s.db.QueryContext(ctx, query, saleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reservations []FallbackReservation
+	for rows.Next() {
+		var r FallbackReservation
+		if err := rows.Scan(&r.SaleID, &r.UserID, &r.ItemID); err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, r)
+	}
+	return reservations, rows.Err()
+}
+
+const markFallbackReconciledQuery = `UPDATE items_available SET reconciled = TRUE WHERE sale_id = $1 AND item_id = $2`
+
+// MarkFallbackReconciled records that a fallback sale has been replayed
+// against Redis, so it is not replayed again.
+func (s *service) MarkFallbackReconciled(ctx context.Context, saleID, itemID string) error {
+	_, err := s.db.ExecContext(ctx, markFallbackReconciledQuery, saleID, itemID)
+	return err
+}
+
+// FlagFallbackConflict marks a fallback sale reconciled and flags it in
+// purchase_anomalies, in one statement: its replay found the item already
+// sold in Redis, so the item went to two buyers.
+func (s *service) FlagFallbackConflict(ctx context.Context, r *FallbackReservation) error {
+	query := `
+		WITH reconciled AS (
+			UPDATE items_available SET reconciled = TRUE
+			WHERE sale_id = $1 AND item_id = $2 AND NOT reconciled
+			RETURNING sale_id, item_id
+		)
+		INSERT INTO purchase_anomalies (kind, sale_id, item_id, user_id, existing_user_id, purchase_time)
+		SELECT 'fallback_conflict', r.sale_id, r.item_id, $3,
+			(SELECT p.user_id FROM purchases p WHERE p.sale_id = r.sale_id AND p.item_id = r.item_id AND p.user_id <> $3 LIMIT 1), NOW()
+		FROM reconciled r`
+	if _, err := s.db.ExecContext(ctx, query, r.SaleID, r.ItemID, r.UserID); err != nil {
+		return fmt.Errorf("failed to flag fallback conflict: %w", err)
+	}
+	log.Printf("ANOMALY: item %s of sale %s sold through the fallback to %s was already sold in Redis", r.ItemID, r.SaleID, r.UserID)
+	return nil
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SaleSummary is a sale as listed in the sales history.
+type SaleSummary struct {
+	SaleID     string
+	StartTime  time.Time
+	EndTime    time.Time
+	TotalItems int
+	ItemsSold  int
+	Status     string
+	// SoldOutAfter is how long after the start the inventory first ran
+	// out; 0 if it never did or the sale is not finalized yet.
+	SoldOutAfter time.Duration
+}
+
+// ListSales returns a page of the tenant's sales in status, newest first.
+func (s *service) ListSales(ctx context.Context, status string, limit, offset int) ([]SaleSummary, error) {
+	query := `
+		SELECT s.sale_id, s.start_time, s.end_time, s.total_items, s.items_sold, s.status, st.sold_out_after_ms
+		FROM sales s
+		LEFT JOIN sale_stats st ON st.sale_id = s.sale_id
+		WHERE s.tenant_id = $1 AND s.status = $2
+		ORDER BY s.start_time DESC
+		LIMIT $3 OFFSET $4`
+	rows, err := s.db.QueryContext(ctx, query, s.tenant, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sales []SaleSummary
+	for rows.Next() {
+		var (
+			sale         SaleSummary
+			soldOutAfter sql.NullInt64
+		)
+		if err := rows.Scan(&sale.SaleID, &sale.StartTime, &sale.EndTime, &sale.TotalItems, &sale.ItemsSold, &sale.Status, &soldOutAfter); err != nil {
+			return nil, err
+		}
+		sale.SoldOutAfter = time.Duration(soldOutAfter.Int64) * time.Millisecond
+		sales = append(sales, sale)
+	}
+	return sales, rows.Err()
+}
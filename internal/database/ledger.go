@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Inventory movements, as recorded in inventory_ledger.
+const (
+	MovementInit    = "init"
+	MovementReserve = "reserve"
+	MovementRelease = "release"
+	MovementSell    = "sell"
+	MovementRestock = "restock"
+	MovementRevoke  = "revoke"
+)
+
+// Ledger accounts a sale's units move between.
+const (
+	AccountSupply    = "supply"
+	AccountAvailable = "available"
+	AccountReserved  = "reserved"
+	AccountSold      = "sold"
+)
+
+// movementAccounts is the account each movement debits and the one it
+// credits.
+var movementAccounts = map[string][2]string{
+	MovementInit:    {AccountSupply, AccountAvailable},
+	MovementRestock: {AccountSupply, AccountAvailable},
+	MovementReserve: {AccountAvailable, AccountReserved},
+	MovementRelease: {AccountReserved, AccountAvailable},
+	MovementSell:    {AccountReserved, AccountSold},
+	MovementRevoke:  {AccountSold, AccountAvailable},
+}
+
+// InventoryMovement moves Quantity units of a sale from one account to
+// another. EntryID identifies it, so recording it twice is a no-op.
+type InventoryMovement struct {
+	EntryID    string    `json:"entry_id"`
+	SaleID     string    `json:"sale_id"`
+	Movement   string    `json:"movement"`
+	Quantity   int       `json:"quantity"`
+	UserID     string    `json:"user_id,omitempty"`
+	ItemID     string    `json:"item_id,omitempty"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// InventoryBalance is a sale's stock as the ledger has it.
+type InventoryBalance struct {
+	SaleID         string
+	Supplied       int
+	Available      int
+	Reserved       int
+	Sold           int
+	LastMovementAt time.Time
+}
+
+// RecordInventoryMovement writes both legs of a movement in one statement.
+func (s *service) RecordInventoryMovement(ctx context.Context, m *InventoryMovement) error {
+	accounts, ok := movementAccounts[m.Movement]
+	if !ok {
+		return fmt.Errorf("unknown inventory movement %q", m.Movement)
+	}
+	query := `
+		INSERT INTO inventory_ledger (entry_id, account, tenant_id, sale_id, movement, amount, user_id, item_id, recorded_at)
+		VALUES ($1, $2, $4, $5, $6, -$7::int, NULLIF($8, ''), NULLIF($9, ''), $10),
+			($1, $3, $4, $5, $6, $7::int, NULLIF($8, ''), NULLIF($9, ''), $10)
+		ON CONFLICT (entry_id, account) DO NOTHING`
+	_, err := s.db.ExecContext(ctx, query, m.EntryID, accounts[0], accounts[1], s.tenant, m.SaleID, m.Movement, m.Quantity, m.UserID, m.ItemID, m.RecordedAt)
+	return err
+}
+
+// ClaimedItemUnits counts, by item, the units of a sale whose reservations
+// the ledger has not seen released or revoked, sold ones included: the
+// units taken out of available and not put back. Items with none are left
+// out.
+func (s *service) ClaimedItemUnits(ctx context.Context, saleID string) (map[string]int, error) {
+	query := `
+		SELECT item_id, -SUM(amount) AS units
+		FROM inventory_ledger
+		WHERE tenant_id = $1 AND sale_id = $2 AND account = 'available' AND item_id IS NOT NULL
+		GROUP BY item_id
+		HAVING SUM(amount) < 0`
+	rows, err := s.db.QueryContext(ctx, query, s.tenant, saleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	units := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		units[id] = n
+	}
+	return units, rows.Err()
+}
+
+// GetInventoryBalance sums a sale's ledger. A sale with no movements has a
+// zero balance.
+func (s *service) GetInventoryBalance(ctx context.Context, saleID string) (*InventoryBalance, error) {
+	query := `
+		SELECT supplied, available, reserved, sold, last_movement_at
+		FROM inventory_stock WHERE tenant_id = $1 AND sale_id = $2`
+	b := InventoryBalance{SaleID: saleID}
+	err := s.db.QueryRowContext(ctx, query, s.tenant, saleID).Scan(&b.Supplied, &b.Available, &b.Reserved, &b.Sold, &b.LastMovementAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return &b, nil
+}
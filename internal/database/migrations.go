@@ -1,59 +1,221 @@
 package database
 
 import (
+	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
 	"log"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 )
 
 //go:embed migrations/*.sql
 var migrationFiles embed.FS
 
+// downSuffix marks the rollback file that pairs with NNN_name.sql.
+const downSuffix = ".down.sql"
+
+// MigrationStatus describes one embedded migration and whether it has been
+// applied. Dirty means it was started but never completed.
+type MigrationStatus struct {
+	Version   string
+	Applied   bool
+	Dirty     bool
+	AppliedAt time.Time
+	HasDown   bool
+}
+
+// RunMigrations applies every pending migration in order. It refuses to run
+// while a previous migration is marked dirty.
 func (s *service) RunMigrations() error {
 	if err := s.createMigrationsTable(); err != nil {
 		return fmt.Errorf("failed to create migrations table: %w", err)
 	}
+	if err := s.checkDirty(); err != nil {
+		return err
+	}
 
-	files, err := migrationFiles.ReadDir("migrations")
+	versions, err := migrationVersions()
 	if err != nil {
-		return fmt.Errorf("failed to read migrations directory: %w", err)
+		return err
 	}
 
-	var migrationNames []string
-	for _, file := range files {
-		if filepath.Ext(file.Name()) == ".sql" {
-			migrationNames = append(migrationNames, file.Name())
+	for _, version := range versions {
+		if err := s.runMigration(version); err != nil {
+			return fmt.Errorf("failed to run migration %s: %w", version, err)
 		}
 	}
-	sort.Strings(migrationNames)
 
-	for _, filename := range migrationNames {
-		if err := s.runMigration(filename); err != nil {
-			return fmt.Errorf("failed to run migration %s: %w", filename, err)
+	return nil
+}
+
+// RollbackMigrations reverts the n most recently applied migrations using
+// their down files.
+func (s *service) RollbackMigrations(n int) error {
+	if err := s.createMigrationsTable(); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	if err := s.checkDirty(); err != nil {
+		return err
+	}
+
+	rows, err := s.db.Query("SELECT version FROM schema_migrations ORDER BY version DESC LIMIT $1", n)
+	if err != nil {
+		return err
+	}
+	var applied []string
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return err
 		}
+		applied = append(applied, version)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
+	for _, version := range applied {
+		if err := s.rollbackMigration(version); err != nil {
+			return fmt.Errorf("failed to roll back migration %s: %w", version, err)
+		}
+	}
 	return nil
 }
 
+// MigrationStatuses lists every embedded migration with its applied state,
+// followed by any recorded version that no longer has a file.
+func (s *service) MigrationStatuses() ([]MigrationStatus, error) {
+	if err := s.createMigrationsTable(); err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	rows, err := s.db.Query("SELECT version, dirty, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recorded := map[string]MigrationStatus{}
+	for rows.Next() {
+		st := MigrationStatus{Applied: true}
+		var appliedAt sql.NullTime
+		if err := rows.Scan(&st.Version, &st.Dirty, &appliedAt); err != nil {
+			return nil, err
+		}
+		st.AppliedAt = appliedAt.Time
+		recorded[st.Version] = st
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	versions, err := migrationVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	for _, version := range versions {
+		st, ok := recorded[version]
+		if !ok {
+			st = MigrationStatus{Version: version}
+		}
+		st.Applied = ok && !st.Dirty
+		st.HasDown = hasDownFile(version)
+		statuses = append(statuses, st)
+		delete(recorded, version)
+	}
+
+	var unknown []string
+	for version := range recorded {
+		unknown = append(unknown, version)
+	}
+	sort.Strings(unknown)
+	for _, version := range unknown {
+		statuses = append(statuses, recorded[version])
+	}
+	return statuses, nil
+}
+
+// ForceMigrationVersion records the schema as being exactly at target
+// without running any SQL: later migrations are forgotten, earlier ones are
+// marked applied, and any dirty flag is cleared. target is a migration
+// number such as "3", or "0" for an empty schema. It is the way out after
+// fixing a failed migration by hand.
+func (s *service) ForceMigrationVersion(target string) error {
+	if err := s.createMigrationsTable(); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	versions, err := migrationVersions()
+	if err != nil {
+		return err
+	}
+
+	keep := -1
+	if strings.Trim(target, "0") != "" {
+		for i, version := range versions {
+			if migrationNumber(version) == migrationNumber(target) {
+				keep = i
+			}
+		}
+		if keep < 0 {
+			return fmt.Errorf("unknown migration %s", target)
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM schema_migrations"); err != nil {
+		return err
+	}
+	for _, version := range versions[:keep+1] {
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 func (s *service) createMigrationsTable() error {
 	query := `
 		CREATE TABLE IF NOT EXISTS schema_migrations (
 			version VARCHAR(255) PRIMARY KEY,
 			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)`
+		);
+		ALTER TABLE schema_migrations ADD COLUMN IF NOT EXISTS dirty BOOLEAN NOT NULL DEFAULT FALSE`
 	_, err := s.db.Exec(query)
 	return err
 }
 
-func (s *service) runMigration(filename string) error {
-	migrationName := strings.TrimSuffix(filename, ".sql")
+func (s *service) checkDirty() error {
+	var version string
+	err := s.db.QueryRow("SELECT version FROM schema_migrations WHERE dirty ORDER BY version LIMIT 1").Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("schema is dirty at migration %s: fix it by hand, then run `migrate force <version>`", version)
+}
 
+// runMigration applies one migration. The version is recorded as dirty
+// before the SQL runs and cleared in the same transaction as the SQL, so a
+// migration that fails or is interrupted stays flagged.
+func (s *service) runMigration(version string) error {
 	var exists bool
-	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = $1)", migrationName).Scan(&exists)
+	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = $1)", version).Scan(&exists)
 	if err != nil {
 		return err
 	}
@@ -62,11 +224,15 @@ func (s *service) runMigration(filename string) error {
 		return nil
 	}
 
-	content, err := migrationFiles.ReadFile("migrations/" + filename)
+	content, err := migrationFiles.ReadFile("migrations/" + version + ".sql")
 	if err != nil {
 		return err
 	}
 
+	if _, err := s.db.Exec("INSERT INTO schema_migrations (version, dirty) VALUES ($1, TRUE)", version); err != nil {
+		return err
+	}
+
 	tx, err := s.db.Begin()
 	if err != nil {
 		return err
@@ -74,10 +240,10 @@ func (s *service) runMigration(filename string) error {
 	defer tx.Rollback()
 
 	if _, err := tx.Exec(string(content)); err != nil {
-		return fmt.Errorf("migration %s failed: %w", filename, err)
+		return fmt.Errorf("migration %s failed: %w", version, err)
 	}
 
-	if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", migrationName); err != nil {
+	if _, err := tx.Exec("UPDATE schema_migrations SET dirty = FALSE, applied_at = CURRENT_TIMESTAMP WHERE version = $1", version); err != nil {
 		return err
 	}
 
@@ -85,6 +251,70 @@ func (s *service) runMigration(filename string) error {
 		return err
 	}
 
-	log.Printf("Applied migration: %s", filename)
+	log.Printf("Applied migration: %s", version)
 	return nil
 }
+
+func (s *service) rollbackMigration(version string) error {
+	content, err := migrationFiles.ReadFile("migrations/" + version + downSuffix)
+	if err != nil {
+		return fmt.Errorf("migration %s has no down file", version)
+	}
+
+	if _, err := s.db.Exec("UPDATE schema_migrations SET dirty = TRUE WHERE version = $1", version); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(string(content)); err != nil {
+		return fmt.Errorf("rollback of %s failed: %w", version, err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM schema_migrations WHERE version = $1", version); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Rolled back migration: %s", version)
+	return nil
+}
+
+// migrationVersions returns the embedded up migrations, without extension,
+// in the order they apply.
+func migrationVersions() ([]string, error) {
+	files, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations directory: %w", err)
+	}
+
+	var versions []string
+	for _, file := range files {
+		name := file.Name()
+		if filepath.Ext(name) != ".sql" || strings.HasSuffix(name, downSuffix) {
+			continue
+		}
+		versions = append(versions, strings.TrimSuffix(name, ".sql"))
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
+
+func hasDownFile(version string) bool {
+	_, err := migrationFiles.Open("migrations/" + version + downSuffix)
+	return err == nil
+}
+
+// migrationNumber extracts the leading number of a version, so "3",
+// "003" and "003_item_categories" all compare equal.
+func migrationNumber(version string) string {
+	number, _, _ := strings.Cut(version, "_")
+	return strings.TrimLeft(number, "0")
+}
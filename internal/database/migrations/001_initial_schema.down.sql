@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS purchases;
+DROP TABLE IF EXISTS checkout_attempts;
+DROP TABLE IF EXISTS items;
+DROP TABLE IF EXISTS sales;
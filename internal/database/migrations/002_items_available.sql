@@ -0,0 +1,15 @@
+-- Row-per-item availability used when Redis is unavailable
+CREATE TABLE IF NOT EXISTS items_available (
+    item_id VARCHAR(50) PRIMARY KEY,
+    sale_id VARCHAR(50) NOT NULL,
+    reserved_by VARCHAR(100),
+    code VARCHAR(100),
+    reserved_until TIMESTAMP,
+    sold BOOLEAN NOT NULL DEFAULT FALSE,
+    fallback BOOLEAN NOT NULL DEFAULT FALSE,
+    reconciled BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS idx_items_available_sale_sold ON items_available(sale_id, sold);
+CREATE INDEX IF NOT EXISTS idx_items_available_code ON items_available(code);
+CREATE INDEX IF NOT EXISTS idx_items_available_reserved_by ON items_available(sale_id, reserved_by);
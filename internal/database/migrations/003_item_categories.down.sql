@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_items_available_sale_category;
+DROP INDEX IF EXISTS idx_items_sale_category;
+
+ALTER TABLE items_available DROP COLUMN IF EXISTS category;
+ALTER TABLE items DROP COLUMN IF EXISTS category;
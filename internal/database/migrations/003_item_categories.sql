@@ -0,0 +1,6 @@
+-- Item categories with per-category availability
+ALTER TABLE items ADD COLUMN IF NOT EXISTS category VARCHAR(50) NOT NULL DEFAULT 'artifacts';
+ALTER TABLE items_available ADD COLUMN IF NOT EXISTS category VARCHAR(50) NOT NULL DEFAULT 'artifacts';
+
+CREATE INDEX IF NOT EXISTS idx_items_sale_category ON items(sale_id, category);
+CREATE INDEX IF NOT EXISTS idx_items_available_sale_category ON items_available(sale_id, category, sold);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_sales_unarchived;
+ALTER TABLE sales DROP COLUMN IF EXISTS archived_at;
+
+DROP TABLE IF EXISTS purchases_archive;
+DROP TABLE IF EXISTS checkout_attempts_archive;
+DROP TABLE IF EXISTS items_archive;
@@ -0,0 +1,12 @@
+-- Archive tables for ended sales. They mirror the hot tables column for
+-- column, so any later column added to a hot table must be added here too.
+CREATE TABLE IF NOT EXISTS items_archive (LIKE items INCLUDING DEFAULTS);
+CREATE TABLE IF NOT EXISTS checkout_attempts_archive (LIKE checkout_attempts INCLUDING DEFAULTS);
+CREATE TABLE IF NOT EXISTS purchases_archive (LIKE purchases INCLUDING DEFAULTS);
+
+CREATE INDEX IF NOT EXISTS idx_items_archive_sale_id ON items_archive(sale_id);
+CREATE INDEX IF NOT EXISTS idx_checkout_attempts_archive_sale_id ON checkout_attempts_archive(sale_id);
+CREATE INDEX IF NOT EXISTS idx_purchases_archive_sale_id ON purchases_archive(sale_id);
+
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_sales_unarchived ON sales(end_time) WHERE status = 'ended' AND archived_at IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_purchases_sale_item;
+DROP TABLE IF EXISTS purchase_anomalies;
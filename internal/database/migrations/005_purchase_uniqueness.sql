@@ -0,0 +1,33 @@
+-- Purchases that collide on (sale_id, item_id) are double sells. They are
+-- kept here instead of in purchases.
+CREATE TABLE IF NOT EXISTS purchase_anomalies (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind VARCHAR(50) NOT NULL,
+    sale_id VARCHAR(50) NOT NULL,
+    item_id VARCHAR(50) NOT NULL,
+    user_id VARCHAR(100) NOT NULL,
+    existing_user_id VARCHAR(100),
+    purchase_time TIMESTAMP,
+    detected_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    resolved BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_anomalies_sale_id ON purchase_anomalies(sale_id);
+
+-- Move existing duplicates out of the way, keeping the earliest purchase.
+WITH ranked AS (
+    SELECT id, sale_id, item_id, user_id, purchase_time,
+           FIRST_VALUE(user_id) OVER w AS first_user_id,
+           ROW_NUMBER() OVER w AS n
+    FROM purchases
+    WINDOW w AS (PARTITION BY sale_id, item_id ORDER BY purchase_time, id)
+),
+moved AS (
+    DELETE FROM purchases p USING ranked r
+    WHERE p.id = r.id AND r.n > 1
+    RETURNING r.sale_id, r.item_id, r.user_id, r.first_user_id, r.purchase_time
+)
+INSERT INTO purchase_anomalies (kind, sale_id, item_id, user_id, existing_user_id, purchase_time)
+SELECT 'duplicate_purchase', sale_id, item_id, user_id, first_user_id, purchase_time FROM moved;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_purchases_sale_item ON purchases(sale_id, item_id);
@@ -0,0 +1,8 @@
+ALTER TABLE purchases_archive DROP COLUMN IF EXISTS currency;
+ALTER TABLE purchases_archive DROP COLUMN IF EXISTS amount_minor;
+ALTER TABLE purchases DROP COLUMN IF EXISTS currency;
+ALTER TABLE purchases DROP COLUMN IF EXISTS amount_minor;
+ALTER TABLE items_archive DROP COLUMN IF EXISTS currency;
+ALTER TABLE items_archive DROP COLUMN IF EXISTS price_minor;
+ALTER TABLE items DROP COLUMN IF EXISTS currency;
+ALTER TABLE items DROP COLUMN IF EXISTS price_minor;
@@ -0,0 +1,11 @@
+-- Prices are integer amounts of the currency's minor unit.
+ALTER TABLE items ADD COLUMN IF NOT EXISTS price_minor BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE items ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE items_archive ADD COLUMN IF NOT EXISTS price_minor BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE items_archive ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+
+-- What the buyer was charged; NULL when the item was not in the catalog.
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS amount_minor BIGINT;
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS currency CHAR(3);
+ALTER TABLE purchases_archive ADD COLUMN IF NOT EXISTS amount_minor BIGINT;
+ALTER TABLE purchases_archive ADD COLUMN IF NOT EXISTS currency CHAR(3);
@@ -0,0 +1,3 @@
+ALTER TABLE purchases_archive DROP COLUMN IF EXISTS promo_code;
+ALTER TABLE purchases DROP COLUMN IF EXISTS promo_code;
+DROP TABLE IF EXISTS promo_codes;
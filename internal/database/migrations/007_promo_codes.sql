@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS promo_codes (
+    code VARCHAR(32) PRIMARY KEY,
+    percent_off INT NOT NULL CHECK (percent_off BETWEEN 1 AND 100),
+    -- 0 means the code can be redeemed any number of times.
+    max_redemptions INT NOT NULL DEFAULT 0 CHECK (max_redemptions >= 0),
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS promo_code VARCHAR(32);
+ALTER TABLE purchases_archive ADD COLUMN IF NOT EXISTS promo_code VARCHAR(32);
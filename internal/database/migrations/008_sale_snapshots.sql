@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS sale_snapshots (
+    id BIGSERIAL PRIMARY KEY,
+    sale_id VARCHAR(50) NOT NULL,
+    taken_at TIMESTAMP NOT NULL,
+    keys INT NOT NULL,
+    codes INT NOT NULL,
+    -- The snapshot as JSON, with key values in Redis DUMP format.
+    data BYTEA NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_sale_snapshots_sale ON sale_snapshots(sale_id, taken_at DESC);
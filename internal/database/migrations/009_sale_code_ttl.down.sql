@@ -0,0 +1 @@
+ALTER TABLE sales DROP COLUMN IF EXISTS code_ttl_ms;
@@ -0,0 +1,2 @@
+-- How long a checkout code holds its item, per sale.
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS code_ttl_ms BIGINT NOT NULL DEFAULT 300000;
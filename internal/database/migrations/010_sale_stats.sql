@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS sale_stats (
+    sale_id VARCHAR(50) PRIMARY KEY,
+    total_items INT NOT NULL,
+    items_sold INT NOT NULL,
+    checkout_requests BIGINT NOT NULL,
+    checkout_success BIGINT NOT NULL,
+    checkout_success_rate DOUBLE PRECISION NOT NULL,
+    purchase_requests BIGINT NOT NULL,
+    purchase_success BIGINT NOT NULL,
+    purchase_success_rate DOUBLE PRECISION NOT NULL,
+    sold_out_errors BIGINT NOT NULL,
+    p99_checkout_ms DOUBLE PRECISION NOT NULL,
+    p99_purchase_ms DOUBLE PRECISION NOT NULL,
+    -- How long after the start the inventory first hit zero; NULL if it never did.
+    sold_out_after_ms BIGINT,
+    -- How many replicas reported metrics for the sale.
+    instances INT NOT NULL,
+    recorded_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
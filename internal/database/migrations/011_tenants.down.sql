@@ -0,0 +1,7 @@
+DELETE FROM promo_codes WHERE tenant_id <> '';
+ALTER TABLE promo_codes DROP CONSTRAINT IF EXISTS promo_codes_pkey;
+ALTER TABLE promo_codes ADD PRIMARY KEY (code);
+ALTER TABLE promo_codes DROP COLUMN IF EXISTS tenant_id;
+
+DROP INDEX IF EXISTS idx_sales_tenant_status;
+ALTER TABLE sales DROP COLUMN IF EXISTS tenant_id;
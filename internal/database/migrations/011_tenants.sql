@@ -0,0 +1,7 @@
+-- The default tenant is the empty string, so existing rows keep working.
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(32) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_sales_tenant_status ON sales(tenant_id, status);
+
+ALTER TABLE promo_codes ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE promo_codes DROP CONSTRAINT IF EXISTS promo_codes_pkey;
+ALTER TABLE promo_codes ADD PRIMARY KEY (tenant_id, code);
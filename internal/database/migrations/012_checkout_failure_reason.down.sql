@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_checkout_attempts_failure_reason;
+DELETE FROM checkout_attempts WHERE failure_reason IS NOT NULL;
+DELETE FROM checkout_attempts_archive WHERE failure_reason IS NOT NULL;
+ALTER TABLE checkout_attempts DROP COLUMN IF EXISTS failure_reason;
+ALTER TABLE checkout_attempts_archive DROP COLUMN IF EXISTS failure_reason;
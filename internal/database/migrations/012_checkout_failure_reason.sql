@@ -0,0 +1,5 @@
+-- Failed checkouts are logged too, with an empty code and why they failed;
+-- successful attempts leave failure_reason NULL.
+ALTER TABLE checkout_attempts ADD COLUMN IF NOT EXISTS failure_reason VARCHAR(32);
+ALTER TABLE checkout_attempts_archive ADD COLUMN IF NOT EXISTS failure_reason VARCHAR(32);
+CREATE INDEX IF NOT EXISTS idx_checkout_attempts_failure_reason ON checkout_attempts(sale_id, failure_reason) WHERE failure_reason IS NOT NULL;
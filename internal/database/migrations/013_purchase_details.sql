@@ -0,0 +1,21 @@
+-- Shipping and contact details buyers submit with /purchase, keyed by the
+-- purchase ID returned to them.
+CREATE TABLE IF NOT EXISTS purchase_details (
+    purchase_id VARCHAR(64) PRIMARY KEY,
+    tenant_id VARCHAR(32) NOT NULL DEFAULT '',
+    sale_id VARCHAR(50) NOT NULL,
+    user_id VARCHAR(100) NOT NULL,
+    item_id VARCHAR(50) NOT NULL,
+    name VARCHAR(200) NOT NULL,
+    email VARCHAR(200) NOT NULL,
+    phone VARCHAR(200),
+    address_line1 VARCHAR(200) NOT NULL,
+    address_line2 VARCHAR(200),
+    city VARCHAR(200) NOT NULL,
+    region VARCHAR(200),
+    postal_code VARCHAR(200) NOT NULL,
+    country CHAR(2) NOT NULL,
+    submitted_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_details_sale_id ON purchase_details(sale_id);
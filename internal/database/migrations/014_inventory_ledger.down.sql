@@ -0,0 +1,2 @@
+DROP VIEW IF EXISTS inventory_stock;
+DROP TABLE IF EXISTS inventory_ledger;
@@ -0,0 +1,30 @@
+-- Every movement of a sale's inventory, as two legs that sum to zero: one
+-- account is debited what the other is credited. supply is outside the
+-- sale; available mirrors the Redis inventory counter.
+CREATE TABLE IF NOT EXISTS inventory_ledger (
+    entry_id VARCHAR(64) NOT NULL,
+    account VARCHAR(16) NOT NULL CHECK (account IN ('supply', 'available', 'reserved', 'sold')),
+    tenant_id VARCHAR(32) NOT NULL DEFAULT '',
+    sale_id VARCHAR(50) NOT NULL,
+    movement VARCHAR(16) NOT NULL CHECK (movement IN ('init', 'reserve', 'release', 'sell', 'restock')),
+    amount INT NOT NULL,
+    user_id VARCHAR(100),
+    item_id VARCHAR(50),
+    recorded_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (entry_id, account)
+);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_ledger_sale_id ON inventory_ledger(tenant_id, sale_id);
+
+-- The stock of each sale as the ledger has it.
+CREATE OR REPLACE VIEW inventory_stock AS
+SELECT
+    tenant_id,
+    sale_id,
+    -COALESCE(SUM(amount) FILTER (WHERE account = 'supply'), 0) AS supplied,
+    COALESCE(SUM(amount) FILTER (WHERE account = 'available'), 0) AS available,
+    COALESCE(SUM(amount) FILTER (WHERE account = 'reserved'), 0) AS reserved,
+    COALESCE(SUM(amount) FILTER (WHERE account = 'sold'), 0) AS sold,
+    MAX(recorded_at) AS last_movement_at
+FROM inventory_ledger
+GROUP BY tenant_id, sale_id;
@@ -0,0 +1,12 @@
+-- Endpoints told about every completed purchase of a sale. Payloads are
+-- signed with the webhook's secret.
+CREATE TABLE IF NOT EXISTS sale_webhooks (
+    webhook_id BIGSERIAL PRIMARY KEY,
+    tenant_id VARCHAR(32) NOT NULL DEFAULT '',
+    sale_id VARCHAR(50) NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sale_webhooks_sale_id ON sale_webhooks(tenant_id, sale_id);
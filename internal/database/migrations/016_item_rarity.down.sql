@@ -0,0 +1,2 @@
+ALTER TABLE items_archive DROP COLUMN IF EXISTS rarity;
+ALTER TABLE items DROP COLUMN IF EXISTS rarity;
@@ -0,0 +1,3 @@
+-- Rarity tiers (common, rare, legendary) carry per-user caps of their own.
+ALTER TABLE items ADD COLUMN IF NOT EXISTS rarity VARCHAR(16) NOT NULL DEFAULT 'common';
+ALTER TABLE items_archive ADD COLUMN IF NOT EXISTS rarity VARCHAR(16) NOT NULL DEFAULT 'common';
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS purchases_notify ON purchases;
+DROP FUNCTION IF EXISTS notify_purchase_created();
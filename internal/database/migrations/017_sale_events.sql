@@ -0,0 +1,18 @@
+-- Every purchase is announced on the sale_events channel, so replicas can
+-- drop their cached inventory instead of waiting for it to expire. The
+-- tenant is taken from the sale.
+CREATE OR REPLACE FUNCTION notify_purchase_created() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('sale_events', json_build_object(
+        'type', 'purchase_created',
+        'tenant_id', COALESCE((SELECT tenant_id FROM sales WHERE sale_id = NEW.sale_id), ''),
+        'sale_id', NEW.sale_id,
+        'item_id', NEW.item_id
+    )::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS purchases_notify ON purchases;
+CREATE TRIGGER purchases_notify AFTER INSERT ON purchases
+    FOR EACH ROW EXECUTE FUNCTION notify_purchase_created();
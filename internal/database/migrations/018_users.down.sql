@@ -0,0 +1,3 @@
+ALTER TABLE purchases DROP CONSTRAINT IF EXISTS purchases_user_id_fkey;
+ALTER TABLE checkout_attempts DROP CONSTRAINT IF EXISTS checkout_attempts_user_id_fkey;
+DROP TABLE IF EXISTS users;
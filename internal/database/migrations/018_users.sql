@@ -0,0 +1,24 @@
+-- Users are shared by all tenants. checkout_attempts and purchases only
+-- take user IDs registered here.
+CREATE TABLE IF NOT EXISTS users (
+    id VARCHAR(100) PRIMARY KEY,
+    handle VARCHAR(100) NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Everyone who checked out or bought before users were registered becomes
+-- a user with their ID as handle, created at their first attempt.
+INSERT INTO users (id, handle, created_at)
+SELECT user_id, user_id, COALESCE(MIN(seen_at), CURRENT_TIMESTAMP) FROM (
+    SELECT user_id, created_at AS seen_at FROM checkout_attempts
+    UNION ALL SELECT user_id, created_at FROM checkout_attempts_archive
+    UNION ALL SELECT user_id, purchase_time FROM purchases
+    UNION ALL SELECT user_id, purchase_time FROM purchases_archive
+) seen
+GROUP BY user_id
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE checkout_attempts DROP CONSTRAINT IF EXISTS checkout_attempts_user_id_fkey;
+ALTER TABLE checkout_attempts ADD CONSTRAINT checkout_attempts_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+ALTER TABLE purchases DROP CONSTRAINT IF EXISTS purchases_user_id_fkey;
+ALTER TABLE purchases ADD CONSTRAINT purchases_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
@@ -0,0 +1,14 @@
+-- Keys partner integrations use in place of the admin token, each limited
+-- to some sales of a tenant and some operations. Only a SHA-256 of the
+-- key's secret is kept.
+CREATE TABLE IF NOT EXISTS api_keys (
+    key_id VARCHAR(32) PRIMARY KEY,
+    tenant_id VARCHAR(32) NOT NULL DEFAULT '',
+    name VARCHAR(100) NOT NULL,
+    sale_ids TEXT[] NOT NULL,
+    scopes TEXT[] NOT NULL,
+    secret_hash CHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_tenant_id ON api_keys(tenant_id);
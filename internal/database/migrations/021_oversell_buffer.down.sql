@@ -0,0 +1,3 @@
+ALTER TABLE sale_stats DROP COLUMN IF EXISTS oversold;
+ALTER TABLE sale_stats DROP COLUMN IF EXISTS oversell_buffer;
+ALTER TABLE sales DROP COLUMN IF EXISTS oversell_buffer;
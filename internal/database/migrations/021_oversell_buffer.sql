@@ -0,0 +1,4 @@
+-- How many units a sale may sell beyond its stock, and how many it did.
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS oversell_buffer INT NOT NULL DEFAULT 0;
+ALTER TABLE sale_stats ADD COLUMN IF NOT EXISTS oversell_buffer INT NOT NULL DEFAULT 0;
+ALTER TABLE sale_stats ADD COLUMN IF NOT EXISTS oversold INT NOT NULL DEFAULT 0;
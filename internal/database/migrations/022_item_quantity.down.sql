@@ -0,0 +1,16 @@
+-- Only the first unit of an item fits the old index; later units move to
+-- purchase_anomalies, as duplicates did when it was created.
+WITH moved AS (
+    DELETE FROM purchases WHERE unit > 1
+    RETURNING sale_id, item_id, user_id, purchase_time
+)
+INSERT INTO purchase_anomalies (kind, sale_id, item_id, user_id, purchase_time)
+SELECT 'duplicate_purchase', sale_id, item_id, user_id, purchase_time FROM moved;
+
+DROP INDEX IF EXISTS idx_purchases_sale_item_unit;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_purchases_sale_item ON purchases(sale_id, item_id);
+ALTER TABLE purchase_anomalies DROP COLUMN IF EXISTS unit;
+ALTER TABLE purchases_archive DROP COLUMN IF EXISTS unit;
+ALTER TABLE purchases DROP COLUMN IF EXISTS unit;
+ALTER TABLE items_archive DROP COLUMN IF EXISTS quantity;
+ALTER TABLE items DROP COLUMN IF EXISTS quantity;
@@ -0,0 +1,11 @@
+-- SKU-style items: one item row can stand for many units of a product, and
+-- each purchase records which unit of its item it sold, counted from 1.
+ALTER TABLE items ADD COLUMN IF NOT EXISTS quantity INT NOT NULL DEFAULT 1 CHECK (quantity > 0);
+ALTER TABLE items_archive ADD COLUMN IF NOT EXISTS quantity INT NOT NULL DEFAULT 1;
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS unit INT NOT NULL DEFAULT 1;
+ALTER TABLE purchases_archive ADD COLUMN IF NOT EXISTS unit INT NOT NULL DEFAULT 1;
+
+-- A double sell is now the same unit of an item sold twice.
+DROP INDEX IF EXISTS idx_purchases_sale_item;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_purchases_sale_item_unit ON purchases(sale_id, item_id, unit);
+ALTER TABLE purchase_anomalies ADD COLUMN IF NOT EXISTS unit INT NOT NULL DEFAULT 1;
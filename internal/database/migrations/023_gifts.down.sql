@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_purchases_recipient_id;
+ALTER TABLE purchases_archive DROP COLUMN IF EXISTS recipient_id;
+ALTER TABLE purchases DROP COLUMN IF EXISTS recipient_id;
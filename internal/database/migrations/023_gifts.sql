@@ -0,0 +1,6 @@
+-- A purchase made as a gift records who received it; user_id stays the
+-- buyer who checked out and paid.
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS recipient_id VARCHAR(100) REFERENCES users(id);
+ALTER TABLE purchases_archive ADD COLUMN IF NOT EXISTS recipient_id VARCHAR(100);
+
+CREATE INDEX IF NOT EXISTS idx_purchases_recipient_id ON purchases(recipient_id) WHERE recipient_id IS NOT NULL;
@@ -0,0 +1,2 @@
+-- How often the anti-sniping rule moved a sale's end_time.
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS extensions INT NOT NULL DEFAULT 0;
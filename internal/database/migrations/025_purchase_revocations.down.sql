@@ -0,0 +1,6 @@
+DELETE FROM inventory_ledger WHERE movement = 'revoke';
+ALTER TABLE inventory_ledger DROP CONSTRAINT IF EXISTS inventory_ledger_movement_check;
+ALTER TABLE inventory_ledger ADD CONSTRAINT inventory_ledger_movement_check
+    CHECK (movement IN ('init', 'reserve', 'release', 'sell', 'restock'));
+
+DROP TABLE IF EXISTS purchase_revocations;
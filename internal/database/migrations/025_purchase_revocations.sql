@@ -0,0 +1,12 @@
+-- Purchases taken back from banned users are moved here, with the time
+-- they were revoked. Like purchases_archive, this table needs every column
+-- added to purchases.
+CREATE TABLE IF NOT EXISTS purchase_revocations (LIKE purchases INCLUDING DEFAULTS);
+ALTER TABLE purchase_revocations ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_purchase_revocations_sale_id ON purchase_revocations(sale_id);
+
+-- A revoked unit moves from sold back to available.
+ALTER TABLE inventory_ledger DROP CONSTRAINT IF EXISTS inventory_ledger_movement_check;
+ALTER TABLE inventory_ledger ADD CONSTRAINT inventory_ledger_movement_check
+    CHECK (movement IN ('init', 'reserve', 'release', 'sell', 'restock', 'revoke'));
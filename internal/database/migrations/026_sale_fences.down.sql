@@ -0,0 +1,2 @@
+UPDATE sales SET status = 'ended' WHERE status = 'pending';
+DROP TABLE IF EXISTS sale_fences;
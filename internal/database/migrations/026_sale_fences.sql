@@ -0,0 +1,7 @@
+-- The highest leader token that activated a sale of each tenant. A sale
+-- manager that lost its leadership holds a lower token and can no longer
+-- activate the sale it was creating.
+CREATE TABLE IF NOT EXISTS sale_fences (
+    tenant_id VARCHAR(32) PRIMARY KEY,
+    token BIGINT NOT NULL
+);
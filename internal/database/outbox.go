@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// OutboxPurchaseCompleted is the outbox event CreatePurchase writes; its
+// payload is the Purchase.
+const OutboxPurchaseCompleted = "purchase.completed"
+
+// OutboxEvent is an event waiting in the outbox to be published.
+type OutboxEvent struct {
+	ID      int64
+	Type    string
+	Payload json.RawMessage
+	// Attempts counts the claims of the event, this one included.
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// ClaimOutboxEvents leases up to n of the tenant's unpublished events,
+// oldest first, for lease. Events another replica holds are skipped; those
+// whose lease ran out are claimed again.
+func (s *service) ClaimOutboxEvents(ctx context.Context, n int, lease time.Duration) ([]OutboxEvent, error) {
+	query := `
+		UPDATE outbox SET attempts = attempts + 1, locked_until = NOW() + $3 * INTERVAL '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE tenant_id = $1 AND published_at IS NULL AND (locked_until IS NULL OR locked_until < NOW())
+			ORDER BY id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, event_type, payload, attempts, created_at`
+	rows, err := s.db.QueryContext(ctx, query, s.tenant, n, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []OutboxEvent
+	for rows.Next() {
+		var e OutboxEvent
+		if err := rows.Scan(&e.ID, &e.Type, &e.Payload, &e.Attempts, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// MarkOutboxPublished records that events were published.
+func (s *service) MarkOutboxPublished(ctx context.Context, ids []int64) error {
+	query := `UPDATE outbox SET published_at = NOW(), locked_until = NULL, last_error = NULL WHERE id = ANY($1)`
+	_, err := s.db.ExecContext(ctx, query, ids)
+	return err
+}
+
+// FailOutboxEvent records why an event could not be published and holds it
+// back, 2^attempts seconds and at most five minutes, before it is claimed
+// again.
+func (s *service) FailOutboxEvent(ctx context.Context, id int64, cause error) error {
+	query := `
+		UPDATE outbox SET last_error = $2, locked_until = NOW() + LEAST(POWER(2, attempts), 300) * INTERVAL '1 second'
+		WHERE id = $1`
+	_, err := s.db.ExecContext(ctx, query, id, cause.Error())
+	return err
+}
+
+// PruneOutbox deletes the events published before cutoff.
+func (s *service) PruneOutbox(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM outbox WHERE published_at < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// OutboxBacklog counts the tenant's unpublished events.
+func (s *service) OutboxBacklog(ctx context.Context) (int64, error) {
+	var n int64
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM outbox WHERE tenant_id = $1 AND published_at IS NULL`, s.tenant).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// prewarmQueries are prepared on every pre-warmed connection: the purchase
+// path's writes and the first /sale/items pages.
+var prewarmQueries = []string{
+	createPurchaseQuery,
+	updateCheckoutStatusQuery,
+	consumeAvailableItemQuery,
+	logCheckoutAttemptsQuery,
+	saleItemsQuery,
+}
+
+// Prewarm opens up to n connections to the primary at once and prepares
+// the purchase path's statements on each, then hands them back to the
+// pool, so the first purchases of a sale neither dial Postgres nor wait
+// on a parse. It returns how many connections it warmed; pgx finds the
+// statements by their SQL, so queries run on them skip the prepare.
+func (s *service) Prewarm(ctx context.Context, n int) (int, error) {
+	conns := make([]*sql.Conn, 0, n)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	warmed := 0
+	for range n {
+		// Holding every connection until the end makes the pool open a
+		// new one each time instead of handing back the last.
+		conn, err := s.db.Conn(ctx)
+		if err != nil {
+			return warmed, err
+		}
+		conns = append(conns, conn)
+		err = conn.Raw(func(driverConn any) error {
+			pgConn := driverConn.(*stdlib.Conn).Conn()
+			for _, query := range prewarmQueries {
+				if _, err := pgConn.Prepare(ctx, query, query); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return warmed, fmt.Errorf("failed to prepare statements: %w", err)
+		}
+		warmed++
+	}
+	return warmed, nil
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// PromoCode is a discount buyers attach at checkout. Its redemption counter
+// lives in Redis, next to the inventory it is spent with.
+type PromoCode struct {
+	Code       string
+	PercentOff int
+	// MaxRedemptions caps uses across all sales; 0 is unlimited.
+	MaxRedemptions int
+	// ExpiresAt is zero for codes that never expire.
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// CreatePromoCode stores a new promo code. Codes are never overwritten, so
+// a reused code fails with "promo code exists".
+func (s *service) CreatePromoCode(ctx context.Context, p *PromoCode) error {
+	var expiresAt sql.NullTime
+	if !p.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: p.ExpiresAt, Valid: true}
+	}
+	query := `
+		INSERT INTO promo_codes (code, percent_off, max_redemptions, expires_at, tenant_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (tenant_id, code) DO NOTHING
+		RETURNING created_at`
+	err := s.db.QueryRowContext(ctx, query, p.Code, p.PercentOff, p.MaxRedemptions, expiresAt, s.tenant).Scan(&p.CreatedAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("promo code exists")
+	}
+	return err
+}
+
+// ListPromoCodes returns the tenant's promo codes, newest first.
+func (s *service) ListPromoCodes(ctx context.Context) ([]PromoCode, error) {
+	query := `SELECT code, percent_off, max_redemptions, expires_at, created_at FROM promo_codes WHERE tenant_id = $1 ORDER BY created_at DESC`
+	rows, err := s.db.QueryContext(ctx, query, s.tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var promos []PromoCode
+	for rows.Next() {
+		var (
+			p         PromoCode
+			expiresAt sql.NullTime
+		)
+		if err := rows.Scan(&p.Code, &p.PercentOff, &p.MaxRedemptions, &expiresAt, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		p.ExpiresAt = expiresAt.Time
+		promos = append(promos, p)
+	}
+	return promos, rows.Err()
+}
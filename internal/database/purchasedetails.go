@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// PurchaseDetails is the shipping and contact information a buyer submitted
+// with a purchase.
+type PurchaseDetails struct {
+	PurchaseID   string    `json:"purchase_id"`
+	SaleID       string    `json:"sale_id"`
+	UserID       string    `json:"user_id"`
+	ItemID       string    `json:"item_id"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	Phone        string    `json:"phone,omitempty"`
+	AddressLine1 string    `json:"address_line1"`
+	AddressLine2 string    `json:"address_line2,omitempty"`
+	City         string    `json:"city"`
+	Region       string    `json:"region,omitempty"`
+	PostalCode   string    `json:"postal_code"`
+	Country      string    `json:"country"`
+	SubmittedAt  time.Time `json:"submitted_at"`
+}
+
+// SavePurchaseDetails stores the details of a purchase. Details are written
+// once; saving them again, as a dead letter replay may, is a no-op.
+func (s *service) SavePurchaseDetails(ctx context.Context, d *PurchaseDetails) error {
+	query := `
+		INSERT INTO purchase_details (purchase_id, tenant_id, sale_id, user_id, item_id, name, email, phone,
+			address_line1, address_line2, city, region, postal_code, country, submitted_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, NULLIF($10, ''), $11, NULLIF($12, ''), $13, $14, $15)
+		ON CONFLICT (purchase_id) DO NOTHING`
+	_, err := s.db.ExecContext(ctx, query, d.PurchaseID, s.tenant, d.SaleID, d.UserID, d.ItemID, d.Name, d.Email, d.Phone,
+		d.AddressLine1, d.AddressLine2, d.City, d.Region, d.PostalCode, d.Country, d.SubmittedAt)
+	return err
+}
+
+// GetPurchaseDetails loads the details submitted with a purchase of the
+// tenant. It returns sql.ErrNoRows when there are none.
+func (s *service) GetPurchaseDetails(ctx context.Context, purchaseID string) (*PurchaseDetails, error) {
+	query := `
+		SELECT purchase_id, sale_id, user_id, item_id, name, email, COALESCE(phone, ''),
+			address_line1, COALESCE(address_line2, ''), city, COALESCE(region, ''), postal_code, country, submitted_at
+		FROM purchase_details WHERE purchase_id = $1 AND tenant_id = $2`
+	var d PurchaseDetails
+	err := s.db.QueryRowContext(ctx, query, purchaseID, s.tenant).Scan(&d.PurchaseID, &d.SaleID, &d.UserID, &d.ItemID, &d.Name, &d.Email, &d.Phone,
+		&d.AddressLine1, &d.AddressLine2, &d.City, &d.Region, &d.PostalCode, &d.Country, &d.SubmittedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
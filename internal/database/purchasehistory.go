@@ -0,0 +1,42 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// ListUserPurchases returns a page of the purchases a user bought or was
+// given in the tenant's sales, archived or not, newest first. A gift is
+// listed for both its buyer and its recipient.
+func (s *service) ListUserPurchases(ctx context.Context, userID string, limit, offset int) ([]Purchase, error) {
+	query := `
+		SELECT replace(id::text, '-', ''), sale_id, user_id, item_id, unit, recipient_id, promo_code, purchase_time FROM (
+			SELECT id, sale_id, user_id, item_id, unit, recipient_id, promo_code, purchase_time FROM purchases
+			WHERE user_id = $2 OR recipient_id = $2
+			UNION ALL
+			SELECT id, sale_id, user_id, item_id, unit, recipient_id, promo_code, purchase_time FROM purchases_archive
+			WHERE user_id = $2 OR recipient_id = $2
+		) p
+		WHERE sale_id IN (SELECT sale_id FROM sales WHERE tenant_id = $1)
+		ORDER BY purchase_time DESC, id
+		LIMIT $3 OFFSET $4`
+	rows, err := s.db.QueryContext(ctx, query, s.tenant, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var purchases []Purchase
+	for rows.Next() {
+		var (
+			p                    Purchase
+			recipient, promoCode sql.NullString
+		)
+		if err := rows.Scan(&p.ID, &p.SaleID, &p.UserID, &p.ItemID, &p.Unit, &recipient, &promoCode, &p.PurchaseTime); err != nil {
+			return nil, err
+		}
+		p.RecipientID, p.PromoCode = recipient.String, promoCode.String
+		purchases = append(purchases, p)
+	}
+	return purchases, rows.Err()
+}
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// QueryMetrics configures WithQueryMetrics. Calls slower than SlowQuery are
+// logged and reported to OnSlow; zero logs none. OnQuery, when set, is told
+// the duration and outcome of every instrumented call.
+type QueryMetrics struct {
+	SlowQuery time.Duration
+	OnQuery   func(op string, d time.Duration, err error)
+	OnSlow    func(op string, d time.Duration)
+}
+
+// instrumented times the calls on the checkout and purchase paths and the
+// sale manager's writes, the ones whose lag shows first under load.
+type instrumented struct {
+	Service
+	metrics QueryMetrics
+}
+
+// WithQueryMetrics times the hot calls of svc. Other calls go straight to
+// svc.
+func WithQueryMetrics(svc Service, metrics QueryMetrics) Service {
+	return &instrumented{Service: svc, metrics: metrics}
+}
+
+func (q *instrumented) ForTenant(tenant string) Service {
+	return &instrumented{Service: q.Service.ForTenant(tenant), metrics: q.metrics}
+}
+
+func (q *instrumented) CreateSale(ctx context.Context, sale *Sale) error {
+	return q.observe("create_sale", func() error { return q.Service.CreateSale(ctx, sale) })
+}
+
+func (q *instrumented) ActivateSale(ctx context.Context, saleID string, token int64) (bool, error) {
+	return timed(q, "activate_sale", func() (bool, error) { return q.Service.ActivateSale(ctx, saleID, token) })
+}
+
+func (q *instrumented) AbandonSale(ctx context.Context, saleID string) error {
+	return q.observe("abandon_sale", func() error { return q.Service.AbandonSale(ctx, saleID) })
+}
+
+func (q *instrumented) CreateItems(ctx context.Context, items []Item) error {
+	return q.observe("create_items", func() error { return q.Service.CreateItems(ctx, items) })
+}
+
+func (q *instrumented) DeleteItems(ctx context.Context, saleID string, itemIDs []string) error {
+	return q.observe("delete_items", func() error { return q.Service.DeleteItems(ctx, saleID, itemIDs) })
+}
+
+func (q *instrumented) GetActiveSale(ctx context.Context) (*Sale, error) {
+	return timed(q, "get_active_sale", func() (*Sale, error) { return q.Service.GetActiveSale(ctx) })
+}
+
+func (q *instrumented) GetSale(ctx context.Context, saleID string) (*Sale, error) {
+	return timed(q, "get_sale", func() (*Sale, error) { return q.Service.GetSale(ctx, saleID) })
+}
+
+func (q *instrumented) EndSale(ctx context.Context, saleID string, itemsSold int) error {
+	return q.observe("end_sale", func() error { return q.Service.EndSale(ctx, saleID, itemsSold) })
+}
+
+func (q *instrumented) GetSaleItems(ctx context.Context, saleID, category string, limit, offset int) ([]Item, error) {
+	return timed(q, "get_sale_items", func() ([]Item, error) {
+		return q.Service.GetSaleItems(ctx, saleID, category, limit, offset)
+	})
+}
+
+func (q *instrumented) LogCheckoutAttempt(ctx context.Context, attempt *CheckoutAttempt) error {
+	return q.observe("log_checkout_attempt", func() error { return q.Service.LogCheckoutAttempt(ctx, attempt) })
+}
+
+func (q *instrumented) LogCheckoutAttempts(ctx context.Context, attempts []*CheckoutAttempt) error {
+	return q.observe("log_checkout_attempts", func() error { return q.Service.LogCheckoutAttempts(ctx, attempts) })
+}
+
+func (q *instrumented) CreatePurchase(ctx context.Context, purchase *Purchase) error {
+	return q.observe("create_purchase", func() error { return q.Service.CreatePurchase(ctx, purchase) })
+}
+
+func (q *instrumented) RecordInventoryMovement(ctx context.Context, m *InventoryMovement) error {
+	return q.observe("record_inventory_movement", func() error { return q.Service.RecordInventoryMovement(ctx, m) })
+}
+
+func (q *instrumented) UpdateCheckoutStatus(ctx context.Context, code string, status bool) error {
+	return q.observe("update_checkout_status", func() error { return q.Service.UpdateCheckoutStatus(ctx, code, status) })
+}
+
+func (q *instrumented) ReserveAvailableItem(ctx context.Context, saleID, userID, itemID, category, code string, holdFor time.Duration, maxPerUser int, rarityLimits map[string]int) (string, error) {
+	return timed(q, "reserve_available_item", func() (string, error) {
+		return q.Service.ReserveAvailableItem(ctx, saleID, userID, itemID, category, code, holdFor, maxPerUser, rarityLimits)
+	})
+}
+
+func (q *instrumented) GetUser(ctx context.Context, id string) (*User, error) {
+	return timed(q, "get_user", func() (*User, error) { return q.Service.GetUser(ctx, id) })
+}
+
+func (q *instrumented) GetFallbackReservation(ctx context.Context, code string) (*FallbackReservation, error) {
+	return timed(q, "get_fallback_reservation", func() (*FallbackReservation, error) {
+		return q.Service.GetFallbackReservation(ctx, code)
+	})
+}
+
+func (q *instrumented) ClaimFallbackPurchase(ctx context.Context, code string) (*FallbackReservation, error) {
+	return timed(q, "claim_fallback_purchase", func() (*FallbackReservation, error) {
+		return q.Service.ClaimFallbackPurchase(ctx, code)
+	})
+}
+
+func (q *instrumented) UnreconciledFallbackPurchases(ctx context.Context, saleID string) ([]FallbackReservation, error) {
+	return timed(q, "unreconciled_fallback_purchases", func() ([]FallbackReservation, error) {
+		return q.Service.UnreconciledFallbackPurchases(ctx, saleID)
+	})
+}
+
+func (q *instrumented) MarkFallbackReconciled(ctx context.Context, saleID, itemID string) error {
+	return q.observe("mark_fallback_reconciled", func() error {
+		return q.Service.MarkFallbackReconciled(ctx, saleID, itemID)
+	})
+}
+
+func (q *instrumented) FlagFallbackConflict(ctx context.Context, r *FallbackReservation) error {
+	return q.observe("flag_fallback_conflict", func() error {
+		return q.Service.FlagFallbackConflict(ctx, r)
+	})
+}
+
+func (q *instrumented) observe(op string, fn func() error) error {
+	_, err := timed(q, op, func() (struct{}, error) { return struct{}{}, fn() })
+	return err
+}
+
+// timed runs fn and reports how long it took.
+func timed[T any](q *instrumented, op string, fn func() (T, error)) (T, error) {
+	start := time.Now()
+	v, err := fn()
+	d := time.Since(start)
+
+	if q.metrics.OnQuery != nil {
+		q.metrics.OnQuery(op, d, err)
+	}
+	if q.metrics.SlowQuery > 0 && d >= q.metrics.SlowQuery {
+		log.Printf("Slow query %s took %s (threshold %s)", op, d.Round(time.Millisecond), q.metrics.SlowQuery)
+		if q.metrics.OnSlow != nil {
+			q.metrics.OnSlow(op, d)
+		}
+	}
+	return v, err
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+// routed sends read-only catalog and reporting queries to a read replica
+// and everything else to the primary. A replica that errors is skipped for
+// that call rather than failing the read; replication lag is tolerated, so
+// only reads that can be a few seconds stale belong here.
+type routed struct {
+	Service
+	replica *service
+}
+
+func (r *routed) ForTenant(tenant string) Service {
+	return &routed{Service: r.Service.ForTenant(tenant), replica: &service{db: r.replica.db, tenant: tenant}}
+}
+
+func (r *routed) Health() map[string]string {
+	stats := r.Service.Health()
+	replica := r.replica.Health()
+	stats["replica_status"] = replica["status"]
+	if replica["error"] != "" {
+		stats["replica_error"] = replica["error"]
+	}
+	return stats
+}
+
+func (r *routed) Close() error {
+	return errors.Join(r.Service.Close(), r.replica.db.Close())
+}
+
+func (r *routed) GetSaleItems(ctx context.Context, saleID, category string, limit, offset int) ([]Item, error) {
+	items, err := r.replica.GetSaleItems(ctx, saleID, category, limit, offset)
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Replica failed to list items for sale %s, using primary: %v", saleID, err)
+		return r.Service.GetSaleItems(ctx, saleID, category, limit, offset)
+	}
+	return items, err
+}
+
+func (r *routed) GetShowcaseItemIDs(ctx context.Context, saleID string, limit int) ([]string, []string, error) {
+	firstIDs, lastIDs, err := r.replica.GetShowcaseItemIDs(ctx, saleID, limit)
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Replica failed to load showcase for sale %s, using primary: %v", saleID, err)
+		return r.Service.GetShowcaseItemIDs(ctx, saleID, limit)
+	}
+	return firstIDs, lastIDs, err
+}
+
+func (r *routed) RandomItemIDs(ctx context.Context, saleID string, n int) ([]string, error) {
+	ids, err := r.replica.RandomItemIDs(ctx, saleID, n)
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Replica failed to sample items of sale %s, using primary: %v", saleID, err)
+		return r.Service.RandomItemIDs(ctx, saleID, n)
+	}
+	return ids, err
+}
+
+func (r *routed) SaleRevenue(ctx context.Context, saleID string) ([]Revenue, error) {
+	revenue, err := r.replica.SaleRevenue(ctx, saleID)
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Replica failed to sum revenue for sale %s, using primary: %v", saleID, err)
+		return r.Service.SaleRevenue(ctx, saleID)
+	}
+	return revenue, err
+}
+
+func (r *routed) TopBuyers(ctx context.Context, saleID string, limit int) ([]BuyerCount, error) {
+	buyers, err := r.replica.TopBuyers(ctx, saleID, limit)
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Replica failed to rank buyers for sale %s, using primary: %v", saleID, err)
+		return r.Service.TopBuyers(ctx, saleID, limit)
+	}
+	return buyers, err
+}
+
+func (r *routed) ListSales(ctx context.Context, status string, limit, offset int) ([]SaleSummary, error) {
+	sales, err := r.replica.ListSales(ctx, status, limit, offset)
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Replica failed to list %s sales, using primary: %v", status, err)
+		return r.Service.ListSales(ctx, status, limit, offset)
+	}
+	return sales, err
+}
+
+func (r *routed) ListSoldItemIDs(ctx context.Context, saleID string, limit, offset int) ([]string, int, error) {
+	ids, total, err := r.replica.ListSoldItemIDs(ctx, saleID, limit, offset)
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Replica failed to list sold items of sale %s, using primary: %v", saleID, err)
+		return r.Service.ListSoldItemIDs(ctx, saleID, limit, offset)
+	}
+	return ids, total, err
+}
+
+// StreamPurchases and StreamItems are not retried on the primary: fn may
+// already have seen part of the stream.
+func (r *routed) StreamPurchases(ctx context.Context, saleID string, fn func(*Purchase) error) error {
+	return r.replica.StreamPurchases(ctx, saleID, fn)
+}
+
+func (r *routed) StreamItems(ctx context.Context, saleID string, fn func(*Item) error) error {
+	return r.replica.StreamItems(ctx, saleID, fn)
+}
@@ -0,0 +1,75 @@
+package database
+
+import "context"
+
+// Revenue totals a sale's purchases in one currency. Purchases recorded
+// without a price have an empty Currency.
+type Revenue struct {
+	Currency    string
+	Items       int
+	AmountMinor int64
+}
+
+// SaleRevenue sums a sale's purchases, archived or not, per currency.
+func (s *service) SaleRevenue(ctx context.Context, saleID string) ([]Revenue, error) {
+	query := `
+		SELECT COALESCE(currency, ''), COUNT(*), COALESCE(SUM(amount_minor), 0)
+		FROM (
+			SELECT currency, amount_minor FROM purchases WHERE sale_id = $1
+			UNION ALL
+			SELECT currency, amount_minor FROM purchases_archive WHERE sale_id = $1
+		) AS p
+		GROUP BY 1
+		ORDER BY 1`
+	rows, err := s.db.QueryContext(ctx, query, saleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revenue []Revenue
+	for rows.Next() {
+		var r Revenue
+		if err := rows.Scan(&r.Currency, &r.Items, &r.AmountMinor); err != nil {
+			return nil, err
+		}
+		revenue = append(revenue, r)
+	}
+	return revenue, rows.Err()
+}
+
+// BuyerCount is how many items one user bought in a sale.
+type BuyerCount struct {
+	UserID    string
+	Purchases int
+}
+
+// TopBuyers returns the users with the most recorded purchases in a sale,
+// archived or not, most first.
+func (s *service) TopBuyers(ctx context.Context, saleID string, limit int) ([]BuyerCount, error) {
+	query := `
+		SELECT user_id, COUNT(*) AS purchases
+		FROM (
+			SELECT user_id FROM purchases WHERE sale_id = $1
+			UNION ALL
+			SELECT user_id FROM purchases_archive WHERE sale_id = $1
+		) AS p
+		GROUP BY user_id
+		ORDER BY purchases DESC, user_id
+		LIMIT $2`
+	rows, err := s.db.QueryContext(ctx, query, saleID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buyers []BuyerCount
+	for rows.Next() {
+		var b BuyerCount
+		if err := rows.Scan(&b.UserID, &b.Purchases); err != nil {
+			return nil, err
+		}
+		buyers = append(buyers, b)
+	}
+	return buyers, rows.Err()
+}
@@ -0,0 +1,63 @@
+package database
+
+import "context"
+
+// RevokePurchases takes back the purchases a user made, or was gifted, in
+// a sale: they are moved to purchase_revocations and the revoked items'
+// own items_available rows are unsold, so the fallback path can sell them
+// again. Items without a row, such as those sold by quantity, stay out of
+// the fallback. It returns the revoked purchases, oldest first.
+func (s *service) RevokePurchases(ctx context.Context, saleID, userID string) ([]Purchase, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		WITH revoked AS (
+			DELETE FROM purchases WHERE sale_id = $1 AND (user_id = $2 OR recipient_id = $2)
+			RETURNING *
+		), moved AS (
+			INSERT INTO purchase_revocations SELECT *, NOW() FROM revoked
+			RETURNING id, sale_id, user_id, item_id, unit, recipient_id, promo_code, purchase_time
+		)
+		SELECT replace(id::text, '-', ''), sale_id, user_id, item_id, unit, COALESCE(recipient_id, ''), COALESCE(promo_code, ''), purchase_time
+		FROM moved ORDER BY purchase_time, id`
+	rows, err := tx.QueryContext(ctx, query, saleID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var purchases []Purchase
+	var itemIDs []string
+	for rows.Next() {
+		var p Purchase
+		if err := rows.Scan(&p.ID, &p.SaleID, &p.UserID, &p.ItemID, &p.Unit, &p.RecipientID, &p.PromoCode, &p.PurchaseTime); err != nil {
+			return nil, err
+		}
+		purchases = append(purchases, p)
+		itemIDs = append(itemIDs, p.ItemID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(purchases) == 0 {
+		return nil, nil
+	}
+
+	// Only the revoked items' own rows are unsold; any other sold row
+	// belongs to an item a buyer still owns.
+	unsell := `
+		UPDATE items_available SET sold = FALSE, reserved_by = NULL, code = NULL, reserved_until = NULL
+		WHERE sale_id = $1 AND item_id = ANY($2) AND sold`
+	if _, err := tx.ExecContext(ctx, unsell, saleID, itemIDs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return purchases, nil
+}
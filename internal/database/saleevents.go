@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// SaleEventsChannel is the Postgres channel sale events are sent on.
+const SaleEventsChannel = "sale_events"
+
+// Sale event types. Sale events are sent once the shared sale pointer
+// reflects the change; purchase events are sent by a trigger on
+// purchases, so every write path sends them.
+const (
+	SaleEventCreated  = "sale_created"
+	SaleEventUpdated  = "sale_updated"
+	SaleEventClosing  = "sale_closing"
+	SaleEventEnded    = "sale_ended"
+	SaleEventPurchase = "purchase_created"
+)
+
+// SaleEvent is a change to a sale announced to every replica.
+type SaleEvent struct {
+	Type     string `json:"type"`
+	TenantID string `json:"tenant_id"`
+	SaleID   string `json:"sale_id"`
+	ItemID   string `json:"item_id,omitempty"`
+}
+
+// NotifySaleEvent sends event, stamped with the tenant of s, on
+// SaleEventsChannel.
+func (s *service) NotifySaleEvent(ctx context.Context, event SaleEvent) error {
+	event.TenantID = s.tenant
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, SaleEventsChannel, string(payload))
+	return err
+}
+
+// ListenSaleEvents holds a connection listening on SaleEventsChannel and
+// calls fn with every event of every tenant, until ctx is done or the
+// connection fails. Events sent while no connection listens are lost.
+func (s *service) ListenSaleEvents(ctx context.Context, fn func(SaleEvent)) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		pgConn := driverConn.(*stdlib.Conn).Conn()
+		if _, err := pgConn.Exec(ctx, "LISTEN "+SaleEventsChannel); err != nil {
+			return err
+		}
+		// A healthy connection goes back to the pool unsubscribed; one the
+		// wait broke is discarded by the pool.
+		defer pgConn.Exec(context.Background(), "UNLISTEN *")
+
+		for {
+			notification, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				return fmt.Errorf("waiting for sale events: %w", err)
+			}
+			var event SaleEvent
+			if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+				log.Printf("Ignoring malformed sale event %q: %v", notification.Payload, err)
+				continue
+			}
+			fn(event)
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SaleStats is the record of how a finished sale performed, kept after its
+// other rows are archived so hourly sales can be compared.
+type SaleStats struct {
+	SaleID              string
+	TotalItems          int
+	ItemsSold           int
+	CheckoutRequests    int64
+	CheckoutSuccess     int64
+	CheckoutSuccessRate float64
+	PurchaseRequests    int64
+	PurchaseSuccess     int64
+	PurchaseSuccessRate float64
+	SoldOutErrors       int64
+	P99CheckoutMs       float64
+	P99PurchaseMs       float64
+	// SoldOutAfter is how long after the start the inventory first ran
+	// out; 0 if it never did.
+	SoldOutAfter time.Duration
+	// OversellBuffer is how many units the sale could sell beyond its
+	// stock, and Oversold how many of them it did.
+	OversellBuffer int
+	Oversold       int
+	Instances      int
+	RecordedAt     time.Time
+}
+
+// SaveSaleStats records a sale's stats, replacing any earlier record.
+func (s *service) SaveSaleStats(ctx context.Context, st *SaleStats) error {
+	var soldOutAfter sql.NullInt64
+	if st.SoldOutAfter > 0 {
+		soldOutAfter = sql.NullInt64{Int64: st.SoldOutAfter.Milliseconds(), Valid: true}
+	}
+	query := `
+		INSERT INTO sale_stats (sale_id, total_items, items_sold, checkout_requests, checkout_success, checkout_success_rate,
+			purchase_requests, purchase_success, purchase_success_rate, sold_out_errors, p99_checkout_ms, p99_purchase_ms,
+			sold_out_after_ms, instances, oversell_buffer, oversold)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (sale_id) DO UPDATE SET
+			total_items = EXCLUDED.total_items, items_sold = EXCLUDED.items_sold,
+			checkout_requests = EXCLUDED.checkout_requests, checkout_success = EXCLUDED.checkout_success,
+			checkout_success_rate = EXCLUDED.checkout_success_rate, purchase_requests = EXCLUDED.purchase_requests,
+			purchase_success = EXCLUDED.purchase_success, purchase_success_rate = EXCLUDED.purchase_success_rate,
+			sold_out_errors = EXCLUDED.sold_out_errors, p99_checkout_ms = EXCLUDED.p99_checkout_ms,
+			p99_purchase_ms = EXCLUDED.p99_purchase_ms, sold_out_after_ms = EXCLUDED.sold_out_after_ms,
+			instances = EXCLUDED.instances, oversell_buffer = EXCLUDED.oversell_buffer, oversold = EXCLUDED.oversold,
+			recorded_at = NOW()`
+	_, err := s.db.ExecContext(ctx, query, st.SaleID, st.TotalItems, st.ItemsSold, st.CheckoutRequests, st.CheckoutSuccess,
+		st.CheckoutSuccessRate, st.PurchaseRequests, st.PurchaseSuccess, st.PurchaseSuccessRate, st.SoldOutErrors,
+		st.P99CheckoutMs, st.P99PurchaseMs, soldOutAfter, st.Instances, st.OversellBuffer, st.Oversold)
+	return err
+}
+
+// GetSaleStats loads a sale's stats. It returns sql.ErrNoRows for sales
+// that have not been finalized.
+func (s *service) GetSaleStats(ctx context.Context, saleID string) (*SaleStats, error) {
+	query := `
+		SELECT sale_id, total_items, items_sold, checkout_requests, checkout_success, checkout_success_rate,
+			purchase_requests, purchase_success, purchase_success_rate, sold_out_errors, p99_checkout_ms, p99_purchase_ms,
+			sold_out_after_ms, instances, oversell_buffer, oversold, recorded_at
+		FROM sale_stats WHERE sale_id = $1 AND sale_id IN (SELECT sale_id FROM sales WHERE tenant_id = $2)`
+	var (
+		st           SaleStats
+		soldOutAfter sql.NullInt64
+	)
+	err := s.db.QueryRowContext(ctx, query, saleID, s.tenant).Scan(&st.SaleID, &st.TotalItems, &st.ItemsSold, &st.CheckoutRequests,
+		&st.CheckoutSuccess, &st.CheckoutSuccessRate, &st.PurchaseRequests, &st.PurchaseSuccess, &st.PurchaseSuccessRate,
+		&st.SoldOutErrors, &st.P99CheckoutMs, &st.P99PurchaseMs, &soldOutAfter, &st.Instances, &st.OversellBuffer, &st.Oversold,
+		&st.RecordedAt)
+	if err != nil {
+		return nil, err
+	}
+	if soldOutAfter.Valid {
+		st.SoldOutAfter = time.Duration(soldOutAfter.Int64) * time.Millisecond
+	}
+	return &st, nil
+}
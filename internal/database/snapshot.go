@@ -0,0 +1,37 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// SaleSnapshot is a stored copy of a sale's Redis state.
+type SaleSnapshot struct {
+	ID      int64
+	SaleID  string
+	TakenAt time.Time
+	Keys    int
+	Codes   int
+	Data    []byte
+}
+
+// SaveSaleSnapshot stores a snapshot and sets its ID.
+func (s *service) SaveSaleSnapshot(ctx context.Context, snap *SaleSnapshot) error {
+	query := `INSERT INTO sale_snapshots (sale_id, taken_at, keys, codes, data) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	return s.db.QueryRowContext(ctx, query, snap.SaleID, snap.TakenAt, snap.Keys, snap.Codes, snap.Data).Scan(&snap.ID)
+}
+
+// GetSaleSnapshot loads one snapshot of a sale, the latest when id is 0.
+// It returns sql.ErrNoRows when there is none.
+func (s *service) GetSaleSnapshot(ctx context.Context, saleID string, id int64) (*SaleSnapshot, error) {
+	query := `
+		SELECT id, sale_id, taken_at, keys, codes, data FROM sale_snapshots
+		WHERE sale_id = $1 AND ($2 = 0 OR id = $2)
+		ORDER BY taken_at DESC LIMIT 1`
+	var snap SaleSnapshot
+	err := s.db.QueryRowContext(ctx, query, saleID, id).Scan(&snap.ID, &snap.SaleID, &snap.TakenAt, &snap.Keys, &snap.Codes, &snap.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
@@ -0,0 +1,31 @@
+package database
+
+import "context"
+
+// ListSoldItemIDs returns a page of the items sold in a sale, archived
+// purchases included, ordered by item ID, with the number sold in all.
+func (s *service) ListSoldItemIDs(ctx context.Context, saleID string, limit, offset int) ([]string, int, error) {
+	query := `
+		WITH sold AS (
+			SELECT item_id FROM purchases WHERE sale_id = $1
+			UNION
+			SELECT item_id FROM purchases_archive WHERE sale_id = $1
+		)
+		SELECT item_id, COUNT(*) OVER () FROM sold ORDER BY item_id LIMIT $2 OFFSET $3`
+	rows, err := s.db.QueryContext(ctx, query, saleID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	total := 0
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id, &total); err != nil {
+			return nil, 0, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, total, rows.Err()
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// User is a registered buyer. Users are shared by all tenants; checkout
+// attempts and purchases can only name registered user IDs.
+type User struct {
+	ID        string
+	Handle    string
+	CreatedAt time.Time
+}
+
+// CreateUser registers a user and fills in its creation time. Users are
+// never overwritten: a taken ID fails with "user exists" and a taken handle
+// with "handle taken".
+func (s *service) CreateUser(ctx context.Context, u *User) error {
+	query := `
+		INSERT INTO users (id, handle) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+		RETURNING created_at`
+	err := s.db.QueryRowContext(ctx, query, u.ID, u.Handle).Scan(&u.CreatedAt)
+	if err != sql.ErrNoRows {
+		return err
+	}
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, u.ID).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("user exists")
+	}
+	return fmt.Errorf("handle taken")
+}
+
+// GetUser returns a registered user, or sql.ErrNoRows.
+func (s *service) GetUser(ctx context.Context, id string) (*User, error) {
+	u := &User{}
+	query := `SELECT id, handle, created_at FROM users WHERE id = $1`
+	if err := s.db.QueryRowContext(ctx, query, id).Scan(&u.ID, &u.Handle, &u.CreatedAt); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// ListUserIDs returns up to limit registered user IDs that sort after
+// after, in order, for paging through every user.
+func (s *service) ListUserIDs(ctx context.Context, after string, limit int) ([]string, error) {
+	query := `SELECT id FROM users WHERE id > $1 ORDER BY id LIMIT $2`
+	rows, err := s.db.QueryContext(ctx, query, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
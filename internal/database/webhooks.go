@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Webhook is an endpoint told about every completed purchase of a sale.
+type Webhook struct {
+	ID     int64
+	SaleID string
+	URL    string
+	// Secret signs the payloads sent to URL.
+	Secret    string
+	CreatedAt time.Time
+}
+
+// CreateWebhook registers a webhook for a sale of the tenant and fills in
+// its ID and creation time.
+func (s *service) CreateWebhook(ctx context.Context, w *Webhook) error {
+	query := `
+		INSERT INTO sale_webhooks (tenant_id, sale_id, url, secret)
+		VALUES ($1, $2, $3, $4)
+		RETURNING webhook_id, created_at`
+	return s.db.QueryRowContext(ctx, query, s.tenant, w.SaleID, w.URL, w.Secret).Scan(&w.ID, &w.CreatedAt)
+}
+
+// ListWebhooks returns the webhooks of a sale, oldest first.
+func (s *service) ListWebhooks(ctx context.Context, saleID string) ([]Webhook, error) {
+	query := `
+		SELECT webhook_id, sale_id, url, secret, created_at FROM sale_webhooks
+		WHERE tenant_id = $1 AND sale_id = $2 ORDER BY webhook_id`
+	rows, err := s.db.QueryContext(ctx, query, s.tenant, saleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []Webhook
+	for rows.Next() {
+		var w Webhook
+		if err := rows.Scan(&w.ID, &w.SaleID, &w.URL, &w.Secret, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook removes a webhook of a sale. It returns sql.ErrNoRows when
+// the sale has no such webhook.
+func (s *service) DeleteWebhook(ctx context.Context, saleID string, id int64) error {
+	query := `DELETE FROM sale_webhooks WHERE tenant_id = $1 AND sale_id = $2 AND webhook_id = $3`
+	res, err := s.db.ExecContext(ctx, query, s.tenant, saleID, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+// Package flags switches risky behaviors on and off at runtime. Overrides
+// set through the admin API live in a Redis hash, so every replica sees
+// them; each replica caches the hash for a short TTL, so checking a flag on
+// the hot path does not cost a round trip.
+package flags
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"flash_sale_contest/internal/cache"
+)
+
+const (
+	// Lottery makes checkouts enter the lottery instead of reserving an
+	// item. Its default follows CHECKOUT_MODE.
+	Lottery = "lottery"
+	// Queue admits checkouts through the waiting room when QUEUE_WINDOW is
+	// set.
+	Queue = "queue"
+	// InventoryGate refuses checkouts for nearly sold-out items when
+	// INVENTORY_GATE_THRESHOLD is set.
+	InventoryGate = "inventory_gate"
+)
+
+// Flag is the state of one flag.
+type Flag struct {
+	Name    string
+	Enabled bool
+	Default bool
+	// Overridden is set when Enabled comes from the admin API.
+	Overridden bool
+}
+
+// Set holds the flags of one tenant.
+type Set struct {
+	cache cache.Service
+
+	mu        sync.RWMutex
+	defaults  map[string]bool
+	ttl       time.Duration
+	overrides map[string]bool
+	loadedAt  time.Time
+	refresh   sync.Mutex
+}
+
+// New returns the flags named in defaults, each on or off as given until
+// overridden. Overrides are read from c at most once per ttl.
+func New(c cache.Service, defaults map[string]bool, ttl time.Duration) *Set {
+	return &Set{cache: c, defaults: defaults, ttl: ttl}
+}
+
+// Configure replaces the defaults and the TTL, as after a config reload,
+// and has the next check reread the overrides.
+func (s *Set) Configure(defaults map[string]bool, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.defaults = defaults
+	s.ttl = ttl
+	s.loadedAt = time.Time{}
+}
+
+// Known reports whether name is a flag of the set.
+func (s *Set) Known(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.defaults[name]
+	return ok
+}
+
+// Enabled reports whether a flag is on. When Redis cannot be read the last
+// overrides seen are kept, or the defaults before any were.
+func (s *Set) Enabled(ctx context.Context, name string) bool {
+	s.load(ctx)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if on, ok := s.overrides[name]; ok {
+		return on
+	}
+	return s.defaults[name]
+}
+
+// Set overrides a flag for every replica. This replica sees it at once;
+// others within the TTL.
+func (s *Set) Set(ctx context.Context, name string, on bool) error {
+	if err := s.cache.SetFlag(ctx, name, on); err != nil {
+		return err
+	}
+	s.reload(ctx)
+	return nil
+}
+
+// Clear puts a flag back to its default.
+func (s *Set) Clear(ctx context.Context, name string) error {
+	if err := s.cache.ClearFlag(ctx, name); err != nil {
+		return err
+	}
+	s.reload(ctx)
+	return nil
+}
+
+// All returns every flag of the set, sorted by name.
+func (s *Set) All(ctx context.Context) []Flag {
+	s.load(ctx)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	all := make([]Flag, 0, len(s.defaults))
+	for name, def := range s.defaults {
+		on, overridden := s.overrides[name]
+		if !overridden {
+			on = def
+		}
+		all = append(all, Flag{Name: name, Enabled: on, Default: def, Overridden: overridden})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// load rereads the overrides once they are older than the TTL. Only one
+// caller rereads them; the others go on with the values they have.
+func (s *Set) load(ctx context.Context) {
+	s.mu.RLock()
+	fresh := time.Since(s.loadedAt) < s.ttl
+	s.mu.RUnlock()
+	if fresh || !s.refresh.TryLock() {
+		return
+	}
+	defer s.refresh.Unlock()
+	s.fetch(ctx)
+}
+
+// reload rereads the overrides now, after this replica changed them.
+func (s *Set) reload(ctx context.Context) {
+	s.refresh.Lock()
+	defer s.refresh.Unlock()
+	s.fetch(ctx)
+}
+
+func (s *Set) fetch(ctx context.Context) {
+	overrides, err := s.cache.GetFlags(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Failed reads are retried after a TTL, not on every check.
+	s.loadedAt = time.Now()
+	if err != nil {
+		log.Printf("Warning: could not read feature flags, keeping the last ones: %v", err)
+		return
+	}
+	s.overrides = overrides
+}
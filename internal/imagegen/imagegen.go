@@ -0,0 +1,69 @@
+// Package imagegen derives placeholder images for sale items. Everything is
+// a pure function of the item ID, so an item looks the same on every
+// replica, in every sale it is reloaded into, and in tests.
+package imagegen
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"strings"
+)
+
+// Size is the width and height of generated images, in pixels.
+const Size = 400
+
+// Spec is the seeded metadata an item's image is drawn from.
+type Spec struct {
+	// Seed is the FNV-1a hash of the item ID everything else derives from.
+	Seed uint32
+	// Background and Foreground are "#rrggbb" colours; the foreground is
+	// black or white, whichever reads better on the background.
+	Background string
+	Foreground string
+	Label      string
+}
+
+// For returns the image spec of an item.
+func For(itemID string) Spec {
+	h := fnv.New32a()
+	h.Write([]byte(itemID))
+	seed := h.Sum32()
+
+	bg := seed & 0xFFFFFF
+	r, g, b := bg>>16, bg>>8&0xFF, bg&0xFF
+	fg := "#FFFFFF"
+	// Rec. 601 luma, scaled by 1000.
+	if 299*r+587*g+114*b > 150*1000 {
+		fg = "#000000"
+	}
+
+	return Spec{
+		Seed:       seed,
+		Background: fmt.Sprintf("#%06x", bg),
+		Foreground: fg,
+		Label:      Label(itemID),
+	}
+}
+
+// Label is the text drawn on an item's image: "#000042" for generated and
+// sequential IDs, the ID itself otherwise.
+func Label(itemID string) string {
+	if idx := strings.LastIndex(itemID, "_item_"); idx >= 0 {
+		return "#" + itemID[idx+len("_item_"):]
+	}
+	return itemID
+}
+
+// URL is the path the API serves an item's image on.
+func URL(itemID string) string {
+	return fmt.Sprintf("/items/%s/image", itemID)
+}
+
+// SVG renders the spec as a square SVG tile.
+func (s Spec) SVG() []byte {
+	return []byte(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="%[1]d" viewBox="0 0 %[1]d %[1]d">`+
+		`<rect width="%[1]d" height="%[1]d" fill="%[2]s"/>`+
+		`<text x="%[3]d" y="%[3]d" font-family="sans-serif" font-size="36" fill="%[4]s" text-anchor="middle" dominant-baseline="middle">%[5]s</text>`+
+		`</svg>`, Size, s.Background, Size/2, s.Foreground, html.EscapeString(s.Label)))
+}
@@ -0,0 +1,124 @@
+// Package jobs runs the server's periodic maintenance, such as code cleanup,
+// fallback reconciliation and archival, each on its own interval.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Job is one piece of periodic work. A job never overlaps itself: the next
+// run starts Interval after the previous one finished.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	// Timeout bounds one run; 0 bounds it by Interval.
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// Recorder is told the outcome of every run. A run that panicked reports
+// the panic as its error, with panicked set.
+type Recorder func(name string, duration time.Duration, err error, panicked bool)
+
+// Manager runs jobs in the background until it is stopped.
+type Manager struct {
+	record Recorder
+	jobs   []Job
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewManager(record Recorder) *Manager {
+	return &Manager{record: record}
+}
+
+// Add registers a job. Jobs with a zero Interval are disabled and skipped.
+// Jobs must be added before Start.
+func (m *Manager) Add(job Job) {
+	if job.Interval <= 0 {
+		log.Printf("Job %s disabled", job.Name)
+		return
+	}
+	m.jobs = append(m.jobs, job)
+}
+
+// Start runs every job in a goroutine of its own.
+func (m *Manager) Start(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ctx, m.cancel = context.WithCancel(ctx)
+	for _, job := range m.jobs {
+		m.wg.Add(1)
+		go m.loop(ctx, job)
+	}
+	log.Printf("Job manager started with %d jobs", len(m.jobs))
+}
+
+// Stop cancels running jobs and waits for them to return.
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	cancel := m.cancel
+	m.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	m.wg.Wait()
+	log.Println("Job manager stopped")
+}
+
+func (m *Manager) loop(ctx context.Context, job Job) {
+	defer m.wg.Done()
+
+	timer := time.NewTimer(job.Interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			m.run(ctx, job)
+			timer.Reset(job.Interval)
+		}
+	}
+}
+
+// run runs a job once. A panic fails the run instead of taking the process
+// down with it.
+func (m *Manager) run(ctx context.Context, job Job) {
+	timeout := job.Timeout
+	if timeout <= 0 {
+		timeout = job.Interval
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	var err error
+	panicked := false
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				panicked = true
+				err = fmt.Errorf("panic: %v", p)
+				log.Printf("Job %s panicked: %v\n%s", job.Name, p, debug.Stack())
+			}
+		}()
+		err = job.Run(ctx)
+	}()
+
+	if err != nil && !panicked {
+		log.Printf("Job %s failed: %v", job.Name, err)
+	}
+	if m.record != nil {
+		m.record(job.Name, time.Since(start), err, panicked)
+	}
+}
@@ -1,12 +1,18 @@
 package metrics
 
 import (
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
-type Metrics struct {
+// maxTrackedSales bounds how many per-sale counter sets are kept in memory.
+const maxTrackedSales = 24
+
+// Counters is the set of event counters tracked both for the lifetime of the
+// process and for each individual sale.
+type Counters struct {
 	CheckoutRequests  int64
 	CheckoutSuccess   int64
 	CheckoutFailed    int64
@@ -17,16 +23,132 @@ type Metrics struct {
 	UserLimitErrors   int64
 	CodeInvalidErrors int64
 	Panics            int64
+	FallbackCheckouts int64
+	FallbackPurchases int64
+	TotalItemsSold    int64
+	DeadLetters       int64
+	GatedCheckouts    int64
+	QueuedCheckouts   int64
+	RedisRetries      int64
+	RedisExhausted    int64
+	AttemptsDropped   int64
+	CacheTimeouts     int64
+	SlowQueries       int64
+	LotteryEntries    int64
+	WritesShed        int64
+	WebhooksDelivered int64
+	WebhooksFailed    int64
+	CodesExtended     int64
+	OutboxPublished   int64
+	OutboxFailures    int64
+	RedisHedges       int64
+	SLOShed           int64
+	BannedRequests    int64
+	PurchaseReplays   int64
+}
+
+// maxLatencySamples bounds how many recent latencies are kept, for the
+// process and for each sale.
+const maxLatencySamples = 1000
+
+type saleMetrics struct {
+	Counters
+	saleID    string
+	startedAt time.Time
+
+	mu                sync.Mutex
+	checkoutLatencies []time.Duration
+	purchaseLatencies []time.Duration
+}
+
+// SaleReport is one instance's view of a sale, published so the leader can
+// sum every replica's counters when the sale is finalized.
+type SaleReport struct {
+	CheckoutRequests int64   `json:"checkout_requests"`
+	CheckoutSuccess  int64   `json:"checkout_success"`
+	PurchaseRequests int64   `json:"purchase_requests"`
+	PurchaseSuccess  int64   `json:"purchase_success"`
+	SoldOutErrors    int64   `json:"sold_out_errors"`
+	P99CheckoutMs    float64 `json:"p99_checkout_ms"`
+	P99PurchaseMs    float64 `json:"p99_purchase_ms"`
+}
+
+// Merge adds another instance's report. Percentiles cannot be summed, so
+// the slowest instance's p99 is kept.
+func (r *SaleReport) Merge(other SaleReport) {
+	r.CheckoutRequests += other.CheckoutRequests
+	r.CheckoutSuccess += other.CheckoutSuccess
+	r.PurchaseRequests += other.PurchaseRequests
+	r.PurchaseSuccess += other.PurchaseSuccess
+	r.SoldOutErrors += other.SoldOutErrors
+	r.P99CheckoutMs = max(r.P99CheckoutMs, other.P99CheckoutMs)
+	r.P99PurchaseMs = max(r.P99PurchaseMs, other.P99PurchaseMs)
+}
+
+type Metrics struct {
+	Counters
 
 	AvgCheckoutLatency int64 // nanoseconds
 	AvgPurchaseLatency int64 // nanoseconds
 
-	ActiveUsers    sync.Map // user_id -> last_activity_time
-	TotalItemsSold int64
+	ActiveUsers sync.Map // user_id -> last_activity_time
+
+	OpenConns     int64
+	TotalConns    int64
+	RejectedConns int64
+
+	connMu         sync.Mutex
+	connSecond     int64
+	connThisSecond int64
+	connLastSecond int64
 
 	mu                sync.RWMutex
 	checkoutLatencies []time.Duration
 	purchaseLatencies []time.Duration
+
+	currentSale atomic.Pointer[saleMetrics]
+	salesMu     sync.RWMutex
+	sales       map[string]*saleMetrics
+	saleOrder   []string
+
+	jobsMu sync.Mutex
+	jobs   map[string]*jobStats
+
+	queriesMu sync.Mutex
+	queries   map[string]*queryStats
+
+	apiKeysMu sync.Mutex
+	apiKeys   map[string]*apiKeyStats
+
+	reservationsMu sync.Mutex
+	reservations   map[string]int64
+
+	runtime *runtimeStats
+}
+
+// queryStats is the timing of one database call.
+type queryStats struct {
+	calls  int64
+	errors int64
+	total  time.Duration
+	max    time.Duration
+}
+
+// apiKeyStats is the use of one API key.
+type apiKeyStats struct {
+	requests int64
+	denied   int64
+	lastUsed time.Time
+}
+
+// jobStats is the run history of one background job.
+type jobStats struct {
+	runs         int64
+	failures     int64
+	panics       int64
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastError    string
 }
 
 type Service interface {
@@ -40,101 +162,354 @@ type Service interface {
 	IncrementSoldOutErrors()
 	IncrementUserLimitErrors()
 	IncrementCodeInvalidErrors()
+	IncrementCodesExtended()
 	IncrementItemsSold()
+	IncrementFallbackCheckouts()
+	IncrementFallbackPurchases()
+	IncrementDeadLetters()
+	IncrementGatedCheckouts()
+	IncrementQueuedCheckouts()
+	IncrementRedisRetries()
+	IncrementRedisExhausted()
+	IncrementRedisHedges()
+	IncrementAttemptsDropped()
+	IncrementWritesShed()
+	IncrementWebhooksDelivered()
+	IncrementWebhooksFailed()
+	IncrementOutboxPublished()
+	IncrementOutboxFailures()
+	IncrementCacheTimeouts()
+	IncrementSlowQueries()
+	IncrementLotteryEntries()
+	IncrementSLOShed()
+	IncrementBannedRequests()
+	IncrementPurchaseReplays()
 
 	RecordCheckoutLatency(duration time.Duration)
 	RecordPurchaseLatency(duration time.Duration)
 	UpdateActiveUser(userID string)
+	RecordJobRun(name string, duration time.Duration, err error, panicked bool)
+	RecordQuery(op string, duration time.Duration, err error)
+	RecordAPIKeyRequest(keyID string, allowed bool)
+	RecordReservationOutcome(outcome string)
+
+	ConnOpened()
+	ConnClosed()
+	ConnRejected()
+	GetOpenConns() int64
 
+	BeginSale(saleID string)
 	GetStats() map[string]interface{}
+	GetSaleStats(saleID string) (map[string]interface{}, bool)
+	SaleReport(saleID string) (SaleReport, bool)
 	Reset()
 }
 
-var metricsInstance *Metrics
+var (
+	metricsOnce     sync.Once
+	metricsInstance *Metrics
+)
 
+// New returns the process-wide metrics. Prefer NewService.
 func New() Service {
-	if metricsInstance != nil {
-		return metricsInstance
-	}
+	metricsOnce.Do(func() {
+		metricsInstance = newMetrics()
+	})
+	return metricsInstance
+}
 
-	metricsInstance = &Metrics{
-		checkoutLatencies: make([]time.Duration, 0, 1000),
-		purchaseLatencies: make([]time.Duration, 0, 1000),
+// NewService returns a set of metrics of its own.
+func NewService() Service {
+	return newMetrics()
+}
+
+// NewTenant is NewService, kept for callers that predate it.
+func NewTenant() Service {
+	return NewService()
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{
+		checkoutLatencies: make([]time.Duration, 0, maxLatencySamples),
+		purchaseLatencies: make([]time.Duration, 0, maxLatencySamples),
+		sales:             make(map[string]*saleMetrics),
+		jobs:              make(map[string]*jobStats),
+		queries:           make(map[string]*queryStats),
+		apiKeys:           make(map[string]*apiKeyStats),
+		reservations:      make(map[string]int64),
+		runtime:           newRuntimeStats(),
 	}
+}
 
-	return metricsInstance
+// add bumps a counter in the lifetime set and in the current sale's set.
+func (m *Metrics) add(field func(*Counters) *int64) {
+	atomic.AddInt64(field(&m.Counters), 1)
+	if sale := m.currentSale.Load(); sale != nil {
+		atomic.AddInt64(field(&sale.Counters), 1)
+	}
 }
 
 func (m *Metrics) IncrementCheckoutRequests() {
-	atomic.AddInt64(&m.CheckoutRequests, 1)
+	m.add(func(c *Counters) *int64 { return &c.CheckoutRequests })
 }
 
 func (m *Metrics) IncrementCheckoutSuccess() {
-	atomic.AddInt64(&m.CheckoutSuccess, 1)
+	m.add(func(c *Counters) *int64 { return &c.CheckoutSuccess })
 }
 
 func (m *Metrics) IncrementCheckoutFailed() {
-	atomic.AddInt64(&m.CheckoutFailed, 1)
+	m.add(func(c *Counters) *int64 { return &c.CheckoutFailed })
 }
 
 func (m *Metrics) IncrementPurchaseRequests() {
-	atomic.AddInt64(&m.PurchaseRequests, 1)
+	m.add(func(c *Counters) *int64 { return &c.PurchaseRequests })
 }
 
 func (m *Metrics) IncrementPanic() {
-	atomic.AddInt64(&m.Panics, 1)
+	m.add(func(c *Counters) *int64 { return &c.Panics })
 }
 
 func (m *Metrics) IncrementPurchaseSuccess() {
-	atomic.AddInt64(&m.PurchaseSuccess, 1)
+	m.add(func(c *Counters) *int64 { return &c.PurchaseSuccess })
 }
 
 func (m *Metrics) IncrementPurchaseFailed() {
-	atomic.AddInt64(&m.PurchaseFailed, 1)
+	m.add(func(c *Counters) *int64 { return &c.PurchaseFailed })
 }
 
 func (m *Metrics) IncrementSoldOutErrors() {
-	atomic.AddInt64(&m.SoldOutErrors, 1)
+	m.add(func(c *Counters) *int64 { return &c.SoldOutErrors })
 }
 
 func (m *Metrics) IncrementUserLimitErrors() {
-	atomic.AddInt64(&m.UserLimitErrors, 1)
+	m.add(func(c *Counters) *int64 { return &c.UserLimitErrors })
 }
 
 func (m *Metrics) IncrementCodeInvalidErrors() {
-	atomic.AddInt64(&m.CodeInvalidErrors, 1)
+	m.add(func(c *Counters) *int64 { return &c.CodeInvalidErrors })
+}
+
+func (m *Metrics) IncrementCodesExtended() {
+	m.add(func(c *Counters) *int64 { return &c.CodesExtended })
 }
 
 func (m *Metrics) IncrementItemsSold() {
-	atomic.AddInt64(&m.TotalItemsSold, 1)
+	m.add(func(c *Counters) *int64 { return &c.TotalItemsSold })
+}
+
+func (m *Metrics) IncrementFallbackCheckouts() {
+	m.add(func(c *Counters) *int64 { return &c.FallbackCheckouts })
+}
+
+func (m *Metrics) IncrementFallbackPurchases() {
+	m.add(func(c *Counters) *int64 { return &c.FallbackPurchases })
+}
+
+func (m *Metrics) IncrementDeadLetters() {
+	m.add(func(c *Counters) *int64 { return &c.DeadLetters })
+}
+
+// IncrementGatedCheckouts counts checkouts turned away as sold out by the
+// local inventory gate without reaching Redis.
+func (m *Metrics) IncrementGatedCheckouts() {
+	m.add(func(c *Counters) *int64 { return &c.GatedCheckouts })
+}
+
+// IncrementQueuedCheckouts counts checkouts sent to the waiting queue
+// instead of reaching the reservation path.
+func (m *Metrics) IncrementQueuedCheckouts() {
+	m.add(func(c *Counters) *int64 { return &c.QueuedCheckouts })
+}
+
+// IncrementRedisRetries counts retries of a checkout or purchase script
+// after a transient Redis failure.
+func (m *Metrics) IncrementRedisRetries() {
+	m.add(func(c *Counters) *int64 { return &c.RedisRetries })
+}
+
+// IncrementRedisExhausted counts checkout or purchase scripts that still
+// failed transiently when their retries ran out.
+func (m *Metrics) IncrementRedisExhausted() {
+	m.add(func(c *Counters) *int64 { return &c.RedisExhausted })
+}
+
+// IncrementRedisHedges counts hedged Redis reads: second copies sent
+// because the first had not answered within REDIS_HEDGE_DELAY.
+func (m *Metrics) IncrementRedisHedges() {
+	m.add(func(c *Counters) *int64 { return &c.RedisHedges })
+}
+
+// IncrementAttemptsDropped counts failed checkouts left out of
+// checkout_attempts because the attempt log's buffer was full.
+func (m *Metrics) IncrementAttemptsDropped() {
+	m.add(func(c *Counters) *int64 { return &c.AttemptsDropped })
+}
+
+// IncrementWritesShed counts purchase writes parked in the dead letter
+// queue because the write pool's queue was full.
+func (m *Metrics) IncrementWritesShed() {
+	m.add(func(c *Counters) *int64 { return &c.WritesShed })
+}
+
+// IncrementWebhooksDelivered counts purchase webhooks their endpoint
+// accepted.
+func (m *Metrics) IncrementWebhooksDelivered() {
+	m.add(func(c *Counters) *int64 { return &c.WebhooksDelivered })
+}
+
+// IncrementWebhooksFailed counts purchase webhooks dropped after their
+// last retry.
+func (m *Metrics) IncrementWebhooksFailed() {
+	m.add(func(c *Counters) *int64 { return &c.WebhooksFailed })
+}
+
+// IncrementOutboxPublished counts purchase events the outbox relay
+// published to Redis.
+func (m *Metrics) IncrementOutboxPublished() {
+	m.add(func(c *Counters) *int64 { return &c.OutboxPublished })
+}
+
+// IncrementOutboxFailures counts attempts to publish an outbox event that
+// failed and were put off for a retry.
+func (m *Metrics) IncrementOutboxFailures() {
+	m.add(func(c *Counters) *int64 { return &c.OutboxFailures })
+}
+
+// IncrementCacheTimeouts counts Redis calls that ran past their own
+// deadline.
+func (m *Metrics) IncrementCacheTimeouts() {
+	m.add(func(c *Counters) *int64 { return &c.CacheTimeouts })
+}
+
+// IncrementSlowQueries counts database calls slower than DB_SLOW_QUERY.
+func (m *Metrics) IncrementSlowQueries() {
+	m.add(func(c *Counters) *int64 { return &c.SlowQueries })
+}
+
+// IncrementLotteryEntries counts checkouts entered into a sale's lottery.
+func (m *Metrics) IncrementLotteryEntries() {
+	m.add(func(c *Counters) *int64 { return &c.LotteryEntries })
+}
+
+// IncrementSLOShed counts checkouts shed because the error budget of the
+// checkout and purchase objectives burned too fast.
+func (m *Metrics) IncrementSLOShed() {
+	m.add(func(c *Counters) *int64 { return &c.SLOShed })
+}
+
+// IncrementBannedRequests counts checkouts and purchases refused because
+// the user is banned.
+func (m *Metrics) IncrementBannedRequests() {
+	m.add(func(c *Counters) *int64 { return &c.BannedRequests })
+}
+
+// IncrementPurchaseReplays counts purchases retried with a code that was
+// already redeemed, and answered with the original purchase.
+func (m *Metrics) IncrementPurchaseReplays() {
+	m.add(func(c *Counters) *int64 { return &c.PurchaseReplays })
 }
 
 func (m *Metrics) RecordCheckoutLatency(duration time.Duration) {
 	atomic.StoreInt64(&m.AvgCheckoutLatency, int64(duration))
 
 	m.mu.Lock()
-	if len(m.checkoutLatencies) >= 1000 {
-		m.checkoutLatencies = m.checkoutLatencies[1:]
-	}
-	m.checkoutLatencies = append(m.checkoutLatencies, duration)
+	m.checkoutLatencies = appendLatency(m.checkoutLatencies, duration)
 	m.mu.Unlock()
+
+	if sale := m.currentSale.Load(); sale != nil {
+		sale.mu.Lock()
+		sale.checkoutLatencies = appendLatency(sale.checkoutLatencies, duration)
+		sale.mu.Unlock()
+	}
 }
 
 func (m *Metrics) RecordPurchaseLatency(duration time.Duration) {
 	atomic.StoreInt64(&m.AvgPurchaseLatency, int64(duration))
 
 	m.mu.Lock()
-	if len(m.purchaseLatencies) >= 1000 {
-		m.purchaseLatencies = m.purchaseLatencies[1:]
-	}
-	m.purchaseLatencies = append(m.purchaseLatencies, duration)
+	m.purchaseLatencies = appendLatency(m.purchaseLatencies, duration)
 	m.mu.Unlock()
+
+	if sale := m.currentSale.Load(); sale != nil {
+		sale.mu.Lock()
+		sale.purchaseLatencies = appendLatency(sale.purchaseLatencies, duration)
+		sale.mu.Unlock()
+	}
+}
+
+// appendLatency keeps the newest maxLatencySamples latencies.
+func appendLatency(samples []time.Duration, d time.Duration) []time.Duration {
+	if len(samples) >= maxLatencySamples {
+		samples = samples[1:]
+	}
+	return append(samples, d)
 }
 
 func (m *Metrics) UpdateActiveUser(userID string) {
 	m.ActiveUsers.Store(userID, time.Now())
 }
 
+func (m *Metrics) ConnOpened() {
+	atomic.AddInt64(&m.OpenConns, 1)
+	atomic.AddInt64(&m.TotalConns, 1)
+
+	now := time.Now().Unix()
+	m.connMu.Lock()
+	m.rollConnSecond(now)
+	m.connThisSecond++
+	m.connMu.Unlock()
+}
+
+func (m *Metrics) ConnClosed() {
+	atomic.AddInt64(&m.OpenConns, -1)
+}
+
+func (m *Metrics) ConnRejected() {
+	atomic.AddInt64(&m.RejectedConns, 1)
+}
+
+func (m *Metrics) GetOpenConns() int64 {
+	return atomic.LoadInt64(&m.OpenConns)
+}
+
+// rollConnSecond moves the per-second connection counter forward to now.
+// Callers must hold connMu.
+func (m *Metrics) rollConnSecond(now int64) {
+	if now == m.connSecond {
+		return
+	}
+	if now == m.connSecond+1 {
+		m.connLastSecond = m.connThisSecond
+	} else {
+		m.connLastSecond = 0
+	}
+	m.connSecond = now
+	m.connThisSecond = 0
+}
+
+// BeginSale routes subsequent increments to the counters of saleID. Calling
+// it again for the sale that is already current is a no-op.
+func (m *Metrics) BeginSale(saleID string) {
+	if current := m.currentSale.Load(); current != nil && current.saleID == saleID {
+		return
+	}
+
+	m.salesMu.Lock()
+	defer m.salesMu.Unlock()
+
+	sale, ok := m.sales[saleID]
+	if !ok {
+		sale = &saleMetrics{saleID: saleID, startedAt: time.Now()}
+		m.sales[saleID] = sale
+		m.saleOrder = append(m.saleOrder, saleID)
+		if len(m.saleOrder) > maxTrackedSales {
+			delete(m.sales, m.saleOrder[0])
+			m.saleOrder = m.saleOrder[1:]
+		}
+	}
+	m.currentSale.Store(sale)
+}
+
 func (m *Metrics) GetStats() map[string]interface{} {
 	activeUserCount := 0
 	cutoff := time.Now().Add(-5 * time.Minute)
@@ -166,47 +541,219 @@ func (m *Metrics) GetStats() map[string]interface{} {
 	}
 	m.mu.RUnlock()
 
-	checkoutSuccessRate := float64(0)
-	if totalCheckouts := atomic.LoadInt64(&m.CheckoutRequests); totalCheckouts > 0 {
-		checkoutSuccessRate = float64(atomic.LoadInt64(&m.CheckoutSuccess)) / float64(totalCheckouts) * 100
+	stats := m.Counters.snapshot()
+	stats["active_users_5min"] = activeUserCount
+	stats["avg_checkout_latency_ms"] = avgCheckoutMs
+	stats["avg_purchase_latency_ms"] = avgPurchaseMs
+
+	m.connMu.Lock()
+	m.rollConnSecond(time.Now().Unix())
+	newConnsPerSec := m.connLastSecond
+	m.connMu.Unlock()
+
+	stats["open_connections"] = atomic.LoadInt64(&m.OpenConns)
+	stats["total_connections"] = atomic.LoadInt64(&m.TotalConns)
+	stats["rejected_connections"] = atomic.LoadInt64(&m.RejectedConns)
+	stats["new_connections_per_sec"] = newConnsPerSec
+
+	if sale := m.currentSale.Load(); sale != nil {
+		stats["current_sale"] = sale.snapshot()
 	}
+	if jobs := m.jobsSnapshot(); len(jobs) > 0 {
+		stats["jobs"] = jobs
+	}
+	if queries := m.queriesSnapshot(); len(queries) > 0 {
+		stats["queries"] = queries
+	}
+	if keys := m.apiKeysSnapshot(); len(keys) > 0 {
+		stats["api_keys"] = keys
+	}
+	if outcomes := m.reservationsSnapshot(); len(outcomes) > 0 {
+		stats["reservation_outcomes"] = outcomes
+	}
+	stats["runtime"] = m.runtime.snapshot()
 
-	purchaseSuccessRate := float64(0)
-	if totalPurchases := atomic.LoadInt64(&m.PurchaseRequests); totalPurchases > 0 {
-		purchaseSuccessRate = float64(atomic.LoadInt64(&m.PurchaseSuccess)) / float64(totalPurchases) * 100
+	return stats
+}
+
+// RecordJobRun records one run of a background job. Panics count as
+// failures too.
+func (m *Metrics) RecordJobRun(name string, duration time.Duration, err error, panicked bool) {
+	m.jobsMu.Lock()
+	defer m.jobsMu.Unlock()
+
+	job, ok := m.jobs[name]
+	if !ok {
+		job = &jobStats{}
+		m.jobs[name] = job
+	}
+	job.runs++
+	job.lastRun = time.Now()
+	job.lastDuration = duration
+	job.lastError = ""
+	if err != nil {
+		job.failures++
+		job.lastError = err.Error()
 	}
+	if panicked {
+		job.panics++
+	}
+}
 
-	return map[string]interface{}{
-		"checkout_requests":       atomic.LoadInt64(&m.CheckoutRequests),
-		"checkout_success":        atomic.LoadInt64(&m.CheckoutSuccess),
-		"checkout_failed":         atomic.LoadInt64(&m.CheckoutFailed),
-		"checkout_success_rate":   checkoutSuccessRate,
-		"purchase_requests":       atomic.LoadInt64(&m.PurchaseRequests),
-		"purchase_success":        atomic.LoadInt64(&m.PurchaseSuccess),
-		"purchase_failed":         atomic.LoadInt64(&m.PurchaseFailed),
-		"purchase_success_rate":   purchaseSuccessRate,
-		"sold_out_errors":         atomic.LoadInt64(&m.SoldOutErrors),
-		"user_limit_errors":       atomic.LoadInt64(&m.UserLimitErrors),
-		"panics":                  atomic.LoadInt64(&m.Panics),
-		"code_invalid_errors":     atomic.LoadInt64(&m.CodeInvalidErrors),
-		"total_items_sold":        atomic.LoadInt64(&m.TotalItemsSold),
-		"active_users_5min":       activeUserCount,
-		"avg_checkout_latency_ms": avgCheckoutMs,
-		"avg_purchase_latency_ms": avgPurchaseMs,
+// RecordQuery records one timed database call.
+func (m *Metrics) RecordQuery(op string, duration time.Duration, err error) {
+	m.queriesMu.Lock()
+	defer m.queriesMu.Unlock()
+
+	q, ok := m.queries[op]
+	if !ok {
+		q = &queryStats{}
+		m.queries[op] = q
+	}
+	q.calls++
+	q.total += duration
+	q.max = max(q.max, duration)
+	if err != nil {
+		q.errors++
+	}
+}
+
+// RecordAPIKeyRequest records one request made with an API key, denied
+// when the key is not scoped to what it asked for.
+func (m *Metrics) RecordAPIKeyRequest(keyID string, allowed bool) {
+	m.apiKeysMu.Lock()
+	defer m.apiKeysMu.Unlock()
+
+	k, ok := m.apiKeys[keyID]
+	if !ok {
+		k = &apiKeyStats{}
+		m.apiKeys[keyID] = k
+	}
+	k.requests++
+	k.lastUsed = time.Now()
+	if !allowed {
+		k.denied++
+	}
+}
+
+// RecordReservationOutcome counts one answer of the reservation script,
+// named as by cache.ReservationOutcome.
+func (m *Metrics) RecordReservationOutcome(outcome string) {
+	m.reservationsMu.Lock()
+	m.reservations[outcome]++
+	m.reservationsMu.Unlock()
+}
+
+func (m *Metrics) reservationsSnapshot() map[string]interface{} {
+	m.reservationsMu.Lock()
+	defer m.reservationsMu.Unlock()
+
+	outcomes := make(map[string]interface{}, len(m.reservations))
+	for outcome, n := range m.reservations {
+		outcomes[outcome] = n
+	}
+	return outcomes
+}
+
+func (m *Metrics) apiKeysSnapshot() map[string]interface{} {
+	m.apiKeysMu.Lock()
+	defer m.apiKeysMu.Unlock()
+
+	keys := make(map[string]interface{}, len(m.apiKeys))
+	for id, k := range m.apiKeys {
+		keys[id] = map[string]interface{}{
+			"requests":  k.requests,
+			"denied":    k.denied,
+			"last_used": k.lastUsed,
+		}
+	}
+	return keys
+}
+
+func (m *Metrics) queriesSnapshot() map[string]interface{} {
+	m.queriesMu.Lock()
+	defer m.queriesMu.Unlock()
+
+	queries := make(map[string]interface{}, len(m.queries))
+	for op, q := range m.queries {
+		queries[op] = map[string]interface{}{
+			"calls":  q.calls,
+			"errors": q.errors,
+			"avg_ms": float64(q.total.Nanoseconds()) / float64(q.calls) / 1e6,
+			"max_ms": float64(q.max.Nanoseconds()) / 1e6,
+		}
+	}
+	return queries
+}
+
+func (m *Metrics) jobsSnapshot() map[string]interface{} {
+	m.jobsMu.Lock()
+	defer m.jobsMu.Unlock()
+
+	jobs := make(map[string]interface{}, len(m.jobs))
+	for name, job := range m.jobs {
+		stats := map[string]interface{}{
+			"runs":             job.runs,
+			"failures":         job.failures,
+			"panics":           job.panics,
+			"last_run":         job.lastRun,
+			"last_duration_ms": float64(job.lastDuration.Nanoseconds()) / 1e6,
+		}
+		if job.lastError != "" {
+			stats["last_error"] = job.lastError
+		}
+		jobs[name] = stats
+	}
+	return jobs
+}
+
+func (m *Metrics) GetSaleStats(saleID string) (map[string]interface{}, bool) {
+	m.salesMu.RLock()
+	sale, ok := m.sales[saleID]
+	m.salesMu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return sale.snapshot(), true
+}
+
+// SaleReport summarizes what this instance saw of saleID.
+func (m *Metrics) SaleReport(saleID string) (SaleReport, bool) {
+	m.salesMu.RLock()
+	sale, ok := m.sales[saleID]
+	m.salesMu.RUnlock()
+	if !ok {
+		return SaleReport{}, false
+	}
+
+	sale.mu.Lock()
+	p99Checkout := percentileMs(sale.checkoutLatencies, 0.99)
+	p99Purchase := percentileMs(sale.purchaseLatencies, 0.99)
+	sale.mu.Unlock()
+
+	return SaleReport{
+		CheckoutRequests: atomic.LoadInt64(&sale.CheckoutRequests),
+		CheckoutSuccess:  atomic.LoadInt64(&sale.CheckoutSuccess),
+		PurchaseRequests: atomic.LoadInt64(&sale.PurchaseRequests),
+		PurchaseSuccess:  atomic.LoadInt64(&sale.PurchaseSuccess),
+		SoldOutErrors:    atomic.LoadInt64(&sale.SoldOutErrors),
+		P99CheckoutMs:    p99Checkout,
+		P99PurchaseMs:    p99Purchase,
+	}, true
+}
+
+// percentileMs returns the p-th percentile of samples in milliseconds.
+func percentileMs(samples []time.Duration, p float64) float64 {
+	if len(samples) == 0 {
+		return 0
 	}
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+	return float64(sorted[int(float64(len(sorted)-1)*p)].Nanoseconds()) / 1e6
 }
 
 func (m *Metrics) Reset() {
-	atomic.StoreInt64(&m.CheckoutRequests, 0)
-	atomic.StoreInt64(&m.CheckoutSuccess, 0)
-	atomic.StoreInt64(&m.CheckoutFailed, 0)
-	atomic.StoreInt64(&m.PurchaseRequests, 0)
-	atomic.StoreInt64(&m.PurchaseSuccess, 0)
-	atomic.StoreInt64(&m.PurchaseFailed, 0)
-	atomic.StoreInt64(&m.SoldOutErrors, 0)
-	atomic.StoreInt64(&m.UserLimitErrors, 0)
-	atomic.StoreInt64(&m.CodeInvalidErrors, 0)
-	atomic.StoreInt64(&m.TotalItemsSold, 0)
+	m.Counters.reset()
 
 	m.ActiveUsers = sync.Map{}
 
@@ -214,4 +761,121 @@ func (m *Metrics) Reset() {
 	m.checkoutLatencies = m.checkoutLatencies[:0]
 	m.purchaseLatencies = m.purchaseLatencies[:0]
 	m.mu.Unlock()
+
+	m.salesMu.RLock()
+	for _, sale := range m.sales {
+		sale.Counters.reset()
+		sale.mu.Lock()
+		sale.checkoutLatencies = sale.checkoutLatencies[:0]
+		sale.purchaseLatencies = sale.purchaseLatencies[:0]
+		sale.mu.Unlock()
+	}
+	m.salesMu.RUnlock()
+
+	m.jobsMu.Lock()
+	clear(m.jobs)
+	m.jobsMu.Unlock()
+
+	m.queriesMu.Lock()
+	clear(m.queries)
+	m.queriesMu.Unlock()
+
+	m.apiKeysMu.Lock()
+	clear(m.apiKeys)
+	m.apiKeysMu.Unlock()
+
+	m.reservationsMu.Lock()
+	clear(m.reservations)
+	m.reservationsMu.Unlock()
+}
+
+func (s *saleMetrics) snapshot() map[string]interface{} {
+	stats := s.Counters.snapshot()
+	stats["sale_id"] = s.saleID
+	stats["tracked_since"] = s.startedAt
+	return stats
+}
+
+func (c *Counters) snapshot() map[string]interface{} {
+	checkoutSuccessRate := float64(0)
+	if totalCheckouts := atomic.LoadInt64(&c.CheckoutRequests); totalCheckouts > 0 {
+		checkoutSuccessRate = float64(atomic.LoadInt64(&c.CheckoutSuccess)) / float64(totalCheckouts) * 100
+	}
+
+	purchaseSuccessRate := float64(0)
+	if totalPurchases := atomic.LoadInt64(&c.PurchaseRequests); totalPurchases > 0 {
+		purchaseSuccessRate = float64(atomic.LoadInt64(&c.PurchaseSuccess)) / float64(totalPurchases) * 100
+	}
+
+	return map[string]interface{}{
+		"checkout_requests":     atomic.LoadInt64(&c.CheckoutRequests),
+		"checkout_success":      atomic.LoadInt64(&c.CheckoutSuccess),
+		"checkout_failed":       atomic.LoadInt64(&c.CheckoutFailed),
+		"checkout_success_rate": checkoutSuccessRate,
+		"purchase_requests":     atomic.LoadInt64(&c.PurchaseRequests),
+		"purchase_success":      atomic.LoadInt64(&c.PurchaseSuccess),
+		"purchase_failed":       atomic.LoadInt64(&c.PurchaseFailed),
+		"purchase_success_rate": purchaseSuccessRate,
+		"sold_out_errors":       atomic.LoadInt64(&c.SoldOutErrors),
+		"user_limit_errors":     atomic.LoadInt64(&c.UserLimitErrors),
+		"panics":                atomic.LoadInt64(&c.Panics),
+		"code_invalid_errors":   atomic.LoadInt64(&c.CodeInvalidErrors),
+		"total_items_sold":      atomic.LoadInt64(&c.TotalItemsSold),
+		"fallback_checkouts":    atomic.LoadInt64(&c.FallbackCheckouts),
+		"dead_letters":          atomic.LoadInt64(&c.DeadLetters),
+		"gated_checkouts":       atomic.LoadInt64(&c.GatedCheckouts),
+		"queued_checkouts":      atomic.LoadInt64(&c.QueuedCheckouts),
+		"redis_retries":         atomic.LoadInt64(&c.RedisRetries),
+		"redis_exhausted":       atomic.LoadInt64(&c.RedisExhausted),
+		"redis_hedges":          atomic.LoadInt64(&c.RedisHedges),
+		"attempts_dropped":      atomic.LoadInt64(&c.AttemptsDropped),
+		"writes_shed":           atomic.LoadInt64(&c.WritesShed),
+		"webhooks_delivered":    atomic.LoadInt64(&c.WebhooksDelivered),
+		"webhooks_failed":       atomic.LoadInt64(&c.WebhooksFailed),
+		"outbox_published":      atomic.LoadInt64(&c.OutboxPublished),
+		"outbox_failures":       atomic.LoadInt64(&c.OutboxFailures),
+		"cache_timeouts":        atomic.LoadInt64(&c.CacheTimeouts),
+		"slow_queries":          atomic.LoadInt64(&c.SlowQueries),
+		"lottery_entries":       atomic.LoadInt64(&c.LotteryEntries),
+		"fallback_purchases":    atomic.LoadInt64(&c.FallbackPurchases),
+		"codes_extended":        atomic.LoadInt64(&c.CodesExtended),
+		"slo_shed":              atomic.LoadInt64(&c.SLOShed),
+		"banned_requests":       atomic.LoadInt64(&c.BannedRequests),
+		"purchase_replays":      atomic.LoadInt64(&c.PurchaseReplays),
+	}
+}
+
+func (c *Counters) reset() {
+	atomic.StoreInt64(&c.CheckoutRequests, 0)
+	atomic.StoreInt64(&c.CheckoutSuccess, 0)
+	atomic.StoreInt64(&c.CheckoutFailed, 0)
+	atomic.StoreInt64(&c.PurchaseRequests, 0)
+	atomic.StoreInt64(&c.PurchaseSuccess, 0)
+	atomic.StoreInt64(&c.PurchaseFailed, 0)
+	atomic.StoreInt64(&c.SoldOutErrors, 0)
+	atomic.StoreInt64(&c.UserLimitErrors, 0)
+	atomic.StoreInt64(&c.CodeInvalidErrors, 0)
+	atomic.StoreInt64(&c.CodesExtended, 0)
+	atomic.StoreInt64(&c.Panics, 0)
+	atomic.StoreInt64(&c.FallbackCheckouts, 0)
+	atomic.StoreInt64(&c.FallbackPurchases, 0)
+	atomic.StoreInt64(&c.TotalItemsSold, 0)
+	atomic.StoreInt64(&c.DeadLetters, 0)
+	atomic.StoreInt64(&c.GatedCheckouts, 0)
+	atomic.StoreInt64(&c.QueuedCheckouts, 0)
+	atomic.StoreInt64(&c.RedisRetries, 0)
+	atomic.StoreInt64(&c.RedisExhausted, 0)
+	atomic.StoreInt64(&c.RedisHedges, 0)
+	atomic.StoreInt64(&c.AttemptsDropped, 0)
+	atomic.StoreInt64(&c.WritesShed, 0)
+	atomic.StoreInt64(&c.WebhooksDelivered, 0)
+	atomic.StoreInt64(&c.WebhooksFailed, 0)
+	atomic.StoreInt64(&c.OutboxPublished, 0)
+	atomic.StoreInt64(&c.OutboxFailures, 0)
+	atomic.StoreInt64(&c.CacheTimeouts, 0)
+	atomic.StoreInt64(&c.SlowQueries, 0)
+	atomic.StoreInt64(&c.LotteryEntries, 0)
+	atomic.StoreInt64(&c.SLOShed, 0)
+	atomic.StoreInt64(&c.BannedRequests, 0)
+	atomic.StoreInt64(&c.PurchaseReplays, 0)
 }
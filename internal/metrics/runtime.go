@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"math"
+	"runtime"
+	rtmetrics "runtime/metrics"
+	"slices"
+	"sync"
+	"time"
+)
+
+// runtimeWindow is how far back the GC pause and scheduler latency
+// percentiles reach. They are taken against the older of two baselines,
+// each replaced by a fresh reading once it is this old, so they span
+// between one and two windows.
+const runtimeWindow = 10 * time.Second
+
+// Runtime metrics read on every GetStats.
+const (
+	heapObjectsMetric  = "/memory/classes/heap/objects:bytes"
+	heapGoalMetric     = "/gc/heap/goal:bytes"
+	gcCyclesMetric     = "/gc/cycles/total:gc-cycles"
+	goroutinesMetric   = "/sched/goroutines:goroutines"
+	gcPausesMetric     = "/sched/pauses/total/gc:seconds"
+	schedLatencyMetric = "/sched/latencies:seconds"
+)
+
+// runtimeStats turns the Go runtime's cumulative histograms into
+// percentiles over a recent window, so a GC pause spike during a sale
+// shows up next to the latencies it caused instead of being averaged into
+// the whole life of the process.
+type runtimeStats struct {
+	mu      sync.Mutex
+	samples []rtmetrics.Sample
+	// older holds the histogram counts the percentiles are taken from,
+	// read at olderAt; newer replaces it once newer is runtimeWindow old.
+	older, newer     map[string][]uint64
+	olderAt, newerAt time.Time
+}
+
+func newRuntimeStats() *runtimeStats {
+	names := []string{heapObjectsMetric, heapGoalMetric, gcCyclesMetric, goroutinesMetric, gcPausesMetric, schedLatencyMetric}
+	samples := make([]rtmetrics.Sample, len(names))
+	for i, name := range names {
+		samples[i].Name = name
+	}
+	now := time.Now()
+	return &runtimeStats{samples: samples, older: map[string][]uint64{}, newer: map[string][]uint64{}, olderAt: now, newerAt: now}
+}
+
+// snapshot reads the runtime metrics.
+func (r *runtimeStats) snapshot() map[string]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rtmetrics.Read(r.samples)
+	now := time.Now()
+	rotate := now.Sub(r.newerAt) >= runtimeWindow
+	if rotate {
+		r.older, r.olderAt = r.newer, r.newerAt
+		r.newer, r.newerAt = make(map[string][]uint64, len(r.older)), now
+	}
+	stats := map[string]interface{}{
+		"gomaxprocs":   runtime.GOMAXPROCS(0),
+		"window_start": r.olderAt,
+	}
+	for _, s := range r.samples {
+		switch s.Value.Kind() {
+		case rtmetrics.KindUint64:
+			stats[statName(s.Name)] = s.Value.Uint64()
+		case rtmetrics.KindFloat64Histogram:
+			h := s.Value.Float64Histogram()
+			stats[statName(s.Name)] = histogramPercentileMs(h, r.older[s.Name], 0.99)
+			if rotate {
+				r.newer[s.Name] = slices.Clone(h.Counts)
+			}
+		}
+	}
+	return stats
+}
+
+// statName is the key a runtime metric is reported under.
+func statName(metric string) string {
+	switch metric {
+	case heapObjectsMetric:
+		return "heap_in_use_bytes"
+	case heapGoalMetric:
+		return "heap_goal_bytes"
+	case gcCyclesMetric:
+		return "gc_cycles"
+	case goroutinesMetric:
+		return "goroutines"
+	case gcPausesMetric:
+		return "gc_pause_p99_ms"
+	case schedLatencyMetric:
+		return "sched_latency_p99_ms"
+	}
+	return metric
+}
+
+// histogramPercentileMs returns the p-th percentile, in milliseconds, of what h
+// counted since base, as the upper bound of the bucket it falls in; 0 when
+// nothing was counted.
+func histogramPercentileMs(h *rtmetrics.Float64Histogram, base []uint64, p float64) float64 {
+	counts := make([]uint64, len(h.Counts))
+	var total uint64
+	for i, c := range h.Counts {
+		if i < len(base) {
+			c -= base[i]
+		}
+		counts[i] = c
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(p * float64(total)))
+	var seen uint64
+	for i, c := range counts {
+		seen += c
+		if seen >= rank {
+			// Bucket i spans Buckets[i] to Buckets[i+1]; the last one is
+			// unbounded, so its lower bound is reported.
+			upper := h.Buckets[i+1]
+			if math.IsInf(upper, 1) {
+				upper = h.Buckets[i]
+			}
+			return upper * 1e3
+		}
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+// Package money handles prices as integer amounts of an ISO 4217
+// currency's minor unit (cents, pence, yen), so sums never round.
+package money
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// minorDigits lists currencies whose minor unit is not 1/100.
+var minorDigits = map[string]int{
+	"BHD": 3, "CLP": 0, "IQD": 3, "ISK": 0, "JOD": 3, "JPY": 0,
+	"KRW": 0, "KWD": 3, "OMR": 3, "TND": 3, "UGX": 0, "VND": 0,
+}
+
+// ValidCurrency reports whether code looks like an ISO 4217 code.
+func ValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Digits is how many decimal places the currency's minor unit has.
+func Digits(currency string) int {
+	if d, ok := minorDigits[currency]; ok {
+		return d
+	}
+	return 2
+}
+
+// Unit is the number of minor units in one major unit of currency.
+func Unit(currency string) int64 {
+	return int64(math.Pow10(Digits(currency)))
+}
+
+// Parse converts a decimal amount such as "19.99" to minor units.
+func Parse(amount, currency string) (int64, error) {
+	whole, frac, _ := strings.Cut(strings.TrimSpace(amount), ".")
+	digits := Digits(currency)
+	if len(frac) > digits {
+		return 0, fmt.Errorf("%s has at most %d decimal places", currency, digits)
+	}
+	major, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || major < 0 || strings.HasPrefix(whole, "+") {
+		return 0, fmt.Errorf("invalid amount %q", amount)
+	}
+	var minor int64
+	if frac != "" {
+		minor, err = strconv.ParseInt(frac+strings.Repeat("0", digits-len(frac)), 10, 64)
+		if err != nil || minor < 0 || strings.HasPrefix(frac, "+") {
+			return 0, fmt.Errorf("invalid amount %q", amount)
+		}
+	}
+	if major > math.MaxInt64/Unit(currency)-1 {
+		return 0, fmt.Errorf("amount %q is too large", amount)
+	}
+	return major*Unit(currency) + minor, nil
+}
+
+// Format renders minor units as a decimal amount, e.g. 1999 USD as "19.99".
+func Format(minor int64, currency string) string {
+	digits := Digits(currency)
+	if digits == 0 {
+		return strconv.FormatInt(minor, 10)
+	}
+	sign := ""
+	if minor < 0 {
+		sign, minor = "-", -minor
+	}
+	unit := Unit(currency)
+	return fmt.Sprintf("%s%d.%0*d", sign, minor/unit, digits, minor%unit)
+}
@@ -0,0 +1,182 @@
+// Package notifications tells buyers about events such as a completed
+// purchase. Events are published to a Redis stream and delivered by a
+// background worker, so the request path only pays for one XADD.
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/codes"
+)
+
+const (
+	EventPurchaseCompleted = "purchase.completed"
+	EventWaitlistOffer     = "waitlist.offer"
+	EventSaleRestocked     = "sale.restocked"
+	// EventLotteryWon tells a lottery winner the checkout code they drew.
+	EventLotteryWon = "lottery.won"
+	// EventCodeExpiring and EventSaleExtended are only pushed to the
+	// user's open /ws/user connections, never published to the stream.
+	EventCodeExpiring = "code.expiring"
+	EventSaleExtended = "sale.extended"
+
+	sendAttempts = 3
+)
+
+type Event struct {
+	Type       string `json:"type"`
+	SaleID     string `json:"sale_id"`
+	UserID     string `json:"user_id"`
+	ItemID     string `json:"item_id,omitempty"`
+	PurchaseID string `json:"purchase_id,omitempty"`
+	// Items is how many items a restock added.
+	Items int `json:"items,omitempty"`
+	// Code and ExpiresAt name the checkout code an expiry warning or a
+	// lottery win is about.
+	Code      string    `json:"code,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	// EndsAt is when an extended sale now ends.
+	EndsAt     time.Time `json:"ends_at,omitzero"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// Tenant owns the sale; empty for the default tenant.
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Sender delivers an event over one channel.
+type Sender interface {
+	Name() string
+	Send(ctx context.Context, e Event) error
+}
+
+// Publish queues e for delivery.
+func Publish(ctx context.Context, c cache.Service, e Event) error {
+	payload, err := Encode(e)
+	if err != nil {
+		return err
+	}
+	return c.PublishNotification(ctx, payload)
+}
+
+// Encode returns e as it is queued, for callers that publish it through
+// the cache themselves.
+func Encode(e Event) ([]byte, error) {
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now()
+	}
+	return json.Marshal(e)
+}
+
+// Worker consumes the notifications stream as part of a consumer group, so
+// replicas share the deliveries, and fans each event out to every sender.
+type Worker struct {
+	cache    cache.Service
+	senders  []Sender
+	consumer string
+}
+
+func NewWorker(c cache.Service, senders []Sender) *Worker {
+	consumer, _ := os.Hostname()
+	if consumer == "" {
+		consumer = codes.NewID()
+	}
+	return &Worker{cache: c, senders: senders, consumer: consumer}
+}
+
+// NewSendersFromEnv builds the senders named in NOTIFY_SENDERS, a comma
+// separated list of "log", "webhook", "smtp" and "push".
+func NewSendersFromEnv(c cache.Service) []Sender {
+	var senders []Sender
+	for _, name := range strings.Split(os.Getenv("NOTIFY_SENDERS"), ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "log":
+			senders = append(senders, logSender{})
+		case "webhook":
+			if url := os.Getenv("NOTIFY_WEBHOOK_URL"); url != "" {
+				senders = append(senders, newWebhookSender(url))
+			} else {
+				log.Printf("Notification sender webhook needs NOTIFY_WEBHOOK_URL, skipping")
+			}
+		case "smtp":
+			senders = append(senders, smtpSender{from: os.Getenv("NOTIFY_EMAIL_FROM")})
+		case "push":
+			senders = append(senders, pushSender{cache: c})
+		default:
+			log.Printf("Unknown notification sender %q, skipping", name)
+		}
+	}
+	return senders
+}
+
+func (w *Worker) Start(ctx context.Context, concurrency int) error {
+	if err := w.cache.EnsureNotificationGroup(ctx); err != nil {
+		return err
+	}
+	for i := 0; i < concurrency; i++ {
+		go w.run(ctx)
+	}
+	log.Printf("Notifications worker started with %d consumers and %d senders", concurrency, len(w.senders))
+	return nil
+}
+
+func (w *Worker) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		batch, err := w.cache.ReadNotifications(ctx, w.consumer, 50, time.Second)
+		if err != nil {
+			if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+				log.Printf("Failed to read notifications: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		for _, n := range batch {
+			w.deliver(ctx, n)
+			if err := w.cache.AckNotification(ctx, n.ID); err != nil {
+				log.Printf("Failed to ack notification %s: %v", n.ID, err)
+			}
+		}
+	}
+}
+
+// deliver hands the event to every sender, retrying each a few times. A
+// sender that keeps failing is logged and skipped so one broken channel
+// cannot stall the stream.
+func (w *Worker) deliver(ctx context.Context, n cache.Notification) {
+	var e Event
+	if err := json.Unmarshal(n.Payload, &e); err != nil {
+		log.Printf("Dropping malformed notification %s: %v", n.ID, err)
+		return
+	}
+
+	for _, sender := range w.senders {
+		var err error
+		for attempt := 0; attempt < sendAttempts; attempt++ {
+			sendCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			err = sender.Send(sendCtx, e)
+			cancel()
+			if err == nil {
+				break
+			}
+			time.Sleep(time.Duration(attempt+1) * 200 * time.Millisecond)
+		}
+		if err != nil {
+			log.Printf("Notification %s via %s failed: %v", n.ID, sender.Name(), err)
+		}
+	}
+}
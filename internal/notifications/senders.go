@@ -0,0 +1,110 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"flash_sale_contest/internal/cache"
+)
+
+type logSender struct{}
+
+func (logSender) Name() string { return "log" }
+
+func (logSender) Send(_ context.Context, e Event) error {
+	log.Printf("Notification %s: user=%s sale=%s item=%s", e.Type, e.UserID, e.SaleID, e.ItemID)
+	return nil
+}
+
+type webhookSender struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhookSender(url string) *webhookSender {
+	return &webhookSender{url: url, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (s *webhookSender) Name() string { return "webhook" }
+
+func (s *webhookSender) Send(ctx context.Context, e Event) error {
+	body, _ := json.Marshal(e)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// pushSender publishes events addressed to a user on the user's pub/sub
+// channel, which every replica's /ws/user connections of that user listen
+// on.
+type pushSender struct {
+	cache cache.Service
+}
+
+func (pushSender) Name() string { return "push" }
+
+func (s pushSender) Send(ctx context.Context, e Event) error {
+	if e.UserID == "" {
+		return nil
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.cache.ForTenant(e.Tenant).PublishUserEvent(ctx, e.UserID, payload)
+}
+
+// smtpSender is a stand-in for email delivery: users have no addresses on
+// file yet, so it renders the message and logs it instead of dialing a
+// mail server.
+type smtpSender struct {
+	from string
+}
+
+func (smtpSender) Name() string { return "smtp" }
+
+func (s smtpSender) Send(_ context.Context, e Event) error {
+	// Announcements such as restocks have no recipient.
+	if e.UserID == "" {
+		return nil
+	}
+	subject, body := renderEmail(e)
+	log.Printf("SMTP stub: from=%q to=user:%s subject=%q body=%q", s.from, e.UserID, subject, body)
+	return nil
+}
+
+func renderEmail(e Event) (subject, body string) {
+	switch e.Type {
+	case EventPurchaseCompleted:
+		return "Your flash sale purchase is confirmed",
+			fmt.Sprintf("You bought %s in sale %s.", e.ItemID, e.SaleID)
+	case EventWaitlistOffer:
+		return "An item is waiting for you",
+			fmt.Sprintf("An item in sale %s has been offered to you. Check out soon before the offer expires.", e.SaleID)
+	case EventSaleRestocked:
+		return "The flash sale was restocked",
+			fmt.Sprintf("%d more items are available in sale %s.", e.Items, e.SaleID)
+	case EventLotteryWon:
+		return "You won the flash sale lottery",
+			fmt.Sprintf("You drew %s in sale %s. Purchase it with code %s before %s.", e.ItemID, e.SaleID, e.Code, e.ExpiresAt.Format(time.RFC3339))
+	}
+	return "Flash sale update", fmt.Sprintf("Event %s for sale %s.", e.Type, e.SaleID)
+}
@@ -0,0 +1,202 @@
+// Package payments confirms purchases asynchronously in two-phase purchase
+// mode, so the /purchase hot path never waits on a payment provider.
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"flash_sale_contest/internal/cache"
+)
+
+// Provider charges a buyer for a pending purchase.
+type Provider interface {
+	Charge(ctx context.Context, p *cache.PendingPurchase) error
+}
+
+// purchaseLease is how long a worker holds a dequeued purchase before
+// another may take it over; it outlives the charge timeout.
+const purchaseLease = time.Minute
+
+// Worker drains the pending purchase queue, charges each purchase and
+// records the final state. Purchases are delivered at least once: one whose
+// worker died before recording its status is charged again once its lease
+// runs out, with the purchase ID as the charge's idempotency key, and one
+// that died before settling it is settled again.
+type Worker struct {
+	cache       cache.Service
+	provider    Provider
+	onConfirmed func(p *cache.PendingPurchase)
+	onFailed    func(p *cache.PendingPurchase)
+}
+
+func NewWorker(c cache.Service, provider Provider, onConfirmed, onFailed func(p *cache.PendingPurchase)) *Worker {
+	return &Worker{
+		cache:       c,
+		provider:    provider,
+		onConfirmed: onConfirmed,
+		onFailed:    onFailed,
+	}
+}
+
+// NewProviderFromEnv returns an HTTP provider when PAYMENT_PROVIDER_URL is
+// set and an always-approving stub otherwise.
+func NewProviderFromEnv() Provider {
+	if url := os.Getenv("PAYMENT_PROVIDER_URL"); url != "" {
+		return &httpProvider{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	return stubProvider{delay: 200 * time.Millisecond}
+}
+
+func (w *Worker) Start(ctx context.Context, concurrency int) {
+	for i := 0; i < concurrency; i++ {
+		go w.run(ctx)
+	}
+	go w.reap(ctx)
+	log.Printf("Payments worker started with %d consumers", concurrency)
+}
+
+// reap puts purchases whose worker died back on the queue.
+func (w *Worker) reap(ctx context.Context) {
+	ticker := time.NewTicker(purchaseLease / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := w.cache.RequeueStalePurchases(ctx, purchaseLease)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to requeue stale purchases: %v", err)
+			}
+			continue
+		}
+		if n > 0 {
+			log.Printf("Requeued %d purchases whose payments worker stopped", n)
+		}
+	}
+}
+
+func (w *Worker) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		p, err := w.cache.DequeuePendingPurchase(ctx, time.Second, purchaseLease)
+		if err != nil {
+			if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+				log.Printf("Failed to dequeue pending purchase: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		w.process(ctx, p)
+	}
+}
+
+func (w *Worker) process(ctx context.Context, p *cache.PendingPurchase) {
+	// A purchase requeued after its status was recorded is only settled.
+	if p.Status != cache.PurchasePending {
+		if !p.Settled {
+			w.settle(ctx, p)
+		}
+		w.ack(ctx, p)
+		return
+	}
+
+	chargeCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	err := w.provider.Charge(chargeCtx, p)
+	cancel()
+
+	// A failed purchase's reservation is released with its status. One
+	// whose status could not be recorded stays leased and is retried.
+	if err != nil {
+		log.Printf("Payment for purchase %s failed: %v", p.PurchaseID, err)
+		err = w.cache.ForTenant(p.Tenant).FailPurchase(ctx, p)
+	} else {
+		err = w.cache.SetPurchaseStatus(ctx, p, cache.PurchaseConfirmed)
+	}
+	if err != nil {
+		log.Printf("Failed to record status of purchase %s: %v", p.PurchaseID, err)
+		return
+	}
+
+	w.settle(ctx, p)
+	w.ack(ctx, p)
+}
+
+// settle records a purchase's final state: a confirmed purchase is written
+// to Postgres, which never stores the same unit twice, and a failed one is
+// reported. The purchase is then marked settled.
+func (w *Worker) settle(ctx context.Context, p *cache.PendingPurchase) {
+	if p.Status == cache.PurchaseConfirmed {
+		w.onConfirmed(p)
+	} else {
+		w.onFailed(p)
+	}
+	if err := w.cache.SettlePurchase(ctx, p); err != nil {
+		log.Printf("Failed to settle purchase %s: %v", p.PurchaseID, err)
+	}
+}
+
+func (w *Worker) ack(ctx context.Context, p *cache.PendingPurchase) {
+	if err := w.cache.AckPendingPurchase(ctx, p.PurchaseID); err != nil {
+		log.Printf("Failed to acknowledge purchase %s: %v", p.PurchaseID, err)
+	}
+}
+
+type stubProvider struct {
+	delay time.Duration
+}
+
+func (p stubProvider) Charge(ctx context.Context, _ *cache.PendingPurchase) error {
+	select {
+	case <-time.After(p.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type httpProvider struct {
+	url    string
+	client *http.Client
+}
+
+func (p *httpProvider) Charge(ctx context.Context, purchase *cache.PendingPurchase) error {
+	body, _ := json.Marshal(purchase)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// A purchase charged again after its worker died is charged once.
+	req.Header.Set("Idempotency-Key", purchase.PurchaseID)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("provider declined with status %d", resp.StatusCode)
+	}
+	return nil
+}
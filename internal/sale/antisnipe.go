@@ -0,0 +1,51 @@
+package sale
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"flash_sale_contest/internal/config"
+	"flash_sale_contest/internal/database"
+)
+
+// maybeExtend applies the anti-sniping rule to a sale that reached its
+// end: when more than ANTI_SNIPE_SHARE of its items sold in its last
+// ANTI_SNIPE_WINDOW, it keeps running for another ANTI_SNIPE_EXTENSION.
+// The new end is written to Postgres before the shared pointer, so a
+// follower reading either sees it. It reports whether the sale was
+// extended; only the leader calls it, from tick.
+func (m *Manager) maybeExtend(ctx context.Context, active *ActiveSale) bool {
+	cfg := config.Get()
+	if cfg.AntiSnipeWindow <= 0 || cfg.AntiSnipeExtension <= 0 {
+		return false
+	}
+
+	sold, err := m.db.CountPurchasesSince(ctx, active.SaleID, active.EndTime.Add(-cfg.AntiSnipeWindow))
+	if err != nil {
+		log.Printf("Warning: could not count the last purchases of sale %s, ending it: %v", active.SaleID, err)
+		return false
+	}
+	if float64(sold) <= cfg.AntiSnipeShare*float64(active.TotalItems) {
+		return false
+	}
+
+	extended := *active
+	extended.EndTime = active.EndTime.Add(cfg.AntiSnipeExtension)
+	extended.Extensions++
+	if err := m.db.ExtendSale(ctx, active.SaleID, extended.EndTime); err != nil {
+		log.Printf("Failed to extend sale %s, ending it: %v", active.SaleID, err)
+		return false
+	}
+	if _, err := m.cache.ExtendSaleKeys(ctx, active.SaleID, cfg.AntiSnipeExtension); err != nil {
+		log.Printf("Warning: could not push back the Redis keys of extended sale %s: %v", active.SaleID, err)
+	}
+	if err := m.cache.SetCurrentSale(ctx, extended.pointer()); err != nil {
+		log.Printf("Warning: failed to publish extended sale pointer: %v", err)
+	}
+	m.setActive(&extended)
+	m.announce(ctx, database.SaleEventUpdated, active.SaleID)
+	log.Printf("Sale %s extended by %s to %s: %d of %d items sold in its last %s",
+		active.SaleID, cfg.AntiSnipeExtension, extended.EndTime.Format(time.RFC3339), sold, active.TotalItems, cfg.AntiSnipeWindow)
+	return true
+}
@@ -0,0 +1,51 @@
+package sale
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"flash_sale_contest/internal/config"
+)
+
+// archiveBatch bounds how many sales one archival pass moves.
+const archiveBatch = 10
+
+// ArchiveEndedSales moves sales that ended more than ARCHIVE_AFTER ago into
+// the archive tables and vacuums the hot tables if anything moved. Only the
+// leader archives; on other replicas it does nothing.
+func (m *Manager) ArchiveEndedSales(ctx context.Context) error {
+	if !m.IsLeader() {
+		return nil
+	}
+	cutoff := time.Now().Add(-config.Get().ArchiveAfter)
+
+	saleIDs, err := m.db.ListArchivableSales(ctx, cutoff, archiveBatch)
+	if err != nil {
+		return fmt.Errorf("could not list sales to archive: %w", err)
+	}
+	if len(saleIDs) == 0 {
+		return nil
+	}
+
+	archived := 0
+	for _, saleID := range saleIDs {
+		res, err := m.db.ArchiveSale(ctx, saleID)
+		if err != nil {
+			log.Printf("Failed to archive sale %s: %v", saleID, err)
+			continue
+		}
+		archived++
+		log.Printf("Archived sale %s (%d items, %d checkout attempts, %d purchases)",
+			saleID, res.Items, res.CheckoutAttempts, res.Purchases)
+	}
+
+	if archived == 0 {
+		return fmt.Errorf("none of %d sales could be archived", len(saleIDs))
+	}
+	if err := m.db.VacuumHotTables(ctx); err != nil {
+		log.Printf("Warning: vacuum after archival failed: %v", err)
+	}
+	return nil
+}
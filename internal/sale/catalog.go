@@ -0,0 +1,123 @@
+package sale
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+
+	"flash_sale_contest/internal/catalog"
+	"flash_sale_contest/internal/config"
+	"flash_sale_contest/internal/database"
+	"flash_sale_contest/internal/imagegen"
+	"flash_sale_contest/internal/money"
+)
+
+// DefaultSaleSize is how many items a sale generates when no catalog is
+// supplied.
+const DefaultSaleSize = 10000
+
+// Item ID schemes for catalog items.
+const (
+	ItemIDSequential = "sequential"
+	ItemIDSKU        = "sku"
+)
+
+// loadCatalog reads CATALOG_PATH, if set, once at startup. An invalid file
+// stops the service rather than silently falling back to generated items.
+func (m *Manager) loadCatalog() error {
+	path := config.Get().CatalogPath
+	if path == "" {
+		return nil
+	}
+
+	entries, err := catalog.LoadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to load catalog %s: %w", path, err)
+	}
+	m.catalog = entries
+	log.Printf("Loaded catalog %s with %d items", path, len(entries))
+	return nil
+}
+
+// saleCatalog picks the items for the next sale: a catalog staged through
+// the admin API wins over the startup catalog. It returns nil when the sale
+// should generate its items.
+func (m *Manager) saleCatalog(ctx context.Context) []catalog.Entry {
+	data, err := m.cache.TakeStagedCatalog(ctx)
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("Warning: could not read staged catalog: %v", err)
+		}
+		return m.catalog
+	}
+
+	var entries []catalog.Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		log.Printf("Discarding unreadable staged catalog: %v", err)
+		return m.catalog
+	}
+	if err := catalog.Validate(entries); err != nil {
+		log.Printf("Discarding invalid staged catalog: %v", err)
+		return m.catalog
+	}
+	return entries
+}
+
+// catalogItems turns catalog entries into a sale's items. Item IDs follow
+// ITEM_ID_SCHEME: "sequential" numbers them like generated items, "sku"
+// derives them from the SKU. Both are prefixed with the sale ID, since item
+// IDs are unique across sales.
+func catalogItems(saleID string, entries []catalog.Entry) []database.Item {
+	scheme := config.Get().ItemIDScheme
+	defaultCurrency := config.Get().SaleCurrency
+
+	items := make([]database.Item, len(entries))
+	for i, e := range entries {
+		itemID := fmt.Sprintf("%s_item_%06d", saleID, i+1)
+		if scheme == ItemIDSKU {
+			itemID = fmt.Sprintf("%s_%s", saleID, e.SKU)
+		}
+
+		category := e.Category
+		if category == "" {
+			category = "artifacts"
+		}
+		imageURL := e.ImageURL
+		if imageURL == "" {
+			imageURL = imagegen.URL(itemID)
+		}
+		currency := e.Currency
+		if currency == "" {
+			currency = defaultCurrency
+		}
+		var price int64
+		if e.Price != "" {
+			var err error
+			if price, err = money.Parse(e.Price, currency); err != nil {
+				log.Printf("Warning: catalog entry %s sold unpriced: %v", e.SKU, err)
+			}
+		}
+
+		rarity := e.Rarity
+		if rarity == "" {
+			rarity = catalog.RarityCommon
+		}
+
+		items[i] = database.Item{
+			ItemID:     itemID,
+			SaleID:     saleID,
+			Name:       e.Name,
+			ImageURL:   imageURL,
+			Category:   category,
+			PriceMinor: price,
+			Currency:   currency,
+			Rarity:     rarity,
+			Quantity:   e.Units(),
+		}
+	}
+	return items
+}
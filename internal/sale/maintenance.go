@@ -0,0 +1,74 @@
+package sale
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/config"
+)
+
+// redisKeyTTL is the expiry given to sale-scoped keys found without one; it
+// matches the TTL they are written with.
+const redisKeyTTL = time.Hour + 10*time.Minute
+
+// maybeAuditRedis starts a Redis key audit in the background when the last
+// one is old enough and none is running. Only the leader calls it.
+func (m *Manager) maybeAuditRedis() {
+	cfg := config.Get()
+	if cfg.RedisAuditInterval <= 0 {
+		return
+	}
+	if !m.auditMu.TryLock() {
+		return
+	}
+	if time.Since(m.lastAudit) < cfg.RedisAuditInterval {
+		m.auditMu.Unlock()
+		return
+	}
+	m.lastAudit = time.Now()
+
+	go func() {
+		defer m.auditMu.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.RedisAuditInterval)
+		defer cancel()
+		m.auditRedis(ctx, cfg.RedisPurgeAfter, cfg.RedisAuditSampleEvery)
+	}()
+}
+
+// auditRedis deletes the keys of sales that ended more than purgeAfter ago
+// and of sales abandoned by a deposed leader, repairs missing TTLs and logs
+// memory use per key family.
+func (m *Manager) auditRedis(ctx context.Context, purgeAfter time.Duration, sampleEvery int) {
+	cutoff := time.Now().Add(-purgeAfter)
+	purgeSale := func(saleID string) bool {
+		if current := m.GetCurrentSale(); current != nil && current.SaleID == saleID {
+			return false
+		}
+		sale, err := m.db.GetSale(ctx, saleID)
+		if err != nil {
+			return false
+		}
+		return sale.Status == "abandoned" || sale.Status == "ended" && sale.EndTime.Before(cutoff)
+	}
+
+	audit, err := m.cache.AuditKeys(ctx, cache.KeyAuditOptions{
+		PurgeSale:   purgeSale,
+		DefaultTTL:  redisKeyTTL,
+		SampleEvery: sampleEvery,
+	})
+	if err != nil {
+		log.Printf("Warning: Redis key audit failed: %v", err)
+		return
+	}
+
+	var deleted, fixed int64
+	for prefix, usage := range audit.Prefixes {
+		deleted += usage.Deleted
+		fixed += usage.TTLApplied
+		log.Printf("Redis keys %s: %d keys, ~%d bytes", prefix, usage.Keys-usage.Deleted, usage.EstimatedBytes)
+	}
+	log.Printf("Redis key audit: %d keys scanned, %d deleted, %d TTLs applied, ~%d bytes in %dms",
+		audit.Keys, deleted, fixed, audit.EstimatedBytes, audit.DurationMs)
+}
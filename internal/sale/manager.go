@@ -2,14 +2,23 @@ package sale
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
+	"os"
 	"sync"
 	"time"
 
+	"github.com/redis/go-redis/v9"
+
 	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/catalog"
+	"flash_sale_contest/internal/config"
 	"flash_sale_contest/internal/database"
+	"flash_sale_contest/internal/imagegen"
+	"flash_sale_contest/internal/money"
 )
 
 var (
@@ -32,51 +41,182 @@ var (
 	}
 )
 
+const (
+	leaderLockName = "sale_manager"
+	leaderLeaseTTL = 15 * time.Second
+	// TickInterval is how often replicas check leadership and sale rotation.
+	TickInterval = 5 * time.Second
+)
+
+// nounCategories groups the generated item nouns into sale categories.
+// Nouns not listed here fall into "artifacts".
+var nounCategories = map[string]string{
+	"Blade": "weapons", "Hammer": "weapons", "Bow": "weapons", "Dagger": "weapons",
+	"Sword": "weapons", "Arrow": "weapons", "Quiver": "weapons",
+	"Crystal": "gems", "Gem": "gems", "Jewel": "gems", "Orb": "gems",
+	"Ring": "gems", "Onyx": "gems", "Prism": "gems",
+	"Armor": "armor", "Crown": "armor", "Guardian": "armor", "Wings": "armor",
+	"Banner": "armor", "Dome": "armor", "Yoke": "armor",
+}
+
 type Manager struct {
-	db     database.Service
-	cache  cache.Service
-	mu     sync.RWMutex
-	active *ActiveSale
+	db         database.Service
+	cache      cache.Service
+	instanceID string
+	mu         sync.RWMutex
+	refreshMu  sync.Mutex
+	active     *ActiveSale
+	token      int64
+	listeners  []func(*ActiveSale)
+
+	// tenant prefixes the IDs of the sales this manager runs; empty for
+	// the default tenant.
+	tenant string
+
+	auditMu   sync.Mutex
+	lastAudit time.Time
+
+	// catalog is the item list loaded from CATALOG_PATH; nil means sales
+	// use generated items.
+	catalog []catalog.Entry
+
+	// showcase picks the items /sale/info shows; showcasedAt is when the
+	// leader last picked them.
+	showcase    ShowcaseStrategy
+	showcasedAt time.Time
 }
 
 type ActiveSale struct {
-	SaleID    string
-	StartTime time.Time
-	EndTime   time.Time
+	SaleID     string
+	StartTime  time.Time
+	EndTime    time.Time
+	TotalItems int
+	// ClosingAt is set once the sale has ended and is draining before the
+	// next one starts.
+	ClosingAt time.Time
+	// CodeTTL is how long checkout codes hold their item.
+	CodeTTL time.Duration
+	// Extensions is how often the anti-sniping rule moved EndTime.
+	Extensions int
+}
+
+// CodeExpiry is the sale's checkout code TTL, CHECKOUT_CODE_TTL for sales
+// that never set one.
+func (a *ActiveSale) CodeExpiry() time.Duration {
+	if a.CodeTTL > 0 {
+		return a.CodeTTL
+	}
+	return config.Get().CheckoutCodeTTL
+}
+
+// pointer is the shared form of the sale other replicas follow.
+func (a *ActiveSale) pointer() *cache.CurrentSale {
+	return &cache.CurrentSale{
+		SaleID:     a.SaleID,
+		StartTime:  a.StartTime,
+		EndTime:    a.EndTime,
+		TotalItems: a.TotalItems,
+		ClosingAt:  a.ClosingAt,
+		CodeTTLMs:  a.CodeTTL.Milliseconds(),
+		Extensions: a.Extensions,
+	}
+}
+
+// Closing reports whether the sale is draining and refuses new checkouts.
+func (a *ActiveSale) Closing() bool {
+	return !a.ClosingAt.IsZero()
+}
+
+// Phase is where a sale is in its lifecycle.
+type Phase string
+
+const (
+	// PhaseScheduled sales exist but are not shown yet.
+	PhaseScheduled Phase = "scheduled"
+	// PhasePreview sales can be browsed but not checked out.
+	PhasePreview Phase = "preview"
+	PhaseActive  Phase = "active"
+	// PhaseEnded covers closing sales as well as finalized ones.
+	PhaseEnded Phase = "ended"
+)
+
+// Phase reports the sale's phase at now. The preview window is the
+// SALE_PREVIEW period before StartTime.
+func (a *ActiveSale) Phase(now time.Time) Phase {
+	switch {
+	case a.Closing() || !now.Before(a.EndTime):
+		return PhaseEnded
+	case now.Before(a.StartTime.Add(-config.Get().SalePreview)):
+		return PhaseScheduled
+	case now.Before(a.StartTime):
+		return PhasePreview
+	default:
+		return PhaseActive
+	}
 }
 
 func NewManager(db database.Service, cache cache.Service) *Manager {
+	hostname, _ := os.Hostname()
+	showcase, err := NewShowcaseStrategy(config.Get().ShowcaseStrategy, db, cache)
+	if err != nil {
+		log.Printf("%v, showcasing the first and last items", err)
+		showcase = edgesShowcase{db: db}
+	}
 	return &Manager{
-		db:    db,
-		cache: cache,
+		db:         db,
+		cache:      cache,
+		instanceID: fmt.Sprintf("%s-%d-%x", hostname, os.Getpid(), rand.Int63()),
+		showcase:   showcase,
 	}
 }
 
+// NewTenantManager runs the sales of a tenant other than the default one,
+// with its own leader election. db and cache must already be scoped to the
+// tenant.
+func NewTenantManager(tenant string, db database.Service, cache cache.Service) *Manager {
+	m := NewManager(db, cache)
+	m.tenant = tenant
+	return m
+}
+
+// lockName is the leader lock of this manager's tenant.
+func (m *Manager) lockName() string {
+	if m.tenant == "" {
+		return leaderLockName
+	}
+	return leaderLockName + ":" + m.tenant
+}
+
 func (m *Manager) Start(ctx context.Context) error {
 	if err := m.db.RunMigrations(); err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
-	if err := m.startNewSale(ctx); err != nil {
+	if err := m.loadCatalog(); err != nil {
+		return err
+	}
+
+	if err := m.tick(ctx); err != nil {
 		return fmt.Errorf("failed to start initial sale: %w", err)
 	}
 
-	ticker := time.NewTicker(time.Hour)
+	ticker := time.NewTicker(TickInterval)
 	go func() {
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ctx.Done():
+				m.cache.ReleaseLeadership(context.Background(), m.lockName(), m.instanceID)
 				return
 			case <-ticker.C:
-				if err := m.startNewSale(ctx); err != nil {
-					log.Printf("Failed to start new sale: %v", err)
+				if err := m.tick(ctx); err != nil {
+					log.Printf("Sale manager tick failed: %v", err)
 				}
 			}
 		}
 	}()
 
-	log.Println("Sale manager started")
+	log.Printf("Sale manager started (instance %s, tenant %q)", m.instanceID, m.tenant)
 	return nil
 }
 
@@ -86,75 +226,467 @@ func (m *Manager) GetCurrentSale() *ActiveSale {
 	return m.active
 }
 
-func (m *Manager) startNewSale(ctx context.Context) error {
-	now := time.Now()
-	saleID := fmt.Sprintf("sale_%d", now.Unix())
+// InstanceID identifies this replica among the ones sharing Redis.
+func (m *Manager) InstanceID() string {
+	return m.instanceID
+}
+
+// OnSaleChange registers fn to be called whenever this replica switches to a
+// different active sale. Listeners must be registered before Start.
+func (m *Manager) OnSaleChange(fn func(*ActiveSale)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+// setActive swaps the active sale pointer and notifies listeners when the
+// sale actually changed.
+func (m *Manager) setActive(sale *ActiveSale) {
+	m.mu.Lock()
+	changed := m.active == nil || m.active.SaleID != sale.SaleID
+	m.active = sale
+	listeners := m.listeners
+	m.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	for _, fn := range listeners {
+		fn(sale)
+	}
+}
+
+// IsLeader reports whether this replica currently owns sale rotation.
+func (m *Manager) IsLeader() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.token > 0
+}
+
+// tick renews or contends for leadership. The leader finalizes an expired
+// sale and starts the next one; followers only mirror the active sale from
+// shared state so every replica serves the same sale. A leader that starts
+// without an in-memory sale (fresh boot or crash restart) first adopts
+// whatever sale is already running instead of replacing it.
+func (m *Manager) tick(ctx context.Context) error {
+	token, isLeader, err := m.cache.AcquireLeadership(ctx, m.lockName(), m.instanceID, leaderLeaseTTL)
+	if err != nil {
+		return fmt.Errorf("failed to acquire leadership: %w", err)
+	}
+
+	m.mu.Lock()
+	if isLeader && m.token != token {
+		log.Printf("Instance %s became sale manager leader (token %d)", m.instanceID, token)
+	}
+	if !isLeader && m.token > 0 {
+		log.Printf("Instance %s lost sale manager leadership", m.instanceID)
+	}
+	m.token = token
+	current := m.active
+	m.mu.Unlock()
+
+	if !isLeader {
+		return m.refreshActiveSale(ctx)
+	}
+
+	// The key audit covers all of Redis, so only the default tenant runs it.
+	if m.tenant == "" {
+		m.maybeAuditRedis()
+	}
+
+	if current == nil {
+		if err := m.refreshActiveSale(ctx); err != nil {
+			log.Printf("Warning: could not hydrate active sale: %v", err)
+		}
+		current = m.GetCurrentSale()
+	}
+
+	if current != nil && time.Now().Before(current.EndTime) {
+		current = m.syncCodeTTL(ctx, current)
+		m.maybeRestock(ctx, current)
+		m.maybeRefreshShowcase(ctx, current)
+		return nil
+	}
+
+	if current != nil {
+		if !current.Closing() {
+			if m.maybeExtend(ctx, current) {
+				return nil
+			}
+			m.closeSale(ctx, current)
+			current = m.GetCurrentSale()
+		}
+		if time.Since(current.ClosingAt) < config.Get().RolloverDrain {
+			return nil
+		}
+		// A sale that could not be finalized is tried again next tick
+		// rather than left active behind the next one.
+		if err := m.finalizeSale(ctx, current); err != nil {
+			return err
+		}
+	}
+	return m.startNewSale(ctx, token)
+}
+
+// syncCodeTTL picks up a code TTL changed through the admin API. Followers
+// get it with the rest of the pointer; the leader keeps its own copy of the
+// sale and must adopt it before it next publishes the pointer.
+func (m *Manager) syncCodeTTL(ctx context.Context, current *ActiveSale) *ActiveSale {
+	shared, err := m.cache.GetCurrentSale(ctx)
+	if err != nil || shared.SaleID != current.SaleID {
+		return current
+	}
+	codeTTL := time.Duration(shared.CodeTTLMs) * time.Millisecond
+	if codeTTL == current.CodeTTL {
+		return current
+	}
+	updated := *current
+	updated.CodeTTL = codeTTL
+	m.setActive(&updated)
+	return &updated
+}
+
+// announce tells the other replicas, through Postgres, that the shared
+// sale pointer changed, so they follow it before their next tick.
+func (m *Manager) announce(ctx context.Context, eventType, saleID string) {
+	if err := m.db.NotifySaleEvent(ctx, database.SaleEvent{Type: eventType, SaleID: saleID}); err != nil {
+		log.Printf("Warning: could not announce %s of sale %s: %v", eventType, saleID, err)
+	}
+}
+
+// Follow rereads the active sale pointer on a follower, as its next tick
+// would, after another replica announced a change. The leader made the
+// change itself and ignores it.
+func (m *Manager) Follow(ctx context.Context) error {
+	if m.IsLeader() {
+		return nil
+	}
+	return m.refreshActiveSale(ctx)
+}
+
+// refreshActiveSale loads the active sale pointer from Redis, falling back
+// to Postgres when the pointer is missing or Redis is unreachable. Ticks
+// and announcements refresh one at a time, so an older read never
+// replaces a newer one.
+func (m *Manager) refreshActiveSale(ctx context.Context) error {
+	m.refreshMu.Lock()
+	defer m.refreshMu.Unlock()
+
+	shared, err := m.cache.GetCurrentSale(ctx)
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("Warning: could not read current sale from cache: %v", err)
+		}
+
+		dbSale, err := m.db.GetActiveSale(ctx)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return fmt.Errorf("failed to load active sale: %w", err)
+		}
+		shared = &cache.CurrentSale{
+			SaleID:     dbSale.SaleID,
+			StartTime:  dbSale.StartTime,
+			EndTime:    dbSale.EndTime,
+			TotalItems: dbSale.TotalItems,
+			CodeTTLMs:  dbSale.CodeTTL.Milliseconds(),
+			Extensions: dbSale.Extensions,
+		}
+		if current := m.GetCurrentSale(); current != nil && current.SaleID == dbSale.SaleID {
+			shared.ClosingAt = current.ClosingAt
+		}
+	}
+
+	if current := m.GetCurrentSale(); current == nil || current.SaleID != shared.SaleID {
+		log.Printf("Following active sale %s", shared.SaleID)
+	}
+	totalItems := shared.TotalItems
+	if totalItems == 0 {
+		totalItems = DefaultSaleSize
+	}
+	m.setActive(&ActiveSale{
+		SaleID:     shared.SaleID,
+		StartTime:  shared.StartTime,
+		EndTime:    shared.EndTime,
+		TotalItems: totalItems,
+		ClosingAt:  shared.ClosingAt,
+		CodeTTL:    time.Duration(shared.CodeTTLMs) * time.Millisecond,
+		Extensions: shared.Extensions,
+	})
+	return nil
+}
+
+// ReconcileFallbackPurchases replays sales made through the Postgres
+// fallback into the running sale's Redis state, so the inventory counter
+// and per-user caps account for them once Redis is reachable again. Only
+// the leader reconciles, and only while Redis is up; otherwise it does
+// nothing and the sales wait for a later run.
+func (m *Manager) ReconcileFallbackPurchases(ctx context.Context) error {
+	current := m.GetCurrentSale()
+	if !m.IsLeader() || current == nil || !time.Now().Before(current.EndTime) {
+		return nil
+	}
+	if m.cache.Health()["status"] != "up" {
+		return nil
+	}
+	return m.reconcileFallbackPurchases(ctx, current.SaleID)
+}
+
+// reconcileFallbackPurchases marks each fallback sale reconciled only once
+// its replay went through, so a sale whose replay failed is retried on the
+// next run. A replay that finds the item already sold in Redis is flagged
+// as an anomaly.
+func (m *Manager) reconcileFallbackPurchases(ctx context.Context, saleID string) error {
+	purchases, err := m.db.UnreconciledFallbackPurchases(ctx, saleID)
+	if err != nil {
+		return fmt.Errorf("could not reconcile fallback purchases for sale %s: %w", saleID, err)
+	}
+	if len(purchases) == 0 {
+		return nil
+	}
+
+	reconciled := 0
+	for _, p := range purchases {
+		applied, err := m.cache.ApplyFallbackPurchase(ctx, saleID, p.UserID, p.ItemID)
+		if err != nil {
+			log.Printf("Failed to apply fallback purchase of item %s for user %s: %v", p.ItemID, p.UserID, err)
+			continue
+		}
+		if applied {
+			err = m.db.MarkFallbackReconciled(ctx, saleID, p.ItemID)
+		} else {
+			err = m.db.FlagFallbackConflict(ctx, &p)
+		}
+		if err != nil {
+			log.Printf("Failed to mark fallback purchase of item %s reconciled: %v", p.ItemID, err)
+			continue
+		}
+		reconciled++
+	}
+	log.Printf("Reconciled %d of %d fallback purchases for sale %s", reconciled, len(purchases), saleID)
+	return nil
+}
+
+// closeSale is the first step of a rollover: the sale stops taking new
+// reservations on every replica while checkouts and purchases already in
+// flight drain. The next tick past the drain window finalizes it.
+func (m *Manager) closeSale(ctx context.Context, active *ActiveSale) {
+	closing := *active
+	closing.ClosingAt = time.Now()
+
+	if err := m.cache.SetSaleState(ctx, active.SaleID, cache.SaleStateClosing); err != nil {
+		log.Printf("Warning: could not mark sale %s closing: %v", active.SaleID, err)
+	}
+	if err := m.cache.SetCurrentSale(ctx, closing.pointer()); err != nil {
+		log.Printf("Warning: failed to publish closing sale pointer: %v", err)
+	}
+
+	m.setActive(&closing)
+	m.announce(ctx, database.SaleEventClosing, active.SaleID)
+	log.Printf("Sale %s closing, draining for %s", active.SaleID, config.Get().RolloverDrain)
+}
+
+// finalizeSale ends a drained sale and records how many of its items sold.
+// Nothing is recorded when the final inventory cannot be read, so an
+// unreadable count is never taken for a sell-out.
+func (m *Manager) finalizeSale(ctx context.Context, active *ActiveSale) error {
+	if err := m.reconcileFallbackPurchases(ctx, active.SaleID); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	remaining, err := m.cache.GetInventoryStatus(ctx, active.SaleID)
+	if err != nil {
+		return fmt.Errorf("could not read final inventory for sale %s: %w", active.SaleID, err)
+	}
+
+	itemsSold := active.TotalItems - remaining
+	if err := m.db.EndSale(ctx, active.SaleID, itemsSold); err != nil {
+		return fmt.Errorf("failed to finalize sale %s: %w", active.SaleID, err)
+	}
+	if err := m.cache.SetSaleState(ctx, active.SaleID, cache.SaleStateClosed); err != nil {
+		log.Printf("Warning: could not mark sale %s closed: %v", active.SaleID, err)
+	}
+	m.announce(ctx, database.SaleEventEnded, active.SaleID)
+	m.recordSaleStats(ctx, active, itemsSold)
+	log.Printf("Sale %s finalized with %d items sold", active.SaleID, itemsSold)
+	return nil
+}
+
+// startNewSale creates the next sale. With SALE_PREVIEW set it opens in
+// preview and starts selling once the preview window has passed. A sale
+// that fails to start once it was written to Postgres is marked abandoned.
+func (m *Manager) startNewSale(ctx context.Context, token int64) (err error) {
+	created := time.Now()
+	now := created.Add(config.Get().SalePreview)
+	saleID := fmt.Sprintf("sale_%d", created.Unix())
+	if m.tenant != "" {
+		saleID = m.tenant + "-" + saleID
+	}
 	log.Printf("Starting new sale: %s", saleID)
 
-	// ... (CreateSale in DB) ...
+	var items []database.Item
+	if entries := m.saleCatalog(ctx); entries != nil {
+		items = catalogItems(saleID, entries)
+		log.Printf("Sale %s sells %d catalog items", saleID, len(items))
+	} else {
+		items = GenerateItems(saleID, 0, DefaultSaleSize)
+	}
+	// A sale's size counts units, so an item sold by quantity counts as
+	// many times as it has units.
+	totalItems := 0
+	stock := make(map[string]int)
+	for _, item := range items {
+		totalItems += max(item.Quantity, 1)
+		if item.Quantity > 1 {
+			stock[item.ItemID] = item.Quantity
+		}
+	}
+
+	// The sale is created pending and only activated, fenced by token, once
+	// its items are in place, so a leader deposed meanwhile leaves no active
+	// sale behind.
+	codeTTL := config.Get().CheckoutCodeTTL
+	oversellBuffer := max(config.Get().OversellBuffer, 0)
 	if err := m.db.CreateSale(ctx, &database.Sale{
-		SaleID:     saleID,
-		StartTime:  now,
-		EndTime:    now.Add(time.Hour),
-		TotalItems: 10000,
-		Status:     "active",
+		SaleID:         saleID,
+		StartTime:      now,
+		EndTime:        now.Add(time.Hour),
+		TotalItems:     totalItems,
+		Status:         "pending",
+		CodeTTL:        codeTTL,
+		OversellBuffer: oversellBuffer,
 	}); err != nil {
 		return fmt.Errorf("failed to create sale: %w", err)
 	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if abandonErr := m.db.AbandonSale(context.WithoutCancel(ctx), saleID); abandonErr != nil {
+			log.Printf("Warning: could not mark sale %s abandoned: %v", saleID, abandonErr)
+		}
+	}()
 
-	items := m.generateItems(saleID, 10000)
 	if err := m.db.CreateItems(ctx, items); err != nil {
 		return fmt.Errorf("failed to create items: %w", err)
 	}
 
-	firstIDs, lastIDs, err := m.db.GetShowcaseItemIDs(ctx, saleID, 10)
+	if err := m.db.SeedAvailableItems(ctx, saleID); err != nil {
+		log.Printf("Warning: could not seed fallback availability for sale %s: %v", saleID, err)
+	}
+
+	categoryCounts := make(map[string]int)
+	for _, item := range items {
+		categoryCounts[item.Category] += max(item.Quantity, 1)
+	}
+
+	itemInfos := make([]cache.ItemInfo, len(items))
+	for i, item := range items {
+		itemInfos[i] = cache.ItemInfo{ItemID: item.ItemID, Name: item.Name, ImageURL: item.ImageURL, Category: item.Category, PriceMinor: item.PriceMinor, Currency: item.Currency, Rarity: item.Rarity, Quantity: item.Quantity}
+	}
+	if err := m.cache.SetItems(ctx, saleID, itemInfos); err != nil {
+		log.Printf("Warning: failed to warm item metadata cache: %v", err)
+	}
+
+	m.showcasedAt = time.Now()
+	if _, err := m.RefreshShowcase(ctx, saleID); err != nil {
+		log.Printf("Warning: could not warm showcase of sale %s: %v", saleID, err)
+	}
+
+	if valid, err := m.cache.ValidateFencingToken(ctx, m.lockName(), token); err != nil || !valid {
+		return fmt.Errorf("leadership lost before activating sale %s", saleID)
+	}
+	activated, err := m.db.ActivateSale(ctx, saleID, token)
 	if err != nil {
-		log.Printf("Warning: could not get showcase IDs for cache warming: %v", err)
-	} else {
-		showcaseInfo := &cache.ShowcaseInfo{
-			FirstItemIDs: firstIDs,
-			LastItemIDs:  lastIDs,
-		}
-		if err := m.cache.SetShowcaseInfo(ctx, saleID, showcaseInfo); err != nil {
-			log.Printf("Warning: failed to cache showcase info: %v", err)
-		}
+		return fmt.Errorf("failed to activate sale: %w", err)
+	}
+	if !activated {
+		return fmt.Errorf("leadership lost before activating sale %s", saleID)
 	}
 
-	if err := m.cache.InitializeSale(ctx, saleID, 10000); err != nil {
+	// Set before the inventory, so no checkout sees the sale without it
+	if err := m.cache.SetOversellBuffer(ctx, saleID, oversellBuffer); err != nil {
+		return fmt.Errorf("failed to set oversell buffer: %w", err)
+	}
+	if err := m.cache.SetItemStock(ctx, saleID, stock); err != nil {
+		return fmt.Errorf("failed to set item stock: %w", err)
+	}
+	if err := m.cache.InitializeSale(ctx, saleID, totalItems, categoryCounts); err != nil {
 		return fmt.Errorf("failed to initialize cache: %w", err)
 	}
+	m.recordSupply(ctx, database.MovementInit, "init:"+saleID, saleID, totalItems)
 
-	m.mu.Lock()
-	m.active = &ActiveSale{
-		SaleID:    saleID,
-		StartTime: now,
-		EndTime:   now.Add(time.Hour),
+	active := &ActiveSale{
+		SaleID:     saleID,
+		StartTime:  now,
+		EndTime:    now.Add(time.Hour),
+		TotalItems: totalItems,
+		CodeTTL:    codeTTL,
 	}
-	m.mu.Unlock()
+	if err := m.cache.SetCurrentSale(ctx, active.pointer()); err != nil {
+		log.Printf("Warning: failed to publish current sale pointer: %v", err)
+	}
+	m.setActive(active)
+	m.announce(ctx, database.SaleEventCreated, saleID)
 
+	if now.After(created) {
+		log.Printf("Sale %s is in preview, checkouts open at %s.", saleID, now.Format(time.RFC3339))
+		return nil
+	}
 	log.Printf("Sale %s is active.", saleID)
 	return nil
 }
 
-func (m *Manager) generateItems(saleID string, count int) []database.Item {
+// GenerateItems makes count random items numbered from first+1, as a sale
+// without a catalog sells.
+func GenerateItems(saleID string, first, count int) []database.Item {
 	items := make([]database.Item, count)
+	currency := config.Get().SaleCurrency
+	unit := money.Unit(currency)
 
 	for i := 0; i < count; i++ {
 		adj := adjectives[rand.Intn(len(adjectives))]
 		noun := nouns[rand.Intn(len(nouns))]
 		name := fmt.Sprintf("%s %s", adj, noun)
 
-		itemID := fmt.Sprintf("%s_item_%06d", saleID, i+1)
-		imageURL := fmt.Sprintf("https://via.placeholder.com/400x400/%06x/FFFFFF?text=%s+%s",
-			rand.Intn(0xFFFFFF), adj, noun)
+		itemID := fmt.Sprintf("%s_item_%06d", saleID, first+i+1)
+		imageURL := imagegen.URL(itemID)
+
+		category, ok := nounCategories[noun]
+		if !ok {
+			category = "artifacts"
+		}
+		// Shelf prices: 1 to 500 whole units, just under in currencies
+		// with a minor unit (9.99 rather than 10).
+		price := int64(rand.Intn(500)+1) * unit
+		if unit > 1 {
+			price--
+		}
 
 		items[i] = database.Item{
-			ItemID:   itemID,
-			SaleID:   saleID,
-			Name:     name,
-			ImageURL: imageURL,
+			ItemID:     itemID,
+			SaleID:     saleID,
+			Name:       name,
+			ImageURL:   imageURL,
+			Category:   category,
+			PriceMinor: price,
+			Currency:   currency,
+			Rarity:     randomRarity(),
 		}
 	}
 
 	return items
 }
+
+// randomRarity draws the rarity of a generated item: one in a hundred is
+// legendary and one in ten rare.
+func randomRarity() string {
+	switch n := rand.Intn(100); {
+	case n == 0:
+		return catalog.RarityLegendary
+	case n < 10:
+		return catalog.RarityRare
+	}
+	return catalog.RarityCommon
+}
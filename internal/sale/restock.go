@@ -0,0 +1,123 @@
+package sale
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/codes"
+	"flash_sale_contest/internal/config"
+	"flash_sale_contest/internal/database"
+	"flash_sale_contest/internal/notifications"
+)
+
+// maybeRestock simulates a restock: once RESTOCK_SELL_THROUGH of a running
+// sale has sold, another RESTOCK_TRANCHE of generated items is added to
+// Postgres and Redis, until RESTOCK_MAX_ITEMS have been added to the sale.
+// Only the leader calls it, from tick, so it never races a rollover.
+func (m *Manager) maybeRestock(ctx context.Context, active *ActiveSale) {
+	cfg := config.Get()
+	if cfg.RestockTranche <= 0 || cfg.RestockMaxItems <= 0 || active.Phase(time.Now()) != PhaseActive {
+		return
+	}
+
+	remaining, err := m.cache.GetInventoryStatus(ctx, active.SaleID)
+	if err != nil {
+		return
+	}
+	sold := active.TotalItems - remaining
+	if float64(sold) < cfg.RestockSellThrough*float64(active.TotalItems) {
+		return
+	}
+
+	granted, err := m.cache.ClaimRestock(ctx, active.SaleID, cfg.RestockTranche, cfg.RestockMaxItems)
+	if err != nil {
+		log.Printf("Warning: could not claim restock for sale %s: %v", active.SaleID, err)
+		return
+	}
+	if granted == 0 {
+		return
+	}
+
+	// Items go to Postgres before Redis counts them, so every unit a buyer
+	// can reserve has a row behind it. A tranche that fails to go in gives
+	// its claim back to the budget.
+	items := GenerateItems(active.SaleID, active.TotalItems, granted)
+	if err := m.db.CreateItems(ctx, items); err != nil {
+		log.Printf("Failed to create %d restock items for sale %s: %v", granted, active.SaleID, err)
+		m.unclaimRestock(ctx, active.SaleID, granted)
+		return
+	}
+
+	categoryCounts := make(map[string]int)
+	itemIDs := make([]string, len(items))
+	itemInfos := make([]cache.ItemInfo, len(items))
+	for i, item := range items {
+		categoryCounts[item.Category]++
+		itemIDs[i] = item.ItemID
+		itemInfos[i] = cache.ItemInfo{ItemID: item.ItemID, Name: item.Name, ImageURL: item.ImageURL, Category: item.Category, PriceMinor: item.PriceMinor, Currency: item.Currency, Rarity: item.Rarity, Quantity: item.Quantity}
+	}
+	if err := m.cache.SetItems(ctx, active.SaleID, itemInfos); err != nil {
+		log.Printf("Warning: failed to cache restock item metadata: %v", err)
+	}
+	if err := m.cache.RestockInventory(ctx, active.SaleID, categoryCounts); err != nil {
+		log.Printf("Failed to add %d restock items to sale %s inventory: %v", granted, active.SaleID, err)
+		// The next tranche is numbered from the same item, so its rows must
+		// go before the claim is given back.
+		if err := m.db.DeleteItems(ctx, active.SaleID, itemIDs); err != nil {
+			log.Printf("Warning: could not remove restock items of sale %s: %v", active.SaleID, err)
+			return
+		}
+		m.unclaimRestock(ctx, active.SaleID, granted)
+		return
+	}
+	if err := m.db.SeedAvailableItems(ctx, active.SaleID); err != nil {
+		log.Printf("Warning: could not seed fallback availability for restock of sale %s: %v", active.SaleID, err)
+	}
+	if err := m.db.AddSaleItems(ctx, active.SaleID, granted); err != nil {
+		log.Printf("Warning: could not record restock of sale %s: %v", active.SaleID, err)
+	}
+	m.recordSupply(ctx, database.MovementRestock, codes.NewID(), active.SaleID, granted)
+
+	restocked := *active
+	restocked.TotalItems += granted
+	if err := m.cache.SetCurrentSale(ctx, restocked.pointer()); err != nil {
+		log.Printf("Warning: failed to publish restocked sale pointer: %v", err)
+	}
+	m.setActive(&restocked)
+
+	if err := notifications.Publish(ctx, m.cache, notifications.Event{
+		Type:   notifications.EventSaleRestocked,
+		SaleID: active.SaleID,
+		Items:  granted,
+		Tenant: m.tenant,
+	}); err != nil {
+		log.Printf("Warning: failed to announce restock of sale %s: %v", active.SaleID, err)
+	}
+	log.Printf("Sale %s restocked with %d items after selling %d of %d", active.SaleID, granted, sold, active.TotalItems)
+}
+
+// unclaimRestock gives a tranche that was not added back to the restock
+// budget.
+func (m *Manager) unclaimRestock(ctx context.Context, saleID string, n int) {
+	if err := m.cache.UnclaimRestock(ctx, saleID, n); err != nil {
+		log.Printf("Warning: could not give %d restock items back to the budget of sale %s: %v", n, saleID, err)
+	}
+}
+
+// recordSupply writes units added to a sale's Redis inventory to the
+// inventory ledger. Only the leader adds inventory, so these are written
+// directly rather than through the server's write pool.
+func (m *Manager) recordSupply(ctx context.Context, movement, entryID, saleID string, quantity int) {
+	err := m.db.RecordInventoryMovement(ctx, &database.InventoryMovement{
+		EntryID:    entryID,
+		SaleID:     saleID,
+		Movement:   movement,
+		Quantity:   quantity,
+		RecordedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("Warning: could not record %s of %d items in the ledger of sale %s: %v", movement, quantity, saleID, err)
+	}
+}
@@ -0,0 +1,126 @@
+package sale
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/config"
+	"flash_sale_contest/internal/database"
+)
+
+// Showcase strategies, chosen by SHOWCASE_STRATEGY.
+const (
+	// ShowcaseEdges shows the first and last items by item ID.
+	ShowcaseEdges = "edges"
+	// ShowcaseRandom shows a random sample, drawn again on every refresh.
+	ShowcaseRandom = "random"
+	// ShowcaseStaffPicks shows the items set through the admin API.
+	ShowcaseStaffPicks = "staff_picks"
+	// ShowcaseMostViewed shows the items whose availability was checked
+	// most often.
+	ShowcaseMostViewed = "most_viewed"
+)
+
+// ShowcaseStrategy picks the items /sale/info shows for a sale.
+type ShowcaseStrategy interface {
+	Pick(ctx context.Context, saleID string, n int) (*cache.ShowcaseInfo, error)
+}
+
+// NewShowcaseStrategy returns the strategy called name. Strategies that may
+// have nothing to show, such as staff picks before any are set, fall back
+// to the edges.
+func NewShowcaseStrategy(name string, db database.Service, c cache.Service) (ShowcaseStrategy, error) {
+	edges := edgesShowcase{db: db}
+	switch name {
+	case ShowcaseEdges:
+		return edges, nil
+	case ShowcaseRandom:
+		return randomShowcase{db: db}, nil
+	case ShowcaseStaffPicks:
+		return withFallback{ShowcaseStaffPicks, func(ctx context.Context, saleID string, n int) ([]string, error) {
+			picks, err := c.GetStaffPicks(ctx, saleID)
+			return picks[:min(n, len(picks))], err
+		}, edges}, nil
+	case ShowcaseMostViewed:
+		return withFallback{ShowcaseMostViewed, func(ctx context.Context, saleID string, n int) ([]string, error) {
+			return c.MostViewedItems(ctx, saleID, n)
+		}, edges}, nil
+	}
+	return nil, fmt.Errorf("unknown showcase strategy %q", name)
+}
+
+type edgesShowcase struct {
+	db database.Service
+}
+
+func (e edgesShowcase) Pick(ctx context.Context, saleID string, n int) (*cache.ShowcaseInfo, error) {
+	firstIDs, lastIDs, err := e.db.GetShowcaseItemIDs(ctx, saleID, (n+1)/2)
+	if err != nil {
+		return nil, err
+	}
+	return &cache.ShowcaseInfo{
+		Strategy:     ShowcaseEdges,
+		FirstItemIDs: firstIDs,
+		LastItemIDs:  lastIDs[:min(n/2, len(lastIDs))],
+	}, nil
+}
+
+type randomShowcase struct {
+	db database.Service
+}
+
+func (r randomShowcase) Pick(ctx context.Context, saleID string, n int) (*cache.ShowcaseInfo, error) {
+	ids, err := r.db.RandomItemIDs(ctx, saleID, n)
+	if err != nil {
+		return nil, err
+	}
+	return &cache.ShowcaseInfo{Strategy: ShowcaseRandom, ItemIDs: ids}, nil
+}
+
+// withFallback shows what pick returns, or what fallback picks when that
+// is nothing.
+type withFallback struct {
+	name     string
+	pick     func(ctx context.Context, saleID string, n int) ([]string, error)
+	fallback ShowcaseStrategy
+}
+
+func (w withFallback) Pick(ctx context.Context, saleID string, n int) (*cache.ShowcaseInfo, error) {
+	ids, err := w.pick(ctx, saleID, n)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return w.fallback.Pick(ctx, saleID, n)
+	}
+	return &cache.ShowcaseInfo{Strategy: w.name, ItemIDs: ids}, nil
+}
+
+// RefreshShowcase picks a sale's showcase again and caches it for every
+// replica.
+func (m *Manager) RefreshShowcase(ctx context.Context, saleID string) (*cache.ShowcaseInfo, error) {
+	showcase, err := m.showcase.Pick(ctx, saleID, config.Get().ShowcaseSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pick showcase: %w", err)
+	}
+	if err := m.cache.SetShowcaseInfo(ctx, saleID, showcase); err != nil {
+		return nil, fmt.Errorf("failed to cache showcase: %w", err)
+	}
+	return showcase, nil
+}
+
+// maybeRefreshShowcase refreshes the running sale's showcase every
+// SHOWCASE_REFRESH. Only the leader calls it, from tick.
+func (m *Manager) maybeRefreshShowcase(ctx context.Context, active *ActiveSale) {
+	interval := config.Get().ShowcaseRefresh
+	if interval <= 0 || time.Since(m.showcasedAt) < interval {
+		return
+	}
+	m.showcasedAt = time.Now()
+	if _, err := m.RefreshShowcase(ctx, active.SaleID); err != nil {
+		log.Printf("Warning: could not refresh showcase of sale %s: %v", active.SaleID, err)
+	}
+}
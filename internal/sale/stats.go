@@ -0,0 +1,69 @@
+package sale
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"flash_sale_contest/internal/database"
+	"flash_sale_contest/internal/metrics"
+)
+
+// recordSaleStats sums the metrics reports every replica published for a
+// finalized sale and stores them with its sell-out time. Reports trail the
+// replicas by up to one publish interval, so the last moments of the drain
+// may be missing. Items sold beyond the stock are recorded as oversold,
+// with the oversell buffer the sale ended with.
+func (m *Manager) recordSaleStats(ctx context.Context, active *ActiveSale, itemsSold int) {
+	reports, err := m.cache.GetSaleReports(ctx, active.SaleID)
+	if err != nil {
+		log.Printf("Warning: could not read metrics reports for sale %s: %v", active.SaleID, err)
+	}
+
+	var total metrics.SaleReport
+	instances := 0
+	for _, data := range reports {
+		var report metrics.SaleReport
+		if err := json.Unmarshal(data, &report); err != nil {
+			continue
+		}
+		total.Merge(report)
+		instances++
+	}
+
+	stats := &database.SaleStats{
+		SaleID:           active.SaleID,
+		TotalItems:       active.TotalItems,
+		ItemsSold:        itemsSold,
+		CheckoutRequests: total.CheckoutRequests,
+		CheckoutSuccess:  total.CheckoutSuccess,
+		PurchaseRequests: total.PurchaseRequests,
+		PurchaseSuccess:  total.PurchaseSuccess,
+		SoldOutErrors:    total.SoldOutErrors,
+		P99CheckoutMs:    total.P99CheckoutMs,
+		P99PurchaseMs:    total.P99PurchaseMs,
+		Instances:        instances,
+		Oversold:         max(itemsSold-active.TotalItems, 0),
+	}
+	if buffer, err := m.cache.GetOversellBuffer(ctx, active.SaleID); err != nil {
+		log.Printf("Warning: could not read oversell buffer for sale %s: %v", active.SaleID, err)
+	} else {
+		stats.OversellBuffer = buffer
+	}
+	if total.CheckoutRequests > 0 {
+		stats.CheckoutSuccessRate = float64(total.CheckoutSuccess) / float64(total.CheckoutRequests) * 100
+	}
+	if total.PurchaseRequests > 0 {
+		stats.PurchaseSuccessRate = float64(total.PurchaseSuccess) / float64(total.PurchaseRequests) * 100
+	}
+
+	if soldOutAt, err := m.cache.GetSoldOutAt(ctx, active.SaleID); err != nil {
+		log.Printf("Warning: could not read sell-out time for sale %s: %v", active.SaleID, err)
+	} else if !soldOutAt.IsZero() && soldOutAt.After(active.StartTime) {
+		stats.SoldOutAfter = soldOutAt.Sub(active.StartTime)
+	}
+
+	if err := m.db.SaveSaleStats(ctx, stats); err != nil {
+		log.Printf("Failed to record stats for sale %s: %v", active.SaleID, err)
+	}
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/catalog"
+	"flash_sale_contest/internal/config"
+	"flash_sale_contest/internal/database"
+)
+
+func (s *Server) resetMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	s.metrics.Reset()
+	log.Println("Metrics reset via admin API")
+
+	resp := api.ResetResponse{Reset: true}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+const (
+	defaultDeadLetterPage   = 100
+	defaultDeadLetterReplay = 1000
+)
+
+func (s *Server) deadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.DeadLettersRequest{Limit: defaultDeadLetterPage}
+	if v, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && v > 0 {
+		req.Offset = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 1000 {
+		req.Limit = v
+	}
+
+	ctx := r.Context()
+	depth, err := s.cache.DeadLetterDepth(ctx)
+	if err != nil {
+		writeError(w, r, "Failed to read dead letter queue", http.StatusInternalServerError)
+		return
+	}
+	letters, err := s.cache.ListDeadLetters(ctx, req.Offset, req.Limit)
+	if err != nil {
+		writeError(w, r, "Failed to read dead letter queue", http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.DeadLettersResponse{Depth: depth, Items: make([]api.DeadLetter, len(letters))}
+	for i, d := range letters {
+		resp.Items[i] = api.DeadLetter{
+			ID:       d.ID,
+			Kind:     d.Kind,
+			Payload:  d.Payload,
+			Error:    d.Error,
+			Attempts: d.Attempts,
+			FailedAt: d.FailedAt,
+		}
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+func (s *Server) replayDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.ReplayDeadLettersRequest{Limit: defaultDeadLetterReplay}
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		req.Limit = v
+	}
+
+	ctx := r.Context()
+	// Only replay what is queued now, so letters that fail again and are
+	// requeued are not retried twice in one call.
+	depth, err := s.cache.DeadLetterDepth(ctx)
+	if err != nil {
+		writeError(w, r, "Failed to read dead letter queue", http.StatusInternalServerError)
+		return
+	}
+	if int64(req.Limit) > depth {
+		req.Limit = int(depth)
+	}
+
+	replayed, failed, err := s.replayDeadLetters(ctx, req.Limit)
+	if err != nil {
+		log.Printf("Dead letter replay stopped early: %v", err)
+	}
+	log.Printf("Dead letter replay via admin API: %d replayed, %d failed", replayed, failed)
+
+	remaining, _ := s.cache.DeadLetterDepth(ctx)
+	resp := api.ReplayDeadLettersResponse{Replayed: replayed, Failed: failed, Remaining: remaining}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// nextSaleID addresses the sale the manager will start next, the only sale
+// whose items can still be chosen.
+const nextSaleID = "next"
+
+// uploadCatalogHandler stages a CSV, JSON or NDJSON catalog for the next
+// sale. Gzipped bodies are recognised by their content, so they need not
+// set Content-Encoding; the catalog is COPY-loaded into Postgres when the
+// sale starts.
+func (s *Server) uploadCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.CatalogUploadRequest{
+		SaleID: r.PathValue("sale_id"),
+		Format: r.URL.Query().Get("format"),
+	}
+	if req.SaleID != nextSaleID {
+		writeError(w, r, "Items of a started sale cannot be replaced; upload to /admin/sales/next/items", http.StatusConflict)
+		return
+	}
+	if encoding := r.Header.Get("Content-Encoding"); encoding != "" && encoding != "gzip" && encoding != "identity" {
+		writeError(w, r, "Content-Encoding must be gzip", http.StatusUnsupportedMediaType)
+		return
+	}
+	if req.Format == "" {
+		req.Format = catalog.FormatCSV
+		switch contentType := r.Header.Get("Content-Type"); {
+		case strings.HasPrefix(contentType, "application/json"):
+			req.Format = catalog.FormatJSON
+		case strings.HasPrefix(contentType, "application/x-ndjson"):
+			req.Format = catalog.FormatNDJSON
+		}
+	}
+
+	entries, err := catalog.Parse(r.Body, req.Format)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, r, fmt.Sprintf("Catalog upload larger than %d MiB; gzip it", catalogMaxBodyBytes>>20), http.StatusRequestEntityTooLarge)
+			return
+		}
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data, _ := json.Marshal(entries)
+	if err := s.cache.StageCatalog(r.Context(), data); err != nil {
+		writeError(w, r, "Failed to stage catalog", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Catalog with %d items staged for the next sale via admin API", len(entries))
+
+	resp := api.CatalogUploadResponse{SaleID: req.SaleID, Items: len(entries), Categories: map[string]int{}}
+	for _, e := range entries {
+		category := e.Category
+		if category == "" {
+			category = "artifacts"
+		}
+		resp.Categories[category]++
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// redisAuditHandler reports the most recent Redis key audit.
+func (s *Server) redisAuditHandler(w http.ResponseWriter, r *http.Request) {
+	audit, err := s.cache.GetLastKeyAudit(r.Context())
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			writeError(w, r, "No audit has run yet", http.StatusNotFound)
+			return
+		}
+		writeError(w, r, "Failed to load audit", http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.RedisAuditResponse{
+		StartedAt:      audit.StartedAt,
+		DurationMs:     audit.DurationMs,
+		Keys:           audit.Keys,
+		EstimatedBytes: audit.EstimatedBytes,
+		Prefixes:       make(map[string]api.RedisKeyUsage, len(audit.Prefixes)),
+	}
+	for prefix, usage := range audit.Prefixes {
+		resp.Prefixes[prefix] = api.RedisKeyUsage{
+			Keys:           usage.Keys,
+			SampledKeys:    usage.SampledKeys,
+			EstimatedBytes: usage.EstimatedBytes,
+			TTLApplied:     usage.TTLApplied,
+			Deleted:        usage.Deleted,
+		}
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// saleCodeTTLHandler changes how long a running sale's checkout codes hold
+// their item. Codes already issued keep their expiry; replicas pick up the
+// new TTL from the current-sale pointer once the change is announced, or
+// on their next tick.
+func (s *Server) saleCodeTTLHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.SaleCodeTTLRequest{SaleID: r.PathValue("sale_id"), TTL: r.URL.Query().Get("ttl")}
+	ttl, err := time.ParseDuration(req.TTL)
+	if err != nil || ttl < config.MinCheckoutCodeTTL || ttl > config.MaxCheckoutCodeTTL {
+		writeError(w, r, fmt.Sprintf("ttl must be between %s and %s", config.MinCheckoutCodeTTL, config.MaxCheckoutCodeTTL), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.setSaleCodeTTL(r.Context(), req.SaleID, ttl); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, "Sale is not running", http.StatusConflict)
+			return
+		}
+		writeError(w, r, "Failed to update sale", http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.SaleCodeTTLResponse{SaleID: req.SaleID, TTLSeconds: int(ttl.Seconds())}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// setSaleCodeTTL stores the code TTL of a running sale, publishes it to the
+// other replicas and announces the change so they pick it up at once. It
+// returns sql.ErrNoRows when the sale is not running.
+func (s *Server) setSaleCodeTTL(ctx context.Context, saleID string, ttl time.Duration) error {
+	if err := s.db.SetSaleCodeTTL(ctx, saleID, ttl); err != nil {
+		return err
+	}
+	if _, err := s.cache.SetCurrentSaleCodeTTL(ctx, saleID, ttl); err != nil {
+		// Replicas that fall back to Postgres still see the new TTL.
+		log.Printf("Warning: could not publish code TTL of sale %s: %v", saleID, err)
+	}
+	if err := s.db.NotifySaleEvent(ctx, database.SaleEvent{Type: database.SaleEventUpdated, SaleID: saleID}); err != nil {
+		log.Printf("Warning: could not announce code TTL of sale %s: %v", saleID, err)
+	}
+	log.Printf("Checkout codes of sale %s now hold for %s", saleID, ttl)
+	return nil
+}
+
+// saleOversellBufferHandler changes how many units a running sale may sell
+// beyond its stock. Lowering it below what is already oversold only stops
+// further overselling; no reservation is taken back.
+func (s *Server) saleOversellBufferHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.SaleOversellBufferRequest{SaleID: r.PathValue("sale_id"), Buffer: r.URL.Query().Get("buffer")}
+	buffer, err := strconv.Atoi(req.Buffer)
+	if err != nil || buffer < 0 {
+		writeError(w, r, "buffer must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if err := s.db.SetSaleOversellBuffer(ctx, req.SaleID, buffer); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, "Sale is not running", http.StatusConflict)
+			return
+		}
+		writeError(w, r, "Failed to update sale", http.StatusInternalServerError)
+		return
+	}
+	if err := s.cache.SetOversellBuffer(ctx, req.SaleID, buffer); err != nil {
+		log.Printf("Failed to publish oversell buffer of sale %s: %v", req.SaleID, err)
+		writeError(w, r, "Failed to update sale", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Sale %s may now oversell by %d", req.SaleID, buffer)
+
+	resp := api.SaleOversellBufferResponse{SaleID: req.SaleID, OversellBuffer: buffer}
+	writeJSON(w, r, http.StatusOK, resp)
+}
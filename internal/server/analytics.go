@@ -0,0 +1,112 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/money"
+)
+
+// saleAnalyticsHandler reports what a sale has sold and taken, per currency.
+// Totals come from Postgres, so purchases still being written lag slightly.
+func (s *Server) saleAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.SaleAnalyticsRequest{SaleID: r.URL.Query().Get("sale_id")}
+
+	ctx := r.Context()
+	if req.SaleID == "" {
+		activeSale := s.saleManager.GetCurrentSale()
+		if activeSale == nil {
+			writeError(w, r, "Sale not found", http.StatusNotFound)
+			return
+		}
+		req.SaleID = activeSale.SaleID
+	} else if _, err := s.db.GetSale(ctx, req.SaleID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, "Sale not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, r, "Failed to load sale", http.StatusInternalServerError)
+		return
+	}
+
+	revenue, err := s.db.SaleRevenue(ctx, req.SaleID)
+	if err != nil {
+		log.Printf("Failed to total revenue of sale %s: %v", req.SaleID, err)
+		writeError(w, r, "Failed to load analytics", http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.SaleAnalyticsResponse{SaleID: req.SaleID, Revenue: []api.Revenue{}}
+	for _, rev := range revenue {
+		resp.ItemsSold += rev.Items
+		if rev.Currency == "" {
+			resp.UnpricedItems += rev.Items
+			continue
+		}
+		resp.Revenue = append(resp.Revenue, api.Revenue{
+			Currency:    rev.Currency,
+			Items:       rev.Items,
+			AmountMinor: rev.AmountMinor,
+			Amount:      money.Format(rev.AmountMinor, rev.Currency),
+		})
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+const (
+	defaultTopBuyers = 10
+	maxTopBuyers     = 1000
+)
+
+// topBuyersHandler ranks a sale's buyers. Postgres picks the candidates;
+// their counts are then refreshed from Redis in one HMGET, since purchase
+// rows are written off the request path and lag the live counters.
+func (s *Server) topBuyersHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.TopBuyersRequest{SaleID: r.PathValue("sale_id"), Limit: defaultTopBuyers}
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= maxTopBuyers {
+		req.Limit = v
+	}
+
+	ctx := r.Context()
+	if _, err := s.db.GetSale(ctx, req.SaleID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, "Sale not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, r, "Failed to load sale", http.StatusInternalServerError)
+		return
+	}
+
+	buyers, err := s.db.TopBuyers(ctx, req.SaleID, req.Limit)
+	if err != nil {
+		log.Printf("Failed to rank buyers of sale %s: %v", req.SaleID, err)
+		writeError(w, r, "Failed to load top buyers", http.StatusInternalServerError)
+		return
+	}
+
+	userIDs := make([]string, len(buyers))
+	for i, b := range buyers {
+		userIDs[i] = b.UserID
+	}
+	// Purged sales have no counters left; Postgres is then the full record.
+	live, err := s.cache.GetUserPurchaseCounts(ctx, req.SaleID, userIDs...)
+	if err != nil {
+		log.Printf("Failed to read live purchase counts of sale %s: %v", req.SaleID, err)
+	}
+
+	resp := api.TopBuyersResponse{SaleID: req.SaleID, Buyers: make([]api.TopBuyer, len(buyers))}
+	for i, b := range buyers {
+		resp.Buyers[i] = api.TopBuyer{UserID: b.UserID, Purchases: max(b.Purchases, live[b.UserID])}
+	}
+	sort.SliceStable(resp.Buyers, func(i, j int) bool {
+		return resp.Buyers[i].Purchases > resp.Buyers[j].Purchases
+	})
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,297 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/codes"
+	"flash_sale_contest/internal/database"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	// apiKeyPrefix starts every key, so a leaked one is easy to spot.
+	apiKeyPrefix = "fsk_"
+	// apiKeyLookupTTL is how long a key, or its absence, is cached; a
+	// revoked key is refused by every replica within it.
+	apiKeyLookupTTL = 10 * time.Second
+	// maxAPIKeySales bounds the sales one key is scoped to.
+	maxAPIKeySales = 100
+)
+
+var apiKeyScopes = []string{database.APIKeyScopeStats, database.APIKeyScopeCheckout}
+
+// apiKeyLookup is a key as read from Postgres; key is nil when there was
+// none.
+type apiKeyLookup struct {
+	key *database.APIKey
+	at  time.Time
+}
+
+// apiKeyCache keeps keys for apiKeyLookupTTL, so kiosk checkouts do not
+// each read theirs from Postgres. Stale lookups are swept at most once per
+// apiKeyLookupTTL.
+type apiKeyCache struct {
+	mu      sync.Mutex
+	lookups map[string]apiKeyLookup
+	swept   time.Time
+}
+
+// parseAPIKey splits a key, "fsk_<key_id>.<secret>", into its ID and
+// secret.
+func parseAPIKey(raw string) (id, secret string, ok bool) {
+	rest, ok := strings.CutPrefix(raw, apiKeyPrefix)
+	if !ok {
+		return "", "", false
+	}
+	id, secret, ok = strings.Cut(rest, ".")
+	return id, secret, ok && id != "" && secret != ""
+}
+
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookupAPIKey returns the tenant's key raw is, or nil when raw is not a
+// key of the tenant or its secret does not match.
+func (s *Server) lookupAPIKey(ctx context.Context, raw string) (*database.APIKey, error) {
+	if key, cached := s.cachedAPIKey(raw); cached {
+		return key, nil
+	}
+
+	id, secret, _ := parseAPIKey(raw)
+	key, err := s.db.GetAPIKey(ctx, id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	l := apiKeyLookup{key: key, at: time.Now()}
+
+	c := &s.apiKeys
+	c.mu.Lock()
+	if c.lookups == nil {
+		c.lookups = make(map[string]apiKeyLookup)
+	}
+	if time.Since(c.swept) >= apiKeyLookupTTL {
+		for k, old := range c.lookups {
+			if time.Since(old.at) >= apiKeyLookupTTL {
+				delete(c.lookups, k)
+			}
+		}
+		c.swept = time.Now()
+	}
+	c.lookups[id] = l
+	c.mu.Unlock()
+
+	return l.verify(secret), nil
+}
+
+// cachedAPIKey is lookupAPIKey without Postgres: cached reports whether
+// raw is malformed or its lookup is cached on this replica, and key is
+// then what lookupAPIKey would return.
+func (s *Server) cachedAPIKey(raw string) (key *database.APIKey, cached bool) {
+	id, secret, ok := parseAPIKey(raw)
+	if !ok {
+		return nil, true
+	}
+
+	s.apiKeys.mu.Lock()
+	l, ok := s.apiKeys.lookups[id]
+	s.apiKeys.mu.Unlock()
+	if !ok || time.Since(l.at) >= apiKeyLookupTTL {
+		return nil, false
+	}
+	return l.verify(secret), true
+}
+
+// verify returns the looked up key if secret is its secret, or nil.
+func (l apiKeyLookup) verify(secret string) *database.APIKey {
+	if l.key == nil || subtle.ConstantTimeCompare([]byte(hashAPIKeySecret(secret)), []byte(l.key.SecretHash)) != 1 {
+		return nil
+	}
+	return l.key
+}
+
+// forgetAPIKey drops a key from this replica's cache.
+func (s *Server) forgetAPIKey(id string) {
+	s.apiKeys.mu.Lock()
+	delete(s.apiKeys.lookups, id)
+	s.apiKeys.mu.Unlock()
+}
+
+// authorizeAPIKey checks the key in the X-API-Key header against scope and,
+// unless empty, saleID. It answers the request itself and returns false
+// when the key is unknown or not scoped to them; every use of a known key
+// is counted in its metrics.
+func (s *Server) authorizeAPIKey(w http.ResponseWriter, r *http.Request, scope, saleID string) bool {
+	key, err := s.lookupAPIKey(r.Context(), r.Header.Get(apiKeyHeader))
+	if err != nil {
+		log.Printf("Failed to look up API key: %v", err)
+		writeError(w, r, "Failed to check API key", http.StatusServiceUnavailable)
+		return false
+	}
+	if key == nil {
+		w.Header().Set("WWW-Authenticate", `APIKey realm="partner"`)
+		writeError(w, r, "Invalid API key", http.StatusUnauthorized)
+		return false
+	}
+
+	allowed := slices.Contains(key.Scopes, scope) && (saleID == "" || slices.Contains(key.SaleIDs, saleID))
+	s.metrics.RecordAPIKeyRequest(key.ID, allowed)
+	if !allowed {
+		writeError(w, r, "API key not allowed for "+scope+" in this sale", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// adminOrAPIKey guards a route of one sale, named by its sale_id path
+// value, with adminAuth, or with an API key scoped to scope in that sale
+// when the request carries one.
+func (s *Server) adminOrAPIKey(scope string, next http.HandlerFunc) http.HandlerFunc {
+	admin := s.admin(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(apiKeyHeader) == "" {
+			admin(w, r)
+			return
+		}
+		if s.authorizeAPIKey(w, r, scope, r.PathValue("sale_id")) {
+			next(w, r)
+		}
+	}
+}
+
+// kiosk lets a checkout or purchase route be called with an API key scoped
+// to checkouts in the running sale. Requests without a key are let through
+// as before.
+func (s *Server) kiosk(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(apiKeyHeader) == "" {
+			next(w, r)
+			return
+		}
+		saleID := ""
+		if activeSale := s.saleManager.GetCurrentSale(); activeSale != nil {
+			saleID = activeSale.SaleID
+		}
+		if s.authorizeAPIKey(w, r, database.APIKeyScopeCheckout, saleID) {
+			next(w, r)
+		}
+	}
+}
+
+// createAPIKeyHandler issues an API key. Its secret is generated here and
+// only ever returned once, as part of the key.
+func (s *Server) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.CreateAPIKeyRequest{Key: &api.NewAPIKey{}}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req.Key); err != nil {
+		writeError(w, r, "Body must be a JSON object with name, sale_ids and scopes", http.StatusBadRequest)
+		return
+	}
+	if req.Key.Name == "" || len(req.Key.Name) > 100 {
+		writeError(w, r, "name must be 1-100 characters", http.StatusBadRequest)
+		return
+	}
+	var saleIDs, scopes []string
+	for _, id := range req.Key.SaleIDs {
+		if !slices.Contains(saleIDs, id) {
+			saleIDs = append(saleIDs, id)
+		}
+	}
+	if len(saleIDs) == 0 || len(saleIDs) > maxAPIKeySales {
+		writeError(w, r, "sale_ids must name 1-100 sales", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Key.Scopes {
+		if !slices.Contains(apiKeyScopes, scope) {
+			writeError(w, r, "Unknown scope "+scope+", scopes are stats and checkout", http.StatusBadRequest)
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		writeError(w, r, "scopes must name stats, checkout or both", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	for _, id := range saleIDs {
+		if _, err := s.db.GetSale(ctx, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				writeError(w, r, "Sale not found: "+id, http.StatusNotFound)
+				return
+			}
+			writeError(w, r, "Failed to load sale", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	secret := codes.NewID()
+	key := &database.APIKey{ID: codes.NewID(), Name: req.Key.Name, SaleIDs: saleIDs, Scopes: scopes, SecretHash: hashAPIKeySecret(secret)}
+	if err := s.db.CreateAPIKey(ctx, key); err != nil {
+		log.Printf("Failed to create API key %q: %v", req.Key.Name, err)
+		writeError(w, r, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("API key %s (%s) issued for %s in %d sales", key.ID, key.Name, strings.Join(scopes, ", "), len(saleIDs))
+
+	resp := apiAPIKey(key)
+	resp.Key = apiKeyPrefix + key.ID + "." + secret
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// apiKeysHandler lists the API keys, without their secrets.
+func (s *Server) apiKeysHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeAPIKeys(w, r)
+}
+
+// deleteAPIKeyHandler revokes an API key and lists the others. Other
+// replicas may accept it for up to apiKeyLookupTTL.
+func (s *Server) deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.DeleteAPIKeyRequest{KeyID: r.PathValue("key_id")}
+	if err := s.db.DeleteAPIKey(r.Context(), req.KeyID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, "API key not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, r, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+	s.forgetAPIKey(req.KeyID)
+	log.Printf("API key %s revoked", req.KeyID)
+	s.writeAPIKeys(w, r)
+}
+
+func (s *Server) writeAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.db.ListAPIKeys(r.Context())
+	if err != nil {
+		writeError(w, r, "Failed to list API keys", http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.APIKeysResponse{Keys: []api.APIKey{}}
+	for i := range keys {
+		resp.Keys = append(resp.Keys, apiAPIKey(&keys[i]))
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+func apiAPIKey(k *database.APIKey) api.APIKey {
+	return api.APIKey{KeyID: k.ID, Name: k.Name, SaleIDs: k.SaleIDs, Scopes: k.Scopes, CreatedAt: k.CreatedAt}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/attempts"
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/config"
+	"flash_sale_contest/internal/database"
+)
+
+// startAttemptLog starts the store of checkout attempts chosen by
+// ATTEMPT_LOG. A sold-out rush refuses far more checkouts than the database
+// could take one insert at a time, so attempts are written in batches off
+// the request path, or parked in a Redis stream, or dropped. Tenants share
+// the store.
+func (s *Server) startAttemptLog(ctx context.Context) {
+	hooks := attempts.Hooks{
+		Dropped: s.metrics.IncrementAttemptsDropped,
+		Failed:  s.onAttemptsFailed,
+	}
+	mode := config.Get().AttemptLog
+	attemptLog, err := attempts.NewSwitch(ctx, mode, s.db, s.cache, s.saleManager.InstanceID(), hooks)
+	if err != nil {
+		log.Printf("%v, logging checkout attempts to %s", err, attempts.ModePostgres)
+		attemptLog, _ = attempts.NewSwitch(ctx, attempts.ModePostgres, s.db, s.cache, s.saleManager.InstanceID(), hooks)
+	}
+	s.attemptLog = attemptLog
+}
+
+// onAttemptsFailed parks the successful checkouts of a batch the database
+// refused in the dead letter queue, where they can be replayed. Refused
+// checkouts are only counted.
+func (s *Server) onAttemptsFailed(batch []*database.CheckoutAttempt, writeErr error) {
+	refused := 0
+	for _, attempt := range batch {
+		if attempt.FailureReason != "" {
+			refused++
+			continue
+		}
+		s.parkFailedWrite(cache.DeadLetterCheckoutAttempt, attempt, writeErr)
+	}
+	if refused > 0 {
+		log.Printf("Failed to log %d failed checkout attempts: %v", refused, writeErr)
+	}
+}
+
+// logCheckout stores a checkout attempt.
+func (s *Server) logCheckout(attempt *database.CheckoutAttempt) {
+	if s.attemptLog != nil {
+		s.attemptLog.Log(attempt)
+	}
+}
+
+// logFailedCheckout stores a refused checkout.
+func (s *Server) logFailedCheckout(saleID, userID, itemID, reason string) {
+	s.logCheckout(&database.CheckoutAttempt{
+		SaleID:        saleID,
+		UserID:        userID,
+		ItemID:        itemID,
+		FailureReason: reason,
+	})
+}
+
+// checkoutFailureReason maps a reservation error to its failure reason.
+func checkoutFailureReason(err error) string {
+	switch err.Error() {
+	case "sold out":
+		return database.FailureSoldOut
+	case "category sold out":
+		return database.FailureCategorySoldOut
+	case "item already reserved":
+		return database.FailureItemReserved
+	case "user limit exceeded":
+		return database.FailureUserLimit
+	case "rarity limit exceeded":
+		return database.FailureRarityLimit
+	case "too many outstanding codes":
+		return database.FailureTooManyCodes
+	case "sale closing":
+		return database.FailureSaleClosing
+	case "unknown category", "item not in category", "unknown user", "items not numbered":
+		return database.FailureInvalidRequest
+	case "invalid promo code", "promo code expired", "promo code exhausted":
+		return database.FailurePromo
+	}
+	if errors.Is(err, cache.ErrTimeout) {
+		return database.FailureCacheTimeout
+	}
+	return database.FailureError
+}
+
+// logRateLimited records a rate-limited checkout against the current sale
+// of the request's tenant. Rate-limited purchases are not checkout attempts.
+func (s *Server) logRateLimited(r *http.Request, userID string) {
+	if r.URL.Path != "/checkout" || userID == "" {
+		return
+	}
+	t, ok := s.requestTenant(r)
+	if !ok {
+		return
+	}
+	if activeSale := t.saleManager.GetCurrentSale(); activeSale != nil {
+		t.logFailedCheckout(activeSale.SaleID, userID, r.URL.Query().Get("id"), database.FailureRateLimited)
+	}
+}
+
+// setAttemptLogHandler switches where this replica stores checkout
+// attempts, so the write load of a rush can be moved off Postgres.
+func (s *Server) setAttemptLogHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.AttemptLogRequest{Mode: r.URL.Query().Get("mode")}
+	if err := s.attemptLog.Set(req.Mode); err != nil {
+		writeError(w, r, "mode must be postgres, stream or none", http.StatusBadRequest)
+		return
+	}
+	s.attemptLogHandler(w, r)
+}
+
+// attemptLogHandler reports where this replica stores checkout attempts.
+func (s *Server) attemptLogHandler(w http.ResponseWriter, r *http.Request) {
+	backlog, err := s.cache.CheckoutAttemptBacklog(r.Context())
+	if err != nil {
+		log.Printf("Warning: could not read the checkout attempt backlog: %v", err)
+	}
+
+	resp := api.AttemptLogResponse{Mode: s.attemptLog.Mode(), StreamBacklog: backlog}
+	writeJSON(w, r, http.StatusOK, resp)
+}
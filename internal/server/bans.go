@@ -0,0 +1,132 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/database"
+)
+
+// unbanned refuses checkouts and purchases whose user_id is banned.
+// Purchases need not name their user, so the purchase script checks the
+// owner of the code too. Like the rate limits, it lets requests through
+// when Redis cannot be asked.
+func (s *Server) unbanned(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if userID := r.URL.Query().Get("user_id"); userID != "" {
+			if banned, err := s.cache.IsUserBanned(r.Context(), userID); err == nil && banned {
+				s.metrics.IncrementBannedRequests()
+				writeError(w, r, "User is banned", http.StatusForbidden)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// bansHandler lists the banned users.
+func (s *Server) bansHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeBans(w, r)
+}
+
+// banUserHandler bans a user from checking out and purchasing, and lists
+// the banned users. The user's purchases are kept until they are revoked.
+func (s *Server) banUserHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.BanUserRequest{UserID: r.PathValue("user_id")}
+	added, err := s.cache.BanUser(r.Context(), req.UserID)
+	if err != nil {
+		writeError(w, r, "Failed to ban user", http.StatusInternalServerError)
+		return
+	}
+	if added {
+		log.Printf("User %s banned", req.UserID)
+	}
+	s.writeBans(w, r)
+}
+
+// unbanUserHandler lifts a ban and lists the users still banned.
+func (s *Server) unbanUserHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.UnbanUserRequest{UserID: r.PathValue("user_id")}
+	removed, err := s.cache.UnbanUser(r.Context(), req.UserID)
+	if err != nil {
+		writeError(w, r, "Failed to lift ban", http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		writeError(w, r, "User is not banned", http.StatusNotFound)
+		return
+	}
+	log.Printf("Ban of user %s lifted", req.UserID)
+	s.writeBans(w, r)
+}
+
+func (s *Server) writeBans(w http.ResponseWriter, r *http.Request) {
+	users, err := s.cache.BannedUsers(r.Context())
+	if err != nil {
+		writeError(w, r, "Failed to list bans", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, api.BansResponse{UserIDs: append([]string{}, users...)})
+}
+
+// revokePurchasesHandler takes back the purchases a user made or was gifted
+// in a sale. While the sale runs, each item goes back on sale: it is
+// credited to the inventory and uncounted from its owner, as when a
+// payment fails, and the ledger records it moving from sold to available.
+// Purchases still queued for the database are not seen; ban the user first
+// and revoke once the write queue has drained.
+func (s *Server) revokePurchasesHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.RevokePurchasesRequest{SaleID: r.PathValue("sale_id"), UserID: r.PathValue("user_id")}
+	ctx := r.Context()
+
+	if _, err := s.db.GetSale(ctx, req.SaleID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, "Sale not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, r, "Failed to load sale", http.StatusInternalServerError)
+		return
+	}
+
+	purchases, err := s.db.RevokePurchases(ctx, req.SaleID, req.UserID)
+	if err != nil {
+		log.Printf("Failed to revoke the purchases of %s in sale %s: %v", req.UserID, req.SaleID, err)
+		writeError(w, r, "Failed to revoke purchases", http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.RevokePurchasesResponse{SaleID: req.SaleID, UserID: req.UserID, Revoked: []api.RevokedPurchase{}}
+	activeSale := s.saleManager.GetCurrentSale()
+	running := activeSale != nil && activeSale.SaleID == req.SaleID
+	for _, p := range purchases {
+		resp.Revoked = append(resp.Revoked, api.RevokedPurchase{
+			PurchaseID:      p.ID,
+			ItemID:          p.ItemID,
+			Unit:            p.Unit,
+			UserID:          p.UserID,
+			RecipientUserID: p.RecipientID,
+			PurchasedAt:     p.PurchaseTime,
+		})
+		if !running {
+			continue
+		}
+		owner := p.UserID
+		if p.RecipientID != "" {
+			owner = p.RecipientID
+		}
+		// The item's category is counted back in, as every reservation
+		// counts its item's category down.
+		if err := s.cache.RevokePurchase(ctx, req.SaleID, owner, p.ItemID, p.PromoCode); err != nil {
+			log.Printf("Failed to return item %s of revoked purchase %s to sale %s: %v", p.ItemID, p.ID, req.SaleID, err)
+			continue
+		}
+		s.recordMovement(database.MovementRevoke, req.SaleID, owner, p.ItemID)
+		resp.ReturnedToInventory++
+	}
+	log.Printf("Revoked %d purchases of %s in sale %s, %d items back on sale", len(resp.Revoked), req.UserID, req.SaleID, resp.ReturnedToInventory)
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"flash_sale_contest/internal/config"
+)
+
+// clientIP returns the address of the client behind r. Forwarding headers
+// are only believed when the direct peer is a trusted proxy; X-Forwarded-For
+// is then read right to left, skipping trusted hops, so a client cannot
+// spoof its address by prepending entries.
+func clientIP(r *http.Request) string {
+	peer := remoteAddr(r)
+	trusted := config.Get().TrustedProxies
+	if !peer.IsValid() || !isTrusted(peer, trusted) {
+		return peer.String()
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				break
+			}
+			addr = addr.Unmap()
+			if !isTrusted(addr, trusted) {
+				return addr.String()
+			}
+		}
+	}
+
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return realIP.Unmap().String()
+	}
+	return peer.String()
+}
+
+func remoteAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"flash_sale_contest/internal/config"
+)
+
+// encodingWriter is what gzip and zlib writers have in common. The
+// deflate content coding is zlib's format, not raw deflate.
+type encodingWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressor is a pooled encodingWriter, made at level.
+type compressor struct {
+	encodingWriter
+	level int
+}
+
+var compressors = map[string]*sync.Pool{"gzip": {}, "deflate": {}}
+
+// getCompressor returns a writer that compresses into w with encoding, at
+// RESPONSE_COMPRESS_LEVEL. Pooled writers made at another level are
+// dropped, so a reloaded level applies from the next response on.
+func getCompressor(encoding string, w io.Writer) *compressor {
+	level := config.Get().ResponseCompressLevel
+	if c, ok := compressors[encoding].Get().(*compressor); ok && c.level == level {
+		c.Reset(w)
+		return c
+	}
+	c := &compressor{level: level}
+	if encoding == "gzip" {
+		c.encodingWriter, _ = gzip.NewWriterLevel(w, level)
+	} else {
+		c.encodingWriter, _ = zlib.NewWriterLevel(w, level)
+	}
+	return c
+}
+
+// putCompressor returns a closed compressor to its pool.
+func putCompressor(encoding string, c *compressor) {
+	compressors[encoding].Put(c)
+}
+
+// responseEncoding picks the encoding a body of contentType and size bytes
+// goes out in: the first encoding of RESPONSE_COMPRESSION the client
+// accepts, or "" to send it as it is. Streamed bodies pass a size of -1
+// and skip the size threshold. Bodies that could be compressed vary by
+// Accept-Encoding, whether this one is or not.
+func responseEncoding(w http.ResponseWriter, r *http.Request, contentType string, size int) string {
+	cfg := config.Get()
+	if cfg.ResponseCompressMinBytes <= 0 || size >= 0 && size < cfg.ResponseCompressMinBytes {
+		return ""
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	if !slices.Contains(cfg.ResponseCompressTypes, strings.TrimSpace(mediaType)) {
+		return ""
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	header := r.Header.Get("Accept-Encoding")
+	for _, encoding := range cfg.ResponseCompression {
+		if encoding != "none" && acceptsEncoding(header, encoding) {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header accepts
+// encoding, by name or through *, with a q-value above 0.
+func acceptsEncoding(header, encoding string) bool {
+	wildcard := false
+	for _, coding := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(coding), ";")
+		name = strings.TrimSpace(name)
+		accepted := true
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			weight, err := strconv.ParseFloat(q, 64)
+			accepted = err == nil && weight > 0
+		}
+		if strings.EqualFold(name, encoding) {
+			return accepted
+		}
+		if name == "*" {
+			wildcard = accepted
+		}
+	}
+	return wildcard
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"flash_sale_contest/internal/config"
+)
+
+// adminCORSRoutes are the operator routes, which allow no origin unless
+// CORS_ROUTE_ORIGINS lists them.
+var adminCORSRoutes = []string{"/admin/", "/sale/analytics"}
+
+// corsPolicy is the set of browser origins one group of routes answers.
+type corsPolicy struct {
+	origins     []string
+	anyOrigin   bool
+	credentials bool
+}
+
+func newCORSPolicy(origins []string, credentials bool) corsPolicy {
+	return corsPolicy{
+		origins:     origins,
+		anyOrigin:   slices.Contains(origins, "*"),
+		credentials: credentials,
+	}
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or
+// "" when the origin is not allowed. Credentialed policies only ever echo
+// an origin they list by name.
+func (p corsPolicy) allowOrigin(origin string) string {
+	if slices.Contains(p.origins, origin) {
+		return origin
+	}
+	if p.anyOrigin && !p.credentials {
+		return "*"
+	}
+	return ""
+}
+
+// corsMiddleware answers preflights and adds CORS headers for the origins
+// CORS_ALLOWED_ORIGINS allows, or CORS_ROUTE_ORIGINS for the request's
+// route. Requests from other origins get no CORS headers, so browsers
+// refuse to hand the response to their scripts.
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	cfg := config.Get()
+	methods := strings.Join(cfg.CORSAllowedMethods, ", ")
+	headers := strings.Join(cfg.CORSAllowedHeaders, ", ")
+	exposed := strings.Join(cfg.CORSExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.CORSMaxAge.Seconds()))
+
+	defaultPolicy := newCORSPolicy(cfg.CORSAllowedOrigins, cfg.CORSAllowCredentials)
+	routePolicies := make(map[string]corsPolicy)
+	for _, route := range adminCORSRoutes {
+		routePolicies[route] = newCORSPolicy(nil, cfg.CORSAllowCredentials)
+	}
+	for route, origins := range cfg.CORSRouteOrigins {
+		routePolicies[route] = newCORSPolicy(origins, cfg.CORSAllowCredentials)
+	}
+	policyFor := func(path string) corsPolicy {
+		longest, policy := -1, defaultPolicy
+		for route, p := range routePolicies {
+			if strings.HasPrefix(path, route) && len(route) > longest {
+				longest, policy = len(route), p
+			}
+		}
+		return policy
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		origin := r.Header.Get("Origin")
+		policy := policyFor(r.URL.Path)
+		if allowed := policy.allowOrigin(origin); origin != "" && allowed != "" {
+			h.Set("Access-Control-Allow-Origin", allowed)
+			if policy.credentials && allowed != "*" {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if preflight {
+				h.Set("Access-Control-Allow-Methods", methods)
+				h.Set("Access-Control-Allow-Headers", headers)
+				h.Set("Access-Control-Max-Age", maxAge)
+			} else if exposed != "" {
+				h.Set("Access-Control-Expose-Headers", exposed)
+			}
+		}
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	runtimepprof "runtime/pprof"
+	"time"
+
+	"flash_sale_contest/internal/config"
+)
+
+// startDebugServer serves pprof, expvar and a goroutine dump on a separate
+// listener behind admin authentication, so live profiling never shares the
+// public port. It is off unless DEBUG_ADDR and an admin credential are set.
+func (s *Server) startDebugServer() {
+	cfg := config.Get()
+	if cfg.DebugAddr == "" {
+		return
+	}
+	if cfg.AdminToken == "" && cfg.AdminHMACSecret == "" {
+		log.Printf("Debug listener disabled: DEBUG_ADDR is set but neither ADMIN_TOKEN nor ADMIN_HMAC_SECRET is")
+		return
+	}
+
+	expvar.Publish("flash_sale", expvar.Func(func() interface{} {
+		return s.metrics.GetStats()
+	}))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/goroutines", goroutinesHandler)
+
+	// No write timeout: CPU profiles and traces stream for as long as the
+	// caller asks.
+	debugServer := &http.Server{
+		Addr:              cfg.DebugAddr,
+		Handler:           s.adminAuth(mux),
+		ReadHeaderTimeout: 5 * time.Second,
+		IdleTimeout:       time.Minute,
+	}
+
+	go func() {
+		log.Printf("Debug listener on %s", cfg.DebugAddr)
+		if err := debugServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Debug listener stopped: %v", err)
+		}
+	}()
+}
+
+// goroutinesHandler dumps every goroutine's full stack as plain text.
+func goroutinesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	runtimepprof.Lookup("goroutine").WriteTo(w, 2)
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/codes"
+	"flash_sale_contest/internal/database"
+)
+
+// parkFailedWrite moves a database write that failed off the request path
+// into the dead letter queue, so it can be replayed once the database
+// recovers instead of being lost.
+func (s *Server) parkFailedWrite(kind string, payload interface{}, writeErr error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to encode dead letter %s: %v", kind, err)
+		return
+	}
+
+	d := &cache.DeadLetter{
+		ID:       codes.NewID(),
+		Kind:     kind,
+		Payload:  data,
+		Error:    writeErr.Error(),
+		Attempts: 1,
+		FailedAt: time.Now(),
+	}
+	if err := s.cache.PushDeadLetter(context.Background(), d); err != nil {
+		log.Printf("Failed to park %s in dead letter queue: %v (payload %s)", kind, err, data)
+		return
+	}
+	s.metrics.IncrementDeadLetters()
+}
+
+// replayDeadLetters retries up to limit parked writes, oldest first. Writes
+// that fail again go back to the end of the queue.
+func (s *Server) replayDeadLetters(ctx context.Context, limit int) (replayed, failed int, err error) {
+	for i := 0; i < limit; i++ {
+		d, err := s.cache.PopDeadLetter(ctx)
+		if errors.Is(err, redis.Nil) {
+			break
+		}
+		if err != nil {
+			return replayed, failed, err
+		}
+
+		if writeErr := s.applyDeadLetter(ctx, d); writeErr != nil {
+			failed++
+			d.Attempts++
+			d.Error = writeErr.Error()
+			d.FailedAt = time.Now()
+			if err := s.cache.PushDeadLetter(ctx, d); err != nil {
+				log.Printf("Lost dead letter %s while requeueing: %v (payload %s)", d.ID, err, d.Payload)
+			}
+			continue
+		}
+		replayed++
+	}
+	return replayed, failed, nil
+}
+
+func (s *Server) applyDeadLetter(ctx context.Context, d *cache.DeadLetter) error {
+	switch d.Kind {
+	case cache.DeadLetterCheckoutAttempt:
+		var attempt database.CheckoutAttempt
+		if err := json.Unmarshal(d.Payload, &attempt); err != nil {
+			return err
+		}
+		return s.db.LogCheckoutAttempt(ctx, &attempt)
+	case cache.DeadLetterPurchase:
+		var purchase database.Purchase
+		if err := json.Unmarshal(d.Payload, &purchase); err != nil {
+			return err
+		}
+		return s.db.CreatePurchase(ctx, &purchase)
+	case cache.DeadLetterPurchaseDetails:
+		var details database.PurchaseDetails
+		if err := json.Unmarshal(d.Payload, &details); err != nil {
+			return err
+		}
+		return s.db.SavePurchaseDetails(ctx, &details)
+	case cache.DeadLetterInventoryMovement:
+		var m database.InventoryMovement
+		if err := json.Unmarshal(d.Payload, &m); err != nil {
+			return err
+		}
+		return s.db.RecordInventoryMovement(ctx, &m)
+	}
+	return fmt.Errorf("unknown dead letter kind %q", d.Kind)
+}
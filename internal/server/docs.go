@@ -0,0 +1,29 @@
+package server
+
+import (
+	"net/http"
+
+	"flash_sale_contest/internal/api"
+)
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>Flash Sale Contest API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>`
+
+func (s *Server) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, api.Spec())
+}
+
+func (s *Server) docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIPage))
+}
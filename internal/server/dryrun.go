@@ -0,0 +1,320 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/config"
+	"flash_sale_contest/internal/sale"
+	"flash_sale_contest/internal/slo"
+)
+
+const (
+	// dryRunLock is the lease a dry run holds on the sandbox, so replicas
+	// take turns playing in it.
+	dryRunLock = "dry_run"
+	// dryRunSandbox names the key namespace dry runs play in, see
+	// cache.Options.Sandbox.
+	dryRunSandbox = "__dry_run"
+	// dryRunCleanupTimeout bounds deleting the sandbox keys after a dry
+	// run.
+	dryRunCleanupTimeout = time.Minute
+)
+
+// dryRunHandler plays a sale in a sandbox key namespace of the sales'
+// Redis: items are generated as for a sale without a catalog, the sale is
+// initialized, and synthetic users check out and buy until it sells out or
+// they reach MAX_PER_USER. Nothing is written to Postgres, and the sandbox
+// keeps its users and codes apart from the real ones. The run is scored by
+// how many of its checkouts and purchases met their SLO latencies, and
+// scores 0 when the sale oversold, sold an item twice or let a user past
+// the cap. The keys it left are deleted afterwards.
+func (s *Server) dryRunHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := config.Get()
+	req := api.DryRunRequest{Items: cfg.DryRunItems, Users: cfg.DryRunUsers, Concurrency: cfg.DryRunConcurrency}
+	query := r.URL.Query()
+	for _, p := range []struct {
+		name  string
+		value *int
+		max   int
+	}{
+		{"items", &req.Items, config.MaxDryRunItems},
+		{"users", &req.Users, config.MaxDryRunUsers},
+		{"concurrency", &req.Concurrency, config.MaxDryRunConcurrency},
+	} {
+		raw := query.Get(p.name)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > p.max {
+			writeError(w, r, fmt.Sprintf("%s must be between 1 and %d", p.name, p.max), http.StatusBadRequest)
+			return
+		}
+		*p.value = v
+	}
+
+	opts := cache.OptionsFromEnv()
+	opts.Sandbox = dryRunSandbox
+	opts.StandbyAddr = ""
+	opts.PoolSize = req.Concurrency
+	opts.MinIdleConns = 0
+	sandbox, err := cache.NewService(opts)
+	if err != nil {
+		log.Printf("Failed to open the dry-run sandbox: %v", err)
+		writeError(w, r, "Dry-run sandbox unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer sandbox.Close()
+
+	ctx := r.Context()
+	owner := s.saleManager.InstanceID()
+	if _, ok, err := sandbox.AcquireLeadership(ctx, dryRunLock, owner, exportRouteTimeout); err != nil {
+		writeError(w, r, "Dry-run sandbox unavailable", http.StatusServiceUnavailable)
+		return
+	} else if !ok {
+		writeError(w, r, "A dry run is already running", http.StatusConflict)
+		return
+	}
+	saleID := fmt.Sprintf("dryrun_%d", time.Now().UnixNano())
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), dryRunCleanupTimeout)
+		defer cancel()
+		if _, err := sandbox.DeleteSandboxSale(cleanupCtx, saleID); err != nil {
+			log.Printf("Failed to delete dry run %s: %v", saleID, err)
+		}
+		sandbox.ReleaseLeadership(cleanupCtx, dryRunLock, owner)
+	}()
+
+	// The run can outlast the server-wide write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	resp, err := dryRun(ctx, sandbox, saleID, req)
+	if err != nil {
+		log.Printf("Dry run failed: %v", err)
+		writeError(w, r, "Dry run failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Dry run %s sold %d of %d items to %d users in %dms, readiness score %.1f", resp.SaleID, resp.Purchases, resp.Items, resp.Users, resp.TrafficMs, resp.Score)
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// dryRunDriver is the synthetic traffic of a dry run: each user checks out
+// any available item and buys it at once, until refused.
+type dryRunDriver struct {
+	sandbox   cache.Service
+	saleID    string
+	codeTTL   time.Duration
+	checkouts *slo.Tracker
+	purchases *slo.Tracker
+
+	mu sync.Mutex
+	// checkoutLatencies and purchaseLatencies are those of the successful
+	// calls; sold lists the items bought, once per purchase.
+	checkoutLatencies []time.Duration
+	purchaseLatencies []time.Duration
+	reservations      int
+	sold              []string
+}
+
+// run plays one user.
+func (d *dryRunDriver) run(ctx context.Context, userID string) {
+	for ctx.Err() == nil {
+		start := time.Now()
+		reservation, err := d.sandbox.ReserveItem(ctx, d.saleID, userID, "", "", "", d.codeTTL)
+		checkout := time.Since(start)
+		// Refusals answer the checkout; only errors fail it
+		d.checkouts.Record(checkout, cache.ReservationOutcome(err) == cache.ReservationError)
+		if err != nil {
+			return
+		}
+		d.mu.Lock()
+		d.reservations++
+		d.checkoutLatencies = append(d.checkoutLatencies, checkout)
+		d.mu.Unlock()
+
+		start = time.Now()
+		info, err := d.sandbox.CompletePurchase(ctx, d.saleID, reservation.Code, "")
+		if err == nil {
+			err = d.sandbox.MarkItemAsSold(ctx, d.saleID, cache.ItemNumber(d.saleID, info.ItemID))
+		}
+		purchase := time.Since(start)
+		d.purchases.Record(purchase, err != nil)
+		if err != nil {
+			return
+		}
+		d.mu.Lock()
+		d.purchaseLatencies = append(d.purchaseLatencies, purchase)
+		d.sold = append(d.sold, info.ItemID)
+		d.mu.Unlock()
+	}
+}
+
+// dryRun generates and initializes sale saleID in sandbox, drives req's
+// traffic through it and checks what it left behind.
+func dryRun(ctx context.Context, sandbox cache.Service, saleID string, req api.DryRunRequest) (*api.DryRunResponse, error) {
+	cfg := config.Get()
+	start := time.Now()
+	resp := &api.DryRunResponse{SaleID: saleID, Items: req.Items, Users: req.Users, Concurrency: req.Concurrency}
+
+	items := sale.GenerateItems(saleID, 0, req.Items)
+	itemInfos := make([]cache.ItemInfo, len(items))
+	categoryCounts := make(map[string]int)
+	for i, item := range items {
+		itemInfos[i] = cache.ItemInfo{ItemID: item.ItemID, Name: item.Name, ImageURL: item.ImageURL, Category: item.Category, PriceMinor: item.PriceMinor, Currency: item.Currency, Rarity: item.Rarity}
+		categoryCounts[item.Category]++
+	}
+	if err := sandbox.SetItems(ctx, saleID, itemInfos); err != nil {
+		return nil, fmt.Errorf("could not cache the items: %w", err)
+	}
+	if err := sandbox.InitializeSale(ctx, saleID, len(items), categoryCounts); err != nil {
+		return nil, err
+	}
+	userIDs := make([]string, req.Users)
+	for i := range userIDs {
+		userIDs[i] = fmt.Sprintf("%s_user_%06d", saleID, i+1)
+	}
+	if err := sandbox.RegisterUsers(ctx, userIDs...); err != nil {
+		return nil, fmt.Errorf("could not register the users: %w", err)
+	}
+
+	driver := &dryRunDriver{
+		sandbox:   sandbox,
+		saleID:    saleID,
+		codeTTL:   cfg.CheckoutCodeTTL,
+		checkouts: slo.New(exportRouteTimeout, slo.Objective{Latency: cfg.SLOCheckoutLatency, Target: cfg.SLOTarget}),
+		purchases: slo.New(exportRouteTimeout, slo.Objective{Latency: cfg.SLOPurchaseLatency, Target: cfg.SLOTarget}),
+	}
+	users := make(chan string)
+	var wg sync.WaitGroup
+	trafficStart := time.Now()
+	for range req.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for userID := range users {
+				driver.run(ctx, userID)
+			}
+		}()
+	}
+	for _, userID := range userIDs {
+		users <- userID
+	}
+	close(users)
+	wg.Wait()
+	resp.TrafficMs = time.Since(trafficStart).Milliseconds()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	resp.Reservations = driver.reservations
+	resp.Purchases = len(driver.sold)
+	checkouts := driver.checkouts.Status(0)
+	purchases := driver.purchases.Status(0)
+	resp.Checkout = dryRunLatency(checkouts, driver.checkoutLatencies)
+	resp.Purchase = dryRunLatency(purchases, driver.purchaseLatencies)
+	outcomes, err := sandbox.ReservationOutcomes(ctx, saleID)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the reservation outcomes: %w", err)
+	}
+	resp.Outcomes = outcomes
+
+	checks, err := dryRunChecks(ctx, sandbox, saleID, userIDs, len(items), driver)
+	if err != nil {
+		return nil, err
+	}
+	resp.Checks = checks
+	resp.Ready = true
+	for _, c := range checks {
+		resp.Ready = resp.Ready && c.Passed
+	}
+	if resp.Ready {
+		compliance := min(checkouts.Compliance, purchases.Compliance)
+		resp.Score = math.Round(compliance*1000) / 10
+		resp.Ready = compliance >= cfg.SLOTarget
+	}
+	resp.DurationMs = time.Since(start).Milliseconds()
+	return resp, nil
+}
+
+// dryRunChecks checks the invariants a sale must keep against the Redis
+// state the traffic left.
+func dryRunChecks(ctx context.Context, sandbox cache.Service, saleID string, userIDs []string, total int, driver *dryRunDriver) ([]api.DryRunCheck, error) {
+	cfg := config.Get()
+	maxPerUser := cfg.MaxPerUser
+	purchases := len(driver.sold)
+	var checks []api.DryRunCheck
+	check := func(name string, passed bool, format string, args ...any) {
+		checks = append(checks, api.DryRunCheck{Name: name, Passed: passed, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	remaining, err := sandbox.GetInventoryStatus(ctx, saleID)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the inventory: %w", err)
+	}
+	check("no_oversell", remaining >= 0 && driver.reservations <= total,
+		"%d of %d items reserved, %d left", driver.reservations, total, remaining)
+	check("inventory_balanced", remaining == total-driver.reservations,
+		"inventory counter at %d, %d expected", remaining, total-driver.reservations)
+
+	distinct := slices.Compact(slices.Sorted(slices.Values(driver.sold)))
+	check("no_double_sale", len(distinct) == purchases,
+		"%d purchases of %d distinct items", purchases, len(distinct))
+	soldNumbers, err := sandbox.SoldItemNumbers(ctx, saleID)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the sold items: %w", err)
+	}
+	check("sold_items_marked", len(soldNumbers) == purchases,
+		"%d items marked sold for %d purchases", len(soldNumbers), purchases)
+
+	counts, err := sandbox.GetUserPurchaseCounts(ctx, saleID, userIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the purchase counts: %w", err)
+	}
+	counted, most := 0, 0
+	for _, n := range counts {
+		counted += n
+		most = max(most, n)
+	}
+	check("user_cap_held", most <= maxPerUser,
+		"at most %d purchases per user, capped at %d", most, maxPerUser)
+	check("purchases_counted", counted == purchases,
+		"%d purchases counted for %d made", counted, purchases)
+
+	// Users keep buying until refused, so every item that the cap lets
+	// them own must have sold. A user refused an item of a capped rarity
+	// stops buying with room left, so rarity limits skip the check.
+	if len(cfg.RarityLimits) == 0 {
+		expected := min(total, len(userIDs)*maxPerUser)
+		check("sold_through", purchases == expected,
+			"%d of the %d items the users could own were sold", purchases, expected)
+	}
+	return checks, nil
+}
+
+func dryRunLatency(status slo.Status, latencies []time.Duration) api.DryRunLatency {
+	slices.Sort(latencies)
+	percentile := func(p float64) float64 {
+		if len(latencies) == 0 {
+			return 0
+		}
+		return float64(latencies[int(float64(len(latencies)-1)*p)].Microseconds()) / 1000
+	}
+	return api.DryRunLatency{
+		Requests:   status.Requests,
+		Failed:     status.Failed,
+		Slow:       status.Slow,
+		P50Ms:      percentile(0.5),
+		P99Ms:      percentile(0.99),
+		Compliance: status.Compliance,
+	}
+}
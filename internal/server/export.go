@@ -0,0 +1,241 @@
+package server
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/catalog"
+	"flash_sale_contest/internal/database"
+	"flash_sale_contest/internal/imagegen"
+	"flash_sale_contest/internal/money"
+)
+
+// exportFlushEvery is how many rows are written between flushes, so large
+// exports reach the client progressively.
+const exportFlushEvery = 1000
+
+// exportStream buffers the body of a streamed export, compressing it for
+// clients that accept it, and pushes what it holds to the client on flush.
+type exportStream struct {
+	*bufio.Writer
+	encoding string
+	c        *compressor
+	flusher  http.Flusher
+}
+
+// newExportStream starts the body of an export whose Content-Type is set;
+// the status and headers go out with its first flush.
+func newExportStream(w http.ResponseWriter, r *http.Request) *exportStream {
+	e := &exportStream{encoding: responseEncoding(w, r, w.Header().Get("Content-Type"), -1)}
+	e.flusher, _ = w.(http.Flusher)
+	if e.encoding == "" {
+		e.Writer = bufio.NewWriter(w)
+		return e
+	}
+	w.Header().Set("Content-Encoding", e.encoding)
+	e.c = getCompressor(e.encoding, w)
+	e.Writer = bufio.NewWriter(e.c)
+	return e
+}
+
+func (e *exportStream) flush() error {
+	if err := e.Writer.Flush(); err != nil {
+		return err
+	}
+	if e.c != nil {
+		if err := e.c.Flush(); err != nil {
+			return err
+		}
+	}
+	if e.flusher != nil {
+		e.flusher.Flush()
+	}
+	return nil
+}
+
+// close flushes the rest of the body and ends the compressed stream.
+func (e *exportStream) close() error {
+	if err := e.Writer.Flush(); err != nil {
+		return err
+	}
+	if e.c == nil {
+		return nil
+	}
+	err := e.c.Close()
+	putCompressor(e.encoding, e.c)
+	return err
+}
+
+// exportSaleHandler streams every purchase of a sale as CSV (the default)
+// or NDJSON, straight from a Postgres cursor.
+func (s *Server) exportSaleHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.SaleExportRequest{
+		SaleID: r.PathValue("sale_id"),
+		Format: r.URL.Query().Get("format"),
+	}
+	if req.Format == "" {
+		req.Format = "csv"
+	}
+	if req.Format != "csv" && req.Format != "ndjson" {
+		writeError(w, r, "format must be csv or ndjson", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if _, err := s.db.GetSale(ctx, req.SaleID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, "Sale not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, r, "Failed to load sale", http.StatusInternalServerError)
+		return
+	}
+
+	// The export can outlast the server-wide write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	contentType, ext := "text/csv", "csv"
+	if req.Format == "ndjson" {
+		contentType, ext = "application/x-ndjson", "ndjson"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-purchases.%s"`, req.SaleID, ext))
+
+	buf := newExportStream(w, r)
+
+	var write func(p *database.Purchase) error
+	switch req.Format {
+	case "csv":
+		cw := csv.NewWriter(buf)
+		cw.Write([]string{"user_id", "item_id", "purchase_time"})
+		write = func(p *database.Purchase) error {
+			cw.Write([]string{p.UserID, p.ItemID, p.PurchaseTime.UTC().Format(time.RFC3339Nano)})
+			cw.Flush()
+			return cw.Error()
+		}
+	case "ndjson":
+		enc := json.NewEncoder(buf)
+		write = func(p *database.Purchase) error {
+			return enc.Encode(api.ExportedPurchase{UserID: p.UserID, ItemID: p.ItemID, PurchaseTime: p.PurchaseTime})
+		}
+	}
+
+	rows := 0
+	err := s.db.StreamPurchases(ctx, req.SaleID, func(p *database.Purchase) error {
+		if err := write(p); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushEvery == 0 {
+			return buf.flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// Headers are already sent; the truncated body is all we can signal.
+		log.Printf("Export of sale %s failed after %d rows: %v", req.SaleID, rows, err)
+		return
+	}
+	buf.close()
+	log.Printf("Exported %d purchases of sale %s as %s", rows, req.SaleID, req.Format)
+}
+
+// exportCatalogHandler streams a sale's items as a catalog in CSV (the
+// default) or NDJSON, in the form
+// uploadCatalogHandler takes back: exporting a sale and uploading the file
+// to the next one sells the same items again. SKUs are the item IDs
+// without the sale's prefix, and placeholder image URLs are left out so
+// the next sale generates its own.
+func (s *Server) exportCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.CatalogExportRequest{
+		SaleID: r.PathValue("sale_id"),
+		Format: r.URL.Query().Get("format"),
+	}
+	if req.Format == "" {
+		req.Format = catalog.FormatCSV
+	}
+	if req.Format != catalog.FormatCSV && req.Format != catalog.FormatNDJSON {
+		writeError(w, r, "format must be csv or ndjson", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if _, err := s.db.GetSale(ctx, req.SaleID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, "Sale not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, r, "Failed to load sale", http.StatusInternalServerError)
+		return
+	}
+
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	contentType := "text/csv"
+	if req.Format == catalog.FormatNDJSON {
+		contentType = "application/x-ndjson"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-items.%s"`, req.SaleID, req.Format))
+
+	buf := newExportStream(w, r)
+
+	var write func(e *api.CatalogEntry) error
+	switch req.Format {
+	case catalog.FormatCSV:
+		cw := csv.NewWriter(buf)
+		cw.Write([]string{"sku", "name", "category", "image_url", "price", "currency", "rarity", "quantity"})
+		write = func(e *api.CatalogEntry) error {
+			cw.Write([]string{e.SKU, e.Name, e.Category, e.ImageURL, e.Price, e.Currency, e.Rarity, strconv.Itoa(e.Quantity)})
+			cw.Flush()
+			return cw.Error()
+		}
+	case catalog.FormatNDJSON:
+		enc := json.NewEncoder(buf)
+		write = func(e *api.CatalogEntry) error {
+			return enc.Encode(e)
+		}
+	}
+
+	prefix := req.SaleID + "_"
+	rows := 0
+	err := s.db.StreamItems(ctx, req.SaleID, func(item *database.Item) error {
+		e := api.CatalogEntry{
+			SKU:      strings.TrimPrefix(item.ItemID, prefix),
+			Name:     item.Name,
+			Category: item.Category,
+			ImageURL: item.ImageURL,
+			Price:    money.Format(item.PriceMinor, item.Currency),
+			Currency: item.Currency,
+			Rarity:   item.Rarity,
+			Quantity: item.Quantity,
+		}
+		if e.ImageURL == imagegen.URL(item.ItemID) {
+			e.ImageURL = ""
+		}
+		if err := write(&e); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushEvery == 0 {
+			return buf.flush()
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Catalog export of sale %s failed after %d items: %v", req.SaleID, rows, err)
+		return
+	}
+	buf.close()
+	log.Printf("Exported %d items of sale %s as %s", rows, req.SaleID, req.Format)
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"flash_sale_contest/internal/cache"
+)
+
+const (
+	// standbyWarmTimeout bounds the rebuild of one tenant's sale.
+	standbyWarmTimeout = 30 * time.Second
+	// standbyItemsPage is how many items are read from Postgres at a time.
+	standbyItemsPage = 1000
+)
+
+// warmStandby runs when Redis fails over to REDIS_STANDBY_ADDR: the running
+// sale of every tenant and the registered users are rebuilt on the standby
+// from Postgres, so checkouts go on, flagged as degraded in /sale/status,
+// instead of failing until the primary is back.
+func (s *Server) warmStandby() {
+	ctx, cancel := context.WithTimeout(context.Background(), userRegistryTimeout)
+	s.syncUserRegistry(ctx)
+	cancel()
+
+	s.warmStandbySale()
+	for _, t := range s.tenants {
+		t.warmStandbySale()
+	}
+}
+
+func (s *Server) warmStandbySale() {
+	ctx, cancel := context.WithTimeout(context.Background(), standbyWarmTimeout)
+	defer cancel()
+	if err := s.warmSale(ctx); err != nil {
+		log.Printf("Failed to warm standby: %v", err)
+	}
+}
+
+// warmSale rebuilds the running sale in Redis, on a standby or after a
+// flush: its remaining inventory from the inventory ledger, which lags
+// Redis by the movements still queued for writing, and its items from the
+// catalog. Category stock is what the ledger has not seen claimed. A sale
+// whose inventory Redis still holds is left alone.
+func (s *Server) warmSale(ctx context.Context) error {
+	activeSale := s.saleManager.GetCurrentSale()
+	if activeSale == nil {
+		return nil
+	}
+
+	balance, err := s.db.GetInventoryBalance(ctx, activeSale.SaleID)
+	if err != nil {
+		return fmt.Errorf("could not sum the ledger of sale %s: %w", activeSale.SaleID, err)
+	}
+	if balance.Supplied == 0 {
+		log.Printf("Warning: sale %s has no inventory ledger, Redis will show it sold out", activeSale.SaleID)
+	}
+	claimed, err := s.db.ClaimedItemUnits(ctx, activeSale.SaleID)
+	if err != nil {
+		return fmt.Errorf("could not count the claimed units of sale %s: %w", activeSale.SaleID, err)
+	}
+
+	items, err := s.saleItemInfos(ctx, activeSale.SaleID)
+	if err != nil {
+		return err
+	}
+	categories := make(map[string]int)
+	for _, item := range items {
+		categories[item.Category] += max(max(item.Quantity, 1)-claimed[item.ItemID], 0)
+	}
+
+	sale, err := s.db.GetSale(ctx, activeSale.SaleID)
+	if err != nil {
+		return fmt.Errorf("could not load sale %s: %w", activeSale.SaleID, err)
+	}
+	if err := s.cache.SetOversellBuffer(ctx, activeSale.SaleID, sale.OversellBuffer); err != nil {
+		return fmt.Errorf("could not restore the oversell buffer of sale %s: %w", activeSale.SaleID, err)
+	}
+	if err := s.cache.WarmStandby(ctx, activeSale.SaleID, balance.Available, categories, claimed, items); err != nil {
+		return fmt.Errorf("could not rebuild sale %s: %w", activeSale.SaleID, err)
+	}
+	return nil
+}
+
+// saleItemInfos reads the metadata of every item of a sale from the
+// catalog, a page at a time.
+func (s *Server) saleItemInfos(ctx context.Context, saleID string) ([]cache.ItemInfo, error) {
+	var items []cache.ItemInfo
+	for offset := 0; ; offset += standbyItemsPage {
+		page, err := s.db.GetSaleItems(ctx, saleID, "", standbyItemsPage, offset)
+		if err != nil {
+			return nil, fmt.Errorf("could not load the items of sale %s: %w", saleID, err)
+		}
+		for _, item := range page {
+			items = append(items, cache.ItemInfo{ItemID: item.ItemID, Name: item.Name, ImageURL: item.ImageURL, Category: item.Category, PriceMinor: item.PriceMinor, Currency: item.Currency, Rarity: item.Rarity, Quantity: item.Quantity})
+		}
+		if len(page) < standbyItemsPage {
+			return items, nil
+		}
+	}
+}
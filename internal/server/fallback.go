@@ -0,0 +1,90 @@
+package server
+
+import (
+	"log"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/codes"
+	"flash_sale_contest/internal/database"
+	"flash_sale_contest/internal/trace"
+)
+
+// fallbackCodePrefix marks checkout codes issued by the Postgres reservation
+// path, so /purchase knows to redeem them there instead of in Redis.
+const fallbackCodePrefix = "fb_"
+
+// isReservationRejection reports whether a reservation failed for a business
+// reason rather than because the cache could not be reached.
+func isReservationRejection(err error) bool {
+	switch err.Error() {
+	case "sold out", "category sold out", "item already reserved", "unknown category", "item not in category", "unknown user", "user limit exceeded", "rarity limit exceeded", "too many outstanding codes", "sale closing",
+		"invalid promo code", "promo code expired", "promo code exhausted", "items not numbered":
+		return true
+	}
+	return false
+}
+
+// fallbackPurchase redeems a code issued by the Postgres reservation path.
+// Bans live in Redis, so the code's owner is checked there before the code
+// is claimed; like the other ban checks, it lets the purchase through when
+// Redis cannot be asked.
+func (s *Server) fallbackPurchase(w http.ResponseWriter, r *http.Request, code string, details *api.PurchaseDetails, start time.Time) {
+	reservation, err := s.db.GetFallbackReservation(r.Context(), code)
+	if err == nil {
+		if banned, banErr := s.cache.IsUserBanned(r.Context(), reservation.UserID); banErr == nil && banned {
+			s.metrics.IncrementPurchaseFailed()
+			s.metrics.IncrementBannedRequests()
+			writeError(w, r, "User is banned", http.StatusForbidden)
+			return
+		}
+		reservation, err = s.db.ClaimFallbackPurchase(r.Context(), code)
+	}
+	if err != nil {
+		s.metrics.IncrementPurchaseFailed()
+		s.metrics.IncrementCodeInvalidErrors()
+		writeError(w, r, "invalid or expired code", http.StatusBadRequest)
+		return
+	}
+
+	s.metrics.IncrementFallbackPurchases()
+	s.metrics.IncrementPurchaseSuccess()
+	s.metrics.IncrementItemsSold()
+	s.metrics.RecordPurchaseLatency(time.Since(start))
+
+	purchaseID := codes.NewID()
+	asyncCtx := trace.Detach(r.Context())
+	if details != nil {
+		s.recordPurchaseDetails(asyncCtx, purchaseID, reservation.SaleID, reservation.UserID, reservation.ItemID, details)
+	}
+	purchase := &database.Purchase{
+		ID:     purchaseID,
+		SaleID: reservation.SaleID,
+		UserID: reservation.UserID,
+		ItemID: reservation.ItemID,
+	}
+	s.persist(func() {
+		ctx, span := trace.Start(asyncCtx, "db.CreatePurchase", slog.String("sale_id", purchase.SaleID))
+		err := s.db.CreatePurchase(ctx, purchase)
+		span.End(err)
+		if err != nil {
+			log.Printf("FATAL: Failed to log fallback purchase to DB for code %s: %v", code, err)
+			s.parkFailedWrite(cache.DeadLetterPurchase, purchase, err)
+		}
+	}, func() {
+		s.parkFailedWrite(cache.DeadLetterPurchase, purchase, errWriteShed)
+	})
+
+	resp := api.PurchaseResponse{
+		Success:    true,
+		PurchaseID: purchaseID,
+		UserID:     reservation.UserID,
+		ItemID:     reservation.ItemID,
+		SaleID:     reservation.SaleID,
+		Receipt:    s.receipt(purchaseID, reservation.SaleID, reservation.UserID, reservation.ItemID, time.Now()),
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
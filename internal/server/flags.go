@@ -0,0 +1,58 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"flash_sale_contest/internal/api"
+)
+
+// setFlagHandler switches a feature flag for every replica of the tenant,
+// so a strategy can be changed mid-contest without a redeploy.
+func (s *Server) setFlagHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.SetFlagRequest{Name: r.PathValue("name")}
+	if !s.flags.Known(req.Name) {
+		writeError(w, r, "Unknown flag", http.StatusNotFound)
+		return
+	}
+	var err error
+	if req.Enabled, err = strconv.ParseBool(r.URL.Query().Get("enabled")); err != nil {
+		writeError(w, r, "enabled must be true or false", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.flags.Set(r.Context(), req.Name, req.Enabled); err != nil {
+		log.Printf("Failed to set flag %s: %v", req.Name, err)
+		writeError(w, r, "Failed to set flag", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Flag %s set to %t", req.Name, req.Enabled)
+	s.flagsHandler(w, r)
+}
+
+// clearFlagHandler puts a feature flag back to its default.
+func (s *Server) clearFlagHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.ClearFlagRequest{Name: r.PathValue("name")}
+	if !s.flags.Known(req.Name) {
+		writeError(w, r, "Unknown flag", http.StatusNotFound)
+		return
+	}
+
+	if err := s.flags.Clear(r.Context(), req.Name); err != nil {
+		log.Printf("Failed to clear flag %s: %v", req.Name, err)
+		writeError(w, r, "Failed to clear flag", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Flag %s back to its default", req.Name)
+	s.flagsHandler(w, r)
+}
+
+// flagsHandler lists the feature flags of the tenant.
+func (s *Server) flagsHandler(w http.ResponseWriter, r *http.Request) {
+	resp := api.FlagsResponse{Flags: []api.Flag{}}
+	for _, f := range s.flags.All(r.Context()) {
+		resp.Flags = append(resp.Flags, api.Flag{Name: f.Name, Enabled: f.Enabled, Default: f.Default, Overridden: f.Overridden})
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+
+	"flash_sale_contest/internal/api"
+)
+
+// healthzHandler is the liveness probe: answering at all means the process
+// is up, so it never touches a dependency.
+func (s *Server) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	resp := api.ProbeResponse{Status: "ok"}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// readyzHandler is the readiness probe. A replica is ready only when it can
+// reach Redis and Postgres, has an active sale loaded and is warmed up;
+// otherwise it answers 503 so the orchestrator stops routing traffic to it.
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	resp := api.ProbeResponse{Status: "ok", Checks: map[string]string{}}
+
+	if cacheHealth := s.cache.Health(); cacheHealth["status"] != "up" {
+		resp.Checks["cache"] = cacheHealth["error"]
+	} else {
+		resp.Checks["cache"] = "ok"
+	}
+
+	if dbHealth := s.db.Health(); dbHealth["status"] != "up" {
+		resp.Checks["database"] = dbHealth["error"]
+	} else {
+		resp.Checks["database"] = "ok"
+	}
+
+	if activeSale := s.saleManager.GetCurrentSale(); activeSale == nil {
+		resp.Checks["sale"] = "no active sale loaded"
+	} else {
+		resp.Checks["sale"] = "ok"
+	}
+
+	if !s.warmedUp.Load() {
+		resp.Checks["warmup"] = "warming up"
+	} else {
+		resp.Checks["warmup"] = "ok"
+	}
+
+	status := http.StatusOK
+	for _, check := range resp.Checks {
+		if check != "ok" {
+			resp.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	writeJSON(w, r, status, resp)
+}
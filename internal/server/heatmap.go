@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/config"
+)
+
+// heatmapFlush is how often counted reservation attempts are added to the
+// Redis heatmap.
+const heatmapFlush = time.Second
+
+// heatmap counts checkouts per bucket of item numbers in memory, so the
+// checkout path pays no Redis round trip for it.
+type heatmap struct {
+	bucketSize int
+
+	mu     sync.Mutex
+	counts map[string]map[int]int64 // sale ID -> bucket -> attempts
+}
+
+func newHeatmap(bucketSize int) *heatmap {
+	return &heatmap{bucketSize: bucketSize, counts: make(map[string]map[int]int64)}
+}
+
+// record counts a checkout for itemID. Checkouts that name no item, or an
+// item without a number, are not counted.
+func (h *heatmap) record(saleID, itemID string) {
+	if h == nil {
+		return
+	}
+	n := cache.ItemNumber(saleID, itemID)
+	if n <= 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	buckets, ok := h.counts[saleID]
+	if !ok {
+		buckets = make(map[int]int64)
+		h.counts[saleID] = buckets
+	}
+	buckets[(n-1)/h.bucketSize]++
+}
+
+// take returns the counts since the last call and starts over.
+func (h *heatmap) take() map[string]map[int]int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	counts := h.counts
+	h.counts = make(map[string]map[int]int64)
+	return counts
+}
+
+func (s *Server) runHeatmap(ctx context.Context) {
+	ticker := time.NewTicker(heatmapFlush)
+	defer ticker.Stop()
+
+	flush := func() {
+		for saleID, buckets := range s.heatmap.take() {
+			writeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			if err := s.cache.AddReservationAttempts(writeCtx, saleID, buckets); err != nil {
+				log.Printf("Warning: could not record reservation heatmap of sale %s: %v", saleID, err)
+			}
+			cancel()
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			flush()
+			return
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// saleHeatmapHandler shows where checkouts landed among a sale's item
+// numbers, to tell whether demand clusters on the showcased items.
+func (s *Server) saleHeatmapHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.SaleHeatmapRequest{SaleID: r.PathValue("sale_id")}
+
+	ctx := r.Context()
+	sale, err := s.db.GetSale(ctx, req.SaleID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, "Sale not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, r, "Failed to load sale", http.StatusInternalServerError)
+		return
+	}
+
+	counts, err := s.cache.GetReservationHeatmap(ctx, req.SaleID)
+	if err != nil {
+		log.Printf("Failed to read reservation heatmap of sale %s: %v", req.SaleID, err)
+		writeError(w, r, "Failed to load heatmap", http.StatusInternalServerError)
+		return
+	}
+
+	bucketSize := max(config.Get().HeatmapBucketSize, 1)
+	showcased := make(map[int]bool)
+	if showcase, err := s.cache.GetShowcaseInfo(ctx, req.SaleID); err == nil && showcase != nil {
+		for _, itemID := range showcase.IDs() {
+			if n := cache.ItemNumber(req.SaleID, itemID); n > 0 {
+				showcased[(n-1)/bucketSize] = true
+			}
+		}
+	}
+
+	buckets := (sale.TotalItems + bucketSize - 1) / bucketSize
+	for bucket := range counts {
+		buckets = max(buckets, bucket+1)
+	}
+
+	resp := api.SaleHeatmapResponse{
+		SaleID:     req.SaleID,
+		BucketSize: bucketSize,
+		Buckets:    make([]api.HeatmapBucket, buckets),
+	}
+	for i := range resp.Buckets {
+		resp.Buckets[i] = api.HeatmapBucket{
+			FirstItem: i*bucketSize + 1,
+			LastItem:  (i + 1) * bucketSize,
+			Attempts:  counts[i],
+			Showcased: showcased[i],
+		}
+		resp.Attempts += counts[i]
+		if showcased[i] {
+			resp.ShowcasedAttempts += counts[i]
+		}
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
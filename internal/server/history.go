@@ -0,0 +1,61 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"flash_sale_contest/internal/api"
+)
+
+const salesHistoryPageSize = 20
+
+// salesHistoryHandler lists previous sales and how they went, so the
+// frontend has results to show between sales.
+func (s *Server) salesHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.SalesRequest{Status: r.URL.Query().Get("status")}
+	if req.Status == "" {
+		req.Status = "ended"
+	}
+	if req.Status != "ended" && req.Status != "active" {
+		writeError(w, r, "status must be ended or active", http.StatusBadRequest)
+		return
+	}
+	req.Page, _ = strconv.Atoi(r.URL.Query().Get("page"))
+	if req.Page < 1 {
+		req.Page = 1
+	}
+
+	sales, err := s.db.ListSales(r.Context(), req.Status, salesHistoryPageSize, (req.Page-1)*salesHistoryPageSize)
+	if err != nil {
+		log.Printf("Failed to list %s sales: %v", req.Status, err)
+		writeError(w, r, "Failed to list sales", http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.SalesResponse{
+		Status:   req.Status,
+		Page:     req.Page,
+		PageSize: salesHistoryPageSize,
+		Sales:    make([]api.SaleSummary, 0, len(sales)),
+	}
+	for _, sale := range sales {
+		summary := api.SaleSummary{
+			SaleID:          sale.SaleID,
+			Status:          sale.Status,
+			StartTime:       sale.StartTime,
+			EndTime:         sale.EndTime,
+			DurationSeconds: int(sale.EndTime.Sub(sale.StartTime).Seconds()),
+			TotalItems:      sale.TotalItems,
+			ItemsSold:       sale.ItemsSold,
+		}
+		if sale.SoldOutAfter > 0 {
+			soldOutAt := sale.StartTime.Add(sale.SoldOutAfter)
+			seconds := sale.SoldOutAfter.Seconds()
+			summary.SoldOutAt, summary.SoldOutAfterSeconds = &soldOutAt, &seconds
+		}
+		resp.Sales = append(resp.Sales, summary)
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
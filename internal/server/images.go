@@ -0,0 +1,64 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"flash_sale_contest/internal/imagegen"
+)
+
+var imageCDN = strings.TrimSuffix(os.Getenv("IMAGE_CDN_URL"), "/")
+
+var imageClient = &http.Client{Timeout: 5 * time.Second}
+
+func (s *Server) itemImageHandler(w http.ResponseWriter, r *http.Request) {
+	itemID := r.PathValue("item_id")
+	if itemID == "" {
+		writeError(w, r, "item_id is required", http.StatusBadRequest)
+		return
+	}
+
+	if imageCDN != "" {
+		s.proxyItemImage(w, r, itemID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "public, max-age=86400, immutable")
+	w.Write(imagegen.For(itemID).SVG())
+}
+
+// proxyItemImage fetches an item's image from the CDN. The item ID is
+// escaped, so one decoded from the path cannot reach another CDN path or
+// add a query.
+func (s *Server) proxyItemImage(w http.ResponseWriter, r *http.Request, itemID string) {
+	imageURL := fmt.Sprintf("%s/%s.png", imageCDN, url.PathEscape(itemID))
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, imageURL, nil)
+	if err != nil {
+		writeError(w, r, "Failed to build image request", http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := imageClient.Do(req)
+	if err != nil {
+		log.Printf("Failed to fetch image for %s from CDN: %v", itemID, err)
+		writeError(w, r, "Image unavailable", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		writeError(w, r, "Image unavailable", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	io.Copy(w, resp.Body)
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"flash_sale_contest/internal/config"
+)
+
+// inventoryGate keeps a per-process estimate of the active sale's remaining
+// inventory so that, once a sale is clearly sold out, /checkout can answer
+// 409 without a Redis round trip. The estimate is reset from Redis on every
+// refresh and decremented by each checkout let through in between; it only
+// turns requests away once it has fallen threshold below zero, which leaves
+// room for released reservations to be picked up.
+type inventoryGate struct {
+	state     atomic.Pointer[gateState]
+	threshold int64
+}
+
+type gateState struct {
+	saleID   string
+	estimate atomic.Int64
+}
+
+func newInventoryGate(threshold int) *inventoryGate {
+	return &inventoryGate{threshold: int64(threshold)}
+}
+
+// admit reports whether a checkout for saleID should go on to Redis. It
+// always admits while the gate has no fresh estimate for that sale.
+func (g *inventoryGate) admit(saleID string) bool {
+	st := g.state.Load()
+	if st == nil || st.saleID != saleID {
+		return true
+	}
+	if st.estimate.Load() <= -g.threshold {
+		return false
+	}
+	st.estimate.Add(-1)
+	return true
+}
+
+func (g *inventoryGate) set(saleID string, remaining int64) {
+	st := &gateState{saleID: saleID}
+	st.estimate.Store(remaining)
+	g.state.Store(st)
+}
+
+// invalidate drops the estimate so every checkout reaches Redis until the
+// next successful refresh.
+func (g *inventoryGate) invalidate() {
+	g.state.Store(nil)
+}
+
+// runInventoryGate refreshes the gate from Redis until ctx is done.
+func (s *Server) runInventoryGate(ctx context.Context) {
+	ticker := time.NewTicker(config.Get().InventoryGateRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		activeSale := s.saleManager.GetCurrentSale()
+		if activeSale == nil {
+			s.inventoryGate.invalidate()
+			continue
+		}
+
+		refreshCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		remaining, err := s.cache.GetInventoryStatus(refreshCtx, activeSale.SaleID)
+		var buffer int
+		if err == nil {
+			buffer, err = s.cache.GetOversellBuffer(refreshCtx, activeSale.SaleID)
+		}
+		cancel()
+		if err != nil {
+			s.inventoryGate.invalidate()
+			continue
+		}
+		// Units the sale may still oversell count as remaining here
+		s.inventoryGate.set(activeSale.SaleID, int64(remaining+buffer))
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"flash_sale_contest/internal/config"
+)
+
+// inventoryReading is the active sale's inventory as last read from Redis.
+type inventoryReading struct {
+	saleID     string
+	remaining  int
+	categories map[string]int
+	readAt     time.Time
+	// stale is set when the last read failed and an older reading is
+	// being served in its place.
+	stale bool
+}
+
+// inventorySnapshot shares one Redis read of the inventory between every
+// /sale/status and /sale/current poller of a process for
+// STATUS_CACHE_TTL, so polling load does not turn into Redis load.
+type inventorySnapshot struct {
+	mu      sync.Mutex
+	current atomic.Pointer[inventoryReading]
+}
+
+// inventory returns a reading of saleID no older than STATUS_CACHE_TTL.
+// While one caller refreshes it, the others are served the previous
+// reading. When Redis cannot be read, the last reading is served marked
+// stale; with none, remaining is -1.
+func (s *Server) inventory(ctx context.Context, saleID string) *inventoryReading {
+	ttl := config.Get().StatusCacheTTL
+	snap := &s.inventorySnapshot
+	fresh := func(r *inventoryReading) bool {
+		return r != nil && r.saleID == saleID && time.Since(r.readAt) < ttl
+	}
+
+	if r := snap.current.Load(); fresh(r) {
+		return r
+	}
+	if !snap.mu.TryLock() {
+		if r := snap.current.Load(); r != nil && r.saleID == saleID {
+			return r
+		}
+		snap.mu.Lock()
+	}
+	defer snap.mu.Unlock()
+	if r := snap.current.Load(); fresh(r) {
+		return r
+	}
+
+	reading := &inventoryReading{saleID: saleID, readAt: time.Now()}
+	remaining, err := s.cache.GetInventoryStatus(ctx, saleID)
+	if err == nil {
+		// An oversold sale reads below zero; buyers see it sold out, and
+		// -1 stays the sign of a failed read.
+		reading.remaining = max(remaining, 0)
+		reading.categories, err = s.cache.GetCategoryInventory(ctx, saleID)
+	}
+	if err != nil {
+		log.Printf("Failed to read inventory of sale %s: %v", saleID, err)
+		if last := snap.current.Load(); last != nil && last.saleID == saleID {
+			// Retry after another TTL rather than on every request.
+			stale := *last
+			stale.readAt, stale.stale = reading.readAt, true
+			reading = &stale
+		} else {
+			reading.remaining = -1
+		}
+	}
+	snap.current.Store(reading)
+	return reading
+}
+
+// expire has the next reader refresh the snapshot. The reading is kept to
+// be served while it does.
+func (snap *inventorySnapshot) expire() {
+	if r := snap.current.Load(); r != nil {
+		expired := *r
+		expired.readAt = time.Time{}
+		snap.current.CompareAndSwap(r, &expired)
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+
+	"flash_sale_contest/internal/config"
+	"flash_sale_contest/internal/jobs"
+)
+
+// startJobs starts the periodic maintenance of every tenant: fallback
+// reconciliation, archival and, for the default tenant, expired code
+// cleanup. Jobs of other tenants are named <job>:<tenant>. Each job checks
+// leadership itself, so followers run them as no-ops.
+func (s *Server) startJobs(ctx context.Context) *jobs.Manager {
+	cfg := config.Get()
+	manager := jobs.NewManager(s.metrics.RecordJobRun)
+
+	manager.Add(jobs.Job{
+		Name:     "cleanup_codes",
+		Interval: cfg.CleanupInterval,
+		Run:      s.cleanupExpiredCodes,
+	})
+	servers := []*Server{s}
+	for _, t := range s.tenants {
+		servers = append(servers, t)
+	}
+	for _, t := range servers {
+		manager.Add(jobs.Job{
+			Name:     t.jobName("reconcile"),
+			Interval: cfg.ReconcileInterval,
+			Run:      t.saleManager.ReconcileFallbackPurchases,
+		})
+		manager.Add(jobs.Job{
+			Name:     t.jobName("archive"),
+			Interval: cfg.ArchiveInterval,
+			Run:      t.saleManager.ArchiveEndedSales,
+		})
+	}
+
+	manager.Start(ctx)
+	return manager
+}
+
+// cleanupExpiredCodes deletes checkout codes that lost their expiry. The
+// scan covers all of Redis, so only the default tenant's leader runs it.
+func (s *Server) cleanupExpiredCodes(ctx context.Context) error {
+	if !s.saleManager.IsLeader() {
+		return nil
+	}
+	saleID := ""
+	if activeSale := s.saleManager.GetCurrentSale(); activeSale != nil {
+		saleID = activeSale.SaleID
+	}
+	return s.cache.CleanupExpiredCodes(ctx, saleID)
+}
+
+func (s *Server) jobName(job string) string {
+	if s.tenant == "" {
+		return job
+	}
+	return job + ":" + s.tenant
+}
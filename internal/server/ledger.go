@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/codes"
+	"flash_sale_contest/internal/database"
+)
+
+// recordMovement writes one movement of a sale's inventory to the ledger on
+// the write pool. It is recorded after Redis moved the unit, so the ledger
+// can be held against the counter after the fact.
+func (s *Server) recordMovement(movement, saleID, userID, itemID string) {
+	m := &database.InventoryMovement{
+		EntryID:    codes.NewID(),
+		SaleID:     saleID,
+		Movement:   movement,
+		Quantity:   1,
+		UserID:     userID,
+		ItemID:     itemID,
+		RecordedAt: time.Now(),
+	}
+	s.persist(func() {
+		if err := s.db.RecordInventoryMovement(context.Background(), m); err != nil {
+			log.Printf("Failed to record %s of %s in sale %s: %v", movement, itemID, saleID, err)
+			s.parkFailedWrite(cache.DeadLetterInventoryMovement, m, err)
+		}
+	}, func() {
+		s.parkFailedWrite(cache.DeadLetterInventoryMovement, m, errWriteShed)
+	})
+}
+
+// saleLedgerHandler sums a sale's inventory ledger and, while the sale is
+// running, compares it with the Redis counter.
+func (s *Server) saleLedgerHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.SaleLedgerRequest{SaleID: r.PathValue("sale_id")}
+	ctx := r.Context()
+
+	if _, err := s.db.GetSale(ctx, req.SaleID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, "Sale not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, r, "Failed to load sale", http.StatusInternalServerError)
+		return
+	}
+
+	balance, err := s.db.GetInventoryBalance(ctx, req.SaleID)
+	if err != nil {
+		log.Printf("Failed to sum ledger of sale %s: %v", req.SaleID, err)
+		writeError(w, r, "Failed to load ledger", http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.SaleLedgerResponse{
+		SaleID:    balance.SaleID,
+		Supplied:  balance.Supplied,
+		Available: balance.Available,
+		Reserved:  balance.Reserved,
+		Sold:      balance.Sold,
+	}
+	if !balance.LastMovementAt.IsZero() {
+		resp.LastMovementAt = &balance.LastMovementAt
+	}
+	if activeSale := s.saleManager.GetCurrentSale(); activeSale != nil && activeSale.SaleID == req.SaleID {
+		if remaining, err := s.cache.GetInventoryStatus(ctx, req.SaleID); err == nil {
+			drift := remaining - balance.Available
+			resp.RedisAvailable = &remaining
+			resp.Drift = &drift
+		}
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,299 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/config"
+	"flash_sale_contest/internal/database"
+	"flash_sale_contest/internal/flags"
+	"flash_sale_contest/internal/notifications"
+	"flash_sale_contest/internal/sale"
+)
+
+const (
+	checkoutModeFCFS    = "fcfs"
+	checkoutModeLottery = "lottery"
+
+	// lotteryMaxLosses caps the losing streak that raises an entrant's
+	// weight.
+	lotteryMaxLosses = 5
+	// lotteryDrawTimeout bounds a draw; a draw that does not finish in
+	// time is run again by the leader.
+	lotteryDrawTimeout = time.Minute
+	lotteryPoll        = 500 * time.Millisecond
+)
+
+// lotteryDrawAt is when a sale's lottery closes and is drawn.
+func lotteryDrawAt(activeSale *sale.ActiveSale) time.Time {
+	return activeSale.StartTime.Add(config.Get().LotteryWindow)
+}
+
+// lotteryCheckout enters the user into the sale's lottery while it is open.
+// It returns true once the lottery is drawn, when the inventory left over
+// goes first come first served; otherwise it has answered the request.
+// Until the draw, how fast a checkout arrives makes no difference.
+func (s *Server) lotteryCheckout(w http.ResponseWriter, r *http.Request, activeSale *sale.ActiveSale, userID string) bool {
+	if !s.flags.Enabled(r.Context(), flags.Lottery) {
+		return true
+	}
+	if drawn, _ := s.lotteryDrawn.Load().(string); drawn == activeSale.SaleID {
+		return true
+	}
+
+	ctx := r.Context()
+	drawAt := lotteryDrawAt(activeSale)
+	if until := time.Until(drawAt); until > 0 {
+		entered, err := s.cache.EnterLottery(ctx, activeSale.SaleID, userID)
+		if err != nil {
+			log.Printf("Failed to enter user %s into the lottery of sale %s: %v", userID, activeSale.SaleID, err)
+			writeError(w, r, "Failed to enter the lottery", http.StatusServiceUnavailable)
+			return false
+		}
+		if entered {
+			s.metrics.IncrementLotteryEntries()
+		}
+
+		resp := api.LotteryStatusResponse{
+			SaleID: activeSale.SaleID,
+			UserID: userID,
+			Status: api.LotteryEntered,
+			DrawAt: drawAt,
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(until.Seconds()+0.999)))
+		writeJSON(w, r, http.StatusAccepted, resp)
+		return false
+	}
+
+	state, err := s.cache.GetLotteryDrawState(ctx, activeSale.SaleID)
+	if err != nil {
+		log.Printf("Failed to read the lottery draw of sale %s: %v", activeSale.SaleID, err)
+	}
+	if state == cache.LotteryDone {
+		s.lotteryDrawn.Store(activeSale.SaleID)
+		return true
+	}
+	w.Header().Set("Retry-After", "1")
+	writeError(w, r, "Lottery draw in progress", http.StatusServiceUnavailable)
+	return false
+}
+
+// runLottery draws each sale's lottery once it closes. Only the leader
+// draws; the claim in Redis keeps a leadership change from drawing twice.
+func (s *Server) runLottery(ctx context.Context) {
+	ticker := time.NewTicker(lotteryPoll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		activeSale := s.saleManager.GetCurrentSale()
+		if activeSale == nil || activeSale.Closing() || !s.saleManager.IsLeader() || time.Now().Before(lotteryDrawAt(activeSale)) {
+			continue
+		}
+		if !s.flags.Enabled(ctx, flags.Lottery) {
+			continue
+		}
+		if drawn, _ := s.lotteryDrawn.Load().(string); drawn == activeSale.SaleID {
+			continue
+		}
+
+		claimed, err := s.cache.ClaimLotteryDraw(ctx, activeSale.SaleID, lotteryDrawTimeout)
+		if err != nil {
+			log.Printf("Failed to claim the lottery draw of sale %s: %v", activeSale.SaleID, err)
+			continue
+		}
+		if claimed {
+			drawCtx, cancel := context.WithTimeout(ctx, lotteryDrawTimeout)
+			err = s.drawLottery(drawCtx, activeSale)
+			cancel()
+			if err != nil {
+				log.Printf("Failed to draw the lottery of sale %s: %v", activeSale.SaleID, err)
+				continue
+			}
+		}
+		if state, err := s.cache.GetLotteryDrawState(ctx, activeSale.SaleID); err == nil && state == cache.LotteryDone {
+			s.lotteryDrawn.Store(activeSale.SaleID)
+		}
+	}
+}
+
+// drawLottery issues checkout codes to entrants in weighted random order
+// until the inventory runs out, and records every entrant's result. Each
+// winner is recorded as they are drawn, so when a draw fails partway the
+// next one keeps their codes and skips them.
+func (s *Server) drawLottery(ctx context.Context, activeSale *sale.ActiveSale) error {
+	entrants, err := s.cache.GetLotteryEntrants(ctx, activeSale.SaleID)
+	if err != nil {
+		return err
+	}
+	drawn, err := s.cache.GetLotteryResults(ctx, activeSale.SaleID)
+	if err != nil {
+		return err
+	}
+
+	codeTTL := activeSale.CodeExpiry()
+	results := make(map[string]*cache.LotteryResult, len(entrants))
+	var winners []string
+	soldOut := false
+	for _, userID := range weightedOrder(entrants, config.Get().LotteryLoserBonus) {
+		if result, ok := drawn[userID]; ok {
+			results[userID] = result
+			if result.Won {
+				winners = append(winners, userID)
+			}
+			continue
+		}
+		result := &cache.LotteryResult{}
+		results[userID] = result
+		if soldOut {
+			continue
+		}
+
+		reservation, err := s.reserveItem(ctx, activeSale.SaleID, userID, "", "", "", codeTTL)
+		if err != nil {
+			switch err.Error() {
+			case "sold out":
+				soldOut = true
+			case "items not numbered":
+				log.Printf("Sale %s has no numbered items to draw", activeSale.SaleID)
+				soldOut = true
+			default:
+				if !isReservationRejection(err) {
+					log.Printf("Failed to reserve an item for lottery winner %s: %v", userID, err)
+				}
+			}
+			continue
+		}
+
+		s.recordMovement(database.MovementReserve, activeSale.SaleID, userID, reservation.ItemID)
+		s.logCheckout(&database.CheckoutAttempt{
+			SaleID: activeSale.SaleID,
+			UserID: userID,
+			ItemID: reservation.ItemID,
+			Code:   reservation.Code,
+		})
+
+		result.Won = true
+		result.Code, result.ItemID, result.ExpiresAt = reservation.Code, reservation.ItemID, reservation.ExpiresAt
+		saved, err := s.cache.SaveLotteryWin(ctx, activeSale.SaleID, userID, result)
+		if err != nil {
+			return fmt.Errorf("failed to record lottery win of user %s: %w", userID, err)
+		}
+		if !saved {
+			// Another draw got to them first; their code stands and this
+			// one expires unclaimed.
+			log.Printf("Lottery winner %s of sale %s was already drawn, dropping code for item %s", userID, activeSale.SaleID, reservation.ItemID)
+			delete(results, userID)
+			continue
+		}
+		winners = append(winners, userID)
+	}
+
+	if err := s.cache.SaveLotteryResults(ctx, activeSale.SaleID, results); err != nil {
+		return err
+	}
+	log.Printf("Lottery of sale %s drawn: %d winners among %d entrants", activeSale.SaleID, len(winners), len(entrants))
+
+	if s.notifications {
+		for _, userID := range winners {
+			result := results[userID]
+			err := notifications.Publish(context.Background(), s.cache, notifications.Event{
+				Type:      notifications.EventLotteryWon,
+				SaleID:    activeSale.SaleID,
+				UserID:    userID,
+				ItemID:    result.ItemID,
+				Code:      result.Code,
+				ExpiresAt: result.ExpiresAt,
+				Tenant:    s.tenant,
+			})
+			if err != nil {
+				log.Printf("Failed to publish lottery win for user %s: %v", userID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// weightedOrder shuffles entrants so that each is drawn ahead of the rest
+// with probability proportional to its weight: 1, plus bonus for every
+// lottery lost in a row. Sorting by exponential variates scaled by the
+// inverse weights samples without replacement in one pass.
+func weightedOrder(entrants map[string]int, bonus float64) []string {
+	keys := make(map[string]float64, len(entrants))
+	order := make([]string, 0, len(entrants))
+	for userID, losses := range entrants {
+		weight := 1 + max(bonus, 0)*float64(min(losses, lotteryMaxLosses))
+		keys[userID] = rand.ExpFloat64() / weight
+		order = append(order, userID)
+	}
+	sort.Slice(order, func(i, j int) bool { return keys[order[i]] < keys[order[j]] })
+	return order
+}
+
+// lotteryStatusHandler tells an entrant whether they won the current
+// sale's lottery, and the checkout code they drew.
+func (s *Server) lotteryStatusHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.LotteryStatusRequest{UserID: r.URL.Query().Get("user_id")}
+	if req.UserID == "" {
+		writeError(w, r, "user_id is required", http.StatusBadRequest)
+		return
+	}
+	if !s.flags.Enabled(r.Context(), flags.Lottery) {
+		writeError(w, r, "Lottery is disabled", http.StatusNotFound)
+		return
+	}
+	activeSale := s.saleManager.GetCurrentSale()
+	if activeSale == nil {
+		writeError(w, r, "No active sale", http.StatusNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	resp := api.LotteryStatusResponse{
+		SaleID: activeSale.SaleID,
+		UserID: req.UserID,
+		DrawAt: lotteryDrawAt(activeSale),
+	}
+	result, err := s.cache.GetLotteryResult(ctx, activeSale.SaleID, req.UserID)
+	switch {
+	case err == nil:
+		resp.Status = api.LotteryLost
+		if result.Won {
+			resp.Status = api.LotteryWon
+			resp.Code, resp.ItemID, resp.ExpiresAt = result.Code, result.ItemID, result.ExpiresAt
+		}
+	case errors.Is(err, redis.Nil):
+		entered, err := s.cache.IsLotteryEntrant(ctx, activeSale.SaleID, req.UserID)
+		if err != nil {
+			writeError(w, r, "Failed to load lottery entry", http.StatusInternalServerError)
+			return
+		}
+		if !entered {
+			writeError(w, r, "Not entered in the lottery", http.StatusNotFound)
+			return
+		}
+		resp.Status = api.LotteryEntered
+	default:
+		writeError(w, r, "Failed to load lottery result", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, r, http.StatusOK, resp)
+}
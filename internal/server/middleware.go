@@ -8,32 +8,86 @@ import (
 	"log"
 	"net/http"
 	"runtime/debug"
+	"slices"
 	"time"
+
+	"flash_sale_contest/internal/config"
+	"flash_sale_contest/internal/database"
 )
 
 func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Simple rate limiting using Redis
-		if r.URL.Path == "/checkout" || r.URL.Path == "/purchase" {
+		// Simple rate limiting using Redis, per user and per client IP.
+		// Registrations count too, or fresh users would sidestep the
+		// per-user limits.
+		if r.URL.Path == "/checkout" || r.URL.Path == "/purchase" || r.URL.Path == "/users" {
+			cfg := config.Get()
 			userID := r.URL.Query().Get("user_id")
-			if userID != "" {
-				key := fmt.Sprintf("rate_limit:%s", userID)
-				count, err := s.cache.GetClient().Incr(r.Context(), key).Result()
-				if err == nil {
-					if count == 1 {
-						s.cache.GetClient().Expire(r.Context(), key, time.Minute)
-					}
-					if count > 100 { // 100 requests per minute per user
-						http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			if userID != "" && cfg.RateLimitPerUser > 0 {
+				if s.overLimit(r.Context(), fmt.Sprintf("rate_limit:%s", userID), cfg.RateLimitPerUser) {
+					s.logRateLimited(r, userID)
+					writeError(w, r, "Rate limit exceeded", http.StatusTooManyRequests)
+					return
+				}
+			}
+			// A kiosk serves many buyers from one IP, so its checkouts and
+			// purchases count against its key instead, once the key is
+			// known to be valid and to carry the checkout scope, and only
+			// while RATE_LIMIT_PER_API_KEY sets a limit. A key that is not
+			// cached yet is first counted against the IP, so made-up keys
+			// cannot reach Postgres faster than the IP limit allows. Keys
+			// belong to the tenant the request is for.
+			var key *database.APIKey
+			countedIP := false
+			t, known := s.requestTenant(r)
+			if raw := r.Header.Get(apiKeyHeader); raw != "" && known && r.URL.Path != "/users" && cfg.RateLimitPerAPIKey > 0 {
+				var cached bool
+				if key, cached = t.cachedAPIKey(raw); !cached {
+					if s.overIPLimit(r) {
+						s.logRateLimited(r, userID)
+						writeError(w, r, "Rate limit exceeded", http.StatusTooManyRequests)
 						return
 					}
+					countedIP = true
+					key, _ = t.lookupAPIKey(r.Context(), raw)
 				}
 			}
+			if key != nil && slices.Contains(key.Scopes, database.APIKeyScopeCheckout) {
+				if s.overLimit(r.Context(), fmt.Sprintf("rate_limit:key:%s", key.ID), cfg.RateLimitPerAPIKey) {
+					s.logRateLimited(r, userID)
+					writeError(w, r, "Rate limit exceeded", http.StatusTooManyRequests)
+					return
+				}
+			} else if !countedIP && s.overIPLimit(r) {
+				s.logRateLimited(r, userID)
+				writeError(w, r, "Rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// overIPLimit counts a request against its client IP's window, see
+// overLimit.
+func (s *Server) overIPLimit(r *http.Request) bool {
+	limit := config.Get().RateLimitPerIP
+	return limit > 0 && s.overLimit(r.Context(), fmt.Sprintf("rate_limit:ip:%s", clientIP(r)), limit)
+}
+
+// overLimit counts a request against key's one-minute window and reports
+// whether the window is over limit. Redis errors fail open.
+func (s *Server) overLimit(ctx context.Context, key string, limit int) bool {
+	count, err := s.cache.GetClient().Incr(ctx, key).Result()
+	if err != nil {
+		return false
+	}
+	if count == 1 {
+		s.cache.GetClient().Expire(ctx, key, time.Minute)
+	}
+	return count > int64(limit)
+}
+
 func (s *Server) recoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -42,7 +96,7 @@ func (s *Server) recoveryMiddleware(next http.Handler) http.Handler {
 
 				s.metrics.IncrementPanic()
 
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				writeError(w, r, "Internal server error", http.StatusInternalServerError)
 			}
 		}()
 
@@ -50,11 +104,28 @@ func (s *Server) recoveryMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func (s *Server) timeoutMiddleware(next http.Handler) http.Handler {
+const (
+	defaultRouteTimeout  = 2 * time.Second
+	checkoutRouteTimeout = 500 * time.Millisecond
+	purchaseRouteTimeout = time.Second
+	imageRouteTimeout    = 5 * time.Second
+	adminRouteTimeout    = 5 * time.Second
+	exportRouteTimeout   = 10 * time.Minute
+	streamRouteTimeout   = time.Hour
+
+	defaultMaxBodyBytes = 4 << 10
+	adminMaxBodyBytes   = 1 << 20
+	catalogMaxBodyBytes = 16 << 20
+)
+
+// limit bounds a single route: the request context gets its own deadline and
+// the body is capped so slow or oversized uploads can't hold a worker.
+func (s *Server) limit(timeout time.Duration, maxBodyBytes int64, next http.HandlerFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
 		defer cancel()
 
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
 		r = r.WithContext(ctx)
 		next.ServeHTTP(w, r)
 	})
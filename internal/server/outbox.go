@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/config"
+	"flash_sale_contest/internal/database"
+	"flash_sale_contest/internal/notifications"
+)
+
+const (
+	// outboxBatch is how many events the relay claims at a time.
+	outboxBatch = 100
+	// outboxLease is how long a claimed event is kept from other replicas
+	// before it is claimed again, as when this one dies publishing it.
+	outboxLease = 30 * time.Second
+	// outboxRetention is how long published events stay in Postgres.
+	outboxRetention = 24 * time.Hour
+	// outboxPruneInterval is how often published events are pruned.
+	outboxPruneInterval = time.Hour
+)
+
+// startOutboxRelay starts publishing the purchase events CreatePurchase
+// writes to the outbox, for the default tenant and every other one. It
+// runs on every replica; claims keep them from publishing the same events.
+// It has to start after the webhooks and tenants it publishes to.
+func (s *Server) startOutboxRelay(ctx context.Context) {
+	interval := config.Get().OutboxRelayInterval
+	if interval <= 0 {
+		log.Println("Outbox relay disabled on this replica")
+		return
+	}
+	go s.runOutboxRelay(ctx, interval)
+	for _, t := range s.tenants {
+		go t.runOutboxRelay(ctx, interval)
+	}
+	go s.pruneOutbox(ctx)
+}
+
+// runOutboxRelay publishes the tenant's outbox every interval, and again
+// at once while it finds full batches.
+func (s *Server) runOutboxRelay(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for s.relayOutbox(ctx) == outboxBatch {
+		}
+	}
+}
+
+// relayOutbox claims a batch of events and publishes them, returning how
+// many it claimed. Events that cannot be published are held back to be
+// retried; none are dropped.
+func (s *Server) relayOutbox(ctx context.Context) int {
+	events, err := s.db.ClaimOutboxEvents(ctx, outboxBatch, outboxLease)
+	if err != nil {
+		log.Printf("Failed to claim outbox events: %v", err)
+		return 0
+	}
+
+	published := make([]int64, 0, len(events))
+	for _, e := range events {
+		if err := s.publishOutboxEvent(ctx, e); err != nil {
+			log.Printf("Failed to publish outbox event %d (attempt %d): %v", e.ID, e.Attempts, err)
+			s.metrics.IncrementOutboxFailures()
+			if err := s.db.FailOutboxEvent(ctx, e.ID, err); err != nil {
+				log.Printf("Failed to put off outbox event %d: %v", e.ID, err)
+			}
+			continue
+		}
+		published = append(published, e.ID)
+	}
+	if len(published) > 0 {
+		// Events not marked here are claimed again once their lease runs
+		// out; Redis remembers them and they are not published twice.
+		if err := s.db.MarkOutboxPublished(ctx, published); err != nil {
+			log.Printf("Failed to mark %d outbox events published: %v", len(published), err)
+		}
+	}
+	return len(events)
+}
+
+// publishOutboxEvent queues the notification and webhook deliveries of a
+// purchase event in one step, unless an earlier claim already did.
+func (s *Server) publishOutboxEvent(ctx context.Context, e database.OutboxEvent) error {
+	if e.Type != database.OutboxPurchaseCompleted {
+		return fmt.Errorf("unknown event type %q", e.Type)
+	}
+	var purchase database.Purchase
+	if err := json.Unmarshal(e.Payload, &purchase); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	var notification []byte
+	if s.notifications {
+		var err error
+		notification, err = notifications.Encode(notifications.Event{
+			Type:       notifications.EventPurchaseCompleted,
+			SaleID:     purchase.SaleID,
+			UserID:     purchase.UserID,
+			ItemID:     purchase.ItemID,
+			Tenant:     s.tenant,
+			OccurredAt: purchase.PurchaseTime,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	var deliveries []cache.WebhookDelivery
+	if s.webhooks != nil {
+		var err error
+		deliveries, err = s.webhooks.PurchaseDeliveries(ctx, s.tenant, fmt.Sprintf("outbox-%d", e.ID), &purchase)
+		if err != nil {
+			return err
+		}
+	}
+
+	fresh, err := s.cache.PublishOutboxEvent(ctx, e.ID, notification, deliveries)
+	if err != nil {
+		return err
+	}
+	if fresh {
+		s.metrics.IncrementOutboxPublished()
+	}
+	return nil
+}
+
+// pruneOutbox deletes published events once they are outboxRetention old.
+func (s *Server) pruneOutbox(ctx context.Context) {
+	ticker := time.NewTicker(outboxPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pruned, err := s.db.PruneOutbox(ctx, time.Now().Add(-outboxRetention))
+		if err != nil {
+			log.Printf("Failed to prune the outbox: %v", err)
+			continue
+		}
+		if pruned > 0 {
+			log.Printf("Pruned %d published outbox events", pruned)
+		}
+	}
+}
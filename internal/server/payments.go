@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/database"
+	"flash_sale_contest/internal/trace"
+)
+
+// enqueuePurchase is the first phase of two-phase purchase mode: the code is
+// already redeemed, so the item is held for the buyer while the payments
+// worker charges them. Details are stored right away, so they can be
+// confirmed while the payment is pending.
+func (s *Server) enqueuePurchase(w http.ResponseWriter, r *http.Request, code string, info *cache.CheckoutInfo, details *api.PurchaseDetails, start time.Time) {
+	pending := &cache.PendingPurchase{
+		PurchaseID:  info.PurchaseID,
+		Code:        code,
+		SaleID:      info.SaleID,
+		UserID:      info.UserID,
+		ItemID:      info.ItemID,
+		Unit:        info.Unit,
+		RecipientID: info.RecipientID,
+		Category:    info.Category,
+		PromoCode:   info.PromoCode,
+		PercentOff:  info.PercentOff,
+		Tenant:      s.tenant,
+		Status:      cache.PurchasePending,
+		UpdatedAt:   time.Now(),
+	}
+	if sc, ok := trace.FromContext(r.Context()); ok {
+		pending.Traceparent = sc.Traceparent()
+	}
+	pending.CorrelationID = trace.CorrelationID(r.Context())
+
+	if err := s.cache.EnqueuePendingPurchase(r.Context(), pending); err != nil {
+		log.Printf("Failed to enqueue purchase for code %s: %v", code, err)
+		if err := s.cache.ReleaseReservation(r.Context(), info.SaleID, info.Owner(), info.ItemID, info.Category, info.PromoCode); err != nil {
+			log.Printf("Failed to release reservation for code %s: %v", code, err)
+		} else {
+			s.recordMovement(database.MovementRelease, info.SaleID, info.UserID, info.ItemID)
+		}
+		s.metrics.IncrementPurchaseFailed()
+		writeError(w, r, "Failed to complete purchase", http.StatusInternalServerError)
+		return
+	}
+
+	s.metrics.RecordPurchaseLatency(time.Since(start))
+	if details != nil {
+		s.recordPurchaseDetails(trace.Detach(r.Context()), pending.PurchaseID, info.SaleID, info.UserID, info.ItemID, details)
+	}
+
+	resp := api.PendingPurchaseResponse{
+		PurchaseID: pending.PurchaseID,
+		Status:     pending.Status,
+	}
+	writeJSON(w, r, http.StatusAccepted, resp)
+}
+
+// onPaymentConfirmed and onPaymentFailed run on the default tenant's
+// Server, which owns the payments worker, and hand off to the purchase's.
+func (s *Server) onPaymentConfirmed(p *cache.PendingPurchase) {
+	s = s.forTenant(p.Tenant)
+	s.metrics.IncrementPurchaseSuccess()
+	s.metrics.IncrementItemsSold()
+	s.recordMovement(database.MovementSell, p.SaleID, p.UserID, p.ItemID)
+	ctx := trace.WithCorrelationID(context.Background(), p.CorrelationID)
+	if sc, ok := trace.Parse(p.Traceparent); ok {
+		ctx = trace.WithRemote(ctx, sc)
+	}
+	s.recordPurchase(ctx, &database.Purchase{
+		ID:          p.PurchaseID,
+		SaleID:      p.SaleID,
+		UserID:      p.UserID,
+		ItemID:      p.ItemID,
+		Unit:        p.Unit,
+		RecipientID: p.RecipientID,
+		PromoCode:   p.PromoCode,
+		PercentOff:  p.PercentOff,
+	}, p.Code)
+}
+
+// onPaymentFailed is called once the worker has released the reservation,
+// or logged why it could not. The sale's webhooks are told the purchase
+// failed; confirmed purchases reach them through the outbox.
+func (s *Server) onPaymentFailed(p *cache.PendingPurchase) {
+	s = s.forTenant(p.Tenant)
+	s.metrics.IncrementPurchaseFailed()
+	s.recordMovement(database.MovementRelease, p.SaleID, p.UserID, p.ItemID)
+	if s.webhooks == nil {
+		return
+	}
+
+	ctx := context.Background()
+	deliveries, err := s.webhooks.PaymentFailedDeliveries(ctx, p)
+	if err != nil {
+		log.Printf("Failed to notify webhooks of failed purchase %s: %v", p.PurchaseID, err)
+		return
+	}
+	for _, d := range deliveries {
+		if err := s.cache.ScheduleWebhook(ctx, d.ID, d.Payload, time.Now()); err != nil {
+			log.Printf("Failed to schedule webhook delivery %s: %v", d.ID, err)
+		}
+	}
+}
+
+func (s *Server) purchaseStatusHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := s.cache.GetPendingPurchase(r.Context(), r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			writeError(w, r, "Purchase not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, r, "Failed to load purchase", http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.PurchaseStatusResponse{
+		PurchaseID: p.PurchaseID,
+		Status:     p.Status,
+		SaleID:     p.SaleID,
+		UserID:     p.UserID,
+		ItemID:     p.ItemID,
+		UpdatedAt:  p.UpdatedAt,
+	}
+	if p.Status == cache.PurchaseConfirmed {
+		resp.Receipt = s.receipt(p.PurchaseID, p.SaleID, p.UserID, p.ItemID, p.UpdatedAt)
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
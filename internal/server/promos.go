@@ -0,0 +1,109 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/database"
+)
+
+var promoCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+// createPromoHandler stores a promo code in Postgres and publishes it to
+// Redis, where checkouts redeem it.
+func (s *Server) createPromoHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := api.CreatePromoRequest{Code: strings.ToUpper(query.Get("code"))}
+	var err error
+	if !promoCodePattern.MatchString(req.Code) {
+		writeError(w, r, "code must be 3-32 letters, digits, '-' or '_'", http.StatusBadRequest)
+		return
+	}
+	if req.PercentOff, err = strconv.Atoi(query.Get("percent_off")); err != nil || req.PercentOff < 1 || req.PercentOff > 100 {
+		writeError(w, r, "percent_off must be between 1 and 100", http.StatusBadRequest)
+		return
+	}
+	if v := query.Get("max_redemptions"); v != "" {
+		if req.MaxRedemptions, err = strconv.Atoi(v); err != nil || req.MaxRedemptions < 0 {
+			writeError(w, r, "max_redemptions must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("expires_at"); v != "" {
+		if req.ExpiresAt, err = time.Parse(time.RFC3339, v); err != nil || !req.ExpiresAt.After(time.Now()) {
+			writeError(w, r, "expires_at must be a future RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	promo := &database.PromoCode{
+		Code:           req.Code,
+		PercentOff:     req.PercentOff,
+		MaxRedemptions: req.MaxRedemptions,
+		ExpiresAt:      req.ExpiresAt,
+	}
+	if err := s.db.CreatePromoCode(ctx, promo); err != nil {
+		if err.Error() == "promo code exists" {
+			writeError(w, r, "Promo code exists", http.StatusConflict)
+			return
+		}
+		log.Printf("Failed to create promo code %s: %v", req.Code, err)
+		writeError(w, r, "Failed to create promo code", http.StatusInternalServerError)
+		return
+	}
+	if err := s.cache.SetPromo(ctx, &cache.Promo{
+		Code:           promo.Code,
+		PercentOff:     promo.PercentOff,
+		MaxRedemptions: promo.MaxRedemptions,
+		ExpiresAt:      promo.ExpiresAt,
+	}); err != nil {
+		log.Printf("Failed to publish promo code %s: %v", req.Code, err)
+		writeError(w, r, "Failed to publish promo code", http.StatusServiceUnavailable)
+		return
+	}
+	log.Printf("Promo code %s created: %d%% off, max %d redemptions", promo.Code, promo.PercentOff, promo.MaxRedemptions)
+
+	writeJSON(w, r, http.StatusOK, apiPromo(promo, 0))
+}
+
+// listPromosHandler lists promo codes with their redemption counts.
+func (s *Server) listPromosHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	promos, err := s.db.ListPromoCodes(ctx)
+	if err != nil {
+		writeError(w, r, "Failed to load promo codes", http.StatusInternalServerError)
+		return
+	}
+	codes := make([]string, len(promos))
+	for i, p := range promos {
+		codes[i] = p.Code
+	}
+	redeemed, err := s.cache.GetPromoRedemptions(ctx, codes...)
+	if err != nil {
+		log.Printf("Failed to read promo redemptions: %v", err)
+	}
+
+	resp := api.PromosResponse{Promos: make([]api.Promo, len(promos))}
+	for i := range promos {
+		resp.Promos[i] = apiPromo(&promos[i], redeemed[promos[i].Code])
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+func apiPromo(p *database.PromoCode, redeemed int) api.Promo {
+	return api.Promo{
+		Code:           p.Code,
+		PercentOff:     p.PercentOff,
+		MaxRedemptions: p.MaxRedemptions,
+		Redeemed:       redeemed,
+		ExpiresAt:      p.ExpiresAt,
+		CreatedAt:      p.CreatedAt,
+	}
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/database"
+)
+
+// maxDetailLength bounds every field of the purchase details.
+const maxDetailLength = 200
+
+// readPurchaseDetails decodes and validates the details a buyer may post
+// with /purchase. It returns nil without an error when the body is empty.
+func readPurchaseDetails(r *http.Request) (*api.PurchaseDetails, error) {
+	var d api.PurchaseDetails
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&d); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("purchase details must be a JSON object: %v", err)
+	}
+
+	fields := []*string{&d.Name, &d.Email, &d.Phone, &d.AddressLine1, &d.AddressLine2, &d.City, &d.Region, &d.PostalCode, &d.Country}
+	for _, field := range fields {
+		*field = strings.TrimSpace(*field)
+		if len(*field) > maxDetailLength {
+			return nil, fmt.Errorf("purchase details fields must be at most %d characters", maxDetailLength)
+		}
+	}
+	d.Country = strings.ToUpper(d.Country)
+
+	switch {
+	case d.Name == "":
+		return nil, fmt.Errorf("name is required")
+	case d.AddressLine1 == "":
+		return nil, fmt.Errorf("address_line1 is required")
+	case d.City == "":
+		return nil, fmt.Errorf("city is required")
+	case d.PostalCode == "":
+		return nil, fmt.Errorf("postal_code is required")
+	case !isCountryCode(d.Country):
+		return nil, fmt.Errorf("country must be a two-letter ISO 3166-1 code")
+	}
+	if addr, err := mail.ParseAddress(d.Email); err != nil || addr.Address != d.Email {
+		return nil, fmt.Errorf("email is invalid")
+	}
+	return &d, nil
+}
+
+func isCountryCode(s string) bool {
+	return len(s) == 2 && s[0] >= 'A' && s[0] <= 'Z' && s[1] >= 'A' && s[1] <= 'Z'
+}
+
+// recordPurchaseDetails stores the details submitted with a purchase on the
+// write pool, like the purchase itself; details the pool or the database
+// refuses are parked in the dead letter queue.
+func (s *Server) recordPurchaseDetails(ctx context.Context, purchaseID, saleID, userID, itemID string, d *api.PurchaseDetails) {
+	details := &database.PurchaseDetails{
+		PurchaseID:   purchaseID,
+		SaleID:       saleID,
+		UserID:       userID,
+		ItemID:       itemID,
+		Name:         d.Name,
+		Email:        d.Email,
+		Phone:        d.Phone,
+		AddressLine1: d.AddressLine1,
+		AddressLine2: d.AddressLine2,
+		City:         d.City,
+		Region:       d.Region,
+		PostalCode:   d.PostalCode,
+		Country:      d.Country,
+		SubmittedAt:  time.Now(),
+	}
+	s.persist(func() {
+		if err := s.db.SavePurchaseDetails(ctx, details); err != nil {
+			log.Printf("Failed to save details of purchase %s: %v", purchaseID, err)
+			s.parkFailedWrite(cache.DeadLetterPurchaseDetails, details, err)
+		}
+	}, func() {
+		s.parkFailedWrite(cache.DeadLetterPurchaseDetails, details, errWriteShed)
+	})
+}
+
+// purchaseDetailsHandler shows a winner the details they submitted. The
+// purchase ID is only known to its buyer.
+func (s *Server) purchaseDetailsHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.PurchaseDetailsRequest{PurchaseID: r.PathValue("id")}
+	d, err := s.db.GetPurchaseDetails(r.Context(), req.PurchaseID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, "Purchase details not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to load details of purchase %s: %v", req.PurchaseID, err)
+		writeError(w, r, "Failed to load purchase details", http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.PurchaseDetailsResponse{
+		PurchaseID: d.PurchaseID,
+		SaleID:     d.SaleID,
+		UserID:     d.UserID,
+		ItemID:     d.ItemID,
+		Details: api.PurchaseDetails{
+			Name:         d.Name,
+			Email:        d.Email,
+			Phone:        d.Phone,
+			AddressLine1: d.AddressLine1,
+			AddressLine2: d.AddressLine2,
+			City:         d.City,
+			Region:       d.Region,
+			PostalCode:   d.PostalCode,
+			Country:      d.Country,
+		},
+		SubmittedAt: d.SubmittedAt,
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, r, http.StatusOK, resp)
+}
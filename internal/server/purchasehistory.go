@@ -0,0 +1,54 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"flash_sale_contest/internal/api"
+)
+
+const userPurchasesPageSize = 20
+
+// userPurchasesHandler lists the items a user bought or was given, newest
+// first. Purchases still waiting on the write pool or a payment are not
+// listed yet.
+func (s *Server) userPurchasesHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.UserPurchasesRequest{UserID: r.PathValue("user_id")}
+	req.Page, _ = strconv.Atoi(r.URL.Query().Get("page"))
+	if req.Page < 1 {
+		req.Page = 1
+	}
+
+	purchases, err := s.db.ListUserPurchases(r.Context(), req.UserID, userPurchasesPageSize, (req.Page-1)*userPurchasesPageSize)
+	if err != nil {
+		log.Printf("Failed to list purchases of user %s: %v", req.UserID, err)
+		writeError(w, r, "Failed to list purchases", http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.UserPurchasesResponse{
+		UserID:    req.UserID,
+		Page:      req.Page,
+		PageSize:  userPurchasesPageSize,
+		Purchases: make([]api.UserPurchase, 0, len(purchases)),
+	}
+	for _, p := range purchases {
+		purchase := api.UserPurchase{
+			SaleID:      p.SaleID,
+			ItemID:      p.ItemID,
+			Unit:        p.Unit,
+			PromoCode:   p.PromoCode,
+			PurchasedAt: p.PurchaseTime,
+		}
+		switch {
+		case p.RecipientID == "":
+		case p.UserID == req.UserID:
+			purchase.GiftTo = p.RecipientID
+		default:
+			purchase.GiftFrom = p.UserID
+		}
+		resp.Purchases = append(resp.Purchases, purchase)
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
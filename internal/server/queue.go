@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/config"
+	"flash_sale_contest/internal/flags"
+	"flash_sale_contest/internal/sale"
+)
+
+// queueAdmitted is how many queue places have been admitted by now: every
+// second since the sale opened lets in another QUEUE_ADMIT_RATE. It depends
+// only on the clock, so every replica agrees without coordinating.
+func queueAdmitted(activeSale *sale.ActiveSale, now time.Time, rate int) int64 {
+	elapsed := now.Sub(activeSale.StartTime)
+	if elapsed < 0 {
+		return 0
+	}
+	return int64(rate) * (int64(elapsed/time.Second) + 1)
+}
+
+// queueOpen reports whether checkouts of the sale go through the queue.
+func (s *Server) queueOpen(ctx context.Context, activeSale *sale.ActiveSale, now time.Time, cfg *config.Config) bool {
+	if cfg.QueueWindow <= 0 || cfg.QueueAdmitRate <= 0 || !now.Before(activeSale.StartTime.Add(cfg.QueueWindow)) {
+		return false
+	}
+	return s.flags.Enabled(ctx, flags.Queue)
+}
+
+// admitCheckout places the user in the sale's queue during the queue window.
+// It returns true when the user's place has been admitted; otherwise it has
+// answered 202 with the token and position to poll. Redis trouble admits
+// the checkout rather than stalling the sale.
+func (s *Server) admitCheckout(w http.ResponseWriter, r *http.Request, activeSale *sale.ActiveSale, userID string) bool {
+	cfg := config.Get()
+	now := time.Now()
+	if !s.queueOpen(r.Context(), activeSale, now, cfg) {
+		return true
+	}
+
+	token, place, err := s.cache.JoinQueue(r.Context(), activeSale.SaleID, userID)
+	if err != nil {
+		log.Printf("Failed to queue user %s, admitting: %v", userID, err)
+		return true
+	}
+	position := place - queueAdmitted(activeSale, now, cfg.QueueAdmitRate)
+	if position <= 0 {
+		return true
+	}
+
+	s.metrics.IncrementQueuedCheckouts()
+	resp := queueStatus(activeSale, token, position, cfg.QueueAdmitRate)
+	w.Header().Set("Retry-After", strconv.Itoa(max(resp.EstimatedWaitSeconds, 1)))
+	writeJSON(w, r, http.StatusAccepted, resp)
+	return false
+}
+
+// queueStatusHandler reports a queue token's position. Once admitted, the
+// holder retries /checkout.
+func (s *Server) queueStatusHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.QueueStatusRequest{Token: r.URL.Query().Get("token")}
+	if req.Token == "" {
+		writeError(w, r, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	activeSale := s.saleManager.GetCurrentSale()
+	if activeSale == nil {
+		writeError(w, r, "Queue token not found", http.StatusNotFound)
+		return
+	}
+	place, err := s.cache.QueuePlace(r.Context(), activeSale.SaleID, req.Token)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			writeError(w, r, "Queue token not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, r, "Failed to load queue position", http.StatusInternalServerError)
+		return
+	}
+
+	cfg := config.Get()
+	now := time.Now()
+	position := int64(0)
+	if s.queueOpen(r.Context(), activeSale, now, cfg) {
+		position = max(place-queueAdmitted(activeSale, now, cfg.QueueAdmitRate), 0)
+	}
+
+	writeJSON(w, r, http.StatusOK, queueStatus(activeSale, req.Token, position, cfg.QueueAdmitRate))
+}
+
+func queueStatus(activeSale *sale.ActiveSale, token string, position int64, rate int) api.QueueStatusResponse {
+	resp := api.QueueStatusResponse{
+		Token:    token,
+		SaleID:   activeSale.SaleID,
+		Position: position,
+		Admitted: position <= 0,
+	}
+	if !resp.Admitted && rate > 0 {
+		resp.EstimatedWaitSeconds = int((position + int64(rate) - 1) / int64(rate))
+	}
+	return resp
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/config"
+)
+
+// receipt signs a purchase for its buyer. Receipts are checked against
+// their signature alone, so they hold up while the purchase is still on
+// its way to Postgres. It returns nil when RECEIPT_SECRET is unset.
+func (s *Server) receipt(purchaseID, saleID, userID, itemID string, purchasedAt time.Time) *api.Receipt {
+	secret := config.Get().ReceiptSecret
+	if secret == "" {
+		return nil
+	}
+	r := &api.Receipt{
+		PurchaseID:  purchaseID,
+		SaleID:      saleID,
+		UserID:      userID,
+		ItemID:      itemID,
+		PurchasedAt: purchasedAt.UTC().Truncate(time.Millisecond),
+	}
+	r.Signature = s.receiptMAC(secret, r)
+	return r
+}
+
+// receiptMAC is the hex HMAC-SHA256 of a receipt's fields and the tenant,
+// so a receipt cannot be replayed against another tenant.
+func (s *Server) receiptMAC(secret string, r *api.Receipt) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s\n%s", s.tenant, r.PurchaseID, r.SaleID, r.UserID, r.ItemID,
+		r.PurchasedAt.UTC().Format(time.RFC3339Nano))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyReceiptHandler tells whether a receipt's fields are the ones this
+// service signed.
+func (s *Server) verifyReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := api.VerifyReceiptRequest{
+		PurchaseID:  r.PathValue("purchase_id"),
+		SaleID:      q.Get("sale_id"),
+		UserID:      q.Get("user_id"),
+		ItemID:      q.Get("item_id"),
+		PurchasedAt: q.Get("purchased_at"),
+		Signature:   q.Get("signature"),
+	}
+	secret := config.Get().ReceiptSecret
+	if secret == "" {
+		writeError(w, r, "Receipts are disabled", http.StatusNotFound)
+		return
+	}
+	purchasedAt, err := time.Parse(time.RFC3339Nano, req.PurchasedAt)
+	if err != nil || req.SaleID == "" || req.UserID == "" || req.ItemID == "" || req.Signature == "" {
+		writeError(w, r, "sale_id, user_id, item_id, purchased_at and signature are required", http.StatusBadRequest)
+		return
+	}
+
+	receipt := &api.Receipt{
+		PurchaseID:  req.PurchaseID,
+		SaleID:      req.SaleID,
+		UserID:      req.UserID,
+		ItemID:      req.ItemID,
+		PurchasedAt: purchasedAt,
+	}
+	valid := subtle.ConstantTimeCompare([]byte(req.Signature), []byte(s.receiptMAC(secret, receipt))) == 1
+
+	resp := api.VerifyReceiptResponse{PurchaseID: req.PurchaseID, Valid: valid}
+	writeJSON(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/config"
+	"flash_sale_contest/internal/flags"
+)
+
+// watchConfigReloads reloads the configuration on every SIGHUP.
+func (s *Server) watchConfigReloads(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				if _, err := config.Reload(); err != nil {
+					log.Printf("Config reload on SIGHUP failed, keeping the running config: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// reloadConfigHandler reloads this replica's configuration, as SIGHUP does.
+// Other replicas keep theirs until they are reloaded too.
+func (s *Server) reloadConfigHandler(w http.ResponseWriter, r *http.Request) {
+	changed, err := config.Reload()
+	if err != nil {
+		log.Printf("Config reload failed, keeping the running config: %v", err)
+		writeError(w, r, "Invalid configuration: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := api.ConfigReloadResponse{Changed: changed, ReloadedAt: time.Now().UTC()}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// flagDefaults are the feature flags of a tenant before any override.
+func flagDefaults(cfg *config.Config) map[string]bool {
+	return map[string]bool{
+		flags.Lottery:       cfg.CheckoutMode == checkoutModeLottery,
+		flags.Queue:         true,
+		flags.InventoryGate: true,
+	}
+}
+
+// applyConfig carries a reloaded configuration over to what startSales set
+// up from the old one: the flag defaults and TTL, and the code TTL of the
+// running sale, which replaces any TTL an admin set for it.
+func (s *Server) applyConfig(old, next *config.Config) {
+	s.flags.Configure(flagDefaults(next), next.FlagRefresh)
+
+	if next.CheckoutCodeTTL == old.CheckoutCodeTTL {
+		return
+	}
+	activeSale := s.saleManager.GetCurrentSale()
+	if activeSale == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.setSaleCodeTTL(ctx, activeSale.SaleID, next.CheckoutCodeTTL); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to apply the reloaded code TTL to sale %s: %v", activeSale.SaleID, err)
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/cache"
+)
+
+// userReservationsHandler lists a user's unredeemed checkout codes in the
+// active sale with the time left on each. Codes issued by the Postgres
+// fallback are not listed.
+func (s *Server) userReservationsHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.UserReservationsRequest{UserID: r.PathValue("user_id")}
+
+	activeSale := s.saleManager.GetCurrentSale()
+	if activeSale == nil {
+		writeError(w, r, "No active sale", http.StatusNotFound)
+		return
+	}
+
+	reservations, err := s.cache.ListReservations(r.Context(), activeSale.SaleID, req.UserID)
+	if err != nil {
+		log.Printf("Failed to list reservations for user %s: %v", req.UserID, err)
+		writeError(w, r, "Failed to load reservations", http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.UserReservationsResponse{
+		SaleID:       activeSale.SaleID,
+		UserID:       req.UserID,
+		Reservations: make([]api.Reservation, len(reservations)),
+	}
+	for i, res := range reservations {
+		resp.Reservations[i] = api.Reservation{
+			Code:             res.Code,
+			ItemID:           res.ItemID,
+			Category:         res.Category,
+			ExpiresAt:        res.ExpiresAt,
+			ExpiresInSeconds: int(time.Until(res.ExpiresAt).Seconds()),
+			Extended:         res.Extended,
+		}
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// codeExtendWindow is how close to expiring a checkout code must be before
+// it can be extended.
+const codeExtendWindow = time.Minute
+
+// extendCheckoutHandler gives a checkout code another code TTL of the
+// active sale, once and only in its last minute, so a buyer still paying
+// does not lose the item at the boundary. Codes issued by the Postgres
+// fallback cannot be extended.
+func (s *Server) extendCheckoutHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.ExtendCheckoutRequest{Code: r.PathValue("code")}
+	if strings.HasPrefix(req.Code, fallbackCodePrefix) {
+		writeError(w, r, "Codes issued by the database fallback cannot be extended", http.StatusConflict)
+		return
+	}
+
+	activeSale := s.saleManager.GetCurrentSale()
+	if activeSale == nil {
+		writeError(w, r, "No active sale", http.StatusNotFound)
+		return
+	}
+
+	info, err := s.cache.ExtendCheckout(r.Context(), activeSale.SaleID, req.Code, codeExtendWindow, activeSale.CodeExpiry())
+	if err != nil {
+		switch {
+		case err.Error() == "invalid or expired code":
+			s.metrics.IncrementCodeInvalidErrors()
+			writeError(w, r, err.Error(), http.StatusBadRequest)
+		case err.Error() == "code already extended":
+			writeError(w, r, "Code has already been extended", http.StatusConflict)
+		case err.Error() == "code not expiring yet":
+			writeError(w, r, "Codes can only be extended in their last minute", http.StatusConflict)
+		case err.Error() == "sale closing":
+			writeError(w, r, "Sale is closing", http.StatusConflict)
+		case errors.Is(err, cache.ErrTimeout):
+			writeError(w, r, "Extension timed out", http.StatusServiceUnavailable)
+		default:
+			log.Printf("Failed to extend code %s: %v", req.Code, err)
+			writeError(w, r, "Failed to extend code", http.StatusInternalServerError)
+		}
+		return
+	}
+	s.metrics.IncrementCodesExtended()
+
+	resp := api.ExtendCheckoutResponse{
+		Code:             req.Code,
+		ItemID:           info.ItemID,
+		ExpiresAt:        info.ExpiresAt,
+		ExpiresInSeconds: int(time.Until(info.ExpiresAt).Seconds()),
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// itemAvailabilityHandler tells frontends whether an item can still be
+// checked out, so they can grey out held and sold items.
+func (s *Server) itemAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.ItemAvailabilityRequest{ItemID: r.PathValue("item_id")}
+
+	activeSale := s.saleManager.GetCurrentSale()
+	if activeSale == nil {
+		writeError(w, r, "No active sale", http.StatusNotFound)
+		return
+	}
+
+	availability, err := s.cache.GetItemAvailability(r.Context(), activeSale.SaleID, req.ItemID)
+	if err != nil {
+		if err.Error() == "unknown item" {
+			writeError(w, r, "Item not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to check availability of item %s: %v", req.ItemID, err)
+		writeError(w, r, "Failed to check availability", http.StatusInternalServerError)
+		return
+	}
+	// Views rank items for the most_viewed showcase; losing a few is fine.
+	go s.cache.RecordItemView(context.Background(), activeSale.SaleID, req.ItemID)
+
+	resp := api.ItemAvailabilityResponse{
+		SaleID: activeSale.SaleID,
+		ItemID: req.ItemID,
+		Status: availability.Status,
+	}
+	if !availability.HeldUntil.IsZero() {
+		resp.HeldUntil = &availability.HeldUntil
+	}
+	if availability.UnitsLeft >= 0 {
+		resp.UnitsLeft = &availability.UnitsLeft
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, r, http.StatusOK, resp)
+}
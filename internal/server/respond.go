@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/trace"
+)
+
+const (
+	// serverTimeHeader carries when the server wrote the response, so
+	// clients can line up their clock with the sale's.
+	serverTimeHeader = "X-Server-Time"
+	// serverTimingHeader carries how long the server spent on the request,
+	// which browsers show next to the network timings.
+	serverTimingHeader = "Server-Timing"
+)
+
+type requestStartKey struct{}
+
+// withRequestStart records when the server started on a request.
+func withRequestStart(ctx context.Context, start time.Time) context.Context {
+	return context.WithValue(ctx, requestStartKey{}, start)
+}
+
+// stamp sets the headers every JSON response carries: the server's time
+// and, when the request start is known, the time spent on it. The request
+// ID is set by traceMiddleware.
+func stamp(w http.ResponseWriter, r *http.Request, now time.Time) {
+	w.Header().Set(serverTimeHeader, now.UTC().Format(time.RFC3339Nano))
+	if start, ok := r.Context().Value(requestStartKey{}).(time.Time); ok {
+		w.Header().Set(serverTimingHeader, fmt.Sprintf("app;dur=%.1f", float64(now.Sub(start).Microseconds())/1000))
+	}
+}
+
+// writeJSON answers with status and v as the data of an api.Envelope. A
+// value that cannot be encoded is logged and answered with a 500 instead.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Failed to encode response to %s %s: %v", r.Method, r.URL.Path, err)
+		writeError(w, r, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	body := envelope(r, data, now)
+	stamp(w, r, now)
+	writeBody(w, status, body, responseEncoding(w, r, "application/json", len(body)))
+}
+
+// envelope wraps an encoded response in an api.Envelope stamped with now
+// and the request's ID, as writeError stamps errors.
+func envelope(r *http.Request, data []byte, now time.Time) []byte {
+	body, _ := json.Marshal(api.Envelope{
+		Data:      json.RawMessage(data),
+		RequestID: trace.CorrelationID(r.Context()),
+		Timestamp: now.UTC(),
+	})
+	return body
+}
+
+// writeError answers with status and an api.ErrorResponse carrying message.
+// It takes its arguments in the order of http.Error, which it replaces.
+func writeError(w http.ResponseWriter, r *http.Request, message string, status int) {
+	now := time.Now()
+	body, _ := json.Marshal(api.ErrorResponse{
+		Error:     message,
+		Status:    status,
+		RequestID: trace.CorrelationID(r.Context()),
+		Timestamp: now.UTC(),
+	})
+	// Headers meant for a body that was never written must not describe
+	// this one.
+	w.Header().Del("Content-Length")
+	w.Header().Del("ETag")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	stamp(w, r, now)
+	writeBody(w, status, body, responseEncoding(w, r, "application/json", len(body)))
+}
+
+// writeBody writes a JSON body, compressed with encoding unless it is
+// empty.
+func writeBody(w http.ResponseWriter, status int, body []byte, encoding string) {
+	w.Header().Set("Content-Type", "application/json")
+	if encoding == "" {
+		w.WriteHeader(status)
+		w.Write(body)
+		return
+	}
+
+	w.Header().Set("Content-Encoding", encoding)
+	w.WriteHeader(status)
+	c := getCompressor(encoding, w)
+	c.Write(body)
+	c.Close()
+	putCompressor(encoding, c)
+}
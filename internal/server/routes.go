@@ -2,124 +2,212 @@ package server
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"flash_sale_contest/internal/api"
 	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/codes"
+	"flash_sale_contest/internal/config"
 	"flash_sale_contest/internal/database"
+	"flash_sale_contest/internal/flags"
+	"flash_sale_contest/internal/money"
+	"flash_sale_contest/internal/sale"
+	"flash_sale_contest/internal/trace"
 )
 
 func (s *Server) RegisterRoutes() http.Handler {
-	mux := http.NewServeMux()
-
-	mux.HandleFunc("/", s.HelloWorldHandler)
-	mux.HandleFunc("/health", s.healthHandler)
-	mux.HandleFunc("/metrics", s.metricsHandler)
-
-	mux.HandleFunc("/sale/current", s.currentSaleHandler)
-	mux.HandleFunc("/sale/status", s.saleStatusHandler)
-	mux.HandleFunc("/sale/info", s.saleInfoHandler)
-
-	mux.HandleFunc("POST /checkout", s.checkoutHandler)
-	mux.HandleFunc("POST /purchase", s.purchaseHandler)
-
-	handler := s.corsMiddleware(mux)
-	handler = s.timeoutMiddleware(handler)
+	var handler http.Handler = s.routes()
+	if len(s.tenants) > 0 {
+		handler = s.tenantRouter(handler)
+	}
+	handler = s.corsMiddleware(handler)
 	handler = s.recoveryMiddleware(handler)
 	handler = s.rateLimitMiddleware(handler)
+	handler = s.accessLogMiddleware(handler)
+	handler = s.traceMiddleware(handler)
 
 	return handler
 }
 
-func (s *Server) corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, PATCH")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-CSRF-Token")
-		w.Header().Set("Access-Control-Allow-Credentials", "false")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
+// routes serves one tenant's API.
+func (s *Server) routes() *http.ServeMux {
+	mux := http.NewServeMux()
 
-		next.ServeHTTP(w, r)
-	})
+	mux.Handle("/", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.HelloWorldHandler))
+	mux.Handle("/health", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.healthHandler))
+	mux.Handle("GET /healthz", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.healthzHandler))
+	mux.Handle("GET /readyz", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.readyzHandler))
+	mux.Handle("/metrics", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.metricsHandler))
+
+	mux.Handle("/sale/current", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.currentSaleHandler))
+	mux.Handle("/sale/status", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.saleStatusHandler))
+	mux.Handle("/sale/info", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.saleInfoHandler))
+	mux.Handle("GET /sale/items", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.saleItemsHandler))
+	mux.Handle("GET /sales", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.salesHistoryHandler))
+	mux.Handle("GET /sale/{sale_id}/sold", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.soldItemsHandler))
+	mux.Handle("GET /sale/analytics", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.admin(s.saleAnalyticsHandler)))
+
+	mux.Handle("GET /items/{item_id}/image", s.limit(imageRouteTimeout, defaultMaxBodyBytes, s.itemImageHandler))
+
+	mux.Handle("GET /openapi.json", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.openAPIHandler))
+	mux.Handle("GET /docs", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.docsHandler))
+
+	mux.Handle("POST /admin/metrics/reset", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.resetMetricsHandler)))
+	mux.Handle("GET /admin/dlq", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.deadLettersHandler)))
+	mux.Handle("POST /admin/promos", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.createPromoHandler)))
+	mux.Handle("GET /admin/promos", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.listPromosHandler)))
+	mux.Handle("POST /admin/dlq/replay", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.replayDeadLettersHandler)))
+	mux.Handle("GET /admin/attempt-log", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.attemptLogHandler)))
+	mux.Handle("POST /admin/attempt-log", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.setAttemptLogHandler)))
+	mux.Handle("GET /admin/flags", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.flagsHandler)))
+	mux.Handle("POST /admin/flags/{name}", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.setFlagHandler)))
+	mux.Handle("DELETE /admin/flags/{name}", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.clearFlagHandler)))
+	mux.Handle("POST /admin/api-keys", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.createAPIKeyHandler)))
+	mux.Handle("GET /admin/api-keys", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.apiKeysHandler)))
+	mux.Handle("DELETE /admin/api-keys/{key_id}", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.deleteAPIKeyHandler)))
+	mux.Handle("GET /admin/bans", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.bansHandler)))
+	mux.Handle("POST /admin/bans/{user_id}", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.banUserHandler)))
+	mux.Handle("DELETE /admin/bans/{user_id}", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.unbanUserHandler)))
+	mux.Handle("POST /admin/config/reload", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.reloadConfigHandler)))
+	mux.Handle("GET /admin/redis/audit", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.redisAuditHandler)))
+	mux.Handle("POST /admin/dry-run", s.limit(exportRouteTimeout, adminMaxBodyBytes, s.admin(s.dryRunHandler)))
+	mux.Handle("POST /admin/sales/{sale_id}/items", s.limit(exportRouteTimeout, catalogMaxBodyBytes, s.admin(s.uploadCatalogHandler)))
+	mux.Handle("GET /admin/sales/{sale_id}/items", s.limit(exportRouteTimeout, adminMaxBodyBytes, s.admin(s.exportCatalogHandler)))
+	mux.Handle("GET /admin/sales/{sale_id}/export", s.limit(exportRouteTimeout, adminMaxBodyBytes, s.admin(s.exportSaleHandler)))
+	mux.Handle("POST /admin/sales/{sale_id}/code-ttl", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.saleCodeTTLHandler)))
+	mux.Handle("POST /admin/sales/{sale_id}/oversell-buffer", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.saleOversellBufferHandler)))
+	mux.Handle("POST /admin/sales/{sale_id}/snapshot", s.limit(exportRouteTimeout, adminMaxBodyBytes, s.admin(s.snapshotSaleHandler)))
+	mux.Handle("POST /admin/sales/{sale_id}/restore", s.limit(exportRouteTimeout, adminMaxBodyBytes, s.admin(s.restoreSaleHandler)))
+	mux.Handle("GET /admin/sales/{sale_id}/top-buyers", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.topBuyersHandler)))
+	mux.Handle("GET /admin/sales/{sale_id}/heatmap", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.saleHeatmapHandler)))
+	mux.Handle("GET /admin/sales/{sale_id}/stats", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.adminOrAPIKey(database.APIKeyScopeStats, s.saleStatsHandler)))
+	mux.Handle("GET /admin/sales/{sale_id}/ledger", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.saleLedgerHandler)))
+	mux.Handle("POST /admin/sales/{sale_id}/users/{user_id}/revoke", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.revokePurchasesHandler)))
+	mux.Handle("PUT /admin/sales/{sale_id}/showcase", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.staffPicksHandler)))
+	mux.Handle("POST /admin/sales/{sale_id}/webhooks", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.createWebhookHandler)))
+	mux.Handle("GET /admin/sales/{sale_id}/webhooks", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.webhooksHandler)))
+	mux.Handle("DELETE /admin/sales/{sale_id}/webhooks/{webhook_id}", s.limit(adminRouteTimeout, adminMaxBodyBytes, s.admin(s.deleteWebhookHandler)))
+
+	mux.Handle("POST /users", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.registerUserHandler))
+	mux.Handle("POST /checkout", s.limit(checkoutRouteTimeout, defaultMaxBodyBytes, s.shedOnBurn(s.measured(s.slo.checkout, s.unbanned(s.kiosk(s.checkoutHandler))))))
+	mux.Handle("POST /purchase", s.limit(purchaseRouteTimeout, defaultMaxBodyBytes, s.measured(s.slo.purchase, s.unbanned(s.kiosk(s.purchaseHandler)))))
+	mux.Handle("POST /checkout/{code}/extend", s.limit(purchaseRouteTimeout, defaultMaxBodyBytes, s.extendCheckoutHandler))
+	mux.Handle("GET /queue/status", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.queueStatusHandler))
+	mux.Handle("GET /lottery/status", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.lotteryStatusHandler))
+	mux.Handle("GET /user/{user_id}/reservations", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.userReservationsHandler))
+	mux.Handle("GET /user/{user_id}/purchases", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.userPurchasesHandler))
+	mux.Handle("GET /receipt/{purchase_id}/verify", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.verifyReceiptHandler))
+	mux.Handle("GET /purchase/{id}", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.purchaseDetailsHandler))
+	mux.Handle("GET /purchase/{id}/status", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.purchaseStatusHandler))
+	mux.Handle("POST /item/{item_id}/view", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.itemViewHandler))
+	mux.Handle("GET /sale/trending", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.trendingHandler))
+	mux.Handle("GET /item/{item_id}/availability", s.limit(defaultRouteTimeout, defaultMaxBodyBytes, s.itemAvailabilityHandler))
+	mux.Handle("GET /ws/user", s.limit(streamRouteTimeout, defaultMaxBodyBytes, s.userEventsHandler))
+
+	return mux
 }
 
 func (s *Server) HelloWorldHandler(w http.ResponseWriter, r *http.Request) {
-	resp := map[string]string{"message": "Flash Sale Contest API - Ready for High Load!"}
-	jsonResp, _ := json.Marshal(resp)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(jsonResp)
+	resp := api.MessageResponse{Message: "Flash Sale Contest API - Ready for High Load!"}
+	writeJSON(w, r, http.StatusOK, resp)
 }
 
 func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
 	stats := s.metrics.GetStats()
-	jsonResp, _ := json.Marshal(stats)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(jsonResp)
+	if saleID := r.URL.Query().Get("sale_id"); saleID != "" {
+		saleStats, ok := s.metrics.GetSaleStats(saleID)
+		if !ok {
+			writeError(w, r, "No metrics for sale", http.StatusNotFound)
+			return
+		}
+		if outcomes, err := s.cache.ReservationOutcomes(r.Context(), saleID); err == nil {
+			saleStats["reservation_outcomes"] = outcomes
+		}
+		stats = saleStats
+	} else {
+		if depth, err := s.cache.DeadLetterDepth(r.Context()); err == nil {
+			stats["dlq_depth"] = depth
+		}
+		if backlog, err := s.db.OutboxBacklog(r.Context()); err == nil {
+			stats["outbox_backlog"] = backlog
+		}
+		stats["slo"] = s.sloStats()
+		if activeSale := s.saleManager.GetCurrentSale(); activeSale != nil {
+			if outcomes, err := s.cache.ReservationOutcomes(r.Context(), activeSale.SaleID); err == nil {
+				stats["sale_reservation_outcomes"] = outcomes
+			}
+		}
+	}
+
+	writeJSON(w, r, http.StatusOK, stats)
 }
 
 func (s *Server) saleStatusHandler(w http.ResponseWriter, r *http.Request) {
 	activeSale := s.saleManager.GetCurrentSale()
 	if activeSale == nil {
-		http.Error(w, "No active sale", http.StatusNotFound)
+		writeError(w, r, "No active sale", http.StatusNotFound)
 		return
 	}
 
-	ctx := r.Context()
-	remaining, err := s.cache.GetInventoryStatus(ctx, activeSale.SaleID)
-	if err != nil {
-		log.Printf("Failed to get inventory status: %v", err)
-		remaining = -1
+	inventory := s.inventory(r.Context(), activeSale.SaleID)
+	resp := api.SaleStatusResponse{
+		SaleID:               activeSale.SaleID,
+		RemainingItems:       inventory.remaining,
+		ItemsSold:            activeSale.TotalItems - inventory.remaining,
+		RemainingByCategory:  inventory.categories,
+		SaleEndsAt:           activeSale.EndTime,
+		TimeRemainingSeconds: int(time.Until(activeSale.EndTime).Seconds()),
+		Stale:                inventory.stale,
+		Degraded:             s.cache.FailedOver(),
 	}
 
-	resp := map[string]interface{}{
-		"sale_id":                activeSale.SaleID,
-		"remaining_items":        remaining,
-		"items_sold":             10000 - remaining,
-		"sale_ends_at":           activeSale.EndTime,
-		"time_remaining_seconds": int(time.Until(activeSale.EndTime).Seconds()),
-	}
-
-	jsonResp, _ := json.Marshal(resp)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(jsonResp)
+	writeJSON(w, r, http.StatusOK, resp)
 }
 
 func (s *Server) currentSaleHandler(w http.ResponseWriter, r *http.Request) {
 	activeSale := s.saleManager.GetCurrentSale()
 	if activeSale == nil {
-		http.Error(w, "No active sale", http.StatusNotFound)
+		writeError(w, r, "No active sale", http.StatusNotFound)
 		return
 	}
 
-	resp := map[string]interface{}{
-		"sale_id":    activeSale.SaleID,
-		"start_time": activeSale.StartTime,
-		"end_time":   activeSale.EndTime,
+	resp := api.CurrentSaleResponse{
+		SaleID:     activeSale.SaleID,
+		StartTime:  activeSale.StartTime,
+		EndTime:    activeSale.EndTime,
+		Closing:    activeSale.Closing(),
+		Phase:      string(activeSale.Phase(time.Now())),
+		Extensions: activeSale.Extensions,
+	}
+	if inventory := s.inventory(r.Context(), activeSale.SaleID); inventory.remaining >= 0 {
+		resp.RemainingItems = &inventory.remaining
 	}
 
-	jsonResp, _ := json.Marshal(resp)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(jsonResp)
+	writeCacheable(w, r, activeSale, resp)
 }
 
 func (s *Server) checkoutHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	s.metrics.IncrementCheckoutRequests()
 
-	userID := r.URL.Query().Get("user_id")
-	itemID := r.URL.Query().Get("id")
+	req := api.CheckoutRequest{
+		UserID:    r.URL.Query().Get("user_id"),
+		ItemID:    r.URL.Query().Get("id"),
+		Category:  r.URL.Query().Get("category"),
+		PromoCode: strings.ToUpper(r.URL.Query().Get("promo_code")),
+	}
+	userID, itemID := req.UserID, req.ItemID
 
-	if userID == "" || itemID == "" {
+	if userID == "" {
 		s.metrics.IncrementCheckoutFailed()
-		http.Error(w, "user_id and id are required", http.StatusBadRequest)
+		writeError(w, r, "user_id is required", http.StatusBadRequest)
 		return
 	}
 
@@ -128,74 +216,245 @@ func (s *Server) checkoutHandler(w http.ResponseWriter, r *http.Request) {
 	activeSale := s.saleManager.GetCurrentSale()
 	if activeSale == nil {
 		s.metrics.IncrementCheckoutFailed()
-		http.Error(w, "No active sale", http.StatusServiceUnavailable)
+		writeError(w, r, "No active sale", http.StatusServiceUnavailable)
+		return
+	}
+	if activeSale.Closing() {
+		s.metrics.IncrementCheckoutFailed()
+		s.logFailedCheckout(activeSale.SaleID, userID, itemID, database.FailureSaleClosing)
+		saleClosing(w, r)
+		return
+	}
+	if until := time.Until(activeSale.StartTime); until > 0 {
+		s.metrics.IncrementCheckoutFailed()
+		s.logFailedCheckout(activeSale.SaleID, userID, itemID, database.FailureNotStarted)
+		saleNotStarted(w, r, until)
+		return
+	}
+	if !s.lotteryCheckout(w, r, activeSale, userID) {
+		return
+	}
+	s.heatmap.record(activeSale.SaleID, itemID)
+	if s.inventoryGate != nil && s.flags.Enabled(r.Context(), flags.InventoryGate) && !s.inventoryGate.admit(activeSale.SaleID) {
+		s.metrics.IncrementCheckoutFailed()
+		s.metrics.IncrementSoldOutErrors()
+		s.metrics.IncrementGatedCheckouts()
+		s.logFailedCheckout(activeSale.SaleID, userID, itemID, database.FailureSoldOut)
+		writeError(w, r, "Item sold out", http.StatusConflict)
+		return
+	}
+	if !s.admitCheckout(w, r, activeSale, userID) {
 		return
 	}
 
 	ctx := r.Context()
 
-	code, err := s.cache.ReserveItem(ctx, activeSale.SaleID, userID, itemID)
+	codeTTL := activeSale.CodeExpiry()
+	var (
+		code      string
+		expiresAt time.Time
+	)
+	reservation, err := s.reserveItem(ctx, activeSale.SaleID, userID, itemID, req.Category, req.PromoCode, codeTTL)
+	if err == nil {
+		code, itemID, expiresAt = reservation.Code, reservation.ItemID, reservation.ExpiresAt
+	}
+	// The Postgres fallback cannot redeem promo codes, so checkouts that
+	// carry one fail rather than silently lose the discount. A timed-out
+	// script may still have reserved in Redis, so it is not retried there
+	// either. Nor can the fallback take payment, so it is off with
+	// asynchronous purchases.
+	if err != nil && !isReservationRejection(err) && !errors.Is(err, cache.ErrTimeout) && req.PromoCode == "" && !s.asyncPurchases {
+		log.Printf("Cache reservation failed, falling back to database: %v", err)
+		s.metrics.IncrementFallbackCheckouts()
+		code = fallbackCodePrefix + codes.NewID()
+		expiresAt = time.Now().Add(codeTTL)
+		var reserved string
+		reserved, err = s.db.ReserveAvailableItem(ctx, activeSale.SaleID, userID, req.ItemID, req.Category, code, codeTTL, config.Get().MaxPerUser, config.Get().RarityLimits)
+		if err == nil {
+			itemID = reserved
+		}
+	}
 	if err != nil {
 		s.metrics.IncrementCheckoutFailed()
+		s.logFailedCheckout(activeSale.SaleID, userID, itemID, checkoutFailureReason(err))
 
 		if err.Error() == "sold out" {
 			s.metrics.IncrementSoldOutErrors()
-			http.Error(w, "Item sold out", http.StatusConflict)
+			writeError(w, r, "Item sold out", http.StatusConflict)
+			return
+		}
+		if err.Error() == "category sold out" {
+			s.metrics.IncrementSoldOutErrors()
+			writeError(w, r, "Category sold out", http.StatusConflict)
+			return
+		}
+		if err.Error() == "item already reserved" {
+			writeError(w, r, "Item already reserved", http.StatusConflict)
+			return
+		}
+		if err.Error() == "unknown category" {
+			writeError(w, r, "Unknown category", http.StatusBadRequest)
+			return
+		}
+		if err.Error() == "item not in category" {
+			writeError(w, r, "Item is not in category", http.StatusBadRequest)
+			return
+		}
+		if err.Error() == "items not numbered" {
+			writeError(w, r, "id is required for this sale", http.StatusBadRequest)
+			return
+		}
+		if err.Error() == "unknown user" {
+			writeError(w, r, "User is not registered", http.StatusForbidden)
 			return
 		}
 		if err.Error() == "user limit exceeded" {
 			s.metrics.IncrementUserLimitErrors()
-			http.Error(w, "Purchase limit exceeded", http.StatusForbidden)
+			writeError(w, r, "Purchase limit exceeded", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "rarity limit exceeded" {
+			s.metrics.IncrementUserLimitErrors()
+			writeError(w, r, "Purchase limit for this rarity exceeded", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "sale closing" {
+			saleClosing(w, r)
+			return
+		}
+		if err.Error() == "too many outstanding codes" {
+			s.metrics.IncrementUserLimitErrors()
+			writeError(w, r, "Too many unredeemed checkout codes", http.StatusTooManyRequests)
+			return
+		}
+		if err.Error() == "invalid promo code" || err.Error() == "promo code expired" {
+			writeError(w, r, "Invalid or expired promo code", http.StatusBadRequest)
+			return
+		}
+		if err.Error() == "promo code exhausted" {
+			writeError(w, r, "Promo code fully redeemed", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, cache.ErrTimeout) {
+			writeError(w, r, "Reservation timed out", http.StatusServiceUnavailable)
 			return
 		}
 
-		http.Error(w, "Failed to reserve item", http.StatusInternalServerError)
+		writeError(w, r, "Failed to reserve item", http.StatusInternalServerError)
 		return
 	}
 
 	s.metrics.IncrementCheckoutSuccess()
 	s.metrics.RecordCheckoutLatency(time.Since(start))
+	// Fallback reservations are taken from Postgres, not the Redis counter.
+	if reservation != nil {
+		s.recordMovement(database.MovementReserve, activeSale.SaleID, userID, itemID)
+	}
 
-	go func() {
-		attempt := &database.CheckoutAttempt{
-			SaleID: activeSale.SaleID,
-			UserID: userID,
-			ItemID: itemID,
-			Code:   code,
-			Status: false,
-		}
-		s.db.LogCheckoutAttempt(context.Background(), attempt)
-	}()
-
-	resp := map[string]string{"code": code}
-	jsonResp, _ := json.Marshal(resp)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(jsonResp)
+	s.logCheckout(&database.CheckoutAttempt{
+		SaleID: activeSale.SaleID,
+		UserID: userID,
+		ItemID: itemID,
+		Code:   code,
+	})
+
+	resp := api.CheckoutResponse{
+		Code:        code,
+		ItemID:      itemID,
+		ExpiresAt:   expiresAt,
+		TTLSeconds:  int(codeTTL.Seconds()),
+		EventsToken: s.userEventsToken(userID, time.Now().Add(userEventsTokenTTL)),
+	}
+	writeJSON(w, r, http.StatusOK, resp)
 }
 
 func (s *Server) purchaseHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	s.metrics.IncrementPurchaseRequests()
 
-	code := r.URL.Query().Get("code")
+	req := api.PurchaseRequest{Code: r.URL.Query().Get("code"), RecipientUserID: r.URL.Query().Get("recipient_user_id")}
+	code := req.Code
 	if code == "" {
 		s.metrics.IncrementPurchaseFailed()
-		http.Error(w, "code is required", http.StatusBadRequest)
+		writeError(w, r, "code is required", http.StatusBadRequest)
+		return
+	}
+	// Details are checked before the code is spent, so a buyer can fix
+	// them and retry.
+	details, err := readPurchaseDetails(r)
+	if err != nil {
+		s.metrics.IncrementPurchaseFailed()
+		writeError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	if strings.HasPrefix(code, fallbackCodePrefix) {
+		// The Postgres fallback does not know the recipient's purchases.
+		if req.RecipientUserID != "" {
+			s.metrics.IncrementPurchaseFailed()
+			writeError(w, r, "Gifts cannot be bought with a database fallback code", http.StatusConflict)
+			return
+		}
+		// Payments are queued in Redis, which the fallback stands in for,
+		// so it cannot charge the buyer.
+		if s.asyncPurchases {
+			s.metrics.IncrementPurchaseFailed()
+			writeError(w, r, "Database fallback codes cannot be redeemed with asynchronous purchases", http.StatusConflict)
+			return
+		}
+		s.fallbackPurchase(w, r, code, details, start)
+		return
+	}
+
+	// Codes namespaced per sale are looked up in the running sale.
+	saleID := ""
+	if activeSale := s.saleManager.GetCurrentSale(); activeSale != nil {
+		saleID = activeSale.SaleID
+	}
+
 	ctx := r.Context()
-	checkoutInfo, err := s.cache.VerifyAndPurchase(ctx, code)
+	checkoutInfo, err := s.cache.CompletePurchase(ctx, saleID, code, req.RecipientUserID)
 	if err != nil {
 		s.metrics.IncrementPurchaseFailed()
-		s.metrics.IncrementCodeInvalidErrors()
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		if err.Error() == "invalid or expired code" {
+			s.metrics.IncrementCodeInvalidErrors()
+			writeError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err.Error() == "sale closed" {
+			writeError(w, r, "Sale has ended", http.StatusGone)
+			return
+		}
+		// The code is not spent; the buyer can pick another recipient.
+		if err.Error() == "unknown recipient" {
+			writeError(w, r, "Recipient is not a registered user", http.StatusNotFound)
+			return
+		}
+		if err.Error() == "recipient limit exceeded" {
+			writeError(w, r, "Recipient has reached their purchase limit", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "user banned" {
+			s.metrics.IncrementBannedRequests()
+			writeError(w, r, "User is banned", http.StatusForbidden)
+			return
+		}
+		// The script may still have run, so the code may be spent; a
+		// retry then gets the purchase back.
+		if errors.Is(err, cache.ErrTimeout) {
+			writeError(w, r, "Purchase timed out", http.StatusServiceUnavailable)
+			return
+		}
+		writeError(w, r, "Failed to complete purchase", http.StatusInternalServerError)
+		return
+	}
+	if checkoutInfo.Replayed {
+		s.replayPurchase(w, r, code, checkoutInfo)
 		return
 	}
 
-	if err := s.cache.IncrementUserPurchase(ctx, checkoutInfo.SaleID, checkoutInfo.UserID); err != nil {
-		s.metrics.IncrementPurchaseFailed()
-		http.Error(w, "Failed to complete purchase", http.StatusInternalServerError)
+	if s.asyncPurchases {
+		s.enqueuePurchase(w, r, code, checkoutInfo, details, start)
 		return
 	}
 
@@ -203,80 +462,227 @@ func (s *Server) purchaseHandler(w http.ResponseWriter, r *http.Request) {
 	s.metrics.IncrementItemsSold()
 	s.metrics.RecordPurchaseLatency(time.Since(start))
 
-	go func(info *cache.CheckoutInfo) {
-		parts := strings.Split(info.ItemID, "_item_")
-		if len(parts) == 2 {
-			if itemNumber, err := strconv.Atoi(parts[1]); err == nil {
-				s.cache.MarkItemAsSold(context.Background(), info.SaleID, itemNumber)
-			}
-		}
+	purchase := &database.Purchase{
+		ID:          checkoutInfo.PurchaseID,
+		SaleID:      checkoutInfo.SaleID,
+		UserID:      checkoutInfo.UserID,
+		ItemID:      checkoutInfo.ItemID,
+		Unit:        checkoutInfo.Unit,
+		RecipientID: checkoutInfo.RecipientID,
+		PromoCode:   checkoutInfo.PromoCode,
+		PercentOff:  checkoutInfo.PercentOff,
+	}
+	purchaseID := checkoutInfo.PurchaseID
+	asyncCtx := trace.Detach(ctx)
+	s.recordMovement(database.MovementSell, checkoutInfo.SaleID, checkoutInfo.UserID, checkoutInfo.ItemID)
+	s.persist(func() { s.recordPurchase(asyncCtx, purchase, code) }, func() {
+		s.parkFailedWrite(cache.DeadLetterPurchase, purchase, errWriteShed)
+	})
+	if details != nil {
+		s.recordPurchaseDetails(asyncCtx, purchaseID, checkoutInfo.SaleID, checkoutInfo.UserID, checkoutInfo.ItemID, details)
+	}
 
+	writeJSON(w, r, http.StatusOK, s.purchaseResponse(checkoutInfo))
+}
+
+// purchaseResponse answers a purchase that went through.
+func (s *Server) purchaseResponse(info *cache.CheckoutInfo) api.PurchaseResponse {
+	return api.PurchaseResponse{
+		Success:         true,
+		PurchaseID:      info.PurchaseID,
+		UserID:          info.UserID,
+		ItemID:          info.ItemID,
+		Unit:            info.Unit,
+		RecipientUserID: info.RecipientID,
+		SaleID:          info.SaleID,
+		PromoCode:       info.PromoCode,
+		PercentOff:      info.PercentOff,
+		Receipt:         s.receipt(info.PurchaseID, info.SaleID, info.UserID, info.ItemID, info.PurchasedAt),
+	}
+}
+
+// replayPurchase answers a purchase retried with a code its first try
+// redeemed, say after that reply was lost, as the first try answered: the
+// purchase is not counted again. The first try may have timed out before it
+// recorded the purchase, so it is recorded again; CreatePurchase ignores a
+// purchase ID it already has. With asynchronous purchases, the pending
+// purchase is reported in its current status.
+func (s *Server) replayPurchase(w http.ResponseWriter, r *http.Request, code string, info *cache.CheckoutInfo) {
+	s.metrics.IncrementPurchaseReplays()
+	if !s.asyncPurchases {
 		purchase := &database.Purchase{
-			SaleID: info.SaleID,
-			UserID: info.UserID,
-			ItemID: info.ItemID,
+			ID:          info.PurchaseID,
+			SaleID:      info.SaleID,
+			UserID:      info.UserID,
+			ItemID:      info.ItemID,
+			Unit:        info.Unit,
+			RecipientID: info.RecipientID,
+			PromoCode:   info.PromoCode,
+			PercentOff:  info.PercentOff,
 		}
-		if err := s.db.CreatePurchase(context.Background(), purchase); err != nil {
-			log.Printf("FATAL: Failed to log purchase to DB for code %s: %v", code, err)
+		asyncCtx := trace.Detach(r.Context())
+		s.persist(func() { s.recordPurchase(asyncCtx, purchase, code) }, func() {
+			s.parkFailedWrite(cache.DeadLetterPurchase, purchase, errWriteShed)
+		})
+		writeJSON(w, r, http.StatusOK, s.purchaseResponse(info))
+		return
+	}
+	// The first try failed when its purchase was never enqueued.
+	pending, err := s.cache.GetPendingPurchase(r.Context(), info.PurchaseID)
+	if err != nil {
+		writeError(w, r, "Failed to complete purchase", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, r, http.StatusAccepted, api.PendingPurchaseResponse{PurchaseID: pending.PurchaseID, Status: pending.Status})
+}
+
+// recordPurchase persists a completed purchase. It runs off the request path,
+// on the write pool or the payments worker; ctx carries the request's trace
+// but must not carry its deadline.
+func (s *Server) recordPurchase(ctx context.Context, purchase *database.Purchase, code string) {
+	saleID, itemID := purchase.SaleID, purchase.ItemID
+	parts := strings.Split(itemID, "_item_")
+	if len(parts) == 2 {
+		if itemNumber, err := strconv.Atoi(parts[1]); err == nil {
+			spanCtx, span := trace.Start(ctx, "cache.MarkItemAsSold", slog.String("sale_id", saleID))
+			span.End(s.cache.MarkItemAsSold(spanCtx, saleID, itemNumber))
 		}
-		s.db.UpdateCheckoutStatus(context.Background(), code, true)
-	}(checkoutInfo)
+	}
 
-	resp := map[string]interface{}{
-		"success": true,
-		"user_id": checkoutInfo.UserID,
-		"item_id": checkoutInfo.ItemID,
-		"sale_id": checkoutInfo.SaleID,
+	spanCtx, span := trace.Start(ctx, "db.CreatePurchase", slog.String("sale_id", saleID))
+	err := s.db.CreatePurchase(spanCtx, purchase)
+	span.End(err)
+	if err != nil {
+		log.Printf("FATAL: Failed to log purchase to DB for code %s (correlation %s): %v", code, trace.CorrelationID(ctx), err)
+		s.parkFailedWrite(cache.DeadLetterPurchase, purchase, err)
 	}
-	jsonResp, _ := json.Marshal(resp)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(jsonResp)
+	s.db.UpdateCheckoutStatus(ctx, code, true)
+	s.db.ConsumeAvailableItem(ctx, saleID, itemID)
 }
 
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
-	health := map[string]interface{}{
+	health := api.Stats{
 		"database": s.db.Health(),
 		"cache":    s.cache.Health(),
 		"metrics":  s.metrics.GetStats(),
 		"status":   "ok",
 	}
 
-	resp, _ := json.Marshal(health)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(resp)
+	writeJSON(w, r, http.StatusOK, health)
 }
 
 func (s *Server) saleInfoHandler(w http.ResponseWriter, r *http.Request) {
 	activeSale := s.saleManager.GetCurrentSale()
 	if activeSale == nil {
-		http.Error(w, "No active sale", http.StatusServiceUnavailable)
+		writeError(w, r, "No active sale", http.StatusServiceUnavailable)
 		return
 	}
 
 	ctx := r.Context()
-	var showcase *cache.ShowcaseInfo
-
 	showcase, err := s.cache.GetShowcaseInfo(ctx, activeSale.SaleID)
 	if err != nil {
-		log.Printf("Cache miss for showcase on sale %s. Fetching from DB.", activeSale.SaleID)
-		firstIDs, lastIDs, dbErr := s.db.GetShowcaseItemIDs(ctx, activeSale.SaleID, 10)
-		if dbErr != nil {
-			http.Error(w, "Failed to retrieve sale info", http.StatusInternalServerError)
+		log.Printf("Cache miss for showcase on sale %s. Picking it again.", activeSale.SaleID)
+		showcase, err = s.saleManager.RefreshShowcase(ctx, activeSale.SaleID)
+		if err != nil {
+			log.Printf("Failed to pick showcase of sale %s: %v", activeSale.SaleID, err)
+			writeError(w, r, "Failed to retrieve sale info", http.StatusInternalServerError)
 			return
 		}
-		showcase = &cache.ShowcaseInfo{FirstItemIDs: firstIDs, LastItemIDs: lastIDs}
+	}
+
+	writeCacheable(w, r, activeSale, s.saleInfo(ctx, activeSale, showcase))
+}
+
+// saleInfo resolves the details of a sale's showcased items.
+func (s *Server) saleInfo(ctx context.Context, activeSale *sale.ActiveSale, showcase *cache.ShowcaseInfo) api.SaleInfoResponse {
+	showcaseItems, err := s.cache.GetItems(ctx, activeSale.SaleID, showcase.IDs()...)
+	if err != nil {
+		log.Printf("Failed to resolve showcase item details: %v", err)
+	}
+
+	info := api.SaleInfoResponse{
+		SaleID:           activeSale.SaleID,
+		TotalItems:       activeSale.TotalItems,
+		ShowcaseStrategy: showcase.Strategy,
+		FirstItems:       showcase.FirstItemIDs,
+		LastItems:        showcase.LastItemIDs,
+		Showcase:         showcase.ItemIDs,
+	}
+	for _, item := range showcaseItems {
+		info.ShowcaseItems = append(info.ShowcaseItems, priced(api.Item{ItemID: item.ItemID, Name: item.Name, ImageURL: item.ImageURL, Category: item.Category, Rarity: item.Rarity, Quantity: max(item.Quantity, 1)}, item.PriceMinor, item.Currency))
+	}
+	return info
+}
+
+// priced fills in an item's price. Items cached before prices existed
+// have no currency and are left unpriced.
+func priced(item api.Item, minor int64, currency string) api.Item {
+	if currency == "" {
+		return item
+	}
+	item.PriceMinor = minor
+	item.Price = money.Format(minor, currency)
+	item.Currency = currency
+	return item
+}
+
+const saleItemsPageSize = 100
 
-		go s.cache.SetShowcaseInfo(context.Background(), activeSale.SaleID, showcase)
+func (s *Server) saleItemsHandler(w http.ResponseWriter, r *http.Request) {
+	activeSale := s.saleManager.GetCurrentSale()
+	if activeSale == nil {
+		writeError(w, r, "No active sale", http.StatusServiceUnavailable)
+		return
+	}
+
+	req := api.SaleItemsRequest{Category: r.URL.Query().Get("category")}
+	req.Page, _ = strconv.Atoi(r.URL.Query().Get("page"))
+	if req.Page < 1 {
+		req.Page = 1
+	}
+
+	ctx := r.Context()
+	items, err := s.db.GetSaleItems(ctx, activeSale.SaleID, req.Category, saleItemsPageSize, (req.Page-1)*saleItemsPageSize)
+	if err != nil {
+		log.Printf("Failed to list items for sale %s: %v", activeSale.SaleID, err)
+		writeError(w, r, "Failed to retrieve items", http.StatusInternalServerError)
+		return
 	}
 
-	info := map[string]interface{}{
-		"sale_id":     activeSale.SaleID,
-		"total_items": 10000,
-		"first_items": showcase.FirstItemIDs,
-		"last_items":  showcase.LastItemIDs,
+	resp := api.SaleItemsResponse{
+		SaleID:   activeSale.SaleID,
+		Category: req.Category,
+		Page:     req.Page,
+		PageSize: saleItemsPageSize,
+		Items:    make([]api.Item, 0, len(items)),
 	}
+	for _, item := range items {
+		resp.Items = append(resp.Items, priced(api.Item{ItemID: item.ItemID, Name: item.Name, ImageURL: item.ImageURL, Category: item.Category, Rarity: item.Rarity, Quantity: max(item.Quantity, 1)}, item.PriceMinor, item.Currency))
+	}
+
+	if req.Category != "" {
+		if counts, err := s.cache.GetCategoryInventory(ctx, activeSale.SaleID); err == nil {
+			if remaining, ok := counts[req.Category]; ok {
+				resp.Remaining = &remaining
+			}
+		}
+	}
+
+	writeCacheable(w, r, activeSale, resp)
+}
+
+// saleClosing rejects a checkout against a sale that is rolling over. The
+// next sale starts once the drain window passes.
+func saleClosing(w http.ResponseWriter, r *http.Request) {
+	retryAfter := int(config.Get().RolloverDrain.Seconds()) + int(sale.TickInterval.Seconds())
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeError(w, r, "Sale is closing, the next sale starts shortly", http.StatusGone)
+}
 
-	jsonResp, _ := json.Marshal(info)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(jsonResp)
+// saleNotStarted rejects a checkout during the preview window with the
+// seconds left until the sale opens.
+func saleNotStarted(w http.ResponseWriter, r *http.Request, until time.Duration) {
+	seconds := int(until.Seconds() + 0.999)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeError(w, r, fmt.Sprintf("Sale starts in %d seconds", seconds), http.StatusTooEarly)
 }
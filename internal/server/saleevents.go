@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"flash_sale_contest/internal/config"
+	"flash_sale_contest/internal/database"
+)
+
+const (
+	// saleEventsBuffer is how many sale events may wait to be handled;
+	// more are dropped and left to polling.
+	saleEventsBuffer = 1024
+	// saleEventsRetry is how long a broken listener waits to reconnect.
+	saleEventsRetry = 5 * time.Second
+)
+
+// listenSaleEvents follows the sale events of every tenant from Postgres.
+// Lifecycle events make followers reread the sale pointer at once instead
+// of on their next tick; purchase events expire the cached inventory and
+// trending items, at most once per SALE_EVENTS_COALESCE. Polling stays in
+// place for events missed while no connection listened.
+func (s *Server) listenSaleEvents(ctx context.Context) {
+	if !config.Get().SaleEvents {
+		log.Println("Sale events disabled")
+		return
+	}
+
+	events := make(chan database.SaleEvent, saleEventsBuffer)
+	go func() {
+		for ctx.Err() == nil {
+			err := s.db.ListenSaleEvents(ctx, func(event database.SaleEvent) {
+				select {
+				case events <- event:
+				default:
+				}
+			})
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Sale event listener stopped, reconnecting in %s: %v", saleEventsRetry, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(saleEventsRetry):
+			}
+		}
+	}()
+	go s.handleSaleEvents(ctx, events)
+}
+
+func (s *Server) handleSaleEvents(ctx context.Context, events <-chan database.SaleEvent) {
+	ticker := time.NewTicker(max(config.Get().SaleEventsCoalesce, 10*time.Millisecond))
+	defer ticker.Stop()
+
+	purchased := make(map[*Server]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			t, ok := s.eventTenant(event.TenantID)
+			if !ok {
+				continue
+			}
+			if event.Type == database.SaleEventPurchase {
+				purchased[t] = true
+				continue
+			}
+			if err := t.saleManager.Follow(ctx); err != nil {
+				log.Printf("Failed to follow %s of sale %s: %v", event.Type, event.SaleID, err)
+			}
+			t.expireSaleCaches()
+		case <-ticker.C:
+			for t := range purchased {
+				t.expireSaleCaches()
+				delete(purchased, t)
+			}
+		}
+	}
+}
+
+// eventTenant returns the Server of a sale event's tenant. It reports
+// false for tenants this replica does not run.
+func (s *Server) eventTenant(tenant string) (*Server, bool) {
+	if tenant == "" {
+		return s, true
+	}
+	t, ok := s.tenants[tenant]
+	return t, ok
+}
+
+// expireSaleCaches has the next reads of the inventory and trending items
+// go to Redis.
+func (s *Server) expireSaleCaches() {
+	s.inventorySnapshot.expire()
+	s.trending.expire()
+}
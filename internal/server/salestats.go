@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"flash_sale_contest/internal/api"
+)
+
+// saleReportInterval is how often each replica publishes its view of the
+// current sale for the leader to sum at finalization.
+const saleReportInterval = 2 * time.Second
+
+func (s *Server) publishSaleReports(ctx context.Context) {
+	ticker := time.NewTicker(saleReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		activeSale := s.saleManager.GetCurrentSale()
+		if activeSale == nil {
+			continue
+		}
+		report, ok := s.metrics.SaleReport(activeSale.SaleID)
+		if !ok {
+			continue
+		}
+
+		data, _ := json.Marshal(report)
+		publishCtx, cancel := context.WithTimeout(ctx, time.Second)
+		if err := s.cache.PublishSaleReport(publishCtx, activeSale.SaleID, s.saleManager.InstanceID(), data); err != nil {
+			log.Printf("Failed to publish metrics report for sale %s: %v", activeSale.SaleID, err)
+		}
+		cancel()
+	}
+}
+
+// saleStatsHandler returns the stats recorded when a sale was finalized.
+func (s *Server) saleStatsHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.SaleStatsRequest{SaleID: r.PathValue("sale_id")}
+
+	stats, err := s.db.GetSaleStats(r.Context(), req.SaleID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, "No stats for sale", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to load stats of sale %s: %v", req.SaleID, err)
+		writeError(w, r, "Failed to load sale stats", http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.SaleStatsResponse{
+		SaleID:              stats.SaleID,
+		TotalItems:          stats.TotalItems,
+		ItemsSold:           stats.ItemsSold,
+		CheckoutRequests:    stats.CheckoutRequests,
+		CheckoutSuccess:     stats.CheckoutSuccess,
+		CheckoutSuccessRate: stats.CheckoutSuccessRate,
+		PurchaseRequests:    stats.PurchaseRequests,
+		PurchaseSuccess:     stats.PurchaseSuccess,
+		PurchaseSuccessRate: stats.PurchaseSuccessRate,
+		SoldOutErrors:       stats.SoldOutErrors,
+		P99CheckoutMs:       stats.P99CheckoutMs,
+		P99PurchaseMs:       stats.P99PurchaseMs,
+		OversellBuffer:      stats.OversellBuffer,
+		Oversold:            stats.Oversold,
+		Instances:           stats.Instances,
+		RecordedAt:          stats.RecordedAt,
+	}
+	if stats.SoldOutAfter > 0 {
+		seconds := stats.SoldOutAfter.Seconds()
+		resp.SoldOutAfterSeconds = &seconds
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
@@ -4,17 +4,26 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
 
+	"flash_sale_contest/internal/attempts"
 	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/config"
 	"flash_sale_contest/internal/database"
+	"flash_sale_contest/internal/flags"
 	"flash_sale_contest/internal/metrics"
+	"flash_sale_contest/internal/notifications"
+	"flash_sale_contest/internal/payments"
 	"flash_sale_contest/internal/sale"
+	"flash_sale_contest/internal/webhooks"
+	"flash_sale_contest/internal/workers"
 )
 
 type Server struct {
@@ -23,14 +32,72 @@ type Server struct {
 	cache       cache.Service
 	saleManager *sale.Manager
 	metrics     metrics.Service
+
+	asyncPurchases bool
+	notifications  bool
+	inventoryGate  *inventoryGate
+	heatmap        *heatmap
+	attemptLog     *attempts.Switch
+	writes         *workers.Pool
+	webhooks       *webhooks.Dispatcher
+	flags          *flags.Set
+	slo            *objectives
+
+	// inventorySnapshot is the inventory last read for /sale/status.
+	inventorySnapshot inventorySnapshot
+	// trending is the view ranking last read for /sale/trending.
+	trending trendingSnapshot
+	// apiKeys caches the API keys requests were made with.
+	apiKeys apiKeyCache
+	// lotteryDrawn is the ID of the latest sale whose lottery is drawn.
+	lotteryDrawn atomic.Value
+	// warmedUp is set once startWarmUp is done with this tenant.
+	warmedUp atomic.Bool
+
+	// tenant is empty for the default tenant, whose Server holds the others
+	// in tenants.
+	tenant  string
+	tenants map[string]*Server
 }
 
 func NewServer() *http.Server {
 	port, _ := strconv.Atoi(os.Getenv("PORT"))
 
-	dbService := database.New()
-	cacheService := cache.New()
-	metricsService := metrics.New()
+	cfg := config.Get()
+	// Tenants get metrics of their own in startTenants; connection counts
+	// and database timings stay with these, as the listener and the
+	// database pool are shared.
+	metricsService := metrics.NewService()
+	pool, err := database.NewService(database.OptionsFromEnv())
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	dbService := database.WithQueryMetrics(pool, database.QueryMetrics{
+		SlowQuery: cfg.DBSlowQuery,
+		OnQuery:   metricsService.RecordQuery,
+		OnSlow:    func(string, time.Duration) { metricsService.IncrementSlowQueries() },
+	})
+	redisService, err := cache.NewService(cache.OptionsFromEnv())
+	if err != nil {
+		log.Fatal(err)
+	}
+	hedgedCache := cache.WithHedging(redisService, cache.Hedging{
+		Delay:   cfg.RedisHedgeDelay,
+		OnHedge: func(string) { metricsService.IncrementRedisHedges() },
+	})
+	timedCache := cache.WithTimeouts(hedgedCache, cache.Timeouts{
+		Reserve:   cfg.RedisReserveTimeout,
+		Purchase:  cfg.RedisPurchaseTimeout,
+		Read:      cfg.RedisReadTimeout,
+		OnTimeout: func(string) { metricsService.IncrementCacheTimeouts() },
+	})
+	cacheService := cache.WithRetry(timedCache, cache.RetryPolicy{
+		Attempts:    cfg.RedisRetryAttempts,
+		Backoff:     cfg.RedisRetryBackoff,
+		Jitter:      cfg.RedisRetryJitter,
+		OnRetry:     func(string) { metricsService.IncrementRedisRetries() },
+		OnExhausted: func(string) { metricsService.IncrementRedisExhausted() },
+	})
 	saleManager := sale.NewManager(dbService, cacheService)
 
 	NewServer := &Server{
@@ -39,20 +106,109 @@ func NewServer() *http.Server {
 		cache:       cacheService,
 		saleManager: saleManager,
 		metrics:     metricsService,
+		slo:         newObjectives(cfg),
+
+		asyncPurchases: os.Getenv("PURCHASE_MODE") == "async",
 	}
 
 	ctx := context.Background()
-	if err := saleManager.Start(ctx); err != nil {
-		log.Fatalf("Failed to start sale manager: %v", err)
+	NewServer.startWrites()
+	NewServer.startSales(ctx)
+
+	if senders := notifications.NewSendersFromEnv(cacheService); len(senders) > 0 {
+		worker := notifications.NewWorker(cacheService, senders)
+		if err := worker.Start(ctx, 2); err != nil {
+			log.Printf("Notifications disabled: %v", err)
+		} else {
+			NewServer.notifications = true
+		}
+	}
+
+	NewServer.startAttemptLog(ctx)
+	NewServer.startWebhooks(ctx)
+	NewServer.startTenants(ctx, cfg.Tenants)
+	NewServer.startOutboxRelay(ctx)
+	NewServer.startWarmUp(ctx)
+	go NewServer.runSLO(ctx)
+	NewServer.listenSaleEvents(ctx)
+	go NewServer.loadUserRegistry()
+	NewServer.cache.OnFailover(NewServer.warmStandby)
+	jobManager := NewServer.startJobs(ctx)
+
+	if NewServer.asyncPurchases {
+		worker := payments.NewWorker(cacheService, payments.NewProviderFromEnv(), NewServer.onPaymentConfirmed, NewServer.onPaymentFailed)
+		worker.Start(ctx, 4)
 	}
 
+	NewServer.startDebugServer()
+	NewServer.watchConfigReloads(ctx)
+
 	server := &http.Server{
-		Addr:           fmt.Sprintf(":%d", NewServer.port),
-		Handler:        NewServer.RegisterRoutes(),
-		IdleTimeout:    time.Minute,
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   30 * time.Second,
+		Addr:              fmt.Sprintf(":%d", NewServer.port),
+		Handler:           NewServer.RegisterRoutes(),
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		MaxHeaderBytes:    cfg.HTTPMaxHeaderBytes,
+		ConnState:         NewServer.trackConn,
+	}
+
+	if cfg.HTTPEnableH2C {
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
 	}
+	server.RegisterOnShutdown(jobManager.Stop)
+	writePools.Store(server, NewServer.writes)
+	NewServer.configureTLS(server, cfg)
 
 	return server
 }
+
+// startSales starts the sale manager and the per-sale background work of
+// one tenant.
+func (s *Server) startSales(ctx context.Context) {
+	s.saleManager.OnSaleChange(func(active *sale.ActiveSale) {
+		s.metrics.BeginSale(active.SaleID)
+	})
+	if err := s.saleManager.Start(ctx); err != nil {
+		log.Fatalf("Failed to start sale manager: %v", err)
+	}
+
+	if threshold := config.Get().InventoryGateThreshold; threshold >= 0 {
+		s.inventoryGate = newInventoryGate(threshold)
+		go s.runInventoryGate(ctx)
+	}
+
+	if size := config.Get().HeatmapBucketSize; size > 0 {
+		s.heatmap = newHeatmap(size)
+		go s.runHeatmap(ctx)
+	}
+
+	cfg := config.Get()
+	if mode := cfg.CheckoutMode; mode != checkoutModeLottery && mode != checkoutModeFCFS {
+		log.Printf("Unknown CHECKOUT_MODE %q, checkouts are first come first served", mode)
+	}
+	s.flags = flags.New(s.cache, flagDefaults(cfg), cfg.FlagRefresh)
+	config.OnReload(s.applyConfig)
+	// The lottery can be switched on mid-contest, so its draw always runs.
+	go s.runLottery(ctx)
+
+	go s.publishSaleReports(ctx)
+}
+
+// trackConn feeds connection-level metrics and sheds connections above the
+// configured ceiling before they reach a handler.
+func (s *Server) trackConn(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		s.metrics.ConnOpened()
+		if max := config.Get().HTTPMaxConns; max > 0 && s.metrics.GetOpenConns() > int64(max) {
+			s.metrics.ConnRejected()
+			conn.Close()
+		}
+	case http.StateClosed, http.StateHijacked:
+		s.metrics.ConnClosed()
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+
+	"flash_sale_contest/internal/api"
+)
+
+// maxStaffPicks bounds the staff picks of a sale; only the first
+// SHOWCASE_SIZE are shown.
+const maxStaffPicks = 100
+
+// staffPicksHandler sets the items the staff_picks showcase strategy shows
+// for the running sale and picks its showcase again, so the change shows
+// on /sale/info without waiting for the next refresh.
+func (s *Server) staffPicksHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.StaffPicksRequest{SaleID: r.PathValue("sale_id"), Picks: &api.StaffPicks{}}
+	activeSale := s.saleManager.GetCurrentSale()
+	if activeSale == nil || activeSale.SaleID != req.SaleID {
+		writeError(w, r, "Sale is not running", http.StatusConflict)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req.Picks); err != nil {
+		writeError(w, r, "Body must be a JSON object with item_ids", http.StatusBadRequest)
+		return
+	}
+	var ids []string
+	for _, id := range req.Picks.ItemIDs {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > maxStaffPicks {
+		writeError(w, r, "Too many item_ids", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	items, err := s.cache.GetItems(ctx, req.SaleID, ids...)
+	if err != nil {
+		writeError(w, r, "Failed to look up items", http.StatusInternalServerError)
+		return
+	}
+	known := make(map[string]bool, len(items))
+	for _, item := range items {
+		known[item.ItemID] = true
+	}
+	for _, id := range ids {
+		if !known[id] {
+			writeError(w, r, "Unknown item "+id, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := s.cache.SetStaffPicks(ctx, req.SaleID, ids); err != nil {
+		writeError(w, r, "Failed to store staff picks", http.StatusInternalServerError)
+		return
+	}
+	showcase, err := s.saleManager.RefreshShowcase(ctx, req.SaleID)
+	if err != nil {
+		writeError(w, r, "Failed to pick showcase", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Staff picked %d items for sale %s", len(ids), req.SaleID)
+
+	writeJSON(w, r, http.StatusOK, s.saleInfo(ctx, activeSale, showcase))
+}
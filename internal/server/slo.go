@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"log"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"flash_sale_contest/internal/config"
+	"flash_sale_contest/internal/slo"
+)
+
+// sloMinRequests is how many requests the burn window needs before its
+// burn rate is trusted to shed by.
+const sloMinRequests = 100
+
+// objectives tracks the checkout and purchase objectives. Tenants share
+// them, as they share the listener and pools whose latency they measure.
+type objectives struct {
+	checkout *slo.Tracker
+	purchase *slo.Tracker
+	// shedShare is the share of checkouts being shed, as float64 bits.
+	shedShare atomic.Uint64
+}
+
+// newObjectives tracks the objectives of cfg. SLO_WINDOW only applies on
+// restart; the objectives themselves are reloaded.
+func newObjectives(cfg *config.Config) *objectives {
+	o := &objectives{
+		checkout: slo.New(cfg.SLOWindow, slo.Objective{Latency: cfg.SLOCheckoutLatency, Target: cfg.SLOTarget}),
+		purchase: slo.New(cfg.SLOWindow, slo.Objective{Latency: cfg.SLOPurchaseLatency, Target: cfg.SLOTarget}),
+	}
+	config.OnReload(func(_, next *config.Config) {
+		o.checkout.Configure(slo.Objective{Latency: next.SLOCheckoutLatency, Target: next.SLOTarget})
+		o.purchase.Configure(slo.Objective{Latency: next.SLOPurchaseLatency, Target: next.SLOTarget})
+	})
+	return o
+}
+
+// measured records the requests of a route in tracker while a sale runs.
+// Server errors that ask the client to retry later, such as during a
+// lottery draw, are answered on purpose and do not count as failures.
+func (s *Server) measured(tracker *slo.Tracker, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+		if s.saleManager.GetCurrentSale() == nil {
+			return
+		}
+		failed := rec.status >= 500 && w.Header().Get("Retry-After") == ""
+		tracker.Record(time.Since(start), failed)
+	}
+}
+
+// shedOnBurn turns away the share of checkouts runSLO picked, before they
+// are measured, so that the checkouts let through answer in time again.
+// Purchases are never shed: their buyers already hold an item.
+func (s *Server) shedOnBurn(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if share := math.Float64frombits(s.slo.shedShare.Load()); share > 0 && rand.Float64() < share {
+			s.metrics.IncrementSLOShed()
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, "Server overloaded, retry shortly", http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// runSLO picks, every second, the share of checkouts to shed. While the
+// faster burn rate of the two objectives over SLO_BURN_WINDOW is above
+// SLO_SHED_BURN_RATE, checkouts are let through at the ratio of the two,
+// so the burn rate settles near the threshold instead of swinging between
+// shedding everything and nothing.
+func (s *Server) runSLO(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cfg := config.Get()
+		share := 0.0
+		if threshold := cfg.SLOShedBurnRate; threshold > 0 {
+			checkout := s.slo.checkout.Status(cfg.SLOBurnWindow)
+			purchase := s.slo.purchase.Status(cfg.SLOBurnWindow)
+			burn := 0.0
+			if checkout.Requests >= sloMinRequests {
+				burn = checkout.BurnRate
+			}
+			if purchase.Requests >= sloMinRequests {
+				burn = max(burn, purchase.BurnRate)
+			}
+			if burn > threshold {
+				share = 1 - threshold/burn
+			}
+		}
+
+		was := math.Float64frombits(s.slo.shedShare.Swap(math.Float64bits(share)))
+		switch {
+		case share > 0 && was == 0:
+			log.Printf("Error budget burning faster than %gx, shedding %.0f%% of checkouts", cfg.SLOShedBurnRate, share*100)
+		case share == 0 && was > 0:
+			log.Printf("Error budget burn back under %gx, no longer shedding checkouts", cfg.SLOShedBurnRate)
+		}
+	}
+}
+
+// sloStats reports both objectives for /metrics.
+func (s *Server) sloStats() map[string]interface{} {
+	cfg := config.Get()
+	return map[string]interface{}{
+		"target":              cfg.SLOTarget,
+		"window_seconds":      cfg.SLOWindow.Seconds(),
+		"burn_window_seconds": cfg.SLOBurnWindow.Seconds(),
+		"shed_burn_rate":      cfg.SLOShedBurnRate,
+		"shed_checkouts":      math.Float64frombits(s.slo.shedShare.Load()),
+		"checkout":            objectiveStats(s.slo.checkout, cfg.SLOCheckoutLatency, cfg.SLOBurnWindow),
+		"purchase":            objectiveStats(s.slo.purchase, cfg.SLOPurchaseLatency, cfg.SLOBurnWindow),
+	}
+}
+
+func objectiveStats(tracker *slo.Tracker, latency, burnWindow time.Duration) map[string]interface{} {
+	window := tracker.Status(0)
+	recent := tracker.Status(burnWindow)
+	return map[string]interface{}{
+		"latency_ms":       float64(latency.Microseconds()) / 1000,
+		"requests":         window.Requests,
+		"failed":           window.Failed,
+		"slow":             window.Slow,
+		"availability":     window.Availability,
+		"compliance":       window.Compliance,
+		"budget_remaining": window.BudgetRemaining,
+		"burn_rate":        window.BurnRate,
+		"burn_rate_recent": recent.BurnRate,
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/database"
+)
+
+// snapshotSaleHandler copies a sale's Redis state into Postgres, so a Redis
+// flush mid-sale can be undone with restoreSaleHandler.
+func (s *Server) snapshotSaleHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.SaleSnapshotRequest{SaleID: r.PathValue("sale_id")}
+
+	ctx := r.Context()
+	if _, err := s.db.GetSale(ctx, req.SaleID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, "Sale not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, r, "Failed to load sale", http.StatusInternalServerError)
+		return
+	}
+
+	snap, err := s.cache.SnapshotSale(ctx, req.SaleID)
+	if err != nil {
+		log.Printf("Failed to snapshot sale %s: %v", req.SaleID, err)
+		writeError(w, r, "Failed to snapshot sale", http.StatusInternalServerError)
+		return
+	}
+	if len(snap.Keys) == 0 {
+		writeError(w, r, "Sale has no state in Redis", http.StatusConflict)
+		return
+	}
+
+	data, _ := json.Marshal(snap)
+	stored := &database.SaleSnapshot{
+		SaleID:  snap.SaleID,
+		TakenAt: snap.TakenAt,
+		Keys:    len(snap.Keys),
+		Codes:   snap.Codes,
+		Data:    data,
+	}
+	if err := s.db.SaveSaleSnapshot(ctx, stored); err != nil {
+		log.Printf("Failed to store snapshot of sale %s: %v", req.SaleID, err)
+		writeError(w, r, "Failed to store snapshot", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Snapshot %d of sale %s: %d keys, %d outstanding codes, %d bytes", stored.ID, stored.SaleID, stored.Keys, stored.Codes, len(data))
+
+	resp := api.SaleSnapshotResponse{
+		SnapshotID: stored.ID,
+		SaleID:     stored.SaleID,
+		TakenAt:    stored.TakenAt,
+		Keys:       stored.Keys,
+		Codes:      stored.Codes,
+		Bytes:      len(data),
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// restoreSaleHandler writes a snapshot back into Redis. Only a sale that is
+// still running can be restored; an ended sale's keys are meant to expire.
+func (s *Server) restoreSaleHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.RestoreSaleRequest{SaleID: r.PathValue("sale_id")}
+	if v := r.URL.Query().Get("snapshot_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			writeError(w, r, "snapshot_id must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		req.SnapshotID = id
+	}
+
+	ctx := r.Context()
+	sale, err := s.db.GetSale(ctx, req.SaleID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, "Sale not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, r, "Failed to load sale", http.StatusInternalServerError)
+		return
+	}
+	if sale.Status != "active" {
+		writeError(w, r, "Only a running sale can be restored", http.StatusConflict)
+		return
+	}
+
+	stored, err := s.db.GetSaleSnapshot(ctx, req.SaleID, req.SnapshotID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, "Snapshot not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, r, "Failed to load snapshot", http.StatusInternalServerError)
+		return
+	}
+	var snap cache.SaleSnapshot
+	if err := json.Unmarshal(stored.Data, &snap); err != nil {
+		log.Printf("Snapshot %d of sale %s is unreadable: %v", stored.ID, req.SaleID, err)
+		writeError(w, r, "Snapshot is unreadable", http.StatusInternalServerError)
+		return
+	}
+
+	restored, err := s.cache.RestoreSale(ctx, &snap)
+	if err != nil {
+		log.Printf("Failed to restore sale %s from snapshot %d after %d keys: %v", req.SaleID, stored.ID, restored, err)
+		writeError(w, r, "Failed to restore snapshot", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Restored sale %s from snapshot %d: %d of %d keys", req.SaleID, stored.ID, restored, len(snap.Keys))
+
+	resp := api.RestoreSaleResponse{
+		SnapshotID: stored.ID,
+		SaleID:     req.SaleID,
+		TakenAt:    stored.TakenAt,
+		Restored:   restored,
+		Expired:    len(snap.Keys) - restored,
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/cache"
+)
+
+const soldItemsPageSize = 100
+
+// soldItemsHandler lists the items sold in a sale, for storefronts to badge
+// their catalog. The running sale is read from its sold bitmap in Redis;
+// other sales, and sales whose items carry no number, from their purchases.
+func (s *Server) soldItemsHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.SoldItemsRequest{SaleID: r.PathValue("sale_id")}
+	req.Page, _ = strconv.Atoi(r.URL.Query().Get("page"))
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	offset := (req.Page - 1) * soldItemsPageSize
+
+	ctx := r.Context()
+	resp := api.SoldItemsResponse{
+		SaleID:   req.SaleID,
+		Page:     req.Page,
+		PageSize: soldItemsPageSize,
+		ItemIDs:  []string{},
+	}
+
+	activeSale := s.saleManager.GetCurrentSale()
+	running := activeSale != nil && activeSale.SaleID == req.SaleID
+	var numbers []int
+	if running {
+		var err error
+		if numbers, err = s.cache.SoldItemNumbers(ctx, req.SaleID); err != nil {
+			log.Printf("Failed to read sold bitmap of sale %s, listing its purchases: %v", req.SaleID, err)
+		}
+	}
+
+	if len(numbers) > 0 {
+		resp.TotalSold = len(numbers)
+		for _, n := range numbers[min(offset, len(numbers)):min(offset+soldItemsPageSize, len(numbers))] {
+			resp.ItemIDs = append(resp.ItemIDs, cache.ItemID(req.SaleID, n))
+		}
+	} else {
+		if !running {
+			if _, err := s.db.GetSale(ctx, req.SaleID); err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					writeError(w, r, "Sale not found", http.StatusNotFound)
+					return
+				}
+				writeError(w, r, "Failed to load sale", http.StatusInternalServerError)
+				return
+			}
+		}
+		ids, total, err := s.db.ListSoldItemIDs(ctx, req.SaleID, soldItemsPageSize, offset)
+		if err != nil {
+			log.Printf("Failed to list sold items of sale %s: %v", req.SaleID, err)
+			writeError(w, r, "Failed to list sold items", http.StatusInternalServerError)
+			return
+		}
+		resp.TotalSold = total
+		resp.ItemIDs = append(resp.ItemIDs, ids...)
+	}
+
+	if running {
+		writeCacheable(w, r, activeSale, resp)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
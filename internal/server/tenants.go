@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"flash_sale_contest/internal/metrics"
+	"flash_sale_contest/internal/sale"
+)
+
+// tenantHeader names the tenant a request is for. Without it the first
+// label of the Host is tried, then the default tenant serves the request.
+const tenantHeader = "X-Tenant-ID"
+
+// startTenants starts an independent contest for every configured tenant:
+// its own sale manager, metrics and inventory gate over tenant-scoped
+// views of Postgres and Redis.
+func (s *Server) startTenants(ctx context.Context, tenants []string) {
+	s.tenants = make(map[string]*Server, len(tenants))
+	for _, tenant := range tenants {
+		t := &Server{
+			port:    s.port,
+			db:      s.db.ForTenant(tenant),
+			cache:   s.cache.ForTenant(tenant),
+			metrics: metrics.NewService(),
+			tenant:  tenant,
+
+			asyncPurchases: s.asyncPurchases,
+			notifications:  s.notifications,
+			attemptLog:     s.attemptLog,
+			writes:         s.writes,
+			webhooks:       s.webhooks,
+			slo:            s.slo,
+		}
+		t.saleManager = sale.NewTenantManager(tenant, t.db, t.cache)
+		t.startSales(ctx)
+		s.tenants[tenant] = t
+	}
+}
+
+// forTenant returns the Server of tenant, or s itself for the default
+// tenant and tenants that are no longer configured.
+func (s *Server) forTenant(tenant string) *Server {
+	if t, ok := s.tenants[tenant]; ok {
+		return t
+	}
+	return s
+}
+
+// tenantRouter sends each request to the routes of its tenant.
+func (s *Server) tenantRouter(defaultRoutes http.Handler) http.Handler {
+	routes := make(map[string]http.Handler, len(s.tenants))
+	for tenant, t := range s.tenants {
+		routes[tenant] = t.routes()
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, ok := s.requestTenant(r)
+		switch {
+		case !ok:
+			writeError(w, r, "Unknown tenant", http.StatusNotFound)
+		case t == s:
+			defaultRoutes.ServeHTTP(w, r)
+		default:
+			routes[t.tenant].ServeHTTP(w, r)
+		}
+	})
+}
+
+// requestTenant returns the Server a request is for: the tenant named by
+// its X-Tenant-ID header or by the first label of its Host, else s. It
+// reports false when the header names an unknown tenant.
+func (s *Server) requestTenant(r *http.Request) (*Server, bool) {
+	if tenant := r.Header.Get(tenantHeader); tenant != "" {
+		t, ok := s.tenants[tenant]
+		return t, ok
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if label, _, ok := strings.Cut(host, "."); ok {
+		if t, ok := s.tenants[label]; ok {
+			return t, true
+		}
+	}
+	return s, true
+}
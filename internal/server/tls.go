@@ -0,0 +1,93 @@
+package server
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"flash_sale_contest/internal/config"
+)
+
+// configureTLS turns on HTTPS for srv when a certificate or autocert domains
+// are configured, and starts the HTTP_REDIRECT_ADDR listener next to it.
+// With autocert, certificates are obtained on the first handshake for each
+// domain, through TLS-ALPN on srv or HTTP-01 on the redirect listener.
+func (s *Server) configureTLS(srv *http.Server, cfg *config.Config) {
+	var challenges func(http.Handler) http.Handler
+	switch {
+	case len(cfg.TLSAutocertDomains) > 0:
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.TLSAutocertDomains...),
+			Cache:      autocert.DirCache(cfg.TLSAutocertCacheDir),
+		}
+		srv.TLSConfig = m.TLSConfig()
+		challenges = m.HTTPHandler
+	case cfg.TLSCertFile != "" && cfg.TLSKeyFile != "":
+		srv.TLSConfig = &tls.Config{}
+	default:
+		return
+	}
+	srv.TLSConfig.MinVersion = tls.VersionTLS12
+	if srv.Protocols != nil {
+		srv.Protocols.SetHTTP2(true)
+	}
+
+	if cfg.HTTPRedirectAddr == "" {
+		return
+	}
+	handler := redirectToHTTPS(s.port)
+	if challenges != nil {
+		handler = challenges(handler)
+	}
+	redirect := &http.Server{
+		Addr:              cfg.HTTPRedirectAddr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+	}
+	srv.RegisterOnShutdown(func() { redirect.Close() })
+	go func() {
+		log.Printf("Redirecting HTTP on %s to HTTPS", cfg.HTTPRedirectAddr)
+		if err := redirect.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("HTTP redirect listener stopped: %v", err)
+		}
+	}()
+}
+
+// redirectToHTTPS sends every request to the same host and path over HTTPS
+// on port. 308 keeps the method, so a POST /checkout is not turned into a
+// GET.
+func redirectToHTTPS(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host == "" {
+			writeError(w, r, "Host header is required", http.StatusBadRequest)
+			return
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// ListenAndServe serves srv over HTTPS when NewServer configured TLS for
+// it, and over plain HTTP otherwise.
+func ListenAndServe(srv *http.Server) error {
+	if srv.TLSConfig == nil {
+		return srv.ListenAndServe()
+	}
+	cfg := config.Get()
+	if len(cfg.TLSAutocertDomains) > 0 {
+		return srv.ListenAndServeTLS("", "")
+	}
+	return srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"flash_sale_contest/internal/codes"
+	"flash_sale_contest/internal/trace"
+)
+
+const (
+	requestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 128
+	traceparentHeader  = "traceparent"
+)
+
+// traceMiddleware starts the server span of every request. It continues the
+// caller's trace when a traceparent is sent, and keeps the caller's
+// X-Request-ID (or mints one) as the correlation ID; both are echoed back.
+func (s *Server) traceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := withRequestStart(r.Context(), time.Now())
+		if sc, ok := trace.Parse(r.Header.Get(traceparentHeader)); ok {
+			ctx = trace.WithRemote(ctx, sc)
+		}
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = codes.NewID()
+		}
+		ctx = trace.WithCorrelationID(ctx, id)
+
+		ctx, span := trace.Start(ctx, r.Method+" "+r.URL.Path, slog.String("http.path", r.URL.Path))
+		w.Header().Set(requestIDHeader, id)
+		w.Header().Set(traceparentHeader, span.Context().Traceparent())
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		r = r.WithContext(ctx)
+		next.ServeHTTP(rec, r)
+
+		// The mux records the matched pattern on the request it was given.
+		if route := r.Pattern; route != "" {
+			if _, path, ok := strings.Cut(route, " "); ok {
+				route = path
+			}
+			span.SetName(r.Method + " " + route)
+		}
+		span.SetAttrs(slog.Int("http.status", rec.status))
+		var err error
+		if rec.status >= 500 {
+			err = fmt.Errorf("%s", http.StatusText(rec.status))
+		}
+		span.End(err)
+	})
+}
+
+// traceID returns the hex trace ID carried by ctx, or "".
+func traceID(ctx context.Context) string {
+	if sc, ok := trace.FromContext(ctx); ok {
+		return hex.EncodeToString(sc.TraceID[:])
+	}
+	return ""
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/config"
+)
+
+// trendingMax is the most items /sale/trending lists, and how many every
+// read of the ranking fetches.
+const trendingMax = 50
+
+// trendingReading is the active sale's view ranking as last read from
+// Redis.
+type trendingReading struct {
+	saleID string
+	items  []cache.ItemViews
+	readAt time.Time
+}
+
+// trendingSnapshot shares one Redis read of the view ranking between every
+// /sale/trending request of a process for TRENDING_REFRESH.
+type trendingSnapshot struct {
+	mu      sync.Mutex
+	current atomic.Pointer[trendingReading]
+}
+
+// trendingItems returns the unsold items of saleID, most viewed first, as
+// read no longer than TRENDING_REFRESH ago. While one caller refreshes
+// them, the others are served the previous reading, which is also kept
+// when Redis cannot be read.
+func (s *Server) trendingItems(ctx context.Context, saleID string) ([]cache.ItemViews, error) {
+	ttl := config.Get().TrendingRefresh
+	snap := &s.trending
+	fresh := func(r *trendingReading) bool {
+		return r != nil && r.saleID == saleID && time.Since(r.readAt) < ttl
+	}
+
+	if r := snap.current.Load(); fresh(r) {
+		return r.items, nil
+	}
+	if !snap.mu.TryLock() {
+		if r := snap.current.Load(); r != nil && r.saleID == saleID {
+			return r.items, nil
+		}
+		snap.mu.Lock()
+	}
+	defer snap.mu.Unlock()
+	if r := snap.current.Load(); fresh(r) {
+		return r.items, nil
+	}
+
+	items, err := s.cache.TrendingItems(ctx, saleID, trendingMax)
+	if err != nil {
+		last := snap.current.Load()
+		if last == nil || last.saleID != saleID {
+			return nil, err
+		}
+		log.Printf("Failed to read trending items of sale %s, serving the last ones: %v", saleID, err)
+		// Retry after another TTL rather than on every request.
+		items = last.items
+	}
+	snap.current.Store(&trendingReading{saleID: saleID, items: items, readAt: time.Now()})
+	return items, nil
+}
+
+// itemViewHandler is the beacon frontends send when a buyer opens an
+// item's details. Views rank the items of /sale/trending and of the
+// most_viewed showcase.
+func (s *Server) itemViewHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.ItemViewRequest{ItemID: r.PathValue("item_id")}
+
+	activeSale := s.saleManager.GetCurrentSale()
+	if activeSale == nil {
+		writeError(w, r, "No active sale", http.StatusNotFound)
+		return
+	}
+
+	if err := s.cache.RecordItemView(r.Context(), activeSale.SaleID, req.ItemID); err != nil {
+		if err.Error() == "unknown item" {
+			writeError(w, r, "Item not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to record a view of item %s: %v", req.ItemID, err)
+		writeError(w, r, "Failed to record view", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, r, http.StatusOK, api.ItemViewResponse{SaleID: activeSale.SaleID, ItemID: req.ItemID})
+}
+
+// trendingHandler lists the active sale's most viewed items that are still
+// for sale, so frontends can show buyers what others are after.
+func (s *Server) trendingHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.TrendingRequest{Limit: config.Get().TrendingSize}
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		req.Limit = v
+	}
+	req.Limit = min(req.Limit, trendingMax)
+
+	activeSale := s.saleManager.GetCurrentSale()
+	if activeSale == nil {
+		writeError(w, r, "No active sale", http.StatusNotFound)
+		return
+	}
+
+	items, err := s.trendingItems(r.Context(), activeSale.SaleID)
+	if err != nil {
+		log.Printf("Failed to read trending items of sale %s: %v", activeSale.SaleID, err)
+		writeError(w, r, "Failed to load trending items", http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.TrendingResponse{SaleID: activeSale.SaleID, Items: []api.TrendingItem{}}
+	for _, item := range items[:min(req.Limit, len(items))] {
+		resp.Items = append(resp.Items, api.TrendingItem{ItemID: item.ItemID, Views: item.Views})
+	}
+	writeCacheable(w, r, activeSale, resp)
+}
+
+// expire has the next reader refresh the snapshot. The reading is kept to
+// be served while it does.
+func (snap *trendingSnapshot) expire() {
+	if r := snap.current.Load(); r != nil {
+		expired := *r
+		expired.readAt = time.Time{}
+		snap.current.CompareAndSwap(r, &expired)
+	}
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/config"
+	"flash_sale_contest/internal/notifications"
+	"flash_sale_contest/internal/usertoken"
+)
+
+const (
+	// userEventsTokenTTL is how long a token from /checkout opens
+	// /ws/user; it outlasts the sale the checkout was made in.
+	userEventsTokenTTL = 2 * time.Hour
+	// userEventsPoll is how often a connection looks for codes about to
+	// expire and sends a keep-alive.
+	userEventsPoll = 5 * time.Second
+)
+
+// userEventsToken signs userID for /ws/user, see usertoken.Sign. It
+// returns "" when the stream is off.
+func (s *Server) userEventsToken(userID string, expires time.Time) string {
+	return usertoken.Sign(config.Get().UserEventsSecret, s.tenant, userID, expires)
+}
+
+// verifyUserEventsToken returns the user a token was issued to, if it is
+// well formed, correctly signed and unexpired.
+func (s *Server) verifyUserEventsToken(token string, now time.Time) (string, bool) {
+	return usertoken.Verify(config.Get().UserEventsSecret, s.tenant, token, now)
+}
+
+// userEventsHandler streams one user's events as server-sent events:
+// purchase confirmations and waitlist offers published on the user's Redis
+// channel by the push notification sender, and warnings for checkout codes
+// about to expire and extensions of the running sale, which the connection
+// finds itself.
+func (s *Server) userEventsHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.UserEventsRequest{Token: r.URL.Query().Get("token")}
+	if config.Get().UserEventsSecret == "" {
+		writeError(w, r, "User events are disabled", http.StatusNotFound)
+		return
+	}
+	userID, ok := s.verifyUserEventsToken(req.Token, time.Now())
+	if !ok {
+		writeError(w, r, "Invalid or expired token", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+	sub := s.cache.SubscribeUserEvents(ctx, userID)
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		log.Printf("Failed to subscribe to events of user %s: %v", userID, err)
+		writeError(w, r, "Failed to subscribe", http.StatusServiceUnavailable)
+		return
+	}
+
+	// The stream outlives the server-wide write timeout.
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	warned := make(map[string]time.Time)
+	s.warnExpiringCodes(ctx, w, userID, warned)
+	var seen saleEnd
+	s.announceExtension(w, userID, &seen)
+	if rc.Flush() != nil {
+		return
+	}
+
+	ticker := time.NewTicker(userEventsPoll)
+	defer ticker.Stop()
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var e notifications.Event
+			if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+				continue
+			}
+			writeEvent(w, e.Type, []byte(msg.Payload))
+		case <-ticker.C:
+			s.warnExpiringCodes(ctx, w, userID, warned)
+			s.announceExtension(w, userID, &seen)
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
+
+// warnExpiringCodes sends a code.expiring event, once per expiry, for each of
+// the user's codes in the current sale that expires within
+// CODE_EXPIRY_WARNING. warned holds the expiry each code was warned about,
+// so an extended code is warned about again, and is trimmed to the codes
+// still outstanding.
+func (s *Server) warnExpiringCodes(ctx context.Context, w http.ResponseWriter, userID string, warned map[string]time.Time) {
+	warning := config.Get().CodeExpiryWarning
+	activeSale := s.saleManager.GetCurrentSale()
+	if warning <= 0 || activeSale == nil {
+		return
+	}
+	reservations, err := s.cache.ListReservations(ctx, activeSale.SaleID, userID)
+	if err != nil {
+		return
+	}
+
+	outstanding := make(map[string]bool, len(reservations))
+	now := time.Now()
+	for _, res := range reservations {
+		outstanding[res.Code] = true
+		if warned[res.Code].Equal(res.ExpiresAt) || res.ExpiresAt.Sub(now) > warning {
+			continue
+		}
+		warned[res.Code] = res.ExpiresAt
+		payload, _ := json.Marshal(notifications.Event{
+			Type:       notifications.EventCodeExpiring,
+			SaleID:     res.SaleID,
+			UserID:     userID,
+			ItemID:     res.ItemID,
+			Code:       res.Code,
+			ExpiresAt:  res.ExpiresAt,
+			OccurredAt: now,
+			Tenant:     s.tenant,
+		})
+		writeEvent(w, notifications.EventCodeExpiring, payload)
+	}
+	for code := range warned {
+		if !outstanding[code] {
+			delete(warned, code)
+		}
+	}
+}
+
+// saleEnd is the end of the running sale a connection last saw.
+type saleEnd struct {
+	saleID string
+	end    time.Time
+}
+
+// announceExtension sends a sale.extended event when the anti-sniping rule
+// moved the end of the running sale since the connection last looked. A
+// connection's first look, and a new sale, only update seen.
+func (s *Server) announceExtension(w http.ResponseWriter, userID string, seen *saleEnd) {
+	activeSale := s.saleManager.GetCurrentSale()
+	if activeSale == nil {
+		return
+	}
+	extended := seen.saleID == activeSale.SaleID && activeSale.EndTime.After(seen.end)
+	*seen = saleEnd{saleID: activeSale.SaleID, end: activeSale.EndTime}
+	if !extended {
+		return
+	}
+	payload, _ := json.Marshal(notifications.Event{
+		Type:       notifications.EventSaleExtended,
+		SaleID:     activeSale.SaleID,
+		UserID:     userID,
+		EndsAt:     activeSale.EndTime,
+		OccurredAt: time.Now(),
+		Tenant:     s.tenant,
+	})
+	writeEvent(w, notifications.EventSaleExtended, payload)
+}
+
+func writeEvent(w http.ResponseWriter, event string, data []byte) {
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/codes"
+	"flash_sale_contest/internal/database"
+)
+
+var (
+	userIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.:@-]{1,100}$`)
+	handlePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,32}$`)
+)
+
+const (
+	// userRegistryPage is how many user IDs are copied to Redis at a time.
+	userRegistryPage = 5000
+	// userRegistryTimeout bounds one copy of every user ID to Redis.
+	userRegistryTimeout = 2 * time.Minute
+)
+
+// registerUserHandler registers a user, with a generated ID unless the
+// client brings its own. Only registered users can check out.
+func (s *Server) registerUserHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.RegisterUserRequest{
+		UserID: r.URL.Query().Get("user_id"),
+		Handle: r.URL.Query().Get("handle"),
+	}
+	if !handlePattern.MatchString(req.Handle) {
+		writeError(w, r, "handle must be 3-32 letters, digits, '.', '-' or '_'", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = codes.NewID()
+	} else if !userIDPattern.MatchString(req.UserID) {
+		writeError(w, r, "user_id must be 1-100 letters, digits, '.', ':', '@', '-' or '_'", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	user := &database.User{ID: req.UserID, Handle: req.Handle}
+	if err := s.db.CreateUser(ctx, user); err != nil {
+		switch err.Error() {
+		case "user exists":
+			writeError(w, r, "User already registered", http.StatusConflict)
+		case "handle taken":
+			writeError(w, r, "Handle taken", http.StatusConflict)
+		default:
+			log.Printf("Failed to register user %s: %v", req.UserID, err)
+			writeError(w, r, "Failed to register user", http.StatusInternalServerError)
+		}
+		return
+	}
+	// A user missing from Redis is found in Postgres at their first
+	// checkout, so this failing only costs that lookup.
+	if err := s.cache.RegisterUsers(ctx, user.ID); err != nil {
+		log.Printf("Failed to publish user %s to Redis: %v", user.ID, err)
+	}
+
+	resp := api.RegisterUserResponse{UserID: user.ID, Handle: user.Handle, CreatedAt: user.CreatedAt}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// reserveItem is cache.ReserveItem with a second chance for users Redis
+// lost in a flush or a failover: a user it does not know is looked up in
+// Postgres and, if registered there, published again and retried.
+func (s *Server) reserveItem(ctx context.Context, saleID, userID, itemID, category, promoCode string, ttl time.Duration) (*cache.Reservation, error) {
+	reservation, err := s.cache.ReserveItem(ctx, saleID, userID, itemID, category, promoCode, ttl)
+	s.metrics.RecordReservationOutcome(cache.ReservationOutcome(err))
+	if err == nil || err.Error() != "unknown user" {
+		return reservation, err
+	}
+	if _, dbErr := s.db.GetUser(ctx, userID); dbErr != nil {
+		if !errors.Is(dbErr, sql.ErrNoRows) {
+			log.Printf("Failed to look up user %s: %v", userID, dbErr)
+		}
+		return nil, err
+	}
+	if err := s.cache.RegisterUsers(ctx, userID); err != nil {
+		return nil, err
+	}
+	reservation, err = s.cache.ReserveItem(ctx, saleID, userID, itemID, category, promoCode, ttl)
+	s.metrics.RecordReservationOutcome(cache.ReservationOutcome(err))
+	return reservation, err
+}
+
+// loadUserRegistry copies the registered users to Redis when it holds none,
+// as after a flush, so the first checkouts do not each look their user up
+// in Postgres.
+func (s *Server) loadUserRegistry() {
+	ctx, cancel := context.WithTimeout(context.Background(), userRegistryTimeout)
+	defer cancel()
+
+	known, err := s.cache.RegisteredUserCount(ctx)
+	if err != nil {
+		log.Printf("Failed to count the users known to Redis: %v", err)
+		return
+	}
+	if known == 0 {
+		s.syncUserRegistry(ctx)
+	}
+}
+
+// syncUserRegistry copies every registered user to Redis, a page at a time.
+func (s *Server) syncUserRegistry(ctx context.Context) {
+	total := 0
+	for after := ""; ; {
+		ids, err := s.db.ListUserIDs(ctx, after, userRegistryPage)
+		if err != nil {
+			log.Printf("Failed to list users after %d copied to Redis: %v", total, err)
+			return
+		}
+		if err := s.cache.RegisterUsers(ctx, ids...); err != nil {
+			log.Printf("Failed to copy users to Redis after %d: %v", total, err)
+			return
+		}
+		total += len(ids)
+		if len(ids) < userRegistryPage {
+			break
+		}
+		after = ids[len(ids)-1]
+	}
+	log.Printf("Copied %d registered users to Redis", total)
+}
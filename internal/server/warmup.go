@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"flash_sale_contest/internal/config"
+)
+
+const (
+	// warmUpTimeout bounds one attempt to warm a tenant up.
+	warmUpTimeout = 30 * time.Second
+	// warmUpRetry is how long a failed warm-up waits before trying again.
+	warmUpRetry = 5 * time.Second
+	// warmUpItemPages is how many /sale/items pages are read ahead.
+	warmUpItemPages = 5
+)
+
+// startWarmUp warms the default tenant and every other one up in the
+// background. /readyz answers 503 for a tenant until its warm-up is done.
+func (s *Server) startWarmUp(ctx context.Context) {
+	go func() {
+		s.prewarm(ctx)
+		s.runWarmUp(ctx)
+	}()
+	for _, t := range s.tenants {
+		go t.runWarmUp(ctx)
+	}
+}
+
+// prewarm opens the Redis and Postgres connections the tenants share and
+// readies the scripts and statements of the request path on them, so a
+// replica started just before a sale does not pay for them on its first
+// requests. A failure is logged and left to the pools to recover from.
+func (s *Server) prewarm(ctx context.Context) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, warmUpTimeout)
+	defer cancel()
+
+	redisConns, err := s.cache.Prewarm(ctx)
+	if err != nil {
+		log.Printf("Warning: pre-warming Redis stopped after %d connections: %v", redisConns, err)
+	}
+	dbConns, err := s.db.Prewarm(ctx, config.Get().PrewarmDBConns)
+	if err != nil {
+		log.Printf("Warning: pre-warming Postgres stopped after %d connections: %v", dbConns, err)
+	}
+	log.Printf("Pre-warmed %d Redis and %d Postgres connections in %s", redisConns, dbConns, time.Since(start).Round(time.Millisecond))
+}
+
+// runWarmUp retries warmUp until it succeeds.
+func (s *Server) runWarmUp(ctx context.Context) {
+	start := time.Now()
+	for {
+		attemptCtx, cancel := context.WithTimeout(ctx, warmUpTimeout)
+		err := s.warmUp(attemptCtx)
+		cancel()
+		if err == nil {
+			break
+		}
+		log.Printf("Warm-up failed, retrying in %s: %v", warmUpRetry, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(warmUpRetry):
+		}
+	}
+	s.warmedUp.Store(true)
+	log.Printf("Warmed up in %s", time.Since(start).Round(time.Millisecond))
+}
+
+// warmUp readies a replica that starts in the middle of a sale: the
+// sale's Redis keys are checked and rebuilt if missing, as after a flush,
+// its showcase picked if none is cached, and the first item pages, the
+// inventory snapshot and the trending items read once so the first
+// requests do not all miss together. Without a running sale there is
+// nothing to warm.
+func (s *Server) warmUp(ctx context.Context) error {
+	activeSale := s.saleManager.GetCurrentSale()
+	if activeSale == nil {
+		return nil
+	}
+	saleID := activeSale.SaleID
+
+	missing, err := s.cache.MissingSaleKeys(ctx, saleID)
+	if err != nil {
+		return fmt.Errorf("could not check the Redis keys of sale %s: %w", saleID, err)
+	}
+	switch {
+	case slices.Contains(missing, "inventory"):
+		log.Printf("Redis lost the inventory of sale %s, rebuilding it from the ledger", saleID)
+		if err := s.warmSale(ctx); err != nil {
+			return err
+		}
+	case slices.Contains(missing, "items"):
+		log.Printf("Redis lost the items of sale %s, reloading them from the catalog", saleID)
+		items, err := s.saleItemInfos(ctx, saleID)
+		if err != nil {
+			return err
+		}
+		if err := s.cache.SetItems(ctx, saleID, items); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.cache.GetShowcaseInfo(ctx, saleID); err != nil {
+		if _, err := s.saleManager.RefreshShowcase(ctx, saleID); err != nil {
+			return fmt.Errorf("could not pick the showcase of sale %s: %w", saleID, err)
+		}
+	}
+	for page := 0; page < warmUpItemPages; page++ {
+		items, err := s.db.GetSaleItems(ctx, saleID, "", saleItemsPageSize, page*saleItemsPageSize)
+		if err != nil {
+			return fmt.Errorf("could not read the items of sale %s: %w", saleID, err)
+		}
+		if len(items) < saleItemsPageSize {
+			break
+		}
+	}
+	if reading := s.inventory(ctx, saleID); reading.remaining < 0 {
+		return fmt.Errorf("could not read the inventory of sale %s", saleID)
+	}
+	if _, err := s.trendingItems(ctx, saleID); err != nil {
+		log.Printf("Warning: could not read the trending items of sale %s: %v", saleID, err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"flash_sale_contest/internal/api"
+	"flash_sale_contest/internal/codes"
+	"flash_sale_contest/internal/config"
+	"flash_sale_contest/internal/database"
+	"flash_sale_contest/internal/webhooks"
+)
+
+// startWebhooks starts the webhook dispatcher, which tenants share. With
+// WEBHOOK_WORKERS=0 no webhooks are sent, and none are scheduled.
+func (s *Server) startWebhooks(ctx context.Context) {
+	cfg := config.Get()
+	if cfg.WebhookWorkers <= 0 {
+		log.Println("Webhooks disabled")
+		return
+	}
+	s.webhooks = webhooks.NewDispatcher(s.db, s.cache, cfg.WebhookMaxAttempts, cfg.WebhookBackoff, webhooks.Hooks{
+		Delivered: s.metrics.IncrementWebhooksDelivered,
+		Failed:    s.metrics.IncrementWebhooksFailed,
+	})
+	s.webhooks.Start(ctx, cfg.WebhookWorkers)
+}
+
+// createWebhookHandler registers a webhook for a sale. The secret that
+// signs its payloads is generated here and only ever returned once.
+func (s *Server) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.CreateWebhookRequest{SaleID: r.PathValue("sale_id"), URL: r.URL.Query().Get("url")}
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		writeError(w, r, "url must be an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if _, err := s.db.GetSale(ctx, req.SaleID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, "Sale not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, r, "Failed to load sale", http.StatusInternalServerError)
+		return
+	}
+
+	webhook := &database.Webhook{SaleID: req.SaleID, URL: req.URL, Secret: codes.NewID()}
+	if err := s.db.CreateWebhook(ctx, webhook); err != nil {
+		log.Printf("Failed to create webhook for sale %s: %v", req.SaleID, err)
+		writeError(w, r, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Webhook %d registered for sale %s", webhook.ID, req.SaleID)
+
+	resp := apiWebhook(webhook)
+	resp.Secret = webhook.Secret
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// webhooksHandler lists a sale's webhooks, without their secrets.
+func (s *Server) webhooksHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeWebhooks(w, r, r.PathValue("sale_id"))
+}
+
+// deleteWebhookHandler removes a webhook and lists the sale's others.
+// Deliveries already scheduled for it are still made.
+func (s *Server) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	req := api.DeleteWebhookRequest{SaleID: r.PathValue("sale_id")}
+	var err error
+	if req.WebhookID, err = strconv.ParseInt(r.PathValue("webhook_id"), 10, 64); err != nil {
+		writeError(w, r, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	if err := s.db.DeleteWebhook(r.Context(), req.SaleID, req.WebhookID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, r, "Failed to delete webhook", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Webhook %d of sale %s deleted", req.WebhookID, req.SaleID)
+	s.writeWebhooks(w, r, req.SaleID)
+}
+
+func (s *Server) writeWebhooks(w http.ResponseWriter, r *http.Request, saleID string) {
+	req := api.WebhooksRequest{SaleID: saleID}
+	ctx := r.Context()
+	hooks, err := s.db.ListWebhooks(ctx, req.SaleID)
+	if err != nil {
+		writeError(w, r, "Failed to list webhooks", http.StatusInternalServerError)
+		return
+	}
+	backlog, err := s.cache.WebhookBacklog(ctx)
+	if err != nil {
+		log.Printf("Warning: could not read the webhook backlog: %v", err)
+	}
+
+	resp := api.WebhooksResponse{Webhooks: []api.Webhook{}, Backlog: backlog}
+	for i := range hooks {
+		resp.Webhooks = append(resp.Webhooks, apiWebhook(&hooks[i]))
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+func apiWebhook(w *database.Webhook) api.Webhook {
+	return api.Webhook{WebhookID: w.ID, SaleID: w.SaleID, URL: w.URL, CreatedAt: w.CreatedAt}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+
+	"flash_sale_contest/internal/config"
+	"flash_sale_contest/internal/workers"
+)
+
+// errWriteShed is parked with the writes the pool had no room for.
+var errWriteShed = errors.New("write queue full")
+
+// writePools maps each http.Server made by NewServer to its write pool,
+// which Shutdown drains.
+var writePools sync.Map
+
+// startWrites starts the pool that writes completed purchases to the
+// database. A rush would otherwise start a goroutine, and take a
+// connection, per purchase. Tenants share the pool.
+func (s *Server) startWrites() {
+	cfg := config.Get()
+	pool, err := workers.New(cfg.WriteWorkers, cfg.WriteQueue, cfg.WriteBackpressure)
+	if err != nil {
+		log.Printf("%v, writing with 32 workers and shedding to the dead letter queue", err)
+		pool, _ = workers.New(32, cfg.WriteQueue, workers.PolicyDrop)
+	}
+	s.writes = pool
+}
+
+// persist runs write on the write pool. A write the pool refuses is shed
+// instead: shed parks it in the dead letter queue, to be replayed once the
+// rush is over.
+func (s *Server) persist(write, shed func()) {
+	if s.writes.Submit(write) {
+		return
+	}
+	s.metrics.IncrementWritesShed()
+	shed()
+}
+
+// Shutdown stops srv like http.Server.Shutdown, then waits, until ctx is
+// done, for the writes its handlers queued.
+func Shutdown(ctx context.Context, srv *http.Server) error {
+	err := srv.Shutdown(ctx)
+	if pool, ok := writePools.Load(srv); ok {
+		if left := pool.(*workers.Pool).Stop(ctx); left > 0 {
+			log.Printf("Shut down with %d purchase writes still queued", left)
+		}
+	}
+	return err
+}
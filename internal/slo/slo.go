@@ -0,0 +1,129 @@
+// Package slo tracks how much of a route's error budget is left.
+//
+// An objective such as "99.9% of checkouts answer without a server error in
+// under 100ms" allows 0.1% of requests to miss it; that 0.1% is the error
+// budget. The burn rate is how fast it is being spent: 1 spends exactly
+// the budget over the window, 10 spends it ten times as fast.
+package slo
+
+import (
+	"sync"
+	"time"
+)
+
+// Objective is what a route is held to.
+type Objective struct {
+	// Latency is the slowest a request may answer and still meet the
+	// objective.
+	Latency time.Duration
+	// Target is the share of requests that must meet it, such as 0.999.
+	Target float64
+}
+
+// bucket counts one second of requests.
+type bucket struct {
+	second int64
+	total  int64
+	// failed requests answered with a server error, slow ones answered
+	// after the objective's latency.
+	failed int64
+	slow   int64
+}
+
+// Tracker keeps a rolling window of one route's requests, one bucket per
+// second, and measures them against its objective as they are recorded.
+type Tracker struct {
+	mu        sync.Mutex
+	objective Objective
+	buckets   []bucket
+}
+
+// New tracks requests against objective over the last window, rounded up
+// to a whole second.
+func New(window time.Duration, objective Objective) *Tracker {
+	seconds := max(int((window+time.Second-1)/time.Second), 1)
+	return &Tracker{objective: objective, buckets: make([]bucket, seconds)}
+}
+
+// Configure replaces the objective. Requests already recorded keep the
+// verdict the old one gave them.
+func (t *Tracker) Configure(objective Objective) {
+	t.mu.Lock()
+	t.objective = objective
+	t.mu.Unlock()
+}
+
+// Record adds one request that took latency, failed with a server error or
+// not.
+func (t *Tracker) Record(latency time.Duration, failed bool) {
+	now := time.Now().Unix()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := &t.buckets[now%int64(len(t.buckets))]
+	if b.second != now {
+		*b = bucket{second: now}
+	}
+	b.total++
+	switch {
+	case failed:
+		b.failed++
+	case latency > t.objective.Latency:
+		b.slow++
+	}
+}
+
+// Status is a window of requests measured against the objective.
+type Status struct {
+	Requests int64
+	Failed   int64
+	Slow     int64
+	// Availability is the share of requests answered without a server
+	// error; 1 without requests.
+	Availability float64
+	// Compliance is the share of requests that met the objective; 1
+	// without requests.
+	Compliance float64
+	// BudgetRemaining is the share of the window's error budget left, below
+	// zero once it is overspent.
+	BudgetRemaining float64
+	// BurnRate is how many times faster than allowed the budget is being
+	// spent.
+	BurnRate float64
+}
+
+// Status measures the requests of the last window, up to the tracker's
+// own; a zero window reads all of it.
+func (t *Tracker) Status(window time.Duration) Status {
+	now := time.Now().Unix()
+	seconds := int64(window / time.Second)
+
+	t.mu.Lock()
+	objective := t.objective
+	if seconds <= 0 || seconds > int64(len(t.buckets)) {
+		seconds = int64(len(t.buckets))
+	}
+	var s Status
+	for _, b := range t.buckets {
+		if b.second > now-seconds && b.second <= now {
+			s.Requests += b.total
+			s.Failed += b.failed
+			s.Slow += b.slow
+		}
+	}
+	t.mu.Unlock()
+
+	s.Availability, s.Compliance, s.BudgetRemaining = 1, 1, 1
+	if s.Requests == 0 {
+		return s
+	}
+	missed := float64(s.Failed+s.Slow) / float64(s.Requests)
+	s.Availability = 1 - float64(s.Failed)/float64(s.Requests)
+	s.Compliance = 1 - missed
+	if budget := 1 - objective.Target; budget > 0 {
+		s.BurnRate = missed / budget
+		s.BudgetRemaining = 1 - s.BurnRate
+	}
+	return s
+}
@@ -0,0 +1,172 @@
+// Package trace is a minimal W3C trace-context implementation. Spans are
+// written as structured log lines, so an HTTP request and the database and
+// Redis writes it spawns can be joined on trace_id.
+package trace
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+
+	"flash_sale_contest/internal/config"
+)
+
+var logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+// SpanContext identifies a span within a trace.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are non-zero.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent formats sc as a traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := 0
+	if sc.Sampled {
+		flags = 1
+	}
+	return fmt.Sprintf("00-%x-%x-%02x", sc.TraceID, sc.SpanID, flags)
+}
+
+// Parse reads a traceparent header value.
+func Parse(header string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+type contextKey int
+
+const (
+	spanKey contextKey = iota
+	correlationKey
+)
+
+// WithRemote makes sc, received from a caller, the parent of the next span
+// started from ctx.
+func WithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanKey, sc)
+}
+
+// FromContext returns the span context carried by ctx, if any.
+func FromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanKey).(SpanContext)
+	return sc, ok
+}
+
+// WithCorrelationID attaches the request's correlation ID to ctx.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey, id)
+}
+
+// CorrelationID returns the correlation ID carried by ctx, or "".
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey).(string)
+	return id
+}
+
+// Detach keeps ctx's trace and correlation ID but drops its deadline and
+// cancellation, for work that outlives the request.
+func Detach(ctx context.Context) context.Context {
+	return context.WithoutCancel(ctx)
+}
+
+// Span is one timed operation.
+type Span struct {
+	sc            SpanContext
+	parent        [8]byte
+	name          string
+	correlationID string
+	start         time.Time
+	attrs         []slog.Attr
+}
+
+// Start begins a span named name as a child of the span in ctx. Without a
+// parent a new trace is started and sampled at TRACE_SAMPLE_RATE.
+func Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, *Span) {
+	span := &Span{
+		name:          name,
+		correlationID: CorrelationID(ctx),
+		start:         time.Now(),
+		attrs:         attrs,
+	}
+	if parent, ok := FromContext(ctx); ok {
+		span.sc.TraceID = parent.TraceID
+		span.sc.Sampled = parent.Sampled
+		span.parent = parent.SpanID
+	} else {
+		binary.BigEndian.PutUint64(span.sc.TraceID[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(span.sc.TraceID[8:], rand.Uint64())
+		span.sc.Sampled = rand.Float64() < config.Get().TraceSampleRate
+	}
+	binary.BigEndian.PutUint64(span.sc.SpanID[:], rand.Uint64()|1)
+	return context.WithValue(ctx, spanKey, span.sc), span
+}
+
+// Context returns the span's identity.
+func (s *Span) Context() SpanContext {
+	return s.sc
+}
+
+// SetName renames the span, e.g. once the route it served is known.
+func (s *Span) SetName(name string) {
+	s.name = name
+}
+
+// SetAttrs adds attributes to the span.
+func (s *Span) SetAttrs(attrs ...slog.Attr) {
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// End finishes the span, recording err if it failed, and logs it when the
+// trace is sampled. Failed spans are always logged.
+func (s *Span) End(err error) {
+	if !s.sc.Sampled && err == nil {
+		return
+	}
+	attrs := append([]slog.Attr{
+		slog.String("trace_id", hex.EncodeToString(s.sc.TraceID[:])),
+		slog.String("span_id", hex.EncodeToString(s.sc.SpanID[:])),
+		slog.String("name", s.name),
+		slog.Time("start", s.start),
+		slog.Float64("duration_ms", float64(time.Since(s.start).Microseconds())/1000),
+	}, s.attrs...)
+	if s.parent != [8]byte{} {
+		attrs = append(attrs, slog.String("parent_span_id", hex.EncodeToString(s.parent[:])))
+	}
+	if s.correlationID != "" {
+		attrs = append(attrs, slog.String("correlation_id", s.correlationID))
+	}
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelError
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	logger.LogAttrs(context.Background(), level, "span", attrs...)
+}
@@ -0,0 +1,344 @@
+// Package webhooks tells external systems, such as fulfillment or a CRM,
+// about completed purchases and, in two-phase purchase mode, about
+// purchases whose payment failed. Admins register URLs per sale; every event
+// is POSTed to each URL of its sale, signed with that webhook's secret, and
+// retried with exponential backoff until the endpoint accepts it or the
+// attempts run out. Deliveries are scheduled in Redis, so they survive a
+// restart and are shared by every replica.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"flash_sale_contest/internal/cache"
+	"flash_sale_contest/internal/database"
+)
+
+// Events sent to webhooks.
+const (
+	EventPurchaseCompleted = "purchase.completed"
+	// EventPurchaseFailed is sent when the payment of a pending purchase
+	// fails and its item goes back on sale.
+	EventPurchaseFailed = "purchase.failed"
+)
+
+const (
+	// SignatureHeader carries "t=<unix seconds>,v1=<hex HMAC-SHA256>" of
+	// "<t>.<body>" keyed with the webhook's secret, see Sign.
+	SignatureHeader = "X-Webhook-Signature"
+	// DeliveryHeader carries the delivery ID, which stays the same across
+	// retries so receivers can drop duplicates.
+	DeliveryHeader = "X-Webhook-Delivery"
+
+	// sendTimeout bounds one attempt. A claimed batch is sent all at once,
+	// so lease outlives every attempt in it, and a delivery is only claimed
+	// again once the replica that held it has given up.
+	sendTimeout = 10 * time.Second
+	lease       = 30 * time.Second
+	// maxBackoff caps the wait between two attempts.
+	maxBackoff = time.Hour
+	// claimBatch is the most deliveries a worker claims per poll.
+	claimBatch = 20
+	pollEvery  = 500 * time.Millisecond
+	// lookupTTL is how long a sale's webhooks are cached, so purchases do
+	// not query them one by one; a newly registered webhook is picked up
+	// by every replica within it.
+	lookupTTL = 10 * time.Second
+)
+
+// Payload is the JSON body POSTed for a purchase event. RecipientID is set
+// when UserID bought the item as a gift. Unit tells apart the units of an
+// item sold by quantity.
+type Payload struct {
+	Event       string    `json:"event"`
+	DeliveryID  string    `json:"delivery_id"`
+	WebhookID   int64     `json:"webhook_id"`
+	PurchaseID  string    `json:"purchase_id,omitempty"`
+	SaleID      string    `json:"sale_id"`
+	UserID      string    `json:"user_id"`
+	ItemID      string    `json:"item_id"`
+	Unit        int       `json:"unit,omitempty"`
+	RecipientID string    `json:"recipient_id,omitempty"`
+	PromoCode   string    `json:"promo_code,omitempty"`
+	PercentOff  int       `json:"percent_off,omitempty"`
+	PurchasedAt time.Time `json:"purchased_at"`
+	// Tenant owns the sale; empty for the default tenant.
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// delivery is a payload on its way to one webhook, as scheduled in Redis.
+type delivery struct {
+	URL     string          `json:"url"`
+	Secret  string          `json:"secret"`
+	Attempt int             `json:"attempt"`
+	Body    json.RawMessage `json:"body"`
+}
+
+// Hooks tell the caller how deliveries ended.
+type Hooks struct {
+	// Delivered is called for each delivery its endpoint accepted.
+	Delivered func()
+	// Failed is called for each delivery given up on.
+	Failed func()
+}
+
+// Dispatcher schedules and delivers purchase webhooks.
+type Dispatcher struct {
+	db          database.Service
+	cache       cache.Service
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	hooks       Hooks
+
+	mu      sync.Mutex
+	lookups map[string]lookup
+}
+
+type lookup struct {
+	webhooks []database.Webhook
+	at       time.Time
+}
+
+// NewDispatcher returns a dispatcher that makes up to maxAttempts attempts
+// per delivery, waiting backoff after the first and doubling the wait
+// after each further one. db and c are the default tenant's; other
+// tenants' webhooks are read through db.ForTenant.
+func NewDispatcher(db database.Service, c cache.Service, maxAttempts int, backoff time.Duration, hooks Hooks) *Dispatcher {
+	return &Dispatcher{
+		db:          db,
+		cache:       c,
+		client:      &http.Client{Timeout: sendTimeout},
+		maxAttempts: max(maxAttempts, 1),
+		backoff:     backoff,
+		hooks:       hooks,
+		lookups:     make(map[string]lookup),
+	}
+}
+
+// PurchaseDeliveries returns a delivery of purchase for every webhook of
+// its sale, for the caller to schedule. Each delivery's ID is
+// deliveryPrefix followed by the webhook's ID, so building them again for
+// the same prefix gives the same IDs.
+func (d *Dispatcher) PurchaseDeliveries(ctx context.Context, tenant, deliveryPrefix string, purchase *database.Purchase) ([]cache.WebhookDelivery, error) {
+	purchasedAt := purchase.PurchaseTime
+	if purchasedAt.IsZero() {
+		purchasedAt = time.Now()
+	}
+	return d.deliveries(ctx, tenant, deliveryPrefix, Payload{
+		Event:       EventPurchaseCompleted,
+		PurchaseID:  purchase.ID,
+		SaleID:      purchase.SaleID,
+		UserID:      purchase.UserID,
+		ItemID:      purchase.ItemID,
+		Unit:        purchase.Unit,
+		RecipientID: purchase.RecipientID,
+		PromoCode:   purchase.PromoCode,
+		PercentOff:  purchase.PercentOff,
+		PurchasedAt: purchasedAt.UTC(),
+	})
+}
+
+// PaymentFailedDeliveries returns a purchase.failed delivery of a pending
+// purchase for every webhook of its sale. The payload leaves out the
+// purchase's checkout code.
+func (d *Dispatcher) PaymentFailedDeliveries(ctx context.Context, p *cache.PendingPurchase) ([]cache.WebhookDelivery, error) {
+	return d.deliveries(ctx, p.Tenant, "payment-"+p.PurchaseID, Payload{
+		Event:       EventPurchaseFailed,
+		PurchaseID:  p.PurchaseID,
+		SaleID:      p.SaleID,
+		UserID:      p.UserID,
+		ItemID:      p.ItemID,
+		Unit:        p.Unit,
+		RecipientID: p.RecipientID,
+		PromoCode:   p.PromoCode,
+		PercentOff:  p.PercentOff,
+		PurchasedAt: p.UpdatedAt.UTC(),
+	})
+}
+
+// deliveries addresses payload to every webhook of its sale, under
+// delivery IDs starting with deliveryPrefix.
+func (d *Dispatcher) deliveries(ctx context.Context, tenant, deliveryPrefix string, payload Payload) ([]cache.WebhookDelivery, error) {
+	webhooks, err := d.webhooks(ctx, tenant, payload.SaleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webhooks of sale %s: %w", payload.SaleID, err)
+	}
+
+	payload.Tenant = tenant
+	deliveries := make([]cache.WebhookDelivery, 0, len(webhooks))
+	for _, w := range webhooks {
+		payload.DeliveryID = fmt.Sprintf("%s-%d", deliveryPrefix, w.ID)
+		payload.WebhookID = w.ID
+		body, _ := json.Marshal(payload)
+		dl, _ := json.Marshal(delivery{URL: w.URL, Secret: w.Secret, Body: body})
+		deliveries = append(deliveries, cache.WebhookDelivery{ID: payload.DeliveryID, Payload: dl})
+	}
+	return deliveries, nil
+}
+
+// webhooks returns the webhooks of a sale, cached for lookupTTL.
+func (d *Dispatcher) webhooks(ctx context.Context, tenant, saleID string) ([]database.Webhook, error) {
+	key := tenant + "/" + saleID
+	d.mu.Lock()
+	l, ok := d.lookups[key]
+	d.mu.Unlock()
+	if ok && time.Since(l.at) < lookupTTL {
+		return l.webhooks, nil
+	}
+
+	webhooks, err := d.db.ForTenant(tenant).ListWebhooks(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for k, l := range d.lookups {
+		if time.Since(l.at) >= lookupTTL {
+			delete(d.lookups, k)
+		}
+	}
+	d.lookups[key] = lookup{webhooks: webhooks, at: time.Now()}
+	return webhooks, nil
+}
+
+// Start runs concurrency workers that deliver due webhooks until ctx is
+// done.
+func (d *Dispatcher) Start(ctx context.Context, concurrency int) {
+	for i := 0; i < concurrency; i++ {
+		go d.run(ctx)
+	}
+	log.Printf("Webhook dispatcher started with %d workers", concurrency)
+}
+
+func (d *Dispatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(pollEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		due, err := d.cache.ClaimWebhooks(ctx, lease, claimBatch)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to claim webhook deliveries: %v", err)
+			}
+			continue
+		}
+		var wg sync.WaitGroup
+		for _, scheduled := range due {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.deliver(ctx, scheduled)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// deliver makes one attempt at a delivery, then forgets it or schedules
+// the next attempt.
+func (d *Dispatcher) deliver(ctx context.Context, scheduled cache.WebhookDelivery) {
+	var dl delivery
+	if err := json.Unmarshal(scheduled.Payload, &dl); err != nil {
+		log.Printf("Dropping malformed webhook delivery %s: %v", scheduled.ID, err)
+		d.complete(ctx, scheduled.ID)
+		return
+	}
+
+	dl.Attempt++
+	err := d.send(ctx, scheduled.ID, &dl)
+	switch {
+	case err == nil:
+		d.complete(ctx, scheduled.ID)
+		if d.hooks.Delivered != nil {
+			d.hooks.Delivered()
+		}
+	case dl.Attempt >= d.maxAttempts:
+		log.Printf("Giving up on webhook delivery %s to %s after %d attempts: %v", scheduled.ID, dl.URL, dl.Attempt, err)
+		d.complete(ctx, scheduled.ID)
+		if d.hooks.Failed != nil {
+			d.hooks.Failed()
+		}
+	default:
+		wait := d.backoffFor(dl.Attempt)
+		log.Printf("Webhook delivery %s to %s failed (attempt %d), retrying in %s: %v", scheduled.ID, dl.URL, dl.Attempt, wait.Round(time.Second), err)
+		payload, _ := json.Marshal(dl)
+		if err := d.cache.ScheduleWebhook(ctx, scheduled.ID, payload, time.Now().Add(wait)); err != nil {
+			// The lease runs out and the attempt is made again, uncounted.
+			log.Printf("Failed to reschedule webhook delivery %s: %v", scheduled.ID, err)
+		}
+	}
+}
+
+func (d *Dispatcher) complete(ctx context.Context, id string) {
+	if err := d.cache.CompleteWebhook(ctx, id); err != nil {
+		log.Printf("Failed to complete webhook delivery %s: %v", id, err)
+	}
+}
+
+// backoffFor is the wait after the given attempt, with up to a fifth added
+// at random so endpoints that failed together are not retried together.
+func (d *Dispatcher) backoffFor(attempt int) time.Duration {
+	wait := d.backoff
+	for i := 1; i < attempt && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, maxBackoff)
+	if wait > 0 {
+		wait += time.Duration(rand.Int63n(int64(wait)/5 + 1))
+	}
+	return wait
+}
+
+// send POSTs a delivery's body to its endpoint. Any status outside 2xx
+// fails the attempt.
+func (d *Dispatcher) send(ctx context.Context, id string, dl *delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dl.URL, bytes.NewReader(dl.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, id)
+	req.Header.Set(SignatureHeader, Sign(dl.Secret, time.Now().Unix(), dl.Body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the SignatureHeader value for body sent at timestamp.
+// Receivers recompute the HMAC over "<t>.<body>" with their secret and
+// should reject timestamps too far in the past.
+func Sign(secret string, timestamp int64, body []byte) string {
+	t := strconv.FormatInt(timestamp, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,120 @@
+// Package workers runs writes off the request path on a fixed number of
+// goroutines, so a rush queues work instead of starting a goroutine per
+// request.
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+// Policies for a full queue.
+const (
+	// PolicyDrop refuses the task, so the caller can park it elsewhere and
+	// the request is not slowed down.
+	PolicyDrop = "drop"
+	// PolicyBlock waits for room in the queue, slowing requests down to the
+	// pace the workers keep.
+	PolicyBlock = "block"
+)
+
+// Pool runs submitted tasks on its workers in submission order.
+type Pool struct {
+	tasks chan func()
+	block bool
+	wg    sync.WaitGroup
+
+	// mu keeps Stop from closing tasks while Submit sends on it.
+	mu      sync.RWMutex
+	stopped bool
+}
+
+// New starts size workers behind a queue of queue tasks, applying policy
+// when the queue is full.
+func New(size, queue int, policy string) (*Pool, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("worker pool needs at least one worker, got %d", size)
+	}
+	if policy != PolicyDrop && policy != PolicyBlock {
+		return nil, fmt.Errorf("unknown backpressure policy %q", policy)
+	}
+
+	p := &Pool{
+		tasks: make(chan func(), max(queue, 0)),
+		block: policy == PolicyBlock,
+	}
+	p.wg.Add(size)
+	for range size {
+		go p.work()
+	}
+	return p, nil
+}
+
+// Submit queues task. It reports false when the task was refused: the
+// queue is full under PolicyDrop, or the pool is stopped.
+func (p *Pool) Submit(task func()) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.stopped {
+		return false
+	}
+
+	if p.block {
+		p.tasks <- task
+		return true
+	}
+	select {
+	case p.tasks <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+// Queued is the number of tasks waiting for a worker.
+func (p *Pool) Queued() int {
+	return len(p.tasks)
+}
+
+// Stop refuses new tasks and waits, until ctx is done, for the queued ones
+// to run. It returns how many were still queued when ctx ran out.
+func (p *Pool) Stop(ctx context.Context) int {
+	p.mu.Lock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.tasks)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return 0
+	case <-ctx.Done():
+		return len(p.tasks)
+	}
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for task := range p.tasks {
+		run(task)
+	}
+}
+
+// run runs a task. A panic loses the task instead of the worker.
+func run(task func()) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("Worker task panicked: %v\n%s", p, debug.Stack())
+		}
+	}()
+	task()
+}
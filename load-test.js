@@ -3,6 +3,9 @@ import { check, sleep } from "k6";
 
 const BASE_URL = "http://localhost:8080";
 
+// Users made by cmd/seed, when run with -e FIXTURES=fixtures.json.
+const fixtures = __ENV.FIXTURES ? JSON.parse(open(__ENV.FIXTURES)) : null;
+
 export const options = {
   setupTimeout: "30s",
   scenarios: {
@@ -21,7 +24,7 @@ export function setup() {
     throw new Error("Failed to get sale info");
   }
 
-  const data = response.json();
+  const data = response.json("data");
   
   // Extract all IDs from first_items and last_items arrays
   const allIds = [];
@@ -46,11 +49,28 @@ export function setup() {
     allItemIds.push(i);
   }
 
+  // Only registered users can check out. Fixture users were registered by
+  // cmd/seed; the default ones are registered here, and already are on
+  // later runs.
+  if (!fixtures) {
+    const registrations = [];
+    for (let vu = 1; vu <= options.scenarios.purchase_test.vus; vu++) {
+      registrations.push(["POST", `${BASE_URL}/users?user_id=_${vu}&handle=load_test_${vu}`]);
+    }
+    http.batch(registrations).forEach((r) => {
+      if (r.status !== 200 && r.status !== 409) {
+        throw new Error(`Failed to register load test users: ${r.status}`);
+      }
+    });
+  }
+
   return { allItemIds };
 }
 
 export default function (data) {
-  const userId = `_${__VU}`;
+  const userId = fixtures
+    ? fixtures.users[(__VU - 1) % fixtures.users.length].user_id
+    : `_${__VU}`;
   
   // Randomly pick an item ID from the list
   const randomIndex = Math.floor(Math.random() * data.allItemIds.length);
@@ -67,7 +87,7 @@ export default function (data) {
   });
 
   if (checkoutResponse.status === 200) {
-    const { code } = checkoutResponse.json();
+    const { code } = checkoutResponse.json("data");
     
     const purchaseResponse = http.post(
       `${BASE_URL}/purchase?code=${code}`
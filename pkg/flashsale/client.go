@@ -0,0 +1,421 @@
+// Package flashsale is a Go client for the flash sale HTTP API. It wraps the
+// public routes in typed methods, retries requests the server turned away
+// without acting on them, and honors context cancellation throughout.
+package flashsale
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"flash_sale_contest/internal/api"
+)
+
+// Response types of the API.
+type (
+	CurrentSale      = api.CurrentSaleResponse
+	SaleStatus       = api.SaleStatusResponse
+	SaleInfo         = api.SaleInfoResponse
+	Purchase         = api.PurchaseResponse
+	PendingPurchase  = api.PendingPurchaseResponse
+	PurchaseProgress = api.PurchaseStatusResponse
+	Receipt          = api.Receipt
+	QueueStatus      = api.QueueStatusResponse
+	LotteryStatus    = api.LotteryStatusResponse
+	ExtendedCheckout = api.ExtendCheckoutResponse
+	UserPurchases    = api.UserPurchasesResponse
+	User             = api.RegisterUserResponse
+)
+
+// Client calls one flash sale deployment. Its fields may be changed before
+// the first call.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// MaxRetries is how many times a retryable failure is retried.
+	MaxRetries int
+	// MinBackoff and MaxBackoff bound the jittered exponential delay
+	// between retries. A Retry-After longer than MaxBackoff is not waited
+	// out; the error is returned instead.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// AdminToken, if set, is sent as a bearer token.
+	AdminToken string
+	// Tenant, if set, is sent as X-Tenant-ID to address that tenant's
+	// contest instead of the default one.
+	Tenant string
+}
+
+// New returns a client for the deployment at baseURL, e.g.
+// "http://localhost:8080".
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		MaxRetries: 3,
+		MinBackoff: 50 * time.Millisecond,
+		MaxBackoff: 2 * time.Second,
+	}
+}
+
+// Error is a non-2xx answer from the API.
+type Error struct {
+	StatusCode int
+	Message    string
+	// RequestID identifies the request in the server's logs.
+	RequestID string
+	// RetryAfter is the server's Retry-After hint, 0 if none was sent.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("flashsale: %d %s", e.StatusCode, e.Message)
+}
+
+// PendingError is returned by Purchase in two-phase mode, when the code was
+// redeemed but payment is still being confirmed. Poll PurchaseStatus with
+// PurchaseID.
+type PendingError struct {
+	PurchaseID string
+}
+
+func (e *PendingError) Error() string {
+	return fmt.Sprintf("flashsale: purchase %s is pending payment", e.PurchaseID)
+}
+
+// QueuedError is returned by Checkout when the sale is admitting buyers
+// through its waiting queue. Poll QueueStatus with Token and retry the
+// checkout once admitted.
+type QueuedError struct {
+	Token    string
+	Position int64
+	// Wait is the server's estimate of the time until admission.
+	Wait time.Duration
+}
+
+func (e *QueuedError) Error() string {
+	return fmt.Sprintf("flashsale: queued at position %d", e.Position)
+}
+
+// LotteryEntryError is returned by Checkout when the sale runs a lottery
+// and the user was entered into it. Poll LotteryStatus after DrawAt for the
+// code the user drew, if any.
+type LotteryEntryError struct {
+	DrawAt time.Time
+}
+
+func (e *LotteryEntryError) Error() string {
+	return fmt.Sprintf("flashsale: entered into the lottery drawn at %s", e.DrawAt.Format(time.RFC3339))
+}
+
+// CurrentSale returns the sale being served.
+func (c *Client) CurrentSale(ctx context.Context) (*CurrentSale, error) {
+	var resp CurrentSale
+	if err := c.do(ctx, http.MethodGet, "/sale/current", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SaleStatus returns the remaining inventory of the current sale.
+func (c *Client) SaleStatus(ctx context.Context) (*SaleStatus, error) {
+	var resp SaleStatus
+	if err := c.do(ctx, http.MethodGet, "/sale/status", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SaleInfo returns the current sale's size and showcase items.
+func (c *Client) SaleInfo(ctx context.Context) (*SaleInfo, error) {
+	var resp SaleInfo
+	if err := c.do(ctx, http.MethodGet, "/sale/info", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RegisterUser registers a user under handle. An empty userID has the
+// server generate one. Only registered users can check out.
+func (c *Client) RegisterUser(ctx context.Context, userID, handle string) (*User, error) {
+	query := url.Values{"handle": {handle}}
+	if userID != "" {
+		query.Set("user_id", userID)
+	}
+	var resp User
+	if err := c.do(ctx, http.MethodPost, "/users", query, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Checkout reserves itemID for userID and returns the checkout code. An
+// empty category reserves from the whole sale; an empty itemID reserves any
+// available item, see CheckoutAny. While the sale admits buyers through its
+// queue, the error may be a *QueuedError, and while its lottery is open a
+// *LotteryEntryError.
+func (c *Client) Checkout(ctx context.Context, userID, itemID, category string) (string, error) {
+	resp, err := c.checkout(ctx, userID, itemID, category)
+	if err != nil {
+		return "", err
+	}
+	return resp.Code, nil
+}
+
+// CheckoutAny reserves whichever item is available for userID and returns
+// the checkout code and the item reserved.
+func (c *Client) CheckoutAny(ctx context.Context, userID string) (code, itemID string, err error) {
+	resp, err := c.checkout(ctx, userID, "", "")
+	if err != nil {
+		return "", "", err
+	}
+	return resp.Code, resp.ItemID, nil
+}
+
+func (c *Client) checkout(ctx context.Context, userID, itemID, category string) (*api.CheckoutResponse, error) {
+	query := url.Values{"user_id": {userID}}
+	if itemID != "" {
+		query.Set("id", itemID)
+	}
+	if category != "" {
+		query.Set("category", category)
+	}
+	var raw json.RawMessage
+	if err := c.do(ctx, http.MethodPost, "/checkout", query, &raw); err != nil {
+		return nil, err
+	}
+
+	var queued QueueStatus
+	if err := json.Unmarshal(raw, &queued); err == nil && queued.Token != "" {
+		return nil, &QueuedError{
+			Token:    queued.Token,
+			Position: queued.Position,
+			Wait:     time.Duration(queued.EstimatedWaitSeconds) * time.Second,
+		}
+	}
+	var entry LotteryStatus
+	if err := json.Unmarshal(raw, &entry); err == nil && entry.Status == api.LotteryEntered {
+		return nil, &LotteryEntryError{DrawAt: entry.DrawAt}
+	}
+	var resp api.CheckoutResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, fmt.Errorf("flashsale: decoding checkout: %w", err)
+	}
+	return &resp, nil
+}
+
+// QueueStatus reports the position of a queued checkout.
+func (c *Client) QueueStatus(ctx context.Context, token string) (*QueueStatus, error) {
+	var resp QueueStatus
+	if err := c.do(ctx, http.MethodGet, "/queue/status", url.Values{"token": {token}}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// LotteryStatus reports whether userID won the current sale's lottery, and
+// the checkout code they drew.
+func (c *Client) LotteryStatus(ctx context.Context, userID string) (*LotteryStatus, error) {
+	var resp LotteryStatus
+	if err := c.do(ctx, http.MethodGet, "/lottery/status", url.Values{"user_id": {userID}}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ExtendCheckout extends a checkout code by another code TTL. A code can be
+// extended once, in its last minute.
+func (c *Client) ExtendCheckout(ctx context.Context, code string) (*ExtendedCheckout, error) {
+	var resp ExtendedCheckout
+	if err := c.do(ctx, http.MethodPost, "/checkout/"+url.PathEscape(code)+"/extend", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Purchase redeems a checkout code. It is safe to retry: a code already
+// redeemed returns the purchase it was redeemed for.
+func (c *Client) Purchase(ctx context.Context, code string) (*Purchase, error) {
+	return c.purchase(ctx, url.Values{"code": {code}})
+}
+
+// Gift redeems a checkout code for recipientID, a registered user whose
+// purchase limit the item counts against.
+func (c *Client) Gift(ctx context.Context, code, recipientID string) (*Purchase, error) {
+	return c.purchase(ctx, url.Values{"code": {code}, "recipient_user_id": {recipientID}})
+}
+
+func (c *Client) purchase(ctx context.Context, query url.Values) (*Purchase, error) {
+	var raw json.RawMessage
+	if err := c.do(ctx, http.MethodPost, "/purchase", query, &raw); err != nil {
+		return nil, err
+	}
+
+	var pending PendingPurchase
+	// Completed purchases carry a purchase_id too, but never a status.
+	if err := json.Unmarshal(raw, &pending); err == nil && pending.Status != "" {
+		return nil, &PendingError{PurchaseID: pending.PurchaseID}
+	}
+	var resp Purchase
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, fmt.Errorf("flashsale: decoding purchase: %w", err)
+	}
+	return &resp, nil
+}
+
+// UserPurchases returns a page, counted from 1, of the items userID bought
+// or was given, newest first.
+func (c *Client) UserPurchases(ctx context.Context, userID string, page int) (*UserPurchases, error) {
+	var resp UserPurchases
+	query := url.Values{"page": {strconv.Itoa(page)}}
+	if err := c.do(ctx, http.MethodGet, "/user/"+url.PathEscape(userID)+"/purchases", query, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// PurchaseStatus reports a two-phase purchase.
+func (c *Client) PurchaseStatus(ctx context.Context, purchaseID string) (*PurchaseProgress, error) {
+	var resp PurchaseProgress
+	if err := c.do(ctx, http.MethodGet, "/purchase/"+url.PathEscape(purchaseID)+"/status", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// VerifyReceipt reports whether the deployment signed receipt.
+func (c *Client) VerifyReceipt(ctx context.Context, receipt *Receipt) (bool, error) {
+	query := url.Values{
+		"sale_id":      {receipt.SaleID},
+		"user_id":      {receipt.UserID},
+		"item_id":      {receipt.ItemID},
+		"purchased_at": {receipt.PurchasedAt.Format(time.RFC3339Nano)},
+		"signature":    {receipt.Signature},
+	}
+	var resp api.VerifyReceiptResponse
+	if err := c.do(ctx, http.MethodGet, "/receipt/"+url.PathEscape(receipt.PurchaseID)+"/verify", query, &resp); err != nil {
+		return false, err
+	}
+	return resp.Valid, nil
+}
+
+// do sends one API call and decodes a JSON answer into out. Checkout and
+// purchase are not idempotent, so POSTs are only retried when the server
+// refused them without acting (429 and 503); GETs are also retried on
+// transport errors and gateway failures.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, out interface{}) error {
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, target, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		if c.AdminToken != "" {
+			req.Header.Set("Authorization", "Bearer "+c.AdminToken)
+		}
+		if c.Tenant != "" {
+			req.Header.Set("X-Tenant-ID", c.Tenant)
+		}
+
+		var apiErr *Error
+		resp, err := c.HTTPClient.Do(req)
+		if err == nil {
+			apiErr, err = decode(resp, out)
+			if err == nil && apiErr == nil {
+				return nil
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		retryable := apiErr != nil && retryableStatus(method, apiErr.StatusCode) ||
+			apiErr == nil && method == http.MethodGet
+		if !retryable || attempt >= c.MaxRetries {
+			if apiErr != nil {
+				return apiErr
+			}
+			return err
+		}
+
+		delay := c.backoff(attempt)
+		if apiErr != nil && apiErr.RetryAfter > 0 {
+			if apiErr.RetryAfter > c.MaxBackoff {
+				return apiErr
+			}
+			delay = apiErr.RetryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func retryableStatus(method string, status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return method == http.MethodGet
+	}
+	return false
+}
+
+// backoff is "full jitter": a random delay up to MinBackoff doubled per
+// attempt, capped at MaxBackoff.
+func (c *Client) backoff(attempt int) time.Duration {
+	ceiling := c.MinBackoff << attempt
+	if ceiling <= 0 || ceiling > c.MaxBackoff {
+		ceiling = c.MaxBackoff
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(ceiling))) + 1
+}
+
+// decode reads resp, returning an *Error for non-2xx answers. The API sends
+// errors as an api.ErrorResponse; other bodies, such as a proxy's, are
+// taken as the message. Other answers are unwrapped from their
+// api.Envelope into out.
+func decode(resp *http.Response, out interface{}) (*Error, error) {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+		var errResp api.ErrorResponse
+		if json.Unmarshal(body, &errResp) == nil && errResp.Error != "" {
+			apiErr.Message, apiErr.RequestID = errResp.Error, errResp.RequestID
+		}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return apiErr, nil
+	}
+	if out == nil {
+		return nil, nil
+	}
+	// Data holding out decodes the envelope's data into it.
+	if err := json.Unmarshal(body, &api.Envelope{Data: out}); err != nil {
+		return nil, fmt.Errorf("flashsale: decoding %s: %w", resp.Request.URL.Path, err)
+	}
+	return nil, nil
+}
@@ -0,0 +1,58 @@
+package flashsale
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Fixtures describe the simulated users of a load test, as written by
+// cmd/seed.
+type Fixtures struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	// BaseURL and Tenant are the deployment the fixtures were made for;
+	// events tokens only open /ws/user of that tenant.
+	BaseURL string        `json:"base_url,omitempty"`
+	Tenant  string        `json:"tenant,omitempty"`
+	Users   []FixtureUser `json:"users"`
+	// Sale is the sale running when the fixtures were made, if the
+	// deployment was reachable.
+	Sale *SaleInfo `json:"sale,omitempty"`
+	// Warmup summarizes the warm-up run, if one was made.
+	Warmup *Warmup `json:"warmup,omitempty"`
+}
+
+// FixtureUser is one simulated user.
+type FixtureUser struct {
+	UserID string `json:"user_id"`
+	// EventsToken opens the user's /ws/user stream without a checkout
+	// until the expiry it carries. It is empty when the deployment has no
+	// USER_EVENTS_SECRET.
+	EventsToken string `json:"events_token,omitempty"`
+}
+
+// Warmup counts what happened to the checkouts of a warm-up run.
+type Warmup struct {
+	SaleID    string `json:"sale_id"`
+	Checkouts int    `json:"checkouts"`
+	Purchases int    `json:"purchases"`
+	// Pending purchases await payment confirmation in two-phase mode.
+	Pending int     `json:"pending"`
+	Refused int     `json:"refused"`
+	Failed  int     `json:"failed"`
+	Seconds float64 `json:"seconds"`
+}
+
+// LoadFixtures reads fixtures written by cmd/seed.
+func LoadFixtures(path string) (*Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f Fixtures
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("flashsale: malformed fixtures %s: %w", path, err)
+	}
+	return &f, nil
+}
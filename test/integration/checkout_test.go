@@ -0,0 +1,209 @@
+//go:build integration
+
+package integration
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"flash_sale_contest/pkg/flashsale"
+)
+
+// nextItem hands out item IDs so no two purchases in the run collide on
+// (sale_id, item_id).
+var nextItem atomic.Int64
+
+func itemID() string {
+	return strconv.FormatInt(nextItem.Add(1), 10)
+}
+
+func TestCheckoutPurchaseFlow(t *testing.T) {
+	ctx := testContext(t)
+	c := env.client
+
+	sale, err := c.CurrentSale(ctx)
+	if err != nil {
+		t.Fatalf("current sale: %v", err)
+	}
+	if sale.Phase != "active" {
+		t.Fatalf("sale %s is %q, want active", sale.SaleID, sale.Phase)
+	}
+
+	registerUsers(t, ctx, "flow-user")
+	code, err := c.Checkout(ctx, "flow-user", itemID(), "")
+	if err != nil {
+		t.Fatalf("checkout: %v", err)
+	}
+	purchase, err := c.Purchase(ctx, code)
+	if err != nil {
+		t.Fatalf("purchase: %v", err)
+	}
+	if !purchase.Success || purchase.UserID != "flow-user" || purchase.SaleID != sale.SaleID {
+		t.Fatalf("purchase = %+v, want a success for flow-user in %s", purchase, sale.SaleID)
+	}
+
+	// A retry, as after a lost reply, gets the same purchase back
+	again, err := c.Purchase(ctx, code)
+	if err != nil {
+		t.Fatalf("redeeming a code twice: %v", err)
+	}
+	if again.PurchaseID != purchase.PurchaseID || again.ItemID != purchase.ItemID || again.Unit != purchase.Unit {
+		t.Fatalf("retried purchase = %+v, want %+v", again, purchase)
+	}
+
+	_, err = c.Purchase(ctx, "no-such-code")
+	var apiErr *flashsale.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("redeeming an unknown code: err = %v, want 400", err)
+	}
+}
+
+func TestUnregisteredUser(t *testing.T) {
+	ctx := testContext(t)
+
+	_, err := env.client.Checkout(ctx, "unregistered-user", itemID(), "")
+	var apiErr *flashsale.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("checkout by an unregistered user: err = %v, want 403", err)
+	}
+}
+
+func TestUserLimit(t *testing.T) {
+	ctx := testContext(t)
+	c := env.client
+
+	const maxPerUser = 10
+	registerUsers(t, ctx, "limit-user")
+	for i := 0; i < maxPerUser; i++ {
+		code, err := c.Checkout(ctx, "limit-user", itemID(), "")
+		if err != nil {
+			t.Fatalf("checkout %d: %v", i+1, err)
+		}
+		if _, err := c.Purchase(ctx, code); err != nil {
+			t.Fatalf("purchase %d: %v", i+1, err)
+		}
+	}
+
+	_, err := c.Checkout(ctx, "limit-user", itemID(), "")
+	var apiErr *flashsale.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("checkout past the limit: err = %v, want 403", err)
+	}
+}
+
+// TestNoOversell has 1000 buyers race for what is left of the sale and
+// checks that exactly the remaining inventory is sold, in Redis and in
+// Postgres.
+func TestNoOversell(t *testing.T) {
+	ctx := testContext(t)
+	c := env.client
+
+	const buyers = 1000
+	status, err := c.SaleStatus(ctx)
+	if err != nil {
+		t.Fatalf("sale status: %v", err)
+	}
+	remaining := status.RemainingItems
+	if remaining <= 0 || remaining >= buyers {
+		t.Fatalf("remaining inventory %d, want between 1 and %d", remaining, buyers-1)
+	}
+
+	users := make([]string, buyers)
+	for i := range users {
+		users[i] = fmt.Sprintf("buyer-%d", i)
+	}
+	registerUsers(t, ctx, users...)
+
+	var sold, soldOut atomic.Int64
+	errs := make(chan error, buyers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, user := range users {
+		wg.Add(1)
+		go func(user string) {
+			defer wg.Done()
+			<-start
+			code, err := c.Checkout(ctx, user, itemID(), "")
+			var apiErr *flashsale.Error
+			if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+				soldOut.Add(1)
+				return
+			}
+			if err != nil {
+				errs <- fmt.Errorf("checkout for %s: %w", user, err)
+				return
+			}
+			if _, err := c.Purchase(ctx, code); err != nil {
+				errs <- fmt.Errorf("purchase for %s: %w", user, err)
+				return
+			}
+			sold.Add(1)
+		}(user)
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if got := sold.Load(); got != int64(remaining) {
+		t.Fatalf("sold %d items, want exactly the %d remaining", got, remaining)
+	}
+	if got := soldOut.Load(); got != int64(buyers-remaining) {
+		t.Errorf("%d buyers were told sold out, want %d", got, buyers-remaining)
+	}
+
+	status, err = c.SaleStatus(ctx)
+	if err != nil {
+		t.Fatalf("sale status: %v", err)
+	}
+	if status.RemainingItems != 0 {
+		t.Errorf("remaining inventory %d after selling out, want 0", status.RemainingItems)
+	}
+
+	// Purchases are written to Postgres off the request path.
+	if err := waitFor(30*time.Second, func() error {
+		rows, err := exportedPurchases(status.SaleID)
+		if err != nil {
+			return err
+		}
+		if rows != catalogSize {
+			return fmt.Errorf("postgres has %d purchases, want %d", rows, catalogSize)
+		}
+		return nil
+	}); err != nil {
+		t.Error(err)
+	}
+}
+
+// exportedPurchases counts a sale's purchases through the admin export.
+func exportedPurchases(saleID string) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, env.baseURL+"/admin/sales/"+saleID+"/export?format=ndjson", nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("export answered %d", resp.StatusCode)
+	}
+
+	rows := 0
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		rows++
+	}
+	return rows, scanner.Err()
+}
@@ -0,0 +1,265 @@
+//go:build integration
+
+// Package integration boots the service against throwaway Postgres and
+// Redis containers and drives it over HTTP. It needs a Docker daemon and
+// runs with:
+//
+//	go test -tags integration -count=1 ./test/integration/...
+package integration
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"flash_sale_contest/pkg/flashsale"
+)
+
+const (
+	postgresImage = "postgres:16-alpine"
+	redisImage    = "redis:7-alpine"
+
+	dbName     = "flash_sale_test"
+	dbUser     = "flash_sale"
+	dbPassword = "flash_sale"
+
+	adminToken = "integration-admin-token"
+	// catalogSize is kept small so the concurrency tests can sell a sale
+	// out many times over.
+	catalogSize = 300
+)
+
+// env is shared by every test in the package.
+var env struct {
+	baseURL string
+	client  *flashsale.Client
+}
+
+func TestMain(m *testing.M) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		fmt.Println("skipping integration tests: docker not found")
+		os.Exit(0)
+	}
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	workDir, err := os.MkdirTemp("", "flash-sale-it-")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer os.RemoveAll(workDir)
+
+	pg, err := startContainer(postgresImage, "5432/tcp",
+		"-e", "POSTGRES_DB="+dbName, "-e", "POSTGRES_USER="+dbUser, "-e", "POSTGRES_PASSWORD="+dbPassword)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer pg.remove()
+
+	rd, err := startContainer(redisImage, "6379/tcp")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer rd.remove()
+
+	if err := waitFor(60*time.Second, func() error {
+		return exec.Command("docker", "exec", pg.id, "pg_isready", "-U", dbUser, "-d", dbName).Run()
+	}); err != nil {
+		fmt.Println("postgres never became ready:", err)
+		return 1
+	}
+	if err := waitFor(30*time.Second, func() error {
+		return exec.Command("docker", "exec", rd.id, "redis-cli", "ping").Run()
+	}); err != nil {
+		fmt.Println("redis never became ready:", err)
+		return 1
+	}
+
+	stop, err := startServer(workDir, pg.addr, rd.addr)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer stop()
+
+	return m.Run()
+}
+
+type container struct {
+	id   string
+	addr string
+}
+
+// startContainer runs image detached with port published on a random
+// loopback port and returns where it can be reached.
+func startContainer(image, port string, args ...string) (*container, error) {
+	runArgs := append([]string{"run", "-d", "--rm", "-p", "127.0.0.1::" + strings.TrimSuffix(port, "/tcp")}, args...)
+	out, err := exec.Command("docker", append(runArgs, image)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker run %s: %w", image, err)
+	}
+	c := &container{id: strings.TrimSpace(string(out))}
+
+	out, err = exec.Command("docker", "port", c.id, port).Output()
+	if err != nil {
+		c.remove()
+		return nil, fmt.Errorf("docker port %s: %w", image, err)
+	}
+	c.addr = strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	return c, nil
+}
+
+func (c *container) remove() {
+	exec.Command("docker", "rm", "-f", c.id).Run()
+}
+
+// startServer builds cmd/api and runs it against the containers. It
+// returns once the server reports ready, i.e. migrations ran and the first
+// sale is live.
+func startServer(workDir, pgAddr, redisAddr string) (func(), error) {
+	bin := filepath.Join(workDir, "api")
+	build := exec.Command("go", "build", "-o", bin, "../../cmd/api")
+	build.Stdout, build.Stderr = os.Stdout, os.Stderr
+	if err := build.Run(); err != nil {
+		return nil, fmt.Errorf("building server: %w", err)
+	}
+
+	catalogPath := filepath.Join(workDir, "catalog.csv")
+	if err := writeCatalog(catalogPath, catalogSize); err != nil {
+		return nil, err
+	}
+
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	pgHost, pgPort, _ := net.SplitHostPort(pgAddr)
+
+	cmd := exec.Command(bin)
+	// Run outside the repository so its .env is not loaded.
+	cmd.Dir = workDir
+	cmd.Env = append(os.Environ(),
+		"PORT="+port,
+		"REDIS_ADDR="+redisAddr,
+		"BLUEPRINT_DB_HOST="+pgHost,
+		"BLUEPRINT_DB_PORT="+pgPort,
+		"BLUEPRINT_DB_DATABASE="+dbName,
+		"BLUEPRINT_DB_USERNAME="+dbUser,
+		"BLUEPRINT_DB_PASSWORD="+dbPassword,
+		"BLUEPRINT_DB_SCHEMA=public",
+		"CATALOG_PATH="+catalogPath,
+		"ADMIN_TOKEN="+adminToken,
+		"RATE_LIMIT_PER_USER=0",
+		"ACCESS_LOG_SAMPLE=*=0",
+		"TRACE_SAMPLE_RATE=0",
+	)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting server: %w", err)
+	}
+	stop := func() {
+		cmd.Process.Signal(os.Interrupt)
+		done := make(chan struct{})
+		go func() { cmd.Wait(); close(done) }()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			cmd.Process.Kill()
+		}
+	}
+
+	env.baseURL = "http://127.0.0.1:" + port
+	env.client = flashsale.New(env.baseURL)
+	env.client.AdminToken = adminToken
+
+	if err := waitFor(60*time.Second, func() error {
+		resp, err := http.Get(env.baseURL + "/readyz")
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("readyz answered %d", resp.StatusCode)
+		}
+		return nil
+	}); err != nil {
+		stop()
+		return nil, fmt.Errorf("server never became ready: %w", err)
+	}
+	return stop, nil
+}
+
+func writeCatalog(path string, n int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "sku,name,category")
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(w, "SKU-%d,Test Item %d,gems\n", i, i)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func freePort() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return port, nil
+}
+
+func waitFor(timeout time.Duration, check func() error) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := check()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// registerUsers registers users with their IDs as handles. Users a test
+// registered on an earlier call are fine.
+func registerUsers(t *testing.T, ctx context.Context, userIDs ...string) {
+	t.Helper()
+	for _, id := range userIDs {
+		_, err := env.client.RegisterUser(ctx, id, id)
+		var apiErr *flashsale.Error
+		if err != nil && !(errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict) {
+			t.Fatalf("registering %s: %v", id, err)
+		}
+	}
+}
+
+// testContext bounds one test.
+func testContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	t.Cleanup(cancel)
+	return ctx
+}